@@ -59,19 +59,22 @@ func Gencert(ca *x509.Certificate, caKey *rsa.PrivateKey) {
 	if err != nil {
 		panic(err)
 	}
+	signing, err := profile.Lookup("peer")
+	if err != nil {
+		panic(err)
+	}
 	serverTemplate := x509.Certificate{
 		SerialNumber:          serialNumber,
 		Subject:               csr.Subject,
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth | x509.ExtKeyUsageClientAuth},
+		NotAfter:              time.Now().Add(signing.MaxExpiry),
 		BasicConstraintsValid: false,
 		DNSNames:              csr.DNSNames,
 		IPAddresses:           csr.IPAddresses,
 		EmailAddresses:        csr.EmailAddresses,
 		AuthorityKeyId:        ca.SubjectKeyId, // 设置 AuthorityKeyId 为 CA 的 SubjectKeyId
 	}
+	signing.Apply(&serverTemplate, csr.PublicKey)
 
 	// 确定公钥类型
 	var userPub any // 通用接口，用于存储解析后的公钥
@@ -0,0 +1,234 @@
+package profile
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"spki/src/config"
+	"sync"
+	"time"
+)
+
+// defaultMaxExpiry 未配置最长有效期时的默认值
+const defaultMaxExpiry = 365 * 24 * time.Hour
+
+// keyUsages 密钥用途名称，与 cfssl 保持一致
+var keyUsages = map[string]x509.KeyUsage{
+	"signing":            x509.KeyUsageDigitalSignature,
+	"digital signature":  x509.KeyUsageDigitalSignature,
+	"content commitment": x509.KeyUsageContentCommitment,
+	"key encipherment":   x509.KeyUsageKeyEncipherment,
+	"data encipherment":  x509.KeyUsageDataEncipherment,
+	"key agreement":      x509.KeyUsageKeyAgreement,
+	"cert sign":          x509.KeyUsageCertSign,
+	"crl sign":           x509.KeyUsageCRLSign,
+	"encipher only":      x509.KeyUsageEncipherOnly,
+	"decipher only":      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsages 扩展密钥用途名称，与 cfssl 保持一致
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":              x509.ExtKeyUsageAny,
+	"server auth":      x509.ExtKeyUsageServerAuth,
+	"client auth":      x509.ExtKeyUsageClientAuth,
+	"code signing":     x509.ExtKeyUsageCodeSigning,
+	"email protection": x509.ExtKeyUsageEmailProtection,
+	"s/mime":           x509.ExtKeyUsageEmailProtection,
+	"ipsec end system": x509.ExtKeyUsageIPSECEndSystem,
+	"ipsec tunnel":     x509.ExtKeyUsageIPSECTunnel,
+	"ipsec user":       x509.ExtKeyUsageIPSECUser,
+	"timestamping":     x509.ExtKeyUsageTimeStamping,
+	"ocsp signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// builtin 内置签名配置，可在 spki.yaml 的 spki.profiles 中覆盖或新增
+var builtin = map[string]config.SigningProfile{
+	"server": {
+		KeyUsages:    []string{"digital signature", "key encipherment"},
+		ExtKeyUsages: []string{"server auth"},
+		HonorCSRSans: true,
+	},
+	"client": {
+		KeyUsages:    []string{"digital signature", "key encipherment"},
+		ExtKeyUsages: []string{"client auth"},
+		HonorCSRSans: true,
+	},
+	"peer": {
+		KeyUsages:    []string{"digital signature", "key encipherment"},
+		ExtKeyUsages: []string{"server auth", "client auth"},
+		HonorCSRSans: true,
+	},
+	"code-signing": {
+		KeyUsages:    []string{"digital signature"},
+		ExtKeyUsages: []string{"code signing"},
+	},
+	"email": {
+		KeyUsages:    []string{"digital signature", "key encipherment"},
+		ExtKeyUsages: []string{"email protection"},
+		HonorCSRSans: true,
+	},
+	"ocsp-signing": {
+		KeyUsages:    []string{"digital signature"},
+		ExtKeyUsages: []string{"ocsp signing"},
+		MaxExpiry:    90 * 24 * time.Hour,
+	},
+}
+
+// Signing 解析后的签名配置
+type Signing struct {
+	Name         string
+	KeyUsage     x509.KeyUsage
+	ExtKeyUsage  []x509.ExtKeyUsage
+	MaxExpiry    time.Duration
+	KeyAlgos     []string
+	HonorCSRSans bool
+	Usages       []string // 密钥用途和扩展密钥用途的名称
+	AuthKey      string   // cfssl authsign 使用的密钥名称
+}
+
+// signings 已解析的签名配置
+var signings = struct {
+	sync.RWMutex
+	m map[string]*Signing
+}{}
+
+func init() {
+	if err := Init(nil); err != nil {
+		panic(err)
+	}
+}
+
+// parse 解析签名配置
+func parse(name string, p config.SigningProfile) (*Signing, error) {
+	s := &Signing{
+		Name:         name,
+		MaxExpiry:    p.MaxExpiry,
+		KeyAlgos:     p.KeyAlgos,
+		HonorCSRSans: p.HonorCSRSans,
+		AuthKey:      p.AuthKey,
+	}
+	if s.MaxExpiry <= 0 {
+		s.MaxExpiry = defaultMaxExpiry
+	}
+	for _, u := range p.KeyUsages {
+		ku, ok := keyUsages[u]
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown key usage %q", name, u)
+		}
+		s.KeyUsage |= ku
+		s.Usages = append(s.Usages, u)
+	}
+	for _, u := range p.ExtKeyUsages {
+		eku, ok := extKeyUsages[u]
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown extended key usage %q", name, u)
+		}
+		s.ExtKeyUsage = append(s.ExtKeyUsage, eku)
+		s.Usages = append(s.Usages, u)
+	}
+	for _, algo := range p.KeyAlgos {
+		if algo != "rsa" && algo != "ecdsa" && algo != "ed25519" {
+			return nil, fmt.Errorf("profile %s: unknown key algorithm %q", name, algo)
+		}
+	}
+	return s, nil
+}
+
+// Init 合并内置签名配置与 spki.yaml 中的签名配置
+func Init(profiles map[string]config.SigningProfile) error {
+	m := make(map[string]*Signing, len(builtin)+len(profiles))
+	for name, p := range builtin {
+		s, err := parse(name, p)
+		if err != nil {
+			return err
+		}
+		m[name] = s
+	}
+	for name, p := range profiles {
+		s, err := parse(name, p)
+		if err != nil {
+			return err
+		}
+		m[name] = s
+	}
+
+	signings.Lock()
+	signings.m = m
+	signings.Unlock()
+	return nil
+}
+
+// Lookup 根据名称获取签名配置
+func Lookup(name string) (*Signing, error) {
+	signings.RLock()
+	defer signings.RUnlock()
+	s, ok := signings.m[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s", name)
+	}
+	return s, nil
+}
+
+// KeyAlgo 返回公钥的算法名称：rsa、ecdsa、ed25519
+func KeyAlgo(pub any) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *ecdsa.PublicKey:
+		return "ecdsa"
+	case ed25519.PublicKey:
+		return "ed25519"
+	default:
+		return ""
+	}
+}
+
+// AllowKeyAlgo 检查签名配置是否允许该私钥算法
+func (s *Signing) AllowKeyAlgo(algo string) error {
+	if len(s.KeyAlgos) == 0 {
+		return nil
+	}
+	for _, allowed := range s.KeyAlgos {
+		if allowed == algo {
+			return nil
+		}
+	}
+	return fmt.Errorf("key algorithm %q is not allowed by profile %s", algo, s.Name)
+}
+
+// Validity 计算有效期，expiry 单位是天，为 0 时使用最长有效期
+func (s *Signing) Validity(expiry int) (time.Duration, error) {
+	if expiry < 0 {
+		return 0, fmt.Errorf("expiry must not be negative")
+	}
+	if expiry == 0 {
+		return s.MaxExpiry, nil
+	}
+	validity := time.Duration(expiry) * 24 * time.Hour
+	if validity > s.MaxExpiry {
+		return 0, fmt.Errorf("expiry exceeds the maximum of profile %s (%v)", s.Name, s.MaxExpiry)
+	}
+	return validity, nil
+}
+
+// ValidityTTL 校验以时长指定的有效期，不能超过最长有效期
+func (s *Signing) ValidityTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl must be positive")
+	}
+	if ttl > s.MaxExpiry {
+		return 0, fmt.Errorf("ttl exceeds the maximum of profile %s (%v)", s.Name, s.MaxExpiry)
+	}
+	return ttl, nil
+}
+
+// Apply 将密钥用途写入证书模板，只有 RSA 公钥才能用于密钥加密
+func (s *Signing) Apply(template *x509.Certificate, pub any) {
+	template.KeyUsage = s.KeyUsage
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+	template.ExtKeyUsage = s.ExtKeyUsage
+}
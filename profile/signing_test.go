@@ -0,0 +1,108 @@
+package profile
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"reflect"
+	"spki/src/config"
+	"testing"
+	"time"
+)
+
+// reset 测试结束后恢复内置签名配置
+func reset(t *testing.T) {
+	t.Cleanup(func() {
+		if err := Init(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestInit(t *testing.T) {
+	reset(t)
+	err := Init(map[string]config.SigningProfile{
+		"server": {KeyUsages: []string{"digital signature"}, ExtKeyUsages: []string{"server auth"}, MaxExpiry: 90 * 24 * time.Hour},
+		"iot":    {KeyUsages: []string{"digital signature"}, ExtKeyUsages: []string{"client auth"}, KeyAlgos: []string{"ecdsa"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// spki.yaml 中的签名配置覆盖同名的内置签名配置，未配置最长有效期时使用默认值
+	server, err := Lookup("server")
+	if err != nil || server.MaxExpiry != 90*24*time.Hour || server.HonorCSRSans {
+		t.Fatalf("server = %+v, %v", server, err)
+	}
+	iot, err := Lookup("iot")
+	if err != nil || iot.MaxExpiry != defaultMaxExpiry || iot.KeyUsage != x509.KeyUsageDigitalSignature ||
+		!reflect.DeepEqual(iot.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}) ||
+		!reflect.DeepEqual(iot.Usages, []string{"digital signature", "client auth"}) {
+		t.Fatalf("iot = %+v, %v", iot, err)
+	}
+	if _, err := Lookup("code-signing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lookup("unknown"); err == nil {
+		t.Fatal("unknown profile was found")
+	}
+
+	for name, p := range map[string]config.SigningProfile{
+		"key usage":          {KeyUsages: []string{"signing everything"}},
+		"extended key usage": {ExtKeyUsages: []string{"web auth"}},
+		"key algorithm":      {KeyAlgos: []string{"dsa"}},
+	} {
+		if err := Init(map[string]config.SigningProfile{"invalid": p}); err == nil {
+			t.Errorf("unknown %s was accepted", name)
+		}
+	}
+	// 解析失败时保留之前的签名配置
+	if _, err := Lookup("iot"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidity(t *testing.T) {
+	s := &Signing{Name: "test", MaxExpiry: 30 * 24 * time.Hour}
+	for _, tt := range []struct {
+		expiry int
+		want   time.Duration
+		ok     bool
+	}{
+		{0, 30 * 24 * time.Hour, true},
+		{7, 7 * 24 * time.Hour, true},
+		{30, 30 * 24 * time.Hour, true},
+		{31, 0, false},
+		{-1, 0, false},
+	} {
+		got, err := s.Validity(tt.expiry)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Validity(%d) = %v, %v", tt.expiry, got, err)
+		}
+	}
+}
+
+func TestKeyAlgo(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s := &Signing{Name: "test", KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment, KeyAlgos: []string{"ecdsa"}}
+	if KeyAlgo(rsaKey.Public()) != "rsa" || KeyAlgo(ecKey.Public()) != "ecdsa" || KeyAlgo("key") != "" {
+		t.Fatal("unexpected key algorithm")
+	}
+	if s.AllowKeyAlgo("ecdsa") != nil || s.AllowKeyAlgo("rsa") == nil || (&Signing{}).AllowKeyAlgo("rsa") != nil {
+		t.Fatal("unexpected key algorithm check")
+	}
+
+	// 只有 RSA 公钥才能用于密钥加密
+	var template x509.Certificate
+	s.Apply(&template, ecKey.Public())
+	if template.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Fatalf("ECDSA key usage = %v", template.KeyUsage)
+	}
+	s.Apply(&template, rsaKey.Public())
+	if template.KeyUsage != s.KeyUsage {
+		t.Fatalf("RSA key usage = %v", template.KeyUsage)
+	}
+}
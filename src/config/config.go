@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
@@ -12,7 +13,10 @@ import (
 type FlagArgs struct {
 	CfgPath      string
 	PrintVersion bool
-	Plain        string // 接收命令行字符串，用于加密
+	Plain        string   // 接收命令行字符串，用于加密
+	Rewrap       bool     // 使用当前主密钥重新加密所有私钥
+	AutoMigrate  bool     // 启动时执行未执行的数据库迁移
+	Command      []string // 位置参数，如 migrate up
 }
 
 // NewFlagArgs creates a new FlagArgs object and parses command line flags.
@@ -21,7 +25,14 @@ func NewFlagArgs() *FlagArgs {
 	flag.StringVar(&fa.CfgPath, "c", "spki.yaml", "Configuration file path.")
 	flag.BoolVar(&fa.PrintVersion, "version", false, "Print version information and quit.")
 	flag.StringVar(&fa.Plain, "encrypt", "", "Encrypted string.")
+	flag.BoolVar(&fa.Rewrap, "rewrap", false, "Re-encrypt all private keys with the current master key and quit.")
+	flag.BoolVar(&fa.AutoMigrate, "auto-migrate", false, "Apply pending database migrations on start.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up|down [n]|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	fa.Command = flag.Args()
 	return fa
 }
 
@@ -29,6 +40,9 @@ func NewFlagArgs() *FlagArgs {
 var configPath *string
 var AppCfg *Config
 
+// flagArgs stores the parsed command-line arguments.
+var flagArgs *FlagArgs
+
 // Initializer function is used to initialize the application's configuration.
 func Initializer() {
 	fa := NewFlagArgs()
@@ -40,6 +54,12 @@ func Initializer() {
 		encryption(fa.Plain)
 	}
 	configPath = &fa.CfgPath
+	flagArgs = fa
+}
+
+// Args returns the parsed command-line arguments.
+func Args() *FlagArgs {
+	return flagArgs
 }
 
 // InitConfig 初始化配置
@@ -55,6 +75,11 @@ func InitConfig() *Config {
 	var cfg Config
 	cfg.unmarshal(configData)        // 解析配置文件
 	cfg.decryptionDatabaseMysqlPwd() // 解密数据库密码
+	cfg.decryptionWebhookSecrets()   // 解密 Webhook 签名密钥
+	cfg.decryptionEstPasswords()     // 解密 EST 用户密码
+	cfg.decryptionScepChallenge()    // 解密 SCEP 挑战密码
+	cfg.decryptionCfsslAuthKeys()    // 解密 cfssl authsign 密钥
+	cfg.decryptionVaultTokens()      // 解密 Vault 访问令牌
 	AppCfg = &cfg
 	return &cfg
 }
@@ -93,8 +118,8 @@ type pkiConfig struct {
 	Remote           string
 	Label            string
 	AuthKey          string
-	ResponderFile    string
-	ResponderKeyFile string
+	ResponderFile    string `yaml:"responder_file"`     // OCSP 签名证书
+	ResponderKeyFile string `yaml:"responder_key_file"` // OCSP 签名证书私钥
 	Status           string
 	Reason           string
 	RevokedAt        string
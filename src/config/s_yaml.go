@@ -4,6 +4,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"os"
 	"spki/src/pkg/crypto"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 )
@@ -14,27 +15,55 @@ type Config struct {
 }
 
 type Spki struct {
-	App      App      `yaml:"app"`
-	Database Database `yaml:"database"`
-	Ats      Ats      `yaml:"ats"`
-	Uias     Uias     `yaml:"uias"`
-	Log      Log      `yaml:"log"`
+	App      App                       `yaml:"app"`
+	Database Database                  `yaml:"database"`
+	Ats      Ats                       `yaml:"ats"`
+	Uias     Uias                      `yaml:"uias"`
+	Log      Log                       `yaml:"log"`
+	Crl      Crl                       `yaml:"crl"`
+	Ocsp     Ocsp                      `yaml:"ocsp"`
+	Aia      Aia                       `yaml:"aia"`
+	Profiles map[string]SigningProfile `yaml:"profiles"`
+	Kek      Kek                       `yaml:"kek"`
+	KeyStore KeyStore                  `yaml:"keystore"`
+	Alarm    Alarm                     `yaml:"alarm"`
+	Webhook  Webhook                   `yaml:"webhook"`
+	Acme     Acme                      `yaml:"acme"`
+	Est      Est                       `yaml:"est"`
+	Scep     Scep                      `yaml:"scep"`
+	Cfssl    Cfssl                     `yaml:"cfssl"`
+	Vault    Vault                     `yaml:"vault"`
 }
 
 type App struct {
 	Bind string `yaml:"bind"`
+	TLS  TLS    `yaml:"tls"`
 }
 
+// TLS HTTPS 监听配置，cert_file 为空时使用 HTTP。启用后会请求客户端证书，由需要的接口（如 EST）自行校验
+type TLS struct {
+	CertFile string `yaml:"cert_file"` // 服务端证书（PEM），可包含中间证书
+	KeyFile  string `yaml:"key_file"`  // 服务端私钥（PEM）
+}
+
+// Database 数据库配置，driver 为 sqlite 时只使用 path
 type Database struct {
+	Driver string `yaml:"driver"` // 数据库驱动：mysql（默认）或 sqlite
+	Path   string `yaml:"path"`   // sqlite 数据库文件，为 ":memory:" 时只保存在内存中
 	Host   string `yaml:"host"`
 	Port   string `yaml:"port"`
 	Name   string `yaml:"name"`
 	User   string `yaml:"user"`
 	Passwd string `yaml:"passwd"`
+
+	AutoMigrate bool `yaml:"auto_migrate"` // 启动时执行未执行的数据库迁移
 }
 
+// Ats 审计记录接收服务，审计记录先写入缓冲区，再批量异步发送
 type Ats struct {
-	Endpoint string `yaml:"endpoint"`
+	Endpoint string        `yaml:"endpoint"`
+	Buffer   int           `yaml:"buffer"`  // 缓冲的审计记录数，ATS 不可用且缓冲区已满时丢弃新记录
+	Timeout  time.Duration `yaml:"timeout"` // 单次发送的超时时间
 }
 
 type Uias struct {
@@ -45,6 +74,151 @@ type Log struct {
 	Level string `yaml:"level"`
 }
 
+type Crl struct {
+	NextUpdate time.Duration `yaml:"next_update"` // CRL 的有效期，即 NextUpdate 与 ThisUpdate 的间隔
+	Interval   time.Duration `yaml:"interval"`    // 后台重新生成 CRL 的间隔
+}
+
+type Ocsp struct {
+	Cache     time.Duration `yaml:"cache"`     // 已签名响应的缓存时间，同时作为响应的 NextUpdate
+	Responder pkiConfig     `yaml:"responder"` // 委托 OCSP 签名证书，只用于签发它的 CA，其他 CA 使用 CA 私钥签名
+}
+
+// Aia CA 签发证书时写入的 AIA 和 CRL 分发点地址的默认值，{certid} 会被替换为签发 CA 的证书 ID
+type Aia struct {
+	CAIssuers string `yaml:"ca_issuers"` // CA 证书下载地址
+	Ocsp      string `yaml:"ocsp"`       // OCSP 响应器地址
+	Crl       string `yaml:"crl"`        // CRL 分发点
+}
+
+// Kek 加密私钥数据密钥的主密钥，支持多个版本以便轮换
+type Kek struct {
+	Current        int         `yaml:"current"` // 加密新私钥使用的主密钥版本
+	Keys           []MasterKey `yaml:"keys"`
+	AllowPlaintext bool        `yaml:"allow_plaintext"` // 未配置主密钥时允许以明文保存私钥，仅用于测试
+}
+
+// KeyStore 私钥存储
+type KeyStore struct {
+	Type string `yaml:"type"` // 保管 CA 私钥的存储：db（默认），file
+	Dir  string `yaml:"dir"`  // file 存储保存私钥的目录
+}
+
+// Alarm 证书到期告警
+type Alarm struct {
+	Interval   time.Duration `yaml:"interval"`   // 后台扫描即将到期证书的间隔
+	Thresholds []int         `yaml:"thresholds"` // 告警阈值（天），证书剩余有效期不超过阈值时告警，每个阈值只告警一次
+}
+
+// Webhook 证书生命周期事件通知，事件先写入发件箱，投递失败时按指数退避重试
+type Webhook struct {
+	Interval    time.Duration     `yaml:"interval"`     // 后台检查发件箱的间隔
+	Timeout     time.Duration     `yaml:"timeout"`      // 单次投递的超时时间
+	MaxAttempts int               `yaml:"max_attempts"` // 最大投递次数，超过后不再投递
+	Endpoints   []WebhookEndpoint `yaml:"endpoints"`
+}
+
+// WebhookEndpoint 事件接收地址
+type WebhookEndpoint struct {
+	Name   string   `yaml:"name"`   // 名称，唯一，发件箱中以名称关联接收地址
+	URL    string   `yaml:"url"`    // 接收事件的地址
+	Events []string `yaml:"events"` // 订阅的事件，为空时订阅所有事件
+	Secret string   `yaml:"secret"` // 事件签名密钥（使用 -encrypt 加密）
+}
+
+// Acme ACME（RFC 8555）自动签发接口
+type Acme struct {
+	Enabled       bool          `yaml:"enabled"`
+	CA            string        `yaml:"ca"`             // 签发证书的 CA 证书 ID
+	Profile       string        `yaml:"profile"`        // 签名配置名称，默认为 server
+	Expiry        int           `yaml:"expiry"`         // 有效期,单位是天，为 0 时使用签名配置的最长有效期
+	BaseURL       string        `yaml:"base_url"`       // 客户端访问 spki 的地址，如 https://pki.example.com，为空时根据请求推断
+	OrderLifetime time.Duration `yaml:"order_lifetime"` // 订单和授权的有效期
+	HTTPPort      int           `yaml:"http_port"`      // http-01 验证访问的端口，默认为 80
+	DNSResolver   string        `yaml:"dns_resolver"`   // dns-01 验证使用的 DNS 服务器（host:port），为空时使用系统配置
+}
+
+// Est EST（RFC 7030）注册接口，客户端使用 HTTP basic 或 TLS 客户端证书认证
+type Est struct {
+	Enabled      bool      `yaml:"enabled"`
+	CA           string    `yaml:"ca"`             // 签发证书的 CA 证书 ID
+	Profile      string    `yaml:"profile"`        // 签名配置名称，默认为 client
+	Expiry       int       `yaml:"expiry"`         // 有效期,单位是天，为 0 时使用签名配置的最长有效期，重新注册时与原证书相同
+	Users        []EstUser `yaml:"users"`          // HTTP basic 认证的用户
+	ClientCAFile string    `yaml:"client_ca_file"` // 信任的客户端证书签发者（PEM），如设备出厂证书的 CA；EST 签发 CA 的证书链始终受信任
+}
+
+// Scep SCEP（RFC 8894）注册接口，客户端在证书请求中携带挑战密码认证
+type Scep struct {
+	Enabled           bool   `yaml:"enabled"`
+	CA                string `yaml:"ca"`                 // 签发证书的 CA 证书 ID，CA 私钥须为 RSA，用于解密请求
+	Profile           string `yaml:"profile"`            // 签名配置名称，默认为 client
+	Expiry            int    `yaml:"expiry"`             // 有效期,单位是天，为 0 时使用签名配置的最长有效期
+	ChallengePassword string `yaml:"challenge_password"` // 挑战密码，使用 -encrypt 加密
+}
+
+// Cfssl 兼容 cfssl 的远程签名接口（/api/v1/cfssl/），profiles 中未设置 auth_key 的签名配置无需认证即可使用
+type Cfssl struct {
+	Enabled  bool                    `yaml:"enabled"`
+	CA       string                  `yaml:"ca"`        // 默认签发 CA 的证书 ID
+	Labels   map[string]string       `yaml:"labels"`    // 请求中的 label 对应的 CA 证书 ID，label 为空时使用 ca
+	Profile  string                  `yaml:"profile"`   // 请求未指定 profile 时使用的签名配置，默认为 server
+	Profiles []string                `yaml:"profiles"`  // 无需认证的 sign 和 newcert 可以使用的签名配置，为空时只能使用 profile
+	AuthKeys map[string]CfsslAuthKey `yaml:"auth_keys"` // authsign 使用的 HMAC 密钥，由签名配置的 auth_key 引用
+}
+
+// CfsslAuthKey cfssl authsign 密钥
+type CfsslAuthKey struct {
+	Type string `yaml:"type"` // 只支持 standard（HMAC-SHA256）
+	Key  string `yaml:"key"`  // 十六进制编码的密钥，使用 -encrypt 加密
+}
+
+// Vault 兼容 Vault PKI 引擎的接口（/v1/pki/），Vault 的角色对应签名配置及其名称、有效期和私钥限制
+type Vault struct {
+	Enabled bool                 `yaml:"enabled"`
+	CA      string               `yaml:"ca"`     // 签发 CA 的证书 ID
+	Tokens  map[string]string    `yaml:"tokens"` // 名称对应的访问令牌，使用 -encrypt 加密，客户端通过 X-Vault-Token 传递
+	Roles   map[string]VaultRole `yaml:"roles"`
+}
+
+// VaultRole Vault PKI 角色
+type VaultRole struct {
+	Profile          string        `yaml:"profile"`            // 签名配置，默认为 server
+	AllowedDomains   []string      `yaml:"allowed_domains"`    // 允许的域名
+	AllowSubdomains  bool          `yaml:"allow_subdomains"`   // 允许 allowed_domains 的子域名，包括通配符域名
+	AllowBareDomains bool          `yaml:"allow_bare_domains"` // 允许 allowed_domains 本身
+	AllowGlobDomains bool          `yaml:"allow_glob_domains"` // allowed_domains 可以使用通配符模式
+	AllowAnyName     bool          `yaml:"allow_any_name"`     // 不限制名称
+	AllowIPSans      bool          `yaml:"allow_ip_sans"`      // 允许 IP 地址
+	TTL              time.Duration `yaml:"ttl"`                // 请求未指定 ttl 时的有效期，为 0 时使用 max_ttl
+	MaxTTL           time.Duration `yaml:"max_ttl"`            // 最长有效期，为 0 时使用签名配置的最长有效期
+	KeyType          string        `yaml:"key_type"`           // 私钥类型：rsa、ec、ed25519，any 只能用于 sign，默认为 rsa
+	KeyBits          int           `yaml:"key_bits"`           // 私钥长度，sign 时为 RSA 公钥的最小长度
+}
+
+// EstUser EST 用户
+type EstUser struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"` // 使用 -encrypt 加密
+}
+
+// MasterKey 主密钥，内容为 base64 编码的 32 字节密钥，从文件或环境变量读取
+type MasterKey struct {
+	Version int    `yaml:"version"` // 主密钥版本，必须大于 0
+	File    string `yaml:"file"`    // 主密钥文件
+	Env     string `yaml:"env"`     // 主密钥环境变量，优先于文件
+}
+
+// SigningProfile 签名配置，与内置的同名配置合并时以此为准
+type SigningProfile struct {
+	KeyUsages    []string      `yaml:"key_usages"`     // 密钥用途，如 digital signature、key encipherment
+	ExtKeyUsages []string      `yaml:"ext_key_usages"` // 扩展密钥用途，如 server auth、client auth
+	MaxExpiry    time.Duration `yaml:"max_expiry"`     // 最长有效期，申请时未指定有效期则使用该值
+	KeyAlgos     []string      `yaml:"key_algos"`      // 允许的私钥算法：rsa、ecdsa、ed25519，为空时不限制
+	HonorCSRSans bool          `yaml:"honor_csr_sans"` // 签署证书请求时是否使用其中的使用者可选名称
+	AuthKey      string        `yaml:"auth_key"`       // cfssl authsign 使用的密钥名称，设置后只能通过 authsign 使用该签名配置
+}
+
 // unmarshal is a method used to parse configuration data in a byte slice and fill it into the Config struct.
 func (c *Config) unmarshal(d []byte) {
 	if err := yaml.Unmarshal(d, c); err != nil {
@@ -64,3 +238,76 @@ func (c *Config) decryptionDatabaseMysqlPwd() {
 		}
 	}
 }
+
+// decryptionEstPasswords is a method used to decrypt the EST user passwords.
+func (c *Config) decryptionEstPasswords() {
+	for i := range c.Spki.Est.Users {
+		user := &c.Spki.Est.Users[i]
+		if user.Password == "" {
+			continue
+		}
+		plain, err := crypto.Decryption(user.Password)
+		if err != nil {
+			hlog.Fatal("Decryption of EST password failed. spki.yaml:spki.est.users.password ", user.Username)
+			os.Exit(100)
+		}
+		user.Password = plain
+	}
+}
+
+// decryptionScepChallenge is a method used to decrypt the SCEP challenge password.
+func (c *Config) decryptionScepChallenge() {
+	if c.Spki.Scep.ChallengePassword == "" {
+		return
+	}
+	plain, err := crypto.Decryption(c.Spki.Scep.ChallengePassword)
+	if err != nil {
+		hlog.Fatal("Decryption of SCEP challenge password failed. spki.yaml:spki.scep.challenge_password")
+		os.Exit(100)
+	}
+	c.Spki.Scep.ChallengePassword = plain
+}
+
+// decryptionCfsslAuthKeys is a method used to decrypt the cfssl authsign keys.
+func (c *Config) decryptionCfsslAuthKeys() {
+	for name, key := range c.Spki.Cfssl.AuthKeys {
+		if key.Key == "" {
+			continue
+		}
+		plain, err := crypto.Decryption(key.Key)
+		if err != nil {
+			hlog.Fatal("Decryption of cfssl auth key failed. spki.yaml:spki.cfssl.auth_keys.key ", name)
+			os.Exit(100)
+		}
+		key.Key = plain
+		c.Spki.Cfssl.AuthKeys[name] = key
+	}
+}
+
+// decryptionVaultTokens is a method used to decrypt the Vault API tokens.
+func (c *Config) decryptionVaultTokens() {
+	for name, token := range c.Spki.Vault.Tokens {
+		plain, err := crypto.Decryption(token)
+		if err != nil {
+			hlog.Fatal("Decryption of Vault token failed. spki.yaml:spki.vault.tokens ", name)
+			os.Exit(100)
+		}
+		c.Spki.Vault.Tokens[name] = plain
+	}
+}
+
+// decryptionWebhookSecrets is a method used to decrypt the webhook signing secrets.
+func (c *Config) decryptionWebhookSecrets() {
+	for i := range c.Spki.Webhook.Endpoints {
+		endpoint := &c.Spki.Webhook.Endpoints[i]
+		if endpoint.Secret == "" {
+			continue
+		}
+		plain, err := crypto.Decryption(endpoint.Secret)
+		if err != nil {
+			hlog.Fatal("Decryption of webhook secret failed. spki.yaml:spki.webhook.endpoints.secret ", endpoint.Name)
+			os.Exit(100)
+		}
+		endpoint.Secret = plain
+	}
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"fmt"
+	"spki/src/config"
+	"spki/src/database/migrate"
+	"spki/src/database/mysql"
+	"spki/src/database/sqlite"
+	"spki/src/models"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"gorm.io/gorm"
+)
+
+// 数据库驱动，由 spki.database.driver 配置
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// InitDB 连接配置的数据库并作为 models 的存储，autoMigrate 为 true 时执行未执行的迁移，内存数据库总是执行迁移
+func InitDB(cfg *config.Database, autoMigrate bool) (*gorm.DB, error) {
+	var db *gorm.DB
+	switch cfg.Driver {
+	case "", DriverMySQL:
+		db = mysql.InitDB(cfg)
+	case DriverSQLite:
+		db = sqlite.InitDB(cfg)
+		autoMigrate = autoMigrate || cfg.Path == sqlite.Memory
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+
+	if autoMigrate {
+		n, err := migrate.Up(db)
+		if err != nil {
+			return nil, err
+		}
+		hlog.Infof("Applied %d migrations.", n)
+	}
+	models.SetRepository(models.NewGormRepository(db))
+	return db, nil
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"spki/src/pkg/common"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"gorm.io/gorm"
+)
+
+// Migration 一次数据库结构变更，Version 递增且不可修改，已发布的迁移只能追加不能改动
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false;column:version"` // 迁移版本
+	Name      string `gorm:"type:varchar(255);not null;column:name"`        // 迁移名称
+	AppliedAt int64  `gorm:"type:bigint;not null;column:applied_at"`        // 执行时间戳
+}
+
+// TableName 设置表名
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// State 迁移的执行状态
+type State struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+// ensureTable 创建迁移记录表
+func ensureTable(db *gorm.DB) error {
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&SchemaMigration{})
+}
+
+// applied 查询已执行的迁移
+func applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	var rows []SchemaMigration
+	if err := db.Model(&SchemaMigration{}).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	m := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		m[row.Version] = row
+	}
+	return m, nil
+}
+
+// sorted 按版本排序的迁移
+func sorted() []Migration {
+	list := append([]Migration(nil), migrations...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+// Up 依次执行所有未执行的迁移，返回执行的迁移数量
+func Up(db *gorm.DB) (int, error) {
+	done, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range sorted() {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: common.CreateTimestamp()}).Error
+		})
+		if err != nil {
+			return n, fmt.Errorf("migration %d %s failed: %v", m.Version, m.Name, err)
+		}
+		hlog.Infof("Applied migration %d %s.", m.Version, m.Name)
+		n++
+	}
+	return n, nil
+}
+
+// Down 按版本从高到低回滚最近执行的 steps 个迁移，返回回滚的迁移数量
+func Down(db *gorm.DB, steps int) (int, error) {
+	done, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+	list := sorted()
+	n := 0
+	for i := len(list) - 1; i >= 0 && n < steps; i-- {
+		m := list[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version=?", m.Version).Delete(&SchemaMigration{}).Error
+		})
+		if err != nil {
+			return n, fmt.Errorf("rollback of migration %d %s failed: %v", m.Version, m.Name, err)
+		}
+		hlog.Infof("Rolled back migration %d %s.", m.Version, m.Name)
+		n++
+	}
+	return n, nil
+}
+
+// Status 返回所有迁移的执行状态
+func Status(db *gorm.DB) ([]State, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var states []State
+	for _, m := range sorted() {
+		row, ok := done[m.Version]
+		states = append(states, State{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: row.AppliedAt})
+	}
+	return states, nil
+}
+
+// Run 执行 migrate 命令：up、down [n]、status
+func Run(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [n]|status")
+	}
+	switch args[0] {
+	case "up":
+		n, err := Up(db)
+		fmt.Printf("Applied %d migrations.\n", n)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if _, err := fmt.Sscanf(args[1], "%d", &steps); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations: %s", args[1])
+			}
+		}
+		n, err := Down(db, steps)
+		fmt.Printf("Rolled back %d migrations.\n", n)
+		return err
+	case "status":
+		states, err := Status(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied at " + time.UnixMilli(s.AppliedAt).Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-32s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
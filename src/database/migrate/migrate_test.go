@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"spki/src/config"
+	"spki/src/database/sqlite"
+	"testing"
+)
+
+func TestUpDown(t *testing.T) {
+	db := sqlite.InitDB(&config.Database{Path: sqlite.Memory})
+	n, err := Up(db)
+	if err != nil || n != len(migrations) {
+		t.Fatalf("up = %d, %v", n, err)
+	}
+	if n, err := Up(db); err != nil || n != 0 {
+		t.Fatalf("second up = %d, %v", n, err)
+	}
+	for _, table := range []string{"certificate", "version", "crl", "webhook_outbox", "acme_order", "scep_transaction"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+	if !db.Migrator().HasIndex(&versionV14{}, "idx_version_serial") || !db.Migrator().HasIndex(&certificateV14{}, "idx_certificate_parent_id") {
+		t.Error("indexes on version.serial and certificate.parent_id were not created")
+	}
+
+	// 全部回滚后再次执行，验证每个迁移的 Down 都能在 SQLite 上执行
+	if n, err := Down(db, len(migrations)); err != nil || n != len(migrations) {
+		t.Fatalf("down = %d, %v", n, err)
+	}
+	if db.Migrator().HasTable("certificate") {
+		t.Error("table certificate was not dropped")
+	}
+	if n, err := Up(db); err != nil || n != len(migrations) {
+		t.Fatalf("up after down = %d, %v", n, err)
+	}
+
+	states, err := Status(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if !s.Applied {
+			t.Errorf("migration %d %s is not applied", s.Version, s.Name)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package migrate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+
+	"gorm.io/gorm"
+)
+
+// 迁移中使用的表结构是对应版本的快照，不能引用 models 中的结构体，否则以后修改 models 会改变已发布的迁移
+
+// creatorV1 初始的 creator 表
+type creatorV1 struct {
+	ID     *int    `gorm:"primaryKey;autoIncrement;column:id"`
+	UserID *string `gorm:"type:char(32);default:null;column:user_id;unique"`
+	Name   *string `gorm:"type:varchar(255);default:null;column:name"`
+}
+
+func (creatorV1) TableName() string {
+	return "creator"
+}
+
+// certificateV1 初始的 certificate 表
+type certificateV1 struct {
+	ID       *int    `gorm:"primaryKey;autoIncrement;column:id"`
+	CertID   *string `gorm:"type:char(32);default:null;column:certid;unique"`
+	UserID   *string `gorm:"type:char(32);not null;column:user_id"`
+	Title    *string `gorm:"type:varchar(255);default:null;column:title"`
+	State    *string `gorm:"type:varchar(255);default:null;column:state"`
+	Subject  *string `gorm:"type:varchar(255);default:null;column:subject"`
+	ParentID *string `gorm:"type:char(36);default:null;column:parent_id"`
+	Pathlev  *int    `gorm:"type:int;not null;column:pathlev"`
+	Genre    *int    `gorm:"type:int;not null;column:genre"`
+	CertReq  *string `gorm:"type:varchar(255);default:null;column:cert_req"`
+}
+
+func (certificateV1) TableName() string {
+	return "certificate"
+}
+
+// privateKeyV1 初始的 private_key 表
+type privateKeyV1 struct {
+	ID         int    `gorm:"primaryKey;autoIncrement;column:id"`
+	KeyID      string `gorm:"type:char(32);default:null;column:keyid;unique"`
+	PrivateKey string `gorm:"type:text;not null;column:private_key"`
+	CreateTime int64  `gorm:"type:bigint;default:null;column:create_time"`
+}
+
+func (privateKeyV1) TableName() string {
+	return "private_key"
+}
+
+// versionV1 初始的 version 表
+type versionV1 struct {
+	ID             int    `gorm:"primaryKey;autoIncrement;column:id"`
+	CertID         string `gorm:"type:char(32);default:null;column:certid"`
+	KeyID          string `gorm:"type:char(32);default:null;column:keyid"`
+	Serial         string `gorm:"type:varchar(255);default:null;column:serial"`
+	Cert           string `gorm:"type:text;default:null;column:cert"`
+	EffectiveTime  int64  `gorm:"type:bigint;default:null;column:effective_time"`
+	ExpirationTime int64  `gorm:"type:bigint;default:null;column:expiration_time"`
+	RevocationTime int64  `gorm:"type:bigint;default:null;column:revocation_time"`
+	Alarm          int    `gorm:"type:int;default:0;column:alarm"`
+}
+
+func (versionV1) TableName() string {
+	return "version"
+}
+
+// certificateV2 证书请求改为 text 以保存完整的 PEM
+type certificateV2 struct {
+	CertReq *string `gorm:"type:text;default:null;column:cert_req"`
+}
+
+func (certificateV2) TableName() string {
+	return "certificate"
+}
+
+// versionV3 吊销原因和失效时间
+type versionV3 struct {
+	RevocationCode int   `gorm:"type:int;default:0;column:revocation_code"`
+	InvalidityTime int64 `gorm:"type:bigint;default:null;column:invalidity_time"`
+}
+
+func (versionV3) TableName() string {
+	return "version"
+}
+
+// crlV4 CRL 表
+type crlV4 struct {
+	ID         int    `gorm:"primaryKey;autoIncrement;column:id"`
+	CertID     string `gorm:"type:char(32);not null;column:certid"`
+	Number     int64  `gorm:"type:bigint;not null;column:number"`
+	ThisUpdate int64  `gorm:"type:bigint;not null;column:this_update"`
+	NextUpdate int64  `gorm:"type:bigint;not null;column:next_update"`
+	Crl        string `gorm:"type:mediumtext;not null;column:crl"`
+}
+
+func (crlV4) TableName() string {
+	return "crl"
+}
+
+// certificateV5 CA 签发证书时写入的 AIA 和 CRL 分发点地址
+type certificateV5 struct {
+	IssuerURL *string `gorm:"type:varchar(255);default:null;column:issuer_url"`
+	OcspURL   *string `gorm:"type:varchar(255);default:null;column:ocsp_url"`
+	CrlURL    *string `gorm:"type:varchar(255);default:null;column:crl_url"`
+}
+
+func (certificateV5) TableName() string {
+	return "certificate"
+}
+
+// privateKeyV6 私钥信封加密
+type privateKeyV6 struct {
+	DataKey    string `gorm:"type:varchar(255);default:null;column:data_key"`
+	KekVersion int    `gorm:"type:int;default:0;column:kek_version"`
+}
+
+func (privateKeyV6) TableName() string {
+	return "private_key"
+}
+
+// privateKeyV7 私钥存储
+type privateKeyV7 struct {
+	Backend string `gorm:"type:varchar(32);default:'db';column:backend"`
+}
+
+func (privateKeyV7) TableName() string {
+	return "private_key"
+}
+
+// certificateV8 证书列表的搜索和排序
+type certificateV8 struct {
+	Sans       *string `gorm:"type:text;default:null;column:sans"`
+	CreateTime int64   `gorm:"type:bigint;default:null;column:create_time"`
+}
+
+func (certificateV8) TableName() string {
+	return "certificate"
+}
+
+// webhookEventV10 Webhook 事件发件箱
+type webhookEventV10 struct {
+	ID          int    `gorm:"primaryKey;autoIncrement;column:id"`
+	EventID     string `gorm:"type:char(32);not null;column:event_id"`
+	Endpoint    string `gorm:"type:varchar(255);not null;column:endpoint"`
+	Event       string `gorm:"type:varchar(64);not null;column:event"`
+	Payload     string `gorm:"type:text;not null;column:payload"`
+	State       string `gorm:"type:varchar(16);not null;column:state;index:idx_webhook_outbox_due"`
+	Attempts    int    `gorm:"type:int;default:0;column:attempts"`
+	NextAttempt int64  `gorm:"type:bigint;not null;column:next_attempt;index:idx_webhook_outbox_due"`
+	LastError   string `gorm:"type:text;default:null;column:last_error"`
+	CreateTime  int64  `gorm:"type:bigint;default:null;column:create_time"`
+}
+
+func (webhookEventV10) TableName() string {
+	return "webhook_outbox"
+}
+
+// acmeAccountV11 ACME 账户
+type acmeAccountV11 struct {
+	ID         int    `gorm:"primaryKey;autoIncrement;column:id"`
+	AccountID  string `gorm:"type:char(32);not null;column:account_id;unique"`
+	Thumbprint string `gorm:"type:varchar(64);not null;column:thumbprint;unique"`
+	Jwk        string `gorm:"type:text;not null;column:jwk"`
+	Contact    string `gorm:"type:text;default:null;column:contact"`
+	Status     string `gorm:"type:varchar(16);not null;column:status"`
+	CreateTime int64  `gorm:"type:bigint;default:null;column:create_time"`
+}
+
+func (acmeAccountV11) TableName() string {
+	return "acme_account"
+}
+
+// acmeOrderV11 ACME 订单
+type acmeOrderV11 struct {
+	ID          int     `gorm:"primaryKey;autoIncrement;column:id"`
+	OrderID     string  `gorm:"type:char(32);not null;column:order_id;unique"`
+	AccountID   string  `gorm:"type:char(32);not null;column:account_id;index"`
+	Status      string  `gorm:"type:varchar(16);not null;column:status"`
+	Identifiers string  `gorm:"type:text;not null;column:identifiers"`
+	NotBefore   int64   `gorm:"type:bigint;default:null;column:not_before"`
+	NotAfter    int64   `gorm:"type:bigint;default:null;column:not_after"`
+	Expires     int64   `gorm:"type:bigint;not null;column:expires"`
+	Error       string  `gorm:"type:text;default:null;column:error"`
+	CertID      *string `gorm:"type:char(32);default:null;column:certid;index"`
+	CreateTime  int64   `gorm:"type:bigint;default:null;column:create_time"`
+}
+
+func (acmeOrderV11) TableName() string {
+	return "acme_order"
+}
+
+// acmeAuthorizationV11 ACME 授权
+type acmeAuthorizationV11 struct {
+	ID        int    `gorm:"primaryKey;autoIncrement;column:id"`
+	AuthzID   string `gorm:"type:char(32);not null;column:authz_id;unique"`
+	OrderID   string `gorm:"type:char(32);not null;column:order_id;index"`
+	AccountID string `gorm:"type:char(32);not null;column:account_id"`
+	Type      string `gorm:"type:varchar(16);not null;column:type"`
+	Value     string `gorm:"type:varchar(255);not null;column:value"`
+	Wildcard  bool   `gorm:"default:false;column:wildcard"`
+	Status    string `gorm:"type:varchar(16);not null;column:status"`
+	Expires   int64  `gorm:"type:bigint;not null;column:expires"`
+}
+
+func (acmeAuthorizationV11) TableName() string {
+	return "acme_authorization"
+}
+
+// acmeChallengeV11 ACME 质询
+type acmeChallengeV11 struct {
+	ID          int    `gorm:"primaryKey;autoIncrement;column:id"`
+	ChallengeID string `gorm:"type:char(32);not null;column:challenge_id;unique"`
+	AuthzID     string `gorm:"type:char(32);not null;column:authz_id;index"`
+	Type        string `gorm:"type:varchar(16);not null;column:type"`
+	Token       string `gorm:"type:varchar(64);not null;column:token"`
+	Status      string `gorm:"type:varchar(16);not null;column:status"`
+	Validated   int64  `gorm:"type:bigint;default:null;column:validated"`
+	Error       string `gorm:"type:text;default:null;column:error"`
+}
+
+func (acmeChallengeV11) TableName() string {
+	return "acme_challenge"
+}
+
+// scepTransactionV12 SCEP 事务
+type scepTransactionV12 struct {
+	ID            int    `gorm:"primaryKey;autoIncrement;column:id"`
+	TransactionID string `gorm:"type:varchar(128);not null;column:transaction_id;unique"`
+	CertID        string `gorm:"type:char(32);not null;column:certid"`
+	Serial        string `gorm:"type:varchar(64);not null;column:serial"`
+	CreateTime    int64  `gorm:"type:bigint;not null;column:create_time"`
+}
+
+func (scepTransactionV12) TableName() string {
+	return "scep_transaction"
+}
+
+// certificateV13 签发末端证书时使用的签名配置
+type certificateV13 struct {
+	Profile *string `gorm:"type:varchar(255);default:null;column:profile"`
+}
+
+func (certificateV13) TableName() string {
+	return "certificate"
+}
+
+// versionV14 按序列号查询版本的索引，用于 OCSP 和吊销
+type versionV14 struct {
+	Serial string `gorm:"type:varchar(255);default:null;column:serial;index:idx_version_serial"`
+}
+
+func (versionV14) TableName() string {
+	return "version"
+}
+
+// certificateV14 按上级证书查询的索引，用于 CA 签发的证书列表和 CRL
+type certificateV14 struct {
+	ParentID *string `gorm:"type:char(36);default:null;column:parent_id;index:idx_certificate_parent_id"`
+}
+
+func (certificateV14) TableName() string {
+	return "certificate"
+}
+
+// createTables 创建不存在的表，兼容迁移引入前手工建表的数据库
+func createTables(tx *gorm.DB, models ...interface{}) error {
+	for _, model := range models {
+		if tx.Migrator().HasTable(model) {
+			continue
+		}
+		if err := tx.Migrator().CreateTable(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropTables 删除表
+func dropTables(tx *gorm.DB, models ...interface{}) error {
+	return tx.Migrator().DropTable(models...)
+}
+
+// addColumns 添加不存在的列
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns 删除存在的列
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if !tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexes 创建不存在的索引
+func createIndexes(tx *gorm.DB, model interface{}, names ...string) error {
+	for _, name := range names {
+		if tx.Migrator().HasIndex(model, name) {
+			continue
+		}
+		if err := tx.Migrator().CreateIndex(model, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropIndexes 删除存在的索引
+func dropIndexes(tx *gorm.DB, model interface{}, names ...string) error {
+	for _, name := range names {
+		if !tx.Migrator().HasIndex(model, name) {
+			continue
+		}
+		if err := tx.Migrator().DropIndex(model, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillValidity 从证书中补全版本缺失的序列号和有效期，早期创建 CA 时未保存这些字段
+func backfillValidity(tx *gorm.DB) error {
+	var rows []versionV1
+	err := tx.Where("serial IS NULL OR serial='' OR expiration_time IS NULL OR expiration_time=0").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		block, _ := pem.Decode([]byte(row.Cert))
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		err = tx.Model(&versionV1{}).Where("id=?", row.ID).Updates(map[string]interface{}{
+			"serial":          cert.SerialNumber.Text(16),
+			"effective_time":  cert.NotBefore.UnixMilli(),
+			"expiration_time": cert.NotAfter.UnixMilli(),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrations 所有迁移，新的迁移追加在末尾
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_initial_tables",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &creatorV1{}, &certificateV1{}, &privateKeyV1{}, &versionV1{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, &versionV1{}, &privateKeyV1{}, &certificateV1{}, &creatorV1{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "certificate_cert_req_text",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AlterColumn(&certificateV2{}, "CertReq")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().AlterColumn(&certificateV1{}, "CertReq")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "version_revocation_reason",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &versionV3{}, "RevocationCode", "InvalidityTime")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &versionV3{}, "RevocationCode", "InvalidityTime")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_crl_table",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &crlV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, &crlV4{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "certificate_ca_urls",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &certificateV5{}, "IssuerURL", "OcspURL", "CrlURL")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &certificateV5{}, "IssuerURL", "OcspURL", "CrlURL")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "private_key_envelope",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &privateKeyV6{}, "DataKey", "KekVersion")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &privateKeyV6{}, "DataKey", "KekVersion")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "private_key_backend",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &privateKeyV7{}, "Backend")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &privateKeyV7{}, "Backend")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "certificate_sans_create_time",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &certificateV8{}, "Sans", "CreateTime")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &certificateV8{}, "Sans", "CreateTime")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "version_backfill_validity",
+		Up:      backfillValidity,
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_webhook_outbox",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &webhookEventV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, &webhookEventV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create_acme_tables",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &acmeAccountV11{}, &acmeOrderV11{}, &acmeAuthorizationV11{}, &acmeChallengeV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, &acmeChallengeV11{}, &acmeAuthorizationV11{}, &acmeOrderV11{}, &acmeAccountV11{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "create_scep_transaction",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx, &scepTransactionV12{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, &scepTransactionV12{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "certificate_profile",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &certificateV13{}, "Profile")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &certificateV13{}, "Profile")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "version_serial_parent_id_index",
+		Up: func(tx *gorm.DB) error {
+			if err := createIndexes(tx, &versionV14{}, "idx_version_serial"); err != nil {
+				return err
+			}
+			return createIndexes(tx, &certificateV14{}, "idx_certificate_parent_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndexes(tx, &certificateV14{}, "idx_certificate_parent_id"); err != nil {
+				return err
+			}
+			return dropIndexes(tx, &versionV14{}, "idx_version_serial")
+		},
+	},
+}
@@ -12,10 +12,8 @@ import (
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 )
 
-var OrmDB *gorm.DB
-
 // InitDB initializes the database connection.
-func InitDB(cfg *config.Database) {
+func InitDB(cfg *config.Database) *gorm.DB {
 	// Construct the DSN string.
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=true", cfg.User, cfg.Passwd, cfg.Host, cfg.Port, cfg.Name)
 	hlog.Debug("database passwd: ", cfg.Passwd)
@@ -58,5 +56,5 @@ func InitDB(cfg *config.Database) {
 	_db.SetConnMaxLifetime(time.Hour * 2) // 最大连接有效时间，防止异常连接一直占用
 	_db.SetConnMaxIdleTime(time.Hour)     // 空闲连接如果持续xx时间没有被使用，就会被关闭
 
-	OrmDB = db
+	return db
 }
@@ -1,18 +0,0 @@
-package mysql
-
-//
-//import "spki/src/models"
-//
-//// AutoMigrateDB 自动迁移模式
-//func AutoMigrateDB() {
-//	// 自动迁移模式
-//	err := OrmDB.AutoMigrate(
-//		&models.Creator{},
-//		&models.Certificate{},
-//		&models.PrivateKey{},
-//		&models.Version{},
-//	)
-//	if err != nil {
-//		panic("failed to migrate table")
-//	}
-//}
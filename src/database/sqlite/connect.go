@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"spki/src/config"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Memory 只保存在内存中的数据库路径
+const Memory = ":memory:"
+
+// dsn 连接字符串：启用外键约束，写入时等待锁而不是返回 SQLITE_BUSY
+func dsn(path string) string {
+	return path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+// InitDB 打开内嵌数据库
+func InitDB(cfg *config.Database) *gorm.DB {
+	path := cfg.Path
+	if path == "" {
+		path = "spki.db"
+	}
+	if path != Memory {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			panic(fmt.Errorf("failed to create database directory: %v", err))
+		}
+	}
+	hlog.Info("Open embedded database: ", path)
+
+	db, err := gorm.Open(sqlite.Open(dsn(path)), &gorm.Config{
+		SkipDefaultTransaction: true,
+		NamingStrategy: schema.NamingStrategy{
+			SingularTable: true,
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	// SQLite 只允许一个写入者，且每个 ":memory:" 连接都会打开各自的空数据库
+	_db, _ := db.DB()
+	_db.SetMaxOpenConns(1)
+	_db.SetMaxIdleConns(1)
+	_db.SetConnMaxLifetime(0)
+	_db.SetConnMaxIdleTime(0)
+
+	return db
+}
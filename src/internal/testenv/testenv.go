@@ -0,0 +1,148 @@
+// Package testenv 测试使用的内存数据库和 CA，测试无需连接外部服务
+package testenv
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"spki/src/config"
+	"spki/src/database"
+	"spki/src/database/sqlite"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/signature"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserID 测试数据使用的创建者 ID
+const UserID = "00000000000000000000000000000000"
+
+// Open 打开执行过全部迁移的 SQLite 内存数据库并设置为 models 的数据存储
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDB(&config.Database{Driver: database.DriverSQLite, Path: sqlite.Memory}, true)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// Config 将全局配置替换为空配置并返回，测试结束后恢复原配置
+func Config(t testing.TB) *config.Config {
+	old := config.AppCfg
+	config.AppCfg = &config.Config{Spki: &config.Spki{}}
+	t.Cleanup(func() { config.AppCfg = old })
+	return config.AppCfg
+}
+
+// CA 创建有效期十年、使用 ECDSA P-256 私钥的自签名根 CA，私钥保存在 CA 私钥存储中，返回证书 ID、证书和私钥
+func CA(t testing.TB, cn string) (string, *x509.Certificate, crypto.Signer) {
+	t.Helper()
+	return CAWithKey(t, cn, "ecdsa", 256)
+}
+
+// CAWithKey 创建使用指定算法私钥的自签名根 CA，用于 SCEP 等需要 RSA CA 的协议
+func CAWithKey(t testing.TB, cn, algo string, size int) (string, *x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := keystore.CA().Generate(algo, size)
+	if err == nil {
+		err = key.Save(models.Repo())
+	}
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	signer := key.Signer
+	serial, err := signature.SerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	cert, err := signature.CertSignature(template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatalf("failed to sign CA certificate: %v", err)
+	}
+
+	return save(t, cert, key.ID, nil, 0, models.GenreCA), cert, signer
+}
+
+// Leaf 使用 CA 私钥签发有效期一天的末端证书并保存，返回证书 ID 和证书
+func Leaf(t testing.TB, caCertID string, ca *x509.Certificate, caSigner crypto.Signer, pub crypto.PublicKey, cn string) (string, *x509.Certificate) {
+	t.Helper()
+	serial, err := signature.SerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := signature.CertSignature(template, ca, pub, caSigner)
+	if err != nil {
+		t.Fatalf("failed to sign certificate: %v", err)
+	}
+	return save(t, cert, "", &caCertID, 1, models.GenreLeaf), cert
+}
+
+// save 保存证书及其版本，返回证书 ID
+func save(t testing.TB, cert *x509.Certificate, keyID string, parentID *string, pathlev, genre int) string {
+	t.Helper()
+	certID := common.CreateUuid()
+	userID, state, subject := UserID, models.StateValid, "/CN="+cert.Subject.CommonName
+	err := models.CreateCertificate(models.Certificate{
+		CertID:     &certID,
+		UserID:     &userID,
+		State:      &state,
+		Subject:    &subject,
+		ParentID:   parentID,
+		Pathlev:    &pathlev,
+		Genre:      &genre,
+		CreateTime: common.CreateTimestamp(),
+	})
+	if err == nil {
+		err = models.InstallCertVersion(models.Version{
+			CertID:         certID,
+			KeyID:          keyID,
+			Serial:         signature.SerialString(cert.SerialNumber),
+			Cert:           string(signature.CertToPEM(cert)),
+			EffectiveTime:  cert.NotBefore.UnixMilli(),
+			ExpirationTime: cert.NotAfter.UnixMilli(),
+		})
+	}
+	if err != nil {
+		t.Fatalf("failed to save certificate: %v", err)
+	}
+	return certID
+}
+
+// Count 返回表中的行数
+func Count(t testing.TB, db *gorm.DB, table string) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Table(table).Count(&n).Error; err != nil {
+		t.Fatalf("failed to count %s: %v", table, err)
+	}
+	return n
+}
@@ -0,0 +1,212 @@
+package kek
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/pkg/crypto"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Plaintext 未加密私钥的主密钥版本
+const Plaintext = 0
+
+// masterKeys 已加载的主密钥，按版本区分
+var masterKeys = struct {
+	sync.RWMutex
+	current int
+	keys    map[int][]byte
+}{keys: make(map[int][]byte)}
+
+// readMasterKey 从环境变量或文件读取 base64 编码的主密钥
+func readMasterKey(mk *config.MasterKey) ([]byte, error) {
+	var encoded string
+	switch {
+	case mk.Env != "" && os.Getenv(mk.Env) != "":
+		encoded = os.Getenv(mk.Env)
+	case mk.File != "":
+		data, err := os.ReadFile(mk.File)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	default:
+		return nil, fmt.Errorf("master key %d is not provided", mk.Version)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key %d is not valid base64: %v", mk.Version, err)
+	}
+	if len(key) != crypto.DataKeySize {
+		return nil, fmt.Errorf("master key %d must be %d bytes", mk.Version, crypto.DataKeySize)
+	}
+	return key, nil
+}
+
+// Init 加载主密钥。未配置主密钥时返回错误，除非配置了 allow_plaintext，此时私钥以明文保存
+func Init(cfg *config.Kek) error {
+	keys := make(map[int][]byte, len(cfg.Keys))
+	for i := range cfg.Keys {
+		mk := &cfg.Keys[i]
+		if mk.Version <= Plaintext {
+			return fmt.Errorf("master key version must be greater than %d", Plaintext)
+		}
+		key, err := readMasterKey(mk)
+		if err != nil {
+			return err
+		}
+		keys[mk.Version] = key
+	}
+	switch {
+	case cfg.Current != Plaintext:
+		if _, ok := keys[cfg.Current]; !ok {
+			return fmt.Errorf("current master key %d is not configured", cfg.Current)
+		}
+	case cfg.AllowPlaintext:
+		hlog.Warn("No master key configured, private keys will be stored in plaintext.")
+	default:
+		return errors.New("no master key configured, set kek.current or kek.allow_plaintext")
+	}
+
+	masterKeys.Lock()
+	masterKeys.current = cfg.Current
+	masterKeys.keys = keys
+	masterKeys.Unlock()
+	return nil
+}
+
+// masterKey 获取指定版本的主密钥
+func masterKey(version int) ([]byte, error) {
+	masterKeys.RLock()
+	defer masterKeys.RUnlock()
+	key, ok := masterKeys.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("master key %d is not configured", version)
+	}
+	return key, nil
+}
+
+// currentVersion 加密新私钥使用的主密钥版本
+func currentVersion() int {
+	masterKeys.RLock()
+	defer masterKeys.RUnlock()
+	return masterKeys.current
+}
+
+// wrap 使用当前主密钥加密数据密钥
+func wrap(record *models.PrivateKey, dataKey []byte) error {
+	version := currentVersion()
+	mk, err := masterKey(version)
+	if err != nil {
+		return err
+	}
+	wrapped, err := crypto.SealGCM(mk, dataKey, []byte(record.KeyID))
+	if err != nil {
+		return err
+	}
+	record.DataKey = base64.StdEncoding.EncodeToString(wrapped)
+	record.KekVersion = version
+	return nil
+}
+
+// unwrap 解密私钥的数据密钥
+func unwrap(record *models.PrivateKey) ([]byte, error) {
+	mk, err := masterKey(record.KekVersion)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(record.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.OpenGCM(mk, wrapped, []byte(record.KeyID))
+}
+
+// Seal 加密私钥，填充 record 的 PrivateKey、DataKey 和 KekVersion，私钥 ID 作为附加认证数据
+func Seal(record *models.PrivateKey, pemBytes []byte) error {
+	if currentVersion() == Plaintext {
+		record.PrivateKey = string(pemBytes)
+		record.DataKey = ""
+		record.KekVersion = Plaintext
+		return nil
+	}
+
+	dataKey, err := crypto.NewDataKey()
+	if err != nil {
+		return err
+	}
+	sealed, err := crypto.SealGCM(dataKey, pemBytes, []byte(record.KeyID))
+	if err != nil {
+		return err
+	}
+	if err := wrap(record, dataKey); err != nil {
+		return err
+	}
+	record.PrivateKey = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// Open 解密私钥，返回 PEM 格式的私钥
+func Open(record *models.PrivateKey) ([]byte, error) {
+	if record.KekVersion == Plaintext {
+		return []byte(record.PrivateKey), nil
+	}
+	dataKey, err := unwrap(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key of %s: %v", record.KeyID, err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := crypto.OpenGCM(dataKey, sealed, []byte(record.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key %s: %v", record.KeyID, err)
+	}
+	return plain, nil
+}
+
+// Current 加密新私钥使用的主密钥版本，未配置主密钥时为 Plaintext
+func Current() int {
+	return currentVersion()
+}
+
+// Rewrap 使用当前主密钥重新加密数据密钥，明文私钥则直接加密
+func Rewrap(record *models.PrivateKey) error {
+	if record.KekVersion == Plaintext {
+		return Seal(record, []byte(record.PrivateKey))
+	}
+	dataKey, err := unwrap(record)
+	if err != nil {
+		return err
+	}
+	return wrap(record, dataKey)
+}
+
+// RewrapAll 将保存在数据库中的私钥的数据密钥改由当前主密钥加密，返回处理的私钥数量。
+// 文件私钥存储中的私钥由 keystore.RewrapAll 处理
+func RewrapAll() (int, error) {
+	current := currentVersion()
+	if current == Plaintext {
+		return 0, errors.New("no current master key configured")
+	}
+	records, err := models.FindPrivateKeysNotInKekVersion(current)
+	if err != nil {
+		return 0, err
+	}
+	for i := range records {
+		if err := Rewrap(&records[i]); err != nil {
+			return i, fmt.Errorf("failed to rewrap private key %s: %v", records[i].KeyID, err)
+		}
+		if err := models.UpdatePrivateKeyEnvelope(records[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(records), nil
+}
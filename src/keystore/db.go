@@ -0,0 +1,83 @@
+package keystore
+
+import (
+	"crypto"
+	"fmt"
+	"spki/src/genkey"
+	"spki/src/kek"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/pkg/uuid4"
+)
+
+// dbStore 数据库私钥存储，私钥经主密钥信封加密后保存在 private_key 表中
+type dbStore struct{}
+
+// generate 生成私钥
+func generate(algo string, size int) (crypto.Signer, error) {
+	key, err := genkey.CreateKey(algo, size)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// Generate 生成私钥
+func (s *dbStore) Generate(algo string, size int) (*Key, error) {
+	signer, err := generate(algo, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.Import(signer)
+}
+
+// Import 使用主密钥加密私钥，加密后的私钥由 Key.Save 保存在 private_key 表中
+func (s *dbStore) Import(key crypto.Signer) (*Key, error) {
+	pemBytes, err := genkey.PrivateKeyToPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	record := models.PrivateKey{
+		KeyID:      uuid4.Uuid4Str(), // 私钥id
+		Backend:    BackendDB,
+		CreateTime: common.CreateTimestamp(),
+	}
+	if err := kek.Seal(&record, pemBytes); err != nil {
+		return nil, err
+	}
+	return &Key{ID: record.KeyID, Signer: key, record: record}, nil
+}
+
+// Signer 解密私钥
+func (s *dbStore) Signer(keyID string) (crypto.Signer, error) {
+	return s.Export(keyID)
+}
+
+// Export 解密私钥，数据库中的私钥允许导出
+func (s *dbStore) Export(keyID string) (crypto.Signer, error) {
+	record, err := models.FindPrivateKeyByKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if record.ID == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	pemBytes, err := kek.Open(record)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := genkey.ParsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %v", keyID, err)
+	}
+	return signer, nil
+}
+
+// Destroy 删除私钥
+func (s *dbStore) Destroy(keyID string) error {
+	return models.DeletePrivateKey(keyID)
+}
@@ -0,0 +1,249 @@
+package keystore
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"spki/src/genkey"
+	"spki/src/kek"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/pkg/uuid4"
+	"strings"
+	"sync"
+)
+
+// fileStore 软件令牌私钥存储，作为 HSM 的软件实现
+// 私钥经主密钥信封加密后保存在本地目录中，数据库中只保存私钥 ID 等元数据，
+// 私钥不可导出，使用者只能拿到仅提供 Public、Sign 和 Decrypt 的签名者
+type fileStore struct {
+	dir     string
+	mu      sync.RWMutex
+	signers map[string]crypto.Signer // 已解密的私钥缓存
+}
+
+// envelope 私钥文件内容
+type envelope struct {
+	KeyID      string `json:"keyid"`
+	PrivateKey string `json:"private_key"`
+	DataKey    string `json:"data_key,omitempty"`
+	KekVersion int    `json:"kek_version"`
+}
+
+// newEnvelope 由加密后的私钥记录生成私钥文件内容
+func newEnvelope(sealed *models.PrivateKey) *envelope {
+	return &envelope{
+		KeyID:      sealed.KeyID,
+		PrivateKey: sealed.PrivateKey,
+		DataKey:    sealed.DataKey,
+		KekVersion: sealed.KekVersion,
+	}
+}
+
+// tokenSigner 隐藏底层私钥的签名者，无法通过类型断言取得私钥
+type tokenSigner struct {
+	signer crypto.Signer
+}
+
+// Public 返回公钥
+func (t *tokenSigner) Public() crypto.PublicKey {
+	return t.signer.Public()
+}
+
+// Sign 签名
+func (t *tokenSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return t.signer.Sign(rand, digest, opts)
+}
+
+// Decrypt 解密，底层私钥不支持解密时返回 ErrDecryptUnsupported
+func (t *tokenSigner) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	decrypter, ok := t.signer.(crypto.Decrypter)
+	if !ok {
+		return nil, ErrDecryptUnsupported
+	}
+	return decrypter.Decrypt(rand, msg, opts)
+}
+
+// newFileStore 创建软件令牌私钥存储，目录不存在时自动创建
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key store directory: %v", err)
+	}
+	return &fileStore{dir: dir, signers: make(map[string]crypto.Signer)}, nil
+}
+
+// path 私钥文件路径
+func (s *fileStore) path(keyID string) string {
+	return filepath.Join(s.dir, keyID+".key")
+}
+
+// Generate 在令牌中生成私钥
+func (s *fileStore) Generate(algo string, size int) (*Key, error) {
+	signer, err := generate(algo, size)
+	if err != nil {
+		return nil, err
+	}
+	return s.Import(signer)
+}
+
+// Import 将私钥加密写入令牌目录，数据库中只登记元数据，由 Key.Save 保存
+func (s *fileStore) Import(key crypto.Signer) (*Key, error) {
+	pemBytes, err := genkey.PrivateKeyToPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	record := models.PrivateKey{
+		KeyID:      uuid4.Uuid4Str(), // 私钥id
+		Backend:    BackendFile,
+		CreateTime: common.CreateTimestamp(),
+	}
+	sealed := record
+	if err := kek.Seal(&sealed, pemBytes); err != nil {
+		return nil, err
+	}
+	if err := s.write(newEnvelope(&sealed)); err != nil {
+		return nil, err
+	}
+	return &Key{
+		ID:     record.KeyID,
+		Signer: &tokenSigner{signer: key},
+		record: record,
+		discard: func() error {
+			return s.remove(record.KeyID)
+		},
+	}, nil
+}
+
+// record 信封对应的私钥记录，用于主密钥加解密
+func (env *envelope) record() *models.PrivateKey {
+	return &models.PrivateKey{
+		KeyID:      env.KeyID,
+		PrivateKey: env.PrivateKey,
+		DataKey:    env.DataKey,
+		KekVersion: env.KekVersion,
+	}
+}
+
+// read 读取私钥文件
+func (s *fileStore) read(keyID string) (*envelope, error) {
+	data, err := os.ReadFile(s.path(keyID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+		}
+		return nil, err
+	}
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("invalid private key file %s: %v", keyID, err)
+	}
+	if env.KeyID != keyID {
+		return nil, fmt.Errorf("private key file %s does not match its name", keyID)
+	}
+	return &env, nil
+}
+
+// write 写入私钥文件，先写入临时文件再重命名，避免写入中断时损坏私钥文件
+func (s *fileStore) write(env *envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(env.KeyID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %v", err)
+	}
+	if err := os.Rename(tmp, s.path(env.KeyID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write private key: %v", err)
+	}
+	return nil
+}
+
+// load 读取并解密私钥文件
+func (s *fileStore) load(keyID string) (crypto.Signer, error) {
+	env, err := s.read(keyID)
+	if err != nil {
+		return nil, err
+	}
+	pemBytes, err := kek.Open(env.record())
+	if err != nil {
+		return nil, err
+	}
+	signer, err := genkey.ParsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %v", keyID, err)
+	}
+	return signer, nil
+}
+
+// Signer 返回令牌中私钥的签名者
+func (s *fileStore) Signer(keyID string) (crypto.Signer, error) {
+	s.mu.RLock()
+	signer, ok := s.signers[keyID]
+	s.mu.RUnlock()
+	if ok {
+		return signer, nil
+	}
+
+	key, err := s.load(keyID)
+	if err != nil {
+		return nil, err
+	}
+	signer = &tokenSigner{signer: key}
+	s.mu.Lock()
+	s.signers[keyID] = signer
+	s.mu.Unlock()
+	return signer, nil
+}
+
+// remove 删除私钥文件和已解密的私钥缓存
+func (s *fileStore) remove(keyID string) error {
+	s.mu.Lock()
+	delete(s.signers, keyID)
+	s.mu.Unlock()
+	if err := os.Remove(s.path(keyID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Destroy 删除私钥文件和数据库中的登记
+func (s *fileStore) Destroy(keyID string) error {
+	if err := s.remove(keyID); err != nil {
+		return err
+	}
+	return models.DeletePrivateKey(keyID)
+}
+
+// Rewrap 将令牌目录中所有私钥文件的数据密钥改由当前主密钥加密，返回处理的私钥数量
+func (s *fileStore) Rewrap() (int, error) {
+	current := kek.Current()
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.key"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, path := range paths {
+		env, err := s.read(strings.TrimSuffix(filepath.Base(path), ".key"))
+		if err != nil {
+			return n, err
+		}
+		if env.KekVersion == current {
+			continue
+		}
+		record := env.record()
+		if err := kek.Rewrap(record); err != nil {
+			return n, fmt.Errorf("failed to rewrap private key %s: %v", env.KeyID, err)
+		}
+		if err := s.write(newEnvelope(record)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,211 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"spki/src/config"
+	"spki/src/kek"
+	"spki/src/models"
+	"sync"
+)
+
+// 私钥存储类型，记录在 PrivateKey.Backend 中
+const (
+	BackendDB   = "db"
+	BackendFile = "file"
+)
+
+var (
+	ErrKeyNotFound        = errors.New("private key not found")
+	ErrExportForbidden    = errors.New("private key can not be exported from its key store")
+	ErrDecryptUnsupported = errors.New("private key does not support decryption")
+)
+
+// KeyStore 私钥存储。私钥在存储中生成或导入并保存后，只能通过私钥 ID 获取 crypto.Signer 使用
+type KeyStore interface {
+	// Generate 生成私钥，algo：rsa，ecdsa，ed25519，私钥记录由 Key.Save 保存
+	Generate(algo string, size int) (*Key, error)
+	// Import 导入已有私钥，私钥记录由 Key.Save 保存
+	Import(key crypto.Signer) (*Key, error)
+	// Signer 根据私钥 ID 获取签名者
+	Signer(keyID string) (crypto.Signer, error)
+	// Destroy 销毁私钥
+	Destroy(keyID string) error
+}
+
+// Key 已生成或导入、尚未在数据库中登记的私钥
+// 私钥记录由 Save 在保存证书的事务中写入，事务回滚时调用 Discard 清理保存在数据库之外的私钥
+type Key struct {
+	ID      string
+	Signer  crypto.Signer
+	record  models.PrivateKey
+	discard func() error // 清理数据库之外的私钥，数据库存储为 nil
+}
+
+// Save 在事务中保存私钥记录
+func (k *Key) Save(tx models.Repository) error {
+	return tx.InstallPrivateKey(k.record)
+}
+
+// Discard 丢弃未能保存的私钥，数据库中的私钥记录随事务回滚，只需删除软件令牌中的私钥文件
+func (k *Key) Discard() error {
+	if k.discard == nil {
+		return nil
+	}
+	return k.discard()
+}
+
+// Exporter 允许导出私钥的存储，用于 spki 为用户生成的末端证书私钥
+type Exporter interface {
+	Export(keyID string) (crypto.Signer, error)
+}
+
+// Rewrapper 自行保存私钥密文的存储，主密钥轮换后需要重新加密其中的私钥
+type Rewrapper interface {
+	Rewrap() (int, error)
+}
+
+// stores 已初始化的私钥存储，caBackend 为保管 CA 私钥的存储
+var stores = struct {
+	sync.RWMutex
+	m         map[string]KeyStore
+	caBackend string
+}{m: map[string]KeyStore{BackendDB: &dbStore{}}, caBackend: BackendDB}
+
+// Init 根据配置初始化私钥存储，数据库存储始终可用
+func Init(cfg *config.KeyStore) error {
+	m := map[string]KeyStore{BackendDB: &dbStore{}}
+	caBackend := cfg.Type
+	switch caBackend {
+	case "", BackendDB:
+		caBackend = BackendDB
+	case BackendFile:
+	default:
+		return fmt.Errorf("unsupported key store: %s", cfg.Type)
+	}
+	if cfg.Dir != "" {
+		fs, err := newFileStore(cfg.Dir)
+		if err != nil {
+			return err
+		}
+		m[BackendFile] = fs
+	} else if caBackend == BackendFile {
+		return errors.New("keystore.dir is required by file key store")
+	}
+
+	stores.Lock()
+	stores.m = m
+	stores.caBackend = caBackend
+	stores.Unlock()
+	return nil
+}
+
+// backend 根据名称获取私钥存储
+func backend(name string) (KeyStore, error) {
+	if name == "" {
+		name = BackendDB
+	}
+	stores.RLock()
+	defer stores.RUnlock()
+	ks, ok := stores.m[name]
+	if !ok {
+		return nil, fmt.Errorf("key store %s is not configured", name)
+	}
+	return ks, nil
+}
+
+// CA 返回保管 CA 私钥的存储
+func CA() KeyStore {
+	stores.RLock()
+	defer stores.RUnlock()
+	return stores.m[stores.caBackend]
+}
+
+// Exportable 返回允许导出私钥的存储
+func Exportable() KeyStore {
+	ks, _ := backend(BackendDB)
+	return ks
+}
+
+// lookup 根据私钥 ID 查找其所在的存储
+func lookup(keyID string) (KeyStore, error) {
+	record, err := models.FindPrivateKeyByKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if record.ID == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	return backend(record.Backend)
+}
+
+// Signer 根据私钥 ID 获取签名者，无需关心私钥所在的存储
+func Signer(keyID string) (crypto.Signer, error) {
+	ks, err := lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return ks.Signer(keyID)
+}
+
+// Decrypter 根据私钥 ID 获取解密者，只有 RSA 私钥支持解密，用于 SCEP 等以 CA 证书加密请求的协议
+func Decrypter(keyID string) (crypto.Decrypter, error) {
+	signer, err := Signer(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, ErrDecryptUnsupported
+	}
+	decrypter, ok := signer.(crypto.Decrypter)
+	if !ok {
+		return nil, ErrDecryptUnsupported
+	}
+	return decrypter, nil
+}
+
+// Export 导出私钥，私钥所在的存储不允许导出时返回 ErrExportForbidden
+func Export(keyID string) (crypto.Signer, error) {
+	ks, err := lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+	exporter, ok := ks.(Exporter)
+	if !ok {
+		return nil, ErrExportForbidden
+	}
+	return exporter.Export(keyID)
+}
+
+// Destroy 销毁私钥
+func Destroy(keyID string) error {
+	ks, err := lookup(keyID)
+	if err != nil {
+		return err
+	}
+	return ks.Destroy(keyID)
+}
+
+// RewrapAll 将数据库和各私钥存储中的私钥改由当前主密钥加密，返回处理的私钥数量
+func RewrapAll() (int, error) {
+	n, err := kek.RewrapAll()
+	if err != nil {
+		return n, err
+	}
+	stores.RLock()
+	defer stores.RUnlock()
+	for _, ks := range stores.m {
+		rewrapper, ok := ks.(Rewrapper)
+		if !ok {
+			continue
+		}
+		m, err := rewrapper.Rewrap()
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,137 @@
+package keystore_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/kek"
+	"spki/src/keystore"
+	"spki/src/models"
+	"testing"
+)
+
+// initKek 加载版本 1 和 2 的主密钥，current 为加密新私钥使用的版本
+func initKek(t *testing.T, current int) {
+	for _, env := range []string{"SPKI_TEST_KEK_V1", "SPKI_TEST_KEK_V2"} {
+		if _, ok := os.LookupEnv(env); !ok {
+			key := make([]byte, 32)
+			rand.Read(key)
+			t.Setenv(env, base64.StdEncoding.EncodeToString(key))
+		}
+	}
+	err := kek.Init(&config.Kek{Current: current, Keys: []config.MasterKey{
+		{Version: 1, Env: "SPKI_TEST_KEK_V1"},
+		{Version: 2, Env: "SPKI_TEST_KEK_V2"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { kek.Init(&config.Kek{AllowPlaintext: true}) })
+}
+
+// generate 在私钥存储中生成并保存私钥，返回私钥 ID
+func generate(t *testing.T, ks keystore.KeyStore) string {
+	t.Helper()
+	key, err := ks.Generate("ecdsa", 256)
+	if err == nil {
+		err = key.Save(models.Repo())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.ID
+}
+
+// sign 使用私钥签名，检查私钥仍可解密使用
+func sign(t *testing.T, keyID string) {
+	t.Helper()
+	signer, err := keystore.Signer(keyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("spki"))
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewrapAll(t *testing.T) {
+	testenv.Open(t)
+	initKek(t, 1)
+	dir := t.TempDir()
+	if err := keystore.Init(&config.KeyStore{Type: keystore.BackendFile, Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { keystore.Init(&config.KeyStore{}) })
+	dbKey := generate(t, keystore.Exportable())
+	fileKey := generate(t, keystore.CA())
+
+	// 轮换主密钥后两个存储中的私钥都改由版本 2 加密
+	initKek(t, 2)
+	n, err := keystore.RewrapAll()
+	if err != nil || n != 2 {
+		t.Fatalf("rewrap = %d, %v", n, err)
+	}
+	record, err := models.FindPrivateKeyByKeyID(dbKey)
+	if err != nil || record.KekVersion != 2 {
+		t.Fatalf("db key = %+v, %v", record, err)
+	}
+	var env struct {
+		KekVersion int `json:"kek_version"`
+	}
+	data, err := os.ReadFile(filepath.Join(dir, fileKey+".key"))
+	if err == nil {
+		err = json.Unmarshal(data, &env)
+	}
+	if err != nil || env.KekVersion != 2 {
+		t.Fatalf("file key = %+v, %v", env, err)
+	}
+	if n, err := keystore.RewrapAll(); err != nil || n != 0 {
+		t.Fatalf("second rewrap = %d, %v", n, err)
+	}
+
+	// 退役版本 1 后私钥仍可使用，文件私钥需要重新从文件加载
+	if err := kek.Init(&config.Kek{Current: 2, Keys: []config.MasterKey{{Version: 2, Env: "SPKI_TEST_KEK_V2"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := keystore.Init(&config.KeyStore{Type: keystore.BackendFile, Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	sign(t, dbKey)
+	sign(t, fileKey)
+}
+
+func TestDiscard(t *testing.T) {
+	db := testenv.Open(t)
+	dir := t.TempDir()
+	if err := keystore.Init(&config.KeyStore{Type: keystore.BackendFile, Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { keystore.Init(&config.KeyStore{}) })
+
+	// 未保存的私钥不在数据库中登记，丢弃后私钥文件被删除
+	for name, ks := range map[string]keystore.KeyStore{"db": keystore.Exportable(), "file": keystore.CA()} {
+		key, err := ks.Generate("ecdsa", 256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := key.Discard(); err != nil {
+			t.Fatalf("%s: discard = %v", name, err)
+		}
+		if _, err := keystore.Signer(key.ID); err == nil {
+			t.Fatalf("%s: discarded key is still usable", name)
+		}
+	}
+	if n := testenv.Count(t, db, "private_key"); n != 0 {
+		t.Fatalf("%d private keys after discard", n)
+	}
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*.key")); len(paths) != 0 {
+		t.Fatalf("private key files after discard: %v", paths)
+	}
+}
@@ -2,21 +2,33 @@ package main
 
 import (
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"log"
+	"os"
 	"spki/gencert"
 	"spki/initca"
+	"spki/profile"
 	"spki/src/config"
-	"spki/src/database/mysql"
+	"spki/src/database"
+	"spki/src/database/migrate"
 	"spki/src/genkey"
+	"spki/src/kek"
+	"spki/src/keystore"
 	"spki/src/route"
+	"spki/src/service/acme"
+	"spki/src/service/alarm"
+	"spki/src/service/audit"
+	"spki/src/service/crl"
+	"spki/src/service/webhook"
 	"spki/src/slog"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app/server"
+	hconfig "github.com/cloudwego/hertz/pkg/common/config"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 )
 
@@ -125,12 +137,10 @@ func init() {
 
 // main main
 func main() {
-	aa := NewCAConfig()
 	// 创建CA私钥
 	caPrivateKey, _ := genkey.GenkeyMain("rsa", 2048)
 	// 创建csr
 	// gencsr.GencsrMain(caPrivateKey)
-	fmt.Print("%+v", aa)
 	initca.InitCA(caPrivateKey)
 	ca := `-----BEGIN CERTIFICATE-----
 MIID6TCCAtGgAwIBAgIQdKK54IEVfDfoNvL5j5JOwzANBgkqhkiG9w0BAQsFADB+
@@ -219,11 +229,66 @@ egWz3xdwB9SnzoKdJwBjo3n6JCcNuQmdfkPujv+8utJOfQcJXyrQ/A==
 	cfg := config.InitConfig()
 	app := cfg.Spki.App
 	slog.InitLog(cfg.Spki.Log.Level)
-	mysql.InitDB(&cfg.Spki.Database)
+	if err := profile.Init(cfg.Spki.Profiles); err != nil {
+		hlog.Error("Invalid signing profiles: ", err)
+		os.Exit(1)
+	}
+	// 执行子命令时不自动迁移，否则 migrate status 和 migrate down 会先执行全部迁移
+	autoMigrate := len(config.Args().Command) == 0 && (cfg.Spki.Database.AutoMigrate || config.Args().AutoMigrate)
+	db, err := database.InitDB(&cfg.Spki.Database, autoMigrate)
+	if err != nil {
+		hlog.Error("Failed to initialize database: ", err)
+		os.Exit(1)
+	}
+	if cmd := config.Args().Command; len(cmd) > 0 { // 子命令，如 spki migrate up
+		if cmd[0] != "migrate" {
+			hlog.Error("Unknown command: ", cmd[0])
+			os.Exit(2)
+		}
+		if err := migrate.Run(db, cmd[1:]); err != nil {
+			hlog.Error("Migration failed: ", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err := kek.Init(&cfg.Spki.Kek); err != nil {
+		hlog.Error("Failed to load master keys: ", err)
+		os.Exit(1)
+	}
+	if err := keystore.Init(&cfg.Spki.KeyStore); err != nil {
+		hlog.Error("Failed to initialize key store: ", err)
+		os.Exit(1)
+	}
+	if config.Args().Rewrap { // 主密钥轮换后重新加密私钥
+		n, err := keystore.RewrapAll()
+		if err != nil {
+			hlog.Errorf("Rewrapped %d private keys before failure: %v", n, err)
+			os.Exit(1)
+		}
+		hlog.Infof("Rewrapped %d private keys.", n)
+		os.Exit(0)
+	}
 	hlog.Info("start server")
-	// 自动建表
-	//mysql.AutoMigrateDB()
-	h := server.Default(server.WithHostPorts(app.Bind), server.WithExitWaitTime(0*time.Second))
+	opts := []hconfig.Option{server.WithHostPorts(app.Bind), server.WithExitWaitTime(0 * time.Second)}
+	if app.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(app.TLS.CertFile, app.TLS.KeyFile)
+		if err != nil {
+			hlog.Error("Failed to load TLS certificate: ", err)
+			os.Exit(1)
+		}
+		// 只请求客户端证书，由 EST 等接口根据各自信任的签发者校验
+		opts = append(opts, server.WithTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequestClientCert,
+			MinVersion:   tls.VersionTLS12,
+		}))
+	}
+	h := server.Default(opts...)
 	route.Routes(h)
+	audit.Start()
+	crl.Start()
+	webhook.Start()
+	alarm.Start()
+	acme.Init()
 	h.Spin()
 }
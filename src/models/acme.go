@@ -0,0 +1,195 @@
+package models
+
+func InstallAcmeAccount(data AcmeAccount) error {
+	return repo.InstallAcmeAccount(data)
+}
+
+func (r *gormRepository) InstallAcmeAccount(data AcmeAccount) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindAcmeAccount 根据账户 ID 查询 ACME 账户，不存在时返回的 ID 为 0
+func FindAcmeAccount(accountID string) (*AcmeAccount, error) {
+	return repo.FindAcmeAccount(accountID)
+}
+
+func (r *gormRepository) FindAcmeAccount(accountID string) (*AcmeAccount, error) {
+	var t AcmeAccount
+	err := r.db.Model(&AcmeAccount{}).Where("account_id=?", accountID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindAcmeAccountByThumbprint 根据账户公钥指纹查询 ACME 账户，不存在时返回的 ID 为 0
+func FindAcmeAccountByThumbprint(thumbprint string) (*AcmeAccount, error) {
+	return repo.FindAcmeAccountByThumbprint(thumbprint)
+}
+
+func (r *gormRepository) FindAcmeAccountByThumbprint(thumbprint string) (*AcmeAccount, error) {
+	var t AcmeAccount
+	err := r.db.Model(&AcmeAccount{}).Where("thumbprint=?", thumbprint).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// UpdateAcmeAccount 更新 ACME 账户的公钥、联系方式和状态
+func UpdateAcmeAccount(data AcmeAccount) error {
+	return repo.UpdateAcmeAccount(data)
+}
+
+func (r *gormRepository) UpdateAcmeAccount(data AcmeAccount) error {
+	return r.db.Model(&AcmeAccount{}).Where("account_id=?", data.AccountID).Updates(map[string]interface{}{
+		"thumbprint": data.Thumbprint,
+		"jwk":        data.Jwk,
+		"contact":    data.Contact,
+		"status":     data.Status,
+	}).Error
+}
+
+func InstallAcmeOrder(data AcmeOrder) error {
+	return repo.InstallAcmeOrder(data)
+}
+
+func (r *gormRepository) InstallAcmeOrder(data AcmeOrder) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindAcmeOrder 根据订单 ID 查询 ACME 订单，不存在时返回的 ID 为 0
+func FindAcmeOrder(orderID string) (*AcmeOrder, error) {
+	return repo.FindAcmeOrder(orderID)
+}
+
+func (r *gormRepository) FindAcmeOrder(orderID string) (*AcmeOrder, error) {
+	var t AcmeOrder
+	err := r.db.Model(&AcmeOrder{}).Where("order_id=?", orderID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindAcmeOrderByCertID 查询签发证书的 ACME 订单，不存在时返回的 ID 为 0
+func FindAcmeOrderByCertID(certID string) (*AcmeOrder, error) {
+	return repo.FindAcmeOrderByCertID(certID)
+}
+
+func (r *gormRepository) FindAcmeOrderByCertID(certID string) (*AcmeOrder, error) {
+	var t AcmeOrder
+	err := r.db.Model(&AcmeOrder{}).Where("certid=?", certID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindAcmeOrdersByAccount 查询账户的所有订单，按创建顺序排列
+func FindAcmeOrdersByAccount(accountID string) ([]AcmeOrder, error) {
+	return repo.FindAcmeOrdersByAccount(accountID)
+}
+
+func (r *gormRepository) FindAcmeOrdersByAccount(accountID string) ([]AcmeOrder, error) {
+	var t []AcmeOrder
+	err := r.db.Model(&AcmeOrder{}).Where("account_id=?", accountID).Order("id").Find(&t).Error
+	return t, err
+}
+
+// UpdateAcmeOrder 更新 ACME 订单的状态、失败原因和签发的证书
+func UpdateAcmeOrder(data AcmeOrder) error {
+	return repo.UpdateAcmeOrder(data)
+}
+
+func (r *gormRepository) UpdateAcmeOrder(data AcmeOrder) error {
+	return r.db.Model(&AcmeOrder{}).Where("order_id=?", data.OrderID).Updates(map[string]interface{}{
+		"status": data.Status,
+		"error":  data.Error,
+		"certid": data.CertID,
+	}).Error
+}
+
+// UpdateAcmeOrderStatus 订单处于 from 状态时更新为 to 状态，返回是否更新，用于并发请求中只有一个请求能改变订单状态
+func UpdateAcmeOrderStatus(orderID, from, to string) (bool, error) {
+	return repo.UpdateAcmeOrderStatus(orderID, from, to)
+}
+
+func (r *gormRepository) UpdateAcmeOrderStatus(orderID, from, to string) (bool, error) {
+	result := r.db.Model(&AcmeOrder{}).Where("order_id=? AND status=?", orderID, from).Update("status", to)
+	return result.RowsAffected > 0, result.Error
+}
+
+func InstallAcmeAuthorization(data AcmeAuthorization) error {
+	return repo.InstallAcmeAuthorization(data)
+}
+
+func (r *gormRepository) InstallAcmeAuthorization(data AcmeAuthorization) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindAcmeAuthorization 根据授权 ID 查询 ACME 授权，不存在时返回的 ID 为 0
+func FindAcmeAuthorization(authzID string) (*AcmeAuthorization, error) {
+	return repo.FindAcmeAuthorization(authzID)
+}
+
+func (r *gormRepository) FindAcmeAuthorization(authzID string) (*AcmeAuthorization, error) {
+	var t AcmeAuthorization
+	err := r.db.Model(&AcmeAuthorization{}).Where("authz_id=?", authzID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindAcmeAuthorizationsByOrder 查询订单的所有授权，按创建顺序排列
+func FindAcmeAuthorizationsByOrder(orderID string) ([]AcmeAuthorization, error) {
+	return repo.FindAcmeAuthorizationsByOrder(orderID)
+}
+
+func (r *gormRepository) FindAcmeAuthorizationsByOrder(orderID string) ([]AcmeAuthorization, error) {
+	var t []AcmeAuthorization
+	err := r.db.Model(&AcmeAuthorization{}).Where("order_id=?", orderID).Order("id").Find(&t).Error
+	return t, err
+}
+
+// UpdateAcmeAuthorizationStatus 更新 ACME 授权的状态
+func UpdateAcmeAuthorizationStatus(authzID, status string) error {
+	return repo.UpdateAcmeAuthorizationStatus(authzID, status)
+}
+
+func (r *gormRepository) UpdateAcmeAuthorizationStatus(authzID, status string) error {
+	return r.db.Model(&AcmeAuthorization{}).Where("authz_id=?", authzID).Update("status", status).Error
+}
+
+func InstallAcmeChallenge(data AcmeChallenge) error {
+	return repo.InstallAcmeChallenge(data)
+}
+
+func (r *gormRepository) InstallAcmeChallenge(data AcmeChallenge) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindAcmeChallenge 根据质询 ID 查询 ACME 质询，不存在时返回的 ID 为 0
+func FindAcmeChallenge(challengeID string) (*AcmeChallenge, error) {
+	return repo.FindAcmeChallenge(challengeID)
+}
+
+func (r *gormRepository) FindAcmeChallenge(challengeID string) (*AcmeChallenge, error) {
+	var t AcmeChallenge
+	err := r.db.Model(&AcmeChallenge{}).Where("challenge_id=?", challengeID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindAcmeChallengesByAuthorization 查询授权的所有质询，按创建顺序排列
+func FindAcmeChallengesByAuthorization(authzID string) ([]AcmeChallenge, error) {
+	return repo.FindAcmeChallengesByAuthorization(authzID)
+}
+
+func (r *gormRepository) FindAcmeChallengesByAuthorization(authzID string) ([]AcmeChallenge, error) {
+	var t []AcmeChallenge
+	err := r.db.Model(&AcmeChallenge{}).Where("authz_id=?", authzID).Order("id").Find(&t).Error
+	return t, err
+}
+
+// UpdateAcmeChallenge 更新 ACME 质询的状态、验证时间和失败原因
+func UpdateAcmeChallenge(data AcmeChallenge) error {
+	return repo.UpdateAcmeChallenge(data)
+}
+
+func (r *gormRepository) UpdateAcmeChallenge(data AcmeChallenge) error {
+	return r.db.Model(&AcmeChallenge{}).Where("challenge_id=?", data.ChallengeID).Updates(map[string]interface{}{
+		"status":    data.Status,
+		"validated": data.Validated,
+		"error":     data.Error,
+	}).Error
+}
@@ -1,8 +1,161 @@
 package models
 
-import "spki/src/database/mysql"
+import (
+	"strings"
+	"time"
+)
 
 func CreateCertificate(data Certificate) error {
-	err := mysql.OrmDB.Create(&data).Error
+	return repo.CreateCertificate(data)
+}
+
+func (r *gormRepository) CreateCertificate(data Certificate) error {
+	err := r.db.Create(&data).Error
 	return err
 }
+
+// FindCertificateByCertID 根据证书 ID 查询证书，不存在时返回的 CertID 为 nil
+func FindCertificateByCertID(certID string) (*Certificate, error) {
+	return repo.FindCertificateByCertID(certID)
+}
+
+func (r *gormRepository) FindCertificateByCertID(certID string) (*Certificate, error) {
+	var t Certificate
+	err := r.db.Model(&Certificate{}).Where("certid=?", certID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// UpdateCertificateState 更新证书状态
+func UpdateCertificateState(certID, state string) error {
+	return repo.UpdateCertificateState(certID, state)
+}
+
+func (r *gormRepository) UpdateCertificateState(certID, state string) error {
+	return r.db.Model(&Certificate{}).Where("certid=?", certID).Update("state", state).Error
+}
+
+// FindCertificatesByGenreAndState 按证书类型和状态查询证书
+func FindCertificatesByGenreAndState(genre int, state string) ([]Certificate, error) {
+	return repo.FindCertificatesByGenreAndState(genre, state)
+}
+
+func (r *gormRepository) FindCertificatesByGenreAndState(genre int, state string) ([]Certificate, error) {
+	var t []Certificate
+	err := r.db.Model(&Certificate{}).Where("genre=? AND state=?", genre, state).Find(&t).Error
+	return t, err
+}
+
+// UpdateCertificateURLs 更新 CA 签发证书时写入的地址，nil 表示恢复为默认值
+func UpdateCertificateURLs(certID string, issuerURL, ocspURL, crlURL *string) error {
+	return repo.UpdateCertificateURLs(certID, issuerURL, ocspURL, crlURL)
+}
+
+func (r *gormRepository) UpdateCertificateURLs(certID string, issuerURL, ocspURL, crlURL *string) error {
+	return r.db.Model(&Certificate{}).Where("certid=?", certID).Updates(map[string]interface{}{
+		"issuer_url": issuerURL,
+		"ocsp_url":   ocspURL,
+		"crl_url":    crlURL,
+	}).Error
+}
+
+// CertificateFilter 证书列表的查询条件，零值表示不按该条件过滤
+type CertificateFilter struct {
+	UserID       string
+	Genre        int
+	State        string // 证书状态，StateExpired 为最新版本已到期的有效证书
+	ParentID     string
+	Subject      string // 证书主题包含的字符串
+	ExactSubject string // 证书主题，完全匹配
+	San          string // 使用者可选名称包含的字符串
+	ExpireAfter  int64  // 到期时间不早于该时间戳
+	ExpireBefore int64  // 到期时间早于该时间戳
+	OrderBy      string // 排序字段：expiration_time，create_time
+	Desc         bool
+	Offset       int
+	Limit        int
+}
+
+// CertificateItem 证书及其最新版本
+type CertificateItem struct {
+	Certificate
+	Serial         string `gorm:"column:serial"`
+	EffectiveTime  int64  `gorm:"column:effective_time"`
+	ExpirationTime int64  `gorm:"column:expiration_time"`
+	RevocationTime int64  `gorm:"column:revocation_time"`
+}
+
+// FindCertificates 按条件分页查询证书及其最新版本，返回当前页和总数。
+// 数据库不记录过期状态，最新版本已到期的有效证书的状态返回为 StateExpired
+func FindCertificates(filter CertificateFilter) ([]CertificateItem, int64, error) {
+	return repo.FindCertificates(filter)
+}
+
+// likePattern 以 ! 转义 LIKE 的通配符，返回包含匹配的模式。MySQL 和 SQLite 的默认转义字符不同，因此显式指定
+func likePattern(s string) string {
+	s = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+	return "%" + s + "%"
+}
+
+func (r *gormRepository) FindCertificates(filter CertificateFilter) ([]CertificateItem, int64, error) {
+	query := r.db.Model(&Certificate{}).
+		Joins("JOIN version ON version.certid = certificate.certid AND version.id = (SELECT MAX(v.id) FROM version v WHERE v.certid = certificate.certid)")
+	if filter.UserID != "" {
+		query = query.Where("certificate.user_id=?", filter.UserID)
+	}
+	if filter.Genre != 0 {
+		query = query.Where("certificate.genre=?", filter.Genre)
+	}
+	now := time.Now().UnixMilli()
+	switch filter.State {
+	case "":
+	case StateValid:
+		query = query.Where("certificate.state=? AND version.expiration_time > ?", StateValid, now)
+	case StateExpired:
+		query = query.Where("certificate.state=? AND version.expiration_time <= ?", StateValid, now)
+	default:
+		query = query.Where("certificate.state=?", filter.State)
+	}
+	if filter.ParentID != "" {
+		query = query.Where("certificate.parent_id=?", filter.ParentID)
+	}
+	if filter.Subject != "" {
+		query = query.Where(`certificate.subject LIKE ? ESCAPE '!'`, likePattern(filter.Subject))
+	}
+	if filter.ExactSubject != "" {
+		query = query.Where("certificate.subject = ?", filter.ExactSubject)
+	}
+	if filter.San != "" {
+		query = query.Where(`certificate.sans LIKE ? ESCAPE '!'`, likePattern(filter.San))
+	}
+	if filter.ExpireAfter > 0 {
+		query = query.Where("version.expiration_time >= ?", filter.ExpireAfter)
+	}
+	if filter.ExpireBefore > 0 {
+		query = query.Where("version.expiration_time < ?", filter.ExpireBefore)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "version.expiration_time"
+	if filter.OrderBy == "create_time" {
+		order = "certificate.create_time"
+	}
+	if filter.Desc {
+		order += " desc"
+	}
+	var t []CertificateItem
+	err := query.Select("certificate.*, version.serial, version.effective_time, version.expiration_time, version.revocation_time").
+		Order(order).Order("certificate.id").
+		Offset(filter.Offset).Limit(filter.Limit).
+		Find(&t).Error
+	for i := range t {
+		if t[i].State != nil && *t[i].State == StateValid && t[i].ExpirationTime <= now {
+			state := StateExpired
+			t[i].State = &state
+		}
+	}
+	return t, total, err
+}
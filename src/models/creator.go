@@ -1,17 +1,21 @@
 package models
 
-import (
-	"spki/src/database/mysql"
-)
-
 func FindByCreatorForIdFormDB(UserId string) (*Creator, error) {
+	return repo.FindByCreatorForIdFormDB(UserId)
+}
+
+func (r *gormRepository) FindByCreatorForIdFormDB(UserId string) (*Creator, error) {
 	var t Creator
-	err := mysql.OrmDB.Model(&Creator{}).Where("user_id=?", UserId).Find(&t).Error
+	err := r.db.Model(&Creator{}).Where("user_id=?", UserId).Find(&t).Error
 	return &t, err
 }
 
 func InstallCreator(UserId, Name string) error {
+	return repo.InstallCreator(UserId, Name)
+}
+
+func (r *gormRepository) InstallCreator(UserId, Name string) error {
 	data := Creator{UserID: &UserId, Name: &Name}
-	err := mysql.OrmDB.Create(&data).Error
+	err := r.db.Create(&data).Error
 	return err
 }
@@ -0,0 +1,30 @@
+package models
+
+func InstallCrl(data Crl) error {
+	return repo.InstallCrl(data)
+}
+
+func (r *gormRepository) InstallCrl(data Crl) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindLatestCrl 查询 CA 最新生成的 CRL，不存在时返回的 ID 为 0
+func FindLatestCrl(certID string) (*Crl, error) {
+	return repo.FindLatestCrl(certID)
+}
+
+func (r *gormRepository) FindLatestCrl(certID string) (*Crl, error) {
+	var t Crl
+	err := r.db.Model(&Crl{}).Where("certid=?", certID).Order("number desc").Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// DeleteCrlsBefore 删除 CA 编号小于 number 的 CRL，只保留最新生成的 CRL
+func DeleteCrlsBefore(certID string, number int64) error {
+	return repo.DeleteCrlsBefore(certID, number)
+}
+
+func (r *gormRepository) DeleteCrlsBefore(certID string, number int64) error {
+	return r.db.Where("certid=? AND number<?", certID, number).Delete(&Crl{}).Error
+}
@@ -1,8 +1,54 @@
 package models
 
-import "spki/src/database/mysql"
-
 func InstallPrivateKey(data PrivateKey) error {
-	err := mysql.OrmDB.Create(&data).Error
+	return repo.InstallPrivateKey(data)
+}
+
+func (r *gormRepository) InstallPrivateKey(data PrivateKey) error {
+	err := r.db.Create(&data).Error
 	return err
 }
+
+// FindPrivateKeyByKeyID 根据私钥 ID 查询私钥，不存在时返回的 ID 为 0
+func FindPrivateKeyByKeyID(keyID string) (*PrivateKey, error) {
+	return repo.FindPrivateKeyByKeyID(keyID)
+}
+
+func (r *gormRepository) FindPrivateKeyByKeyID(keyID string) (*PrivateKey, error) {
+	var t PrivateKey
+	err := r.db.Model(&PrivateKey{}).Where("keyid=?", keyID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindPrivateKeysNotInKekVersion 查询保存在数据库中且不是由指定版本主密钥加密的私钥
+func FindPrivateKeysNotInKekVersion(version int) ([]PrivateKey, error) {
+	return repo.FindPrivateKeysNotInKekVersion(version)
+}
+
+func (r *gormRepository) FindPrivateKeysNotInKekVersion(version int) ([]PrivateKey, error) {
+	var t []PrivateKey
+	err := r.db.Model(&PrivateKey{}).Where("kek_version<>? AND (backend IS NULL OR backend='db')", version).Find(&t).Error
+	return t, err
+}
+
+// UpdatePrivateKeyEnvelope 更新私钥的密文、数据密钥和主密钥版本
+func UpdatePrivateKeyEnvelope(data PrivateKey) error {
+	return repo.UpdatePrivateKeyEnvelope(data)
+}
+
+func (r *gormRepository) UpdatePrivateKeyEnvelope(data PrivateKey) error {
+	return r.db.Model(&PrivateKey{}).Where("id=?", data.ID).Updates(map[string]interface{}{
+		"private_key": data.PrivateKey,
+		"data_key":    data.DataKey,
+		"kek_version": data.KekVersion,
+	}).Error
+}
+
+// DeletePrivateKey 删除私钥
+func DeletePrivateKey(keyID string) error {
+	return repo.DeletePrivateKey(keyID)
+}
+
+func (r *gormRepository) DeletePrivateKey(keyID string) error {
+	return r.db.Where("keyid=?", keyID).Delete(&PrivateKey{}).Error
+}
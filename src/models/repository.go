@@ -0,0 +1,103 @@
+package models
+
+import "gorm.io/gorm"
+
+// Repository 数据存储接口，覆盖创建者、证书、私钥、证书版本、CRL、Webhook 事件和 ACME 对象的读写
+type Repository interface {
+	FindByCreatorForIdFormDB(UserId string) (*Creator, error)
+	InstallCreator(UserId, Name string) error
+
+	CreateCertificate(data Certificate) error
+	FindCertificateByCertID(certID string) (*Certificate, error)
+	UpdateCertificateState(certID, state string) error
+	FindCertificatesByGenreAndState(genre int, state string) ([]Certificate, error)
+	UpdateCertificateURLs(certID string, issuerURL, ocspURL, crlURL *string) error
+	FindCertificates(filter CertificateFilter) ([]CertificateItem, int64, error)
+
+	InstallPrivateKey(data PrivateKey) error
+	FindPrivateKeyByKeyID(keyID string) (*PrivateKey, error)
+	FindPrivateKeysNotInKekVersion(version int) ([]PrivateKey, error)
+	UpdatePrivateKeyEnvelope(data PrivateKey) error
+	DeletePrivateKey(keyID string) error
+
+	InstallCertVersion(data Version) error
+	FindLatestCertVersion(certID string) (*Version, error)
+	FindCertVersionBySerial(serial string) (*Version, error)
+	FindCertVersions(certID string) ([]Version, error)
+	RevokeCertVersion(id int, revocationTime int64, code int, invalidityTime int64) (bool, error)
+	FindRevokedCertVersions(caCertID string, now int64) ([]Version, error)
+	FindExpiringCertVersions(after, before int64) ([]ExpiringVersion, error)
+	UpdateCertVersionAlarm(id, alarm int) error
+
+	InstallCrl(data Crl) error
+	FindLatestCrl(certID string) (*Crl, error)
+	DeleteCrlsBefore(certID string, number int64) error
+
+	InstallWebhookEvent(data WebhookEvent) error
+	FindDueWebhookEvents(now int64, limit int) ([]WebhookEvent, error)
+	UpdateWebhookEvent(data WebhookEvent) error
+	DeleteWebhookEvent(id int) error
+
+	InstallAcmeAccount(data AcmeAccount) error
+	FindAcmeAccount(accountID string) (*AcmeAccount, error)
+	FindAcmeAccountByThumbprint(thumbprint string) (*AcmeAccount, error)
+	UpdateAcmeAccount(data AcmeAccount) error
+
+	InstallAcmeOrder(data AcmeOrder) error
+	FindAcmeOrder(orderID string) (*AcmeOrder, error)
+	FindAcmeOrderByCertID(certID string) (*AcmeOrder, error)
+	FindAcmeOrdersByAccount(accountID string) ([]AcmeOrder, error)
+	UpdateAcmeOrder(data AcmeOrder) error
+	UpdateAcmeOrderStatus(orderID, from, to string) (bool, error)
+
+	InstallAcmeAuthorization(data AcmeAuthorization) error
+	FindAcmeAuthorization(authzID string) (*AcmeAuthorization, error)
+	FindAcmeAuthorizationsByOrder(orderID string) ([]AcmeAuthorization, error)
+	UpdateAcmeAuthorizationStatus(authzID, status string) error
+
+	InstallAcmeChallenge(data AcmeChallenge) error
+	FindAcmeChallenge(challengeID string) (*AcmeChallenge, error)
+	FindAcmeChallengesByAuthorization(authzID string) ([]AcmeChallenge, error)
+	UpdateAcmeChallenge(data AcmeChallenge) error
+
+	InstallScepTransaction(data ScepTransaction) error
+	FindScepTransaction(transactionID string) (*ScepTransaction, error)
+	UpdateScepTransaction(data ScepTransaction) error
+
+	// Transaction 在同一个事务中执行 fn，fn 返回错误时回滚，fn 中只能使用传入的 tx 读写数据
+	Transaction(fn func(tx Repository) error) error
+}
+
+// repo 当前使用的数据存储，由 SetRepository 设置
+var repo Repository
+
+// SetRepository 设置数据存储，本包的查询函数均通过它读写数据
+func SetRepository(r Repository) {
+	repo = r
+}
+
+// Repo 返回当前使用的数据存储
+func Repo() Repository {
+	return repo
+}
+
+// Transaction 在同一个事务中执行 fn，所有写入一起提交或一起回滚
+func Transaction(fn func(tx Repository) error) error {
+	return repo.Transaction(fn)
+}
+
+// gormRepository 基于 gorm 的数据存储，MySQL 和 SQLite 共用
+type gormRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRepository 创建基于 gorm 的数据存储
+func NewGormRepository(db *gorm.DB) Repository {
+	return &gormRepository{db: db}
+}
+
+func (r *gormRepository) Transaction(fn func(tx Repository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormRepository{db: tx})
+	})
+}
@@ -0,0 +1,289 @@
+package models_test
+
+import (
+	"errors"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"testing"
+	"time"
+)
+
+// newCert 保存证书和一个版本，返回证书 ID
+func newCert(t *testing.T, certID, parentID, subject string, expiration int64) string {
+	t.Helper()
+	userID, state := testenv.UserID, models.StateValid
+	pathlev, genre := 1, models.GenreLeaf
+	record := models.Certificate{
+		CertID:     &certID,
+		UserID:     &userID,
+		State:      &state,
+		Subject:    &subject,
+		Pathlev:    &pathlev,
+		Genre:      &genre,
+		CreateTime: time.Now().UnixMilli(),
+	}
+	if parentID != "" {
+		record.ParentID = &parentID
+	}
+	if err := models.CreateCertificate(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.InstallCertVersion(models.Version{CertID: certID, Serial: certID + "01", ExpirationTime: expiration}); err != nil {
+		t.Fatal(err)
+	}
+	return certID
+}
+
+func TestCreator(t *testing.T) {
+	testenv.Open(t)
+	if err := models.InstallCreator(testenv.UserID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	creator, err := models.FindByCreatorForIdFormDB(testenv.UserID)
+	if err != nil || creator.Name == nil || *creator.Name != "alice" {
+		t.Fatalf("creator = %+v, %v", creator, err)
+	}
+	if err := models.InstallCreator(testenv.UserID, "bob"); err == nil {
+		t.Fatal("duplicate user_id was accepted")
+	}
+	missing, err := models.FindByCreatorForIdFormDB("missing")
+	if err != nil || missing.UserID != nil {
+		t.Fatalf("missing creator = %+v, %v", missing, err)
+	}
+}
+
+func TestCertificateVersions(t *testing.T) {
+	testenv.Open(t)
+	future := time.Now().Add(time.Hour).UnixMilli()
+	newCert(t, "c1", "ca", "/CN=one", future)
+	if err := models.InstallCertVersion(models.Version{CertID: "c1", Serial: "c102", ExpirationTime: future}); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := models.FindLatestCertVersion("c1")
+	if err != nil || latest.Serial != "c102" {
+		t.Fatalf("latest = %+v, %v", latest, err)
+	}
+	versions, err := models.FindCertVersions("c1")
+	if err != nil || len(versions) != 2 || versions[0].Serial != "c101" {
+		t.Fatalf("versions = %+v, %v", versions, err)
+	}
+	bySerial, err := models.FindCertVersionBySerial("c101")
+	if err != nil || bySerial.ID != versions[0].ID {
+		t.Fatalf("by serial = %+v, %v", bySerial, err)
+	}
+	none, err := models.FindCertVersionBySerial("ff")
+	if err != nil || none.ID != 0 {
+		t.Fatalf("unknown serial = %+v, %v", none, err)
+	}
+
+	if err := models.UpdateCertificateState("c1", models.StateRevoked); err != nil {
+		t.Fatal(err)
+	}
+	record, err := models.FindCertificateByCertID("c1")
+	if err != nil || *record.State != models.StateRevoked {
+		t.Fatalf("record = %+v, %v", record, err)
+	}
+}
+
+func TestRevokeCertVersion(t *testing.T) {
+	testenv.Open(t)
+	now := time.Now().UnixMilli()
+	newCert(t, "c1", "ca", "/CN=one", now+3600000)
+	newCert(t, "c2", "ca", "/CN=two", now-1) // 已过期，不出现在 CRL 中
+	newCert(t, "c3", "other", "/CN=three", now+3600000)
+	for _, certID := range []string{"c1", "c2", "c3"} {
+		v, _ := models.FindLatestCertVersion(certID)
+		if ok, err := models.RevokeCertVersion(v.ID, now, 1, 0); err != nil || !ok {
+			t.Fatalf("revoke %s = %v, %v", certID, ok, err)
+		}
+	}
+
+	v, _ := models.FindLatestCertVersion("c1")
+	ok, err := models.RevokeCertVersion(v.ID, now+1000, 4, 0)
+	if err != nil || ok {
+		t.Fatalf("second revoke = %v, %v", ok, err)
+	}
+	v, _ = models.FindLatestCertVersion("c1")
+	if v.RevocationTime != now || v.RevocationCode != 1 {
+		t.Fatalf("second revoke overwrote the record: %+v", v)
+	}
+
+	revoked, err := models.FindRevokedCertVersions("ca", now)
+	if err != nil || len(revoked) != 1 || revoked[0].CertID != "c1" {
+		t.Fatalf("revoked = %+v, %v", revoked, err)
+	}
+}
+
+func TestFindCertificates(t *testing.T) {
+	testenv.Open(t)
+	now := time.Now().UnixMilli()
+	newCert(t, "c1", "ca", "/CN=www.example.com", now+3*3600000)
+	newCert(t, "c2", "ca", "/CN=100%_off", now+1*3600000)
+	newCert(t, "c3", "other", "/CN=api.example.com", now+2*3600000)
+
+	items, total, err := models.FindCertificates(models.CertificateFilter{ParentID: "ca", Limit: 10})
+	if err != nil || total != 2 || len(items) != 2 || items[0].Serial != "c201" {
+		t.Fatalf("by parent = %+v, %d, %v", items, total, err)
+	}
+	items, total, err = models.FindCertificates(models.CertificateFilter{Subject: "example", Desc: true, Limit: 1})
+	if err != nil || total != 2 || len(items) != 1 || *items[0].CertID != "c1" {
+		t.Fatalf("by subject = %+v, %d, %v", items, total, err)
+	}
+	// LIKE 的通配符按字面匹配
+	_, total, err = models.FindCertificates(models.CertificateFilter{Subject: "0%_", Limit: 10})
+	if err != nil || total != 1 {
+		t.Fatalf("escaped subject = %d, %v", total, err)
+	}
+	// 完全匹配主题时不匹配前缀相同的主题
+	items, total, err = models.FindCertificates(models.CertificateFilter{ExactSubject: "/CN=www.example.com", Limit: 10})
+	if err != nil || total != 1 || *items[0].CertID != "c1" {
+		t.Fatalf("by exact subject = %+v, %d, %v", items, total, err)
+	}
+	if _, total, err = models.FindCertificates(models.CertificateFilter{ExactSubject: "/CN=www.example", Limit: 10}); err != nil || total != 0 {
+		t.Fatalf("by exact subject prefix = %d, %v", total, err)
+	}
+	_, total, err = models.FindCertificates(models.CertificateFilter{ExpireBefore: now + 2*3600000 + 1, Limit: 10})
+	if err != nil || total != 2 {
+		t.Fatalf("expire before = %d, %v", total, err)
+	}
+}
+
+func TestFindExpiringCertVersions(t *testing.T) {
+	testenv.Open(t)
+	now := time.Now().UnixMilli()
+	newCert(t, "c1", "ca", "/CN=one", now+1000)
+	newCert(t, "c2", "ca", "/CN=two", now+2000)
+	// 已续期的证书只检查最新版本
+	if err := models.InstallCertVersion(models.Version{CertID: "c2", Serial: "c202", ExpirationTime: now + 3600000}); err != nil {
+		t.Fatal(err)
+	}
+
+	expiring, err := models.FindExpiringCertVersions(now, now+60000)
+	if err != nil || len(expiring) != 1 || expiring[0].CertID != "c1" || *expiring[0].Subject != "/CN=one" {
+		t.Fatalf("expiring = %+v, %v", expiring, err)
+	}
+	if err := models.UpdateCertVersionAlarm(expiring[0].ID, 7); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := models.FindLatestCertVersion("c1")
+	if v.Alarm != 7 {
+		t.Fatalf("alarm = %d", v.Alarm)
+	}
+}
+
+func TestCrl(t *testing.T) {
+	testenv.Open(t)
+	for n := int64(1); n <= 3; n++ {
+		if err := models.InstallCrl(models.Crl{CertID: "ca", Number: n, Crl: "crl"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.InstallCrl(models.Crl{CertID: "other", Number: 1, Crl: "crl"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DeleteCrlsBefore("ca", 3); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := models.FindLatestCrl("ca")
+	if err != nil || latest.Number != 3 {
+		t.Fatalf("latest = %+v, %v", latest, err)
+	}
+	other, err := models.FindLatestCrl("other")
+	if err != nil || other.ID == 0 {
+		t.Fatalf("CRL of another CA was deleted: %+v, %v", other, err)
+	}
+}
+
+func TestPrivateKeys(t *testing.T) {
+	testenv.Open(t)
+	keys := []models.PrivateKey{
+		{KeyID: "k1", PrivateKey: "a", KekVersion: 1, Backend: "db"},
+		{KeyID: "k2", PrivateKey: "b", KekVersion: 2, Backend: "db"},
+		{KeyID: "k3", PrivateKey: "c", KekVersion: 1, Backend: "file"},
+	}
+	for _, key := range keys {
+		if err := models.InstallPrivateKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, err := models.FindPrivateKeysNotInKekVersion(2)
+	if err != nil || len(stale) != 1 || stale[0].KeyID != "k1" {
+		t.Fatalf("stale = %+v, %v", stale, err)
+	}
+	stale[0].PrivateKey, stale[0].KekVersion = "a2", 2
+	if err := models.UpdatePrivateKeyEnvelope(stale[0]); err != nil {
+		t.Fatal(err)
+	}
+	key, err := models.FindPrivateKeyByKeyID("k1")
+	if err != nil || key.PrivateKey != "a2" || key.KekVersion != 2 {
+		t.Fatalf("key = %+v, %v", key, err)
+	}
+	if err := models.DeletePrivateKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	key, err = models.FindPrivateKeyByKeyID("k1")
+	if err != nil || key.ID != 0 {
+		t.Fatalf("deleted key = %+v, %v", key, err)
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	testenv.Open(t)
+	now := time.Now().UnixMilli()
+	for i, next := range []int64{now - 1, now + 60000, now - 2} {
+		event := models.WebhookEvent{EventID: "e", Endpoint: "ep", Event: "issued", Payload: "{}", State: models.WebhookPending, NextAttempt: next}
+		if i == 2 {
+			event.State = models.WebhookFailed
+		}
+		if err := models.InstallWebhookEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	due, err := models.FindDueWebhookEvents(now, 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("due = %+v, %v", due, err)
+	}
+	due[0].Attempts, due[0].NextAttempt, due[0].LastError = 1, now+60000, "500"
+	if err := models.UpdateWebhookEvent(due[0]); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := models.FindDueWebhookEvents(now, 10); len(due) != 0 {
+		t.Fatalf("rescheduled event is still due: %+v", due)
+	}
+	if err := models.DeleteWebhookEvent(due[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := models.FindDueWebhookEvents(now+60000, 10); len(due) != 1 {
+		t.Fatalf("due after delete = %+v", due)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	db := testenv.Open(t)
+	errAbort := errors.New("abort")
+	err := models.Transaction(func(tx models.Repository) error {
+		if err := tx.InstallCreator(testenv.UserID, "alice"); err != nil {
+			return err
+		}
+		if err := tx.InstallCertVersion(models.Version{CertID: "c1", Serial: "01"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v", err)
+	}
+	for _, table := range []string{"creator", "version"} {
+		if n := testenv.Count(t, db, table); n != 0 {
+			t.Errorf("%s has %d rows after rollback", table, n)
+		}
+	}
+
+	err = models.Transaction(func(tx models.Repository) error {
+		return tx.InstallCreator(testenv.UserID, "alice")
+	})
+	if err != nil || testenv.Count(t, db, "creator") != 1 {
+		t.Fatalf("commit = %v", err)
+	}
+}
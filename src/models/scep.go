@@ -0,0 +1,34 @@
+package models
+
+func InstallScepTransaction(data ScepTransaction) error {
+	return repo.InstallScepTransaction(data)
+}
+
+func (r *gormRepository) InstallScepTransaction(data ScepTransaction) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindScepTransaction 根据事务 ID 查询 SCEP 事务，不存在时返回的 ID 为 0
+func FindScepTransaction(transactionID string) (*ScepTransaction, error) {
+	return repo.FindScepTransaction(transactionID)
+}
+
+func (r *gormRepository) FindScepTransaction(transactionID string) (*ScepTransaction, error) {
+	var t ScepTransaction
+	err := r.db.Model(&ScepTransaction{}).Where("transaction_id=?", transactionID).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// UpdateScepTransaction 更新 SCEP 事务签发的证书，用于同一事务 ID 重新注册
+func UpdateScepTransaction(data ScepTransaction) error {
+	return repo.UpdateScepTransaction(data)
+}
+
+func (r *gormRepository) UpdateScepTransaction(data ScepTransaction) error {
+	return r.db.Model(&ScepTransaction{}).Where("transaction_id=?", data.TransactionID).Updates(map[string]interface{}{
+		"certid":      data.CertID,
+		"serial":      data.Serial,
+		"create_time": data.CreateTime,
+	}).Error
+}
@@ -1,5 +1,18 @@
 package models
 
+// 证书类型 Certificate.Genre
+const (
+	GenreCA   = 1 // CA 证书
+	GenreLeaf = 2 // 末端证书
+)
+
+// 证书状态 Certificate.State，与 openssl index.txt 保持一致
+const (
+	StateValid   = "V" // 有效
+	StateRevoked = "R" // 已吊销
+	StateExpired = "E" // 已过期，不写入数据库，由最新版本的到期时间判断
+)
+
 type Creator struct {
 	ID     *int    `gorm:"primaryKey;autoIncrement;column:id"`               // 主键，自增
 	UserID *string `gorm:"type:char(32);default:null;column:user_id;unique"` // 用户 ID，唯一
@@ -12,16 +25,24 @@ func (Creator) TableName() string {
 }
 
 type Certificate struct {
-	ID       *int    `gorm:"primaryKey;autoIncrement;column:id"`              // 主键，自增
-	CertID   *string `gorm:"type:char(32);default:null;column:certid;unique"` // 证书 ID，唯一
-	UserID   *string `gorm:"type:char(32);not null;column:user_id"`           // 用户 ID，外键
-	Title    *string `gorm:"type:varchar(255);default:null;column:title"`     // 证书友好名称
-	State    *string `gorm:"type:varchar(255);default:null;column:state"`     // 状态
-	Subject  *string `gorm:"type:varchar(255);default:null;column:subject"`   // 证书 Subject
-	ParentID *string `gorm:"type:char(36);default:null;column:parent_id"`     // 上级证书 UUID
-	Pathlev  *int    `gorm:"type:int;not null;column:pathlev"`                // 证书层级
-	Genre    *int    `gorm:"type:int;not null;column:genre"`                  // 证书类型
-	CertReq  *string `gorm:"type:varchar(255);default:null;column:cert_req"`  // 证书请求文件
+	ID         *int    `gorm:"primaryKey;autoIncrement;column:id"`                                          // 主键，自增
+	CertID     *string `gorm:"type:char(32);default:null;column:certid;unique"`                             // 证书 ID，唯一
+	UserID     *string `gorm:"type:char(32);not null;column:user_id"`                                       // 用户 ID，外键
+	Title      *string `gorm:"type:varchar(255);default:null;column:title"`                                 // 证书友好名称
+	State      *string `gorm:"type:varchar(255);default:null;column:state"`                                 // 状态
+	Subject    *string `gorm:"type:varchar(255);default:null;column:subject"`                               // 证书 Subject
+	ParentID   *string `gorm:"type:char(36);default:null;column:parent_id;index:idx_certificate_parent_id"` // 上级证书 UUID
+	Pathlev    *int    `gorm:"type:int;not null;column:pathlev"`                                            // 证书层级
+	Genre      *int    `gorm:"type:int;not null;column:genre"`                                              // 证书类型
+	CertReq    *string `gorm:"type:text;default:null;column:cert_req"`                                      // 证书请求文件（PEM）
+	Sans       *string `gorm:"type:text;default:null;column:sans"`                                          // 使用者可选名称，逗号分隔，用于搜索
+	Profile    *string `gorm:"type:varchar(255);default:null;column:profile"`                               // 签发时使用的签名配置，CA 证书和早期证书为 null
+	CreateTime int64   `gorm:"type:bigint;default:null;column:create_time"`                                 // 创建时间戳
+
+	// 以下为 CA 签发证书时写入的地址，为 null 时使用 spki.yaml 中的默认值，为空字符串时不写入
+	IssuerURL *string `gorm:"type:varchar(255);default:null;column:issuer_url"` // CA 证书下载地址（AIA caIssuers）
+	OcspURL   *string `gorm:"type:varchar(255);default:null;column:ocsp_url"`   // OCSP 响应器地址（AIA ocsp）
+	CrlURL    *string `gorm:"type:varchar(255);default:null;column:crl_url"`    // CRL 分发点
 }
 
 // TableName 设置表名
@@ -32,7 +53,10 @@ func (Certificate) TableName() string {
 type PrivateKey struct {
 	ID         int    `gorm:"primaryKey;autoIncrement;column:id"`             // 主键，自增
 	KeyID      string `gorm:"type:char(32);default:null;column:keyid;unique"` // 私钥 ID，唯一
-	PrivateKey string `gorm:"type:text;not null;column:private_key"`          // 私钥内容
+	PrivateKey string `gorm:"type:text;not null;column:private_key"`          // 私钥内容，已加密时为 base64 编码的密文
+	DataKey    string `gorm:"type:varchar(255);default:null;column:data_key"` // 被主密钥加密的数据密钥（base64）
+	KekVersion int    `gorm:"type:int;default:0;column:kek_version"`          // 主密钥版本，0 表示未加密
+	Backend    string `gorm:"type:varchar(32);default:'db';column:backend"`   // 私钥存储：db，file
 	CreateTime int64  `gorm:"type:bigint;default:null;column:create_time"`    // 创建时间戳
 }
 
@@ -42,18 +66,149 @@ func (PrivateKey) TableName() string {
 }
 
 type Version struct {
-	ID             int    `gorm:"primaryKey;autoIncrement;column:id"`              // 主键，自增
-	CertID         string `gorm:"type:char(32);default:null;column:certid"`        // 证书 ID，外键
-	KeyID          string `gorm:"type:char(32);default:null;column:keyid"`         // 私钥 ID，外键
-	Serial         string `gorm:"type:varchar(255);default:null;column:serial"`    // 证书序列号
-	Cert           string `gorm:"type:text;default:null;column:cert"`              // 证书文件主体
-	EffectiveTime  int64  `gorm:"type:bigint;default:null;column:effective_time"`  // 生效时间戳
-	ExpirationTime int64  `gorm:"type:bigint;default:null;column:expiration_time"` // 到期时间戳
-	RevocationTime int64  `gorm:"type:bigint;default:null;column:revocation_time"` // 吊销时间戳
-	Alarm          int    `gorm:"type:int;default:0;column:alarm"`                 // 到期告警
+	ID             int    `gorm:"primaryKey;autoIncrement;column:id"`                                    // 主键，自增
+	CertID         string `gorm:"type:char(32);default:null;column:certid"`                              // 证书 ID，外键
+	KeyID          string `gorm:"type:char(32);default:null;column:keyid"`                               // 私钥 ID，外键
+	Serial         string `gorm:"type:varchar(255);default:null;column:serial;index:idx_version_serial"` // 证书序列号
+	Cert           string `gorm:"type:text;default:null;column:cert"`                                    // 证书文件主体
+	EffectiveTime  int64  `gorm:"type:bigint;default:null;column:effective_time"`                        // 生效时间戳
+	ExpirationTime int64  `gorm:"type:bigint;default:null;column:expiration_time"`                       // 到期时间戳
+	RevocationTime int64  `gorm:"type:bigint;default:null;column:revocation_time"`                       // 吊销时间戳
+	RevocationCode int    `gorm:"type:int;default:0;column:revocation_code"`                             // 吊销原因（RFC 5280 CRLReason）
+	InvalidityTime int64  `gorm:"type:bigint;default:null;column:invalidity_time"`                       // 私钥泄露或证书失效的时间戳
+	Alarm          int    `gorm:"type:int;default:0;column:alarm"`                                       // 已发送到期告警的最小阈值（天），0 表示未告警
 }
 
 // TableName 设置表名
 func (Version) TableName() string {
 	return "version"
 }
+
+type Crl struct {
+	ID         int    `gorm:"primaryKey;autoIncrement;column:id"`      // 主键，自增
+	CertID     string `gorm:"type:char(32);not null;column:certid"`    // CA 证书 ID，外键
+	Number     int64  `gorm:"type:bigint;not null;column:number"`      // CRL 编号，单调递增
+	ThisUpdate int64  `gorm:"type:bigint;not null;column:this_update"` // 生成时间戳
+	NextUpdate int64  `gorm:"type:bigint;not null;column:next_update"` // 下次更新时间戳
+	Crl        string `gorm:"type:mediumtext;not null;column:crl"`     // CRL 主体（PEM）
+}
+
+// TableName 设置表名
+func (Crl) TableName() string {
+	return "crl"
+}
+
+// Webhook 事件投递状态 WebhookEvent.State
+const (
+	WebhookPending = "pending" // 等待投递或重试
+	WebhookFailed  = "failed"  // 超过最大重试次数，不再投递
+)
+
+type WebhookEvent struct {
+	ID          int    `gorm:"primaryKey;autoIncrement;column:id"`                                    // 主键，自增
+	EventID     string `gorm:"type:char(32);not null;column:event_id"`                                // 事件 ID，同一事件投递到多个地址时相同
+	Endpoint    string `gorm:"type:varchar(255);not null;column:endpoint"`                            // 接收地址名称
+	Event       string `gorm:"type:varchar(64);not null;column:event"`                                // 事件类型
+	Payload     string `gorm:"type:text;not null;column:payload"`                                     // 事件内容（JSON）
+	State       string `gorm:"type:varchar(16);not null;column:state;index:idx_webhook_outbox_due"`   // 投递状态
+	Attempts    int    `gorm:"type:int;default:0;column:attempts"`                                    // 已投递次数
+	NextAttempt int64  `gorm:"type:bigint;not null;column:next_attempt;index:idx_webhook_outbox_due"` // 下次投递时间戳
+	LastError   string `gorm:"type:text;default:null;column:last_error"`                              // 最近一次投递失败的原因
+	CreateTime  int64  `gorm:"type:bigint;default:null;column:create_time"`                           // 创建时间戳
+}
+
+// TableName 设置表名
+func (WebhookEvent) TableName() string {
+	return "webhook_outbox"
+}
+
+// ACME 对象状态（RFC 8555 7.1.6）
+const (
+	AcmePending     = "pending"
+	AcmeReady       = "ready"
+	AcmeProcessing  = "processing"
+	AcmeValid       = "valid"
+	AcmeInvalid     = "invalid"
+	AcmeDeactivated = "deactivated"
+	AcmeRevoked     = "revoked"
+)
+
+type AcmeAccount struct {
+	ID         int    `gorm:"primaryKey;autoIncrement;column:id"`                 // 主键，自增
+	AccountID  string `gorm:"type:char(32);not null;column:account_id;unique"`    // 账户 ID，唯一
+	Thumbprint string `gorm:"type:varchar(64);not null;column:thumbprint;unique"` // 账户公钥的 JWK 指纹（RFC 7638），唯一
+	Jwk        string `gorm:"type:text;not null;column:jwk"`                      // 账户公钥（JWK）
+	Contact    string `gorm:"type:text;default:null;column:contact"`              // 联系方式（JSON 数组）
+	Status     string `gorm:"type:varchar(16);not null;column:status"`            // 账户状态
+	CreateTime int64  `gorm:"type:bigint;default:null;column:create_time"`        // 创建时间戳
+}
+
+// TableName 设置表名
+func (AcmeAccount) TableName() string {
+	return "acme_account"
+}
+
+type AcmeOrder struct {
+	ID          int     `gorm:"primaryKey;autoIncrement;column:id"`             // 主键，自增
+	OrderID     string  `gorm:"type:char(32);not null;column:order_id;unique"`  // 订单 ID，唯一
+	AccountID   string  `gorm:"type:char(32);not null;column:account_id;index"` // 账户 ID
+	Status      string  `gorm:"type:varchar(16);not null;column:status"`        // 订单状态
+	Identifiers string  `gorm:"type:text;not null;column:identifiers"`          // 申请的标识（JSON 数组）
+	NotBefore   int64   `gorm:"type:bigint;default:null;column:not_before"`     // 申请的生效时间戳
+	NotAfter    int64   `gorm:"type:bigint;default:null;column:not_after"`      // 申请的到期时间戳
+	Expires     int64   `gorm:"type:bigint;not null;column:expires"`            // 订单过期时间戳
+	Error       string  `gorm:"type:text;default:null;column:error"`            // 签发失败的原因（JSON）
+	CertID      *string `gorm:"type:char(32);default:null;column:certid;index"` // 签发的证书 ID
+	CreateTime  int64   `gorm:"type:bigint;default:null;column:create_time"`    // 创建时间戳
+}
+
+// TableName 设置表名
+func (AcmeOrder) TableName() string {
+	return "acme_order"
+}
+
+type AcmeAuthorization struct {
+	ID        int    `gorm:"primaryKey;autoIncrement;column:id"`            // 主键，自增
+	AuthzID   string `gorm:"type:char(32);not null;column:authz_id;unique"` // 授权 ID，唯一
+	OrderID   string `gorm:"type:char(32);not null;column:order_id;index"`  // 订单 ID
+	AccountID string `gorm:"type:char(32);not null;column:account_id"`      // 账户 ID
+	Type      string `gorm:"type:varchar(16);not null;column:type"`         // 标识类型，目前只支持 dns
+	Value     string `gorm:"type:varchar(255);not null;column:value"`       // 标识，通配符域名不含 *.
+	Wildcard  bool   `gorm:"default:false;column:wildcard"`                 // 是否为通配符域名
+	Status    string `gorm:"type:varchar(16);not null;column:status"`       // 授权状态
+	Expires   int64  `gorm:"type:bigint;not null;column:expires"`           // 授权过期时间戳
+}
+
+// TableName 设置表名
+func (AcmeAuthorization) TableName() string {
+	return "acme_authorization"
+}
+
+type AcmeChallenge struct {
+	ID          int    `gorm:"primaryKey;autoIncrement;column:id"`                // 主键，自增
+	ChallengeID string `gorm:"type:char(32);not null;column:challenge_id;unique"` // 质询 ID，唯一
+	AuthzID     string `gorm:"type:char(32);not null;column:authz_id;index"`      // 授权 ID
+	Type        string `gorm:"type:varchar(16);not null;column:type"`             // 质询类型：http-01，dns-01
+	Token       string `gorm:"type:varchar(64);not null;column:token"`            // 质询令牌
+	Status      string `gorm:"type:varchar(16);not null;column:status"`           // 质询状态
+	Validated   int64  `gorm:"type:bigint;default:null;column:validated"`         // 验证通过的时间戳
+	Error       string `gorm:"type:text;default:null;column:error"`               // 验证失败的原因（JSON）
+}
+
+// TableName 设置表名
+func (AcmeChallenge) TableName() string {
+	return "acme_challenge"
+}
+
+type ScepTransaction struct {
+	ID            int    `gorm:"primaryKey;autoIncrement;column:id"`                      // 主键，自增
+	TransactionID string `gorm:"type:varchar(128);not null;column:transaction_id;unique"` // SCEP 事务 ID，唯一
+	CertID        string `gorm:"type:char(32);not null;column:certid"`                    // 签发的证书 ID
+	Serial        string `gorm:"type:varchar(64);not null;column:serial"`                 // 签发的证书版本序列号
+	CreateTime    int64  `gorm:"type:bigint;not null;column:create_time"`                 // 创建时间戳
+}
+
+// TableName 设置表名
+func (ScepTransaction) TableName() string {
+	return "scep_transaction"
+}
@@ -1,8 +1,111 @@
 package models
 
-import "spki/src/database/mysql"
-
 func InstallCertVersion(data Version) error {
-	err := mysql.OrmDB.Create(&data).Error
+	return repo.InstallCertVersion(data)
+}
+
+func (r *gormRepository) InstallCertVersion(data Version) error {
+	err := r.db.Create(&data).Error
 	return err
 }
+
+// FindLatestCertVersion 查询证书的最新版本，不存在时返回的 ID 为 0
+func FindLatestCertVersion(certID string) (*Version, error) {
+	return repo.FindLatestCertVersion(certID)
+}
+
+func (r *gormRepository) FindLatestCertVersion(certID string) (*Version, error) {
+	var t Version
+	err := r.db.Model(&Version{}).Where("certid=?", certID).Order("id desc").Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// FindCertVersionBySerial 根据证书序列号查询证书版本，不存在时返回的 ID 为 0
+func FindCertVersionBySerial(serial string) (*Version, error) {
+	return repo.FindCertVersionBySerial(serial)
+}
+
+func (r *gormRepository) FindCertVersionBySerial(serial string) (*Version, error) {
+	var t Version
+	err := r.db.Model(&Version{}).Where("serial=?", serial).Limit(1).Find(&t).Error
+	return &t, err
+}
+
+// RevokeCertVersion 记录证书版本的吊销时间、原因和失效时间，只更新未吊销的版本，版本已吊销时返回 false
+func RevokeCertVersion(id int, revocationTime int64, code int, invalidityTime int64) (bool, error) {
+	return repo.RevokeCertVersion(id, revocationTime, code, invalidityTime)
+}
+
+func (r *gormRepository) RevokeCertVersion(id int, revocationTime int64, code int, invalidityTime int64) (bool, error) {
+	result := r.db.Model(&Version{}).
+		Where("id=? AND (revocation_time IS NULL OR revocation_time = 0)", id).
+		Updates(map[string]interface{}{
+			"revocation_time": revocationTime,
+			"revocation_code": code,
+			"invalidity_time": invalidityTime,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindRevokedCertVersions 查询指定 CA 签发的、已吊销且未过期的证书版本
+func FindRevokedCertVersions(caCertID string, now int64) ([]Version, error) {
+	return repo.FindRevokedCertVersions(caCertID, now)
+}
+
+func (r *gormRepository) FindRevokedCertVersions(caCertID string, now int64) ([]Version, error) {
+	var t []Version
+	err := r.db.Model(&Version{}).
+		Joins("JOIN certificate ON certificate.certid = version.certid").
+		Where("certificate.parent_id=? AND version.revocation_time > 0 AND version.expiration_time > ?", caCertID, now).
+		Order("version.id").
+		Find(&t).Error
+	return t, err
+}
+
+// FindCertVersions 查询证书的所有版本，按创建顺序排列
+func FindCertVersions(certID string) ([]Version, error) {
+	return repo.FindCertVersions(certID)
+}
+
+func (r *gormRepository) FindCertVersions(certID string) ([]Version, error) {
+	var t []Version
+	err := r.db.Model(&Version{}).Where("certid=?", certID).Order("id").Find(&t).Error
+	return t, err
+}
+
+// ExpiringVersion 即将到期的证书版本及其证书信息
+type ExpiringVersion struct {
+	Version
+	UserID   *string `gorm:"column:user_id"`
+	Title    *string `gorm:"column:title"`
+	Subject  *string `gorm:"column:subject"`
+	Genre    *int    `gorm:"column:genre"`
+	ParentID *string `gorm:"column:parent_id"`
+}
+
+// FindExpiringCertVersions 查询到期时间在 [after, before) 之间的有效证书的最新版本，按到期时间排列
+func FindExpiringCertVersions(after, before int64) ([]ExpiringVersion, error) {
+	return repo.FindExpiringCertVersions(after, before)
+}
+
+func (r *gormRepository) FindExpiringCertVersions(after, before int64) ([]ExpiringVersion, error) {
+	var t []ExpiringVersion
+	err := r.db.Model(&Version{}).
+		Joins("JOIN certificate ON certificate.certid = version.certid").
+		Where("version.id = (SELECT MAX(v.id) FROM version v WHERE v.certid = version.certid)").
+		Where("certificate.state=? AND (version.revocation_time IS NULL OR version.revocation_time = 0)", StateValid).
+		Where("version.expiration_time >= ? AND version.expiration_time < ?", after, before).
+		Select("version.*, certificate.user_id, certificate.title, certificate.subject, certificate.genre, certificate.parent_id").
+		Order("version.expiration_time").Order("version.id").
+		Find(&t).Error
+	return t, err
+}
+
+// UpdateCertVersionAlarm 记录证书版本已发送到期告警的阈值
+func UpdateCertVersionAlarm(id, alarm int) error {
+	return repo.UpdateCertVersionAlarm(id, alarm)
+}
+
+func (r *gormRepository) UpdateCertVersionAlarm(id, alarm int) error {
+	return r.db.Model(&Version{}).Where("id=?", id).Update("alarm", alarm).Error
+}
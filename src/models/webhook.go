@@ -0,0 +1,47 @@
+package models
+
+func InstallWebhookEvent(data WebhookEvent) error {
+	return repo.InstallWebhookEvent(data)
+}
+
+func (r *gormRepository) InstallWebhookEvent(data WebhookEvent) error {
+	err := r.db.Create(&data).Error
+	return err
+}
+
+// FindDueWebhookEvents 查询到达投递时间的待投递事件，按创建顺序排列
+func FindDueWebhookEvents(now int64, limit int) ([]WebhookEvent, error) {
+	return repo.FindDueWebhookEvents(now, limit)
+}
+
+func (r *gormRepository) FindDueWebhookEvents(now int64, limit int) ([]WebhookEvent, error) {
+	var t []WebhookEvent
+	err := r.db.Model(&WebhookEvent{}).
+		Where("state=? AND next_attempt <= ?", WebhookPending, now).
+		Order("id").Limit(limit).
+		Find(&t).Error
+	return t, err
+}
+
+// UpdateWebhookEvent 记录投递失败后的状态、次数、下次投递时间和失败原因
+func UpdateWebhookEvent(data WebhookEvent) error {
+	return repo.UpdateWebhookEvent(data)
+}
+
+func (r *gormRepository) UpdateWebhookEvent(data WebhookEvent) error {
+	return r.db.Model(&WebhookEvent{}).Where("id=?", data.ID).Updates(map[string]interface{}{
+		"state":        data.State,
+		"attempts":     data.Attempts,
+		"next_attempt": data.NextAttempt,
+		"last_error":   data.LastError,
+	}).Error
+}
+
+// DeleteWebhookEvent 删除已投递的事件
+func DeleteWebhookEvent(id int) error {
+	return repo.DeleteWebhookEvent(id)
+}
+
+func (r *gormRepository) DeleteWebhookEvent(id int) error {
+	return r.db.Where("id=?", id).Delete(&WebhookEvent{}).Error
+}
@@ -5,8 +5,16 @@ const (
 	EcodeError                     = "SPKI.0101" // 结果错误
 	EcodeInvalidRequestParamsError = "SPKI.0102" // 请求参数校验失败。
 	EcodeInvalidRequestError       = "SPKI.0103" // 请求体错误
+	EcodeResourceNotFound          = "SPKI.0104" // 资源不存在
+	EcodeDatabaseError             = "SPKI.0105" // 数据库操作失败
 	EcodeInvalidTokenError         = "SPKI.0175" // 无效，错误的 token
 	EcodeNoActionError             = "SPKI.0177" // action 不存在
 	EcodePolicyNotAuthorized       = "SPKI.0178" // 策略未授权此操作
 	EcodeDeleteResourceConflict    = "SPKI.0198" // 409 删除资源时冲突
+	EcodeGenerateKeyError          = "SPKI.0201" // 生成私钥失败
+	EcodeSignCertError             = "SPKI.0202" // 签发证书失败
+	EcodeInvalidCAError            = "SPKI.0203" // CA 证书不可用
+	EcodeCertRevoked               = "SPKI.0204" // 证书已吊销
+	EcodeCertExpired               = "SPKI.0205" // 证书已过期
+	EcodeKeyNotExportable          = "SPKI.0206" // 私钥不可导出
 )
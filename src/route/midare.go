@@ -4,16 +4,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"spki/src/config"
 	"spki/src/pkg/answer"
+	"spki/src/service/audit"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 )
 
+// deny 记录拒绝访问的审计记录
+func deny(c *app.RequestContext, action, userID, account, reason string) {
+	r := audit.New(c, audit.ActionAuthDeny, c.Param("certid"), audit.ResultDenied)
+	r.UserID, r.Account, r.Detail = userID, account, action+": "+reason
+	audit.Log(r)
+}
+
 func apc(action string) app.HandlerFunc {
 	return func(ctx context.Context, c *app.RequestContext) {
 		//fmt.Println(action)
@@ -21,6 +30,7 @@ func apc(action string) app.HandlerFunc {
 		token := c.Request.Header.Get("X-Auth-Token")
 		if token == "" {
 			hlog.Error("X-Auth-Token is empty.")
+			deny(c, action, "", "", "X-Auth-Token is empty")
 			c.JSON(http.StatusForbidden, answer.ResBody(answer.EcodeInvalidTokenError, "X-Auth-Token is empty.", ""))
 			c.Abort()
 			return
@@ -57,6 +67,7 @@ func apc(action string) app.HandlerFunc {
 		resp, err := client.Do(req)
 		if err != nil {
 			hlog.Errorf("Error sending req log: %v", err)
+			deny(c, action, "", "", "authorization service unavailable")
 			c.JSON(http.StatusForbidden, answer.ResBody(answer.EcodeInvalidTokenError, "Internal service error.", ""))
 			c.Abort()
 			return
@@ -98,6 +109,7 @@ func apc(action string) app.HandlerFunc {
 
 		if resp.StatusCode != http.StatusOK {
 			hlog.Errorf("Request failed with status code %d: %v", resp.StatusCode, result)
+			deny(c, action, "", "", fmt.Sprintf("authorization service returned %d", resp.StatusCode))
 			c.JSON(resp.StatusCode, result)
 			c.Abort()
 			return
@@ -116,6 +128,7 @@ func apc(action string) app.HandlerFunc {
 		if authentication != 1 {
 			// 没有权限，返回403和上游返回体，便于查看问题
 			hlog.Warnf("Permission denial. result: %+v", result)
+			deny(c, action, result.Payload.User.ID, result.Payload.User.Name.Account, "permission denied")
 			c.JSON(403, result)
 			c.Abort()
 			return
@@ -3,7 +3,18 @@ package route
 import (
 	"context"
 	"net/http"
+	"spki/src/service/acme"
+	"spki/src/service/alarm"
+	"spki/src/service/audit"
 	"spki/src/service/cacert"
+	"spki/src/service/certificate"
+	"spki/src/service/cfssl"
+	"spki/src/service/crl"
+	"spki/src/service/est"
+	"spki/src/service/ocsp"
+	"spki/src/service/revoke"
+	"spki/src/service/scep"
+	"spki/src/service/vault"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
@@ -18,5 +29,68 @@ func helloWord() func(ctx context.Context, c *app.RequestContext) {
 
 func Routes(r *server.Hertz) {
 	r.GET("/", helloWord())
-	r.POST("/spki/ca/init", apc("snms:class:createClass"), cacert.InitCa())
+	r.POST("/spki/ca/init", apc("snms:class:createClass"), audit.Handler(audit.ActionCAInit), cacert.InitCa())
+	r.POST("/spki/ca/:certid/intermediate", apc("spki:ca:createIntermediate"), audit.Handler(audit.ActionIntermediate), cacert.CreateIntermediateCa())
+	r.POST("/spki/ca/:certid/issue", apc("spki:cert:issueCert"), audit.Handler(audit.ActionIssue), cacert.IssueCert())
+	r.POST("/spki/ca/:certid/sign", apc("spki:cert:signCsr"), audit.Handler(audit.ActionSignCSR), cacert.SignCSR())
+	r.PUT("/spki/ca/:certid/urls", apc("spki:ca:updateUrls"), audit.Handler(audit.ActionCAUpdateURLs), cacert.UpdateCaURLs())
+	r.POST("/spki/revoke", apc("spki:cert:revokeCert"), audit.Handler(audit.ActionRevoke), revoke.Revoke())
+	r.GET("/spki/certificates", apc("spki:cert:listCerts"), certificate.ListCertificates())
+	r.GET("/spki/certificates/expiring", apc("spki:cert:listExpiring"), alarm.Expiring())
+	r.GET("/spki/certificates/:certid", apc("spki:cert:getCert"), certificate.GetCertificate())
+	r.GET("/spki/certificates/:certid/versions", apc("spki:cert:listVersions"), certificate.ListVersions())
+	r.GET("/spki/certificates/:certid/download", apc("spki:cert:downloadCert"), certificate.Download())
+	r.POST("/spki/certificates/:certid/renew", apc("spki:cert:renewCert"), audit.Handler(audit.ActionRenew), certificate.RenewCert())
+	r.POST("/spki/certificates/:certid/rekey", apc("spki:cert:rekeyCert"), audit.Handler(audit.ActionRekey), certificate.RekeyCert())
+
+	// 无需认证，供依赖方构建证书链和获取吊销信息
+	r.GET("/spki/ca/:certid/cert", cacert.GetCaCert())
+	r.GET("/spki/crl/:certid", crl.GetCrl())
+	r.GET("/spki/crl/:certid/pem", crl.GetCrlPEM())
+	r.POST("/spki/ocsp/:certid", ocsp.Respond())
+	r.GET("/spki/ocsp/:certid/*request", ocsp.Respond())
+
+	// ACME（RFC 8555），使用 JWS 认证，不经过 apc
+	g := r.Group(acme.Prefix)
+	g.GET("/directory", acme.Directory())
+	g.HEAD("/new-nonce", acme.NewNonce())
+	g.GET("/new-nonce", acme.NewNonce())
+	g.POST("/new-account", acme.NewAccount())
+	g.POST("/account/:id", acme.Account())
+	g.POST("/account/:id/orders", acme.AccountOrders())
+	g.POST("/key-change", acme.KeyChange())
+	g.POST("/new-order", acme.NewOrder())
+	g.POST("/order/:id", acme.Order())
+	g.POST("/order/:id/finalize", acme.Finalize())
+	g.POST("/authz/:id", acme.Authorization())
+	g.POST("/chall/:id", acme.Challenge())
+	g.POST("/cert/:certid", acme.Certificate())
+	g.POST("/revoke-cert", acme.RevokeCert())
+
+	// EST（RFC 7030），使用 HTTP basic 或 TLS 客户端证书认证，不经过 apc
+	r.GET(est.Prefix+"/cacerts", est.CACerts())
+	r.GET(est.Prefix+"/csrattrs", est.CSRAttrs())
+	r.POST(est.Prefix+"/simpleenroll", est.SimpleEnroll())
+	r.POST(est.Prefix+"/simplereenroll", est.SimpleReenroll())
+
+	// SCEP（RFC 8894），请求由 CA 证书加密并携带挑战密码，不经过 apc
+	r.GET(scep.Prefix, scep.Operation())
+	r.POST(scep.Prefix, scep.Operation())
+
+	// 兼容 cfssl 的远程签名接口，authsign 使用 HMAC 认证，不经过 apc
+	r.POST(cfssl.Prefix+"/sign", cfssl.Sign())
+	r.POST(cfssl.Prefix+"/authsign", cfssl.AuthSign())
+	r.POST(cfssl.Prefix+"/newcert", cfssl.NewCert())
+	r.GET(cfssl.Prefix+"/info", cfssl.Info())
+	r.POST(cfssl.Prefix+"/info", cfssl.Info())
+
+	// 兼容 Vault PKI 引擎的接口，使用 X-Vault-Token 认证，不经过 apc；CA 证书和 CRL 无需认证
+	// Vault 客户端写入时使用 PUT，与 Vault 一致同时接受 POST
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		r.Handle(method, vault.Prefix+"/issue/:role", vault.Issue())
+		r.Handle(method, vault.Prefix+"/sign/:role", vault.Sign())
+		r.Handle(method, vault.Prefix+"/revoke", vault.Revoke())
+	}
+	r.GET(vault.Prefix+"/ca/pem", vault.CAPem())
+	r.GET(vault.Prefix+"/crl", vault.CRL())
 }
@@ -0,0 +1,292 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// accountResource 账户资源（RFC 8555 7.1.2）
+type accountResource struct {
+	Status  string   `json:"status"`
+	Contact []string `json:"contact,omitempty"`
+	Orders  string   `json:"orders"`
+}
+
+// accountRequest 创建或更新账户的请求内容
+type accountRequest struct {
+	Contact              *[]string `json:"contact"`
+	TermsOfServiceAgreed bool      `json:"termsOfServiceAgreed"`
+	OnlyReturnExisting   bool      `json:"onlyReturnExisting"`
+	Status               string    `json:"status"`
+}
+
+// keyChangeRequest 更换账户密钥时内层 JWS 的内容
+type keyChangeRequest struct {
+	Account string          `json:"account"`
+	OldKey  json.RawMessage `json:"oldKey"`
+}
+
+func accountURL(c *app.RequestContext, accountID string) string {
+	return resourceURL(c, "account", accountID)
+}
+
+func newAccountResource(c *app.RequestContext, account *models.AcmeAccount) *accountResource {
+	res := &accountResource{
+		Status: account.Status,
+		Orders: accountURL(c, account.AccountID) + "/orders",
+	}
+	if account.Contact != "" {
+		json.Unmarshal([]byte(account.Contact), &res.Contact)
+	}
+	return res
+}
+
+// checkContact 检查联系方式，只支持 mailto
+func checkContact(contact []string) *Problem {
+	for _, uri := range contact {
+		if !strings.HasPrefix(uri, "mailto:") {
+			return problem(http.StatusBadRequest, "unsupportedContact", "Unsupported contact: "+uri)
+		}
+		addr := strings.TrimPrefix(uri, "mailto:")
+		if !strings.Contains(addr, "@") || strings.ContainsAny(addr, ",?") {
+			return problem(http.StatusBadRequest, "invalidContact", "Invalid contact: "+uri)
+		}
+	}
+	return nil
+}
+
+// NewAccount 创建账户，公钥已注册时返回已有的账户
+func NewAccount() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authJWK)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		var req accountRequest
+		if p := r.decode(&req); p != nil {
+			writeProblem(c, p)
+			return
+		}
+		tp, err := thumbprint(r.key)
+		if err != nil {
+			writeProblem(c, problem(http.StatusBadRequest, "badPublicKey", err.Error()))
+			return
+		}
+		existing, err := models.FindAcmeAccountByThumbprint(tp)
+		if err != nil {
+			hlog.Error("Failed to query ACME account. error: ", err)
+			writeProblem(c, serverInternal("Failed to query account."))
+			return
+		}
+		if existing.ID != 0 {
+			c.Header("Location", accountURL(c, existing.AccountID))
+			writeJSON(c, http.StatusOK, newAccountResource(c, existing))
+			return
+		}
+		if req.OnlyReturnExisting {
+			writeProblem(c, problem(http.StatusBadRequest, "accountDoesNotExist", "No account exists with the provided key."))
+			return
+		}
+
+		account := models.AcmeAccount{
+			AccountID:  common.CreateUuid(),
+			Thumbprint: tp,
+			Jwk:        string(r.jwk),
+			Status:     models.AcmeValid,
+			CreateTime: common.CreateTimestamp(),
+		}
+		if req.Contact != nil {
+			if p := checkContact(*req.Contact); p != nil {
+				writeProblem(c, p)
+				return
+			}
+			data, _ := json.Marshal(*req.Contact)
+			account.Contact = string(data)
+		}
+		if err := models.InstallAcmeAccount(account); err != nil {
+			hlog.Error("Failed to save ACME account. error: ", err)
+			writeProblem(c, serverInternal("Failed to save account."))
+			return
+		}
+		hlog.Infof("ACME account %s created", account.AccountID)
+		c.Header("Location", accountURL(c, account.AccountID))
+		writeJSON(c, http.StatusCreated, newAccountResource(c, &account))
+	}
+}
+
+// ownAccount 检查请求的账户是否为地址中的账户
+func ownAccount(c *app.RequestContext, r *request) *Problem {
+	if r.account.AccountID != c.Param("id") {
+		return unauthorized("Account does not match the request URL.")
+	}
+	return nil
+}
+
+// Account 查询、更新联系方式或注销账户
+func Account() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p == nil {
+			p = ownAccount(c, r)
+		}
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		account := r.account
+		if !r.postAsGet() {
+			var req accountRequest
+			if p := r.decode(&req); p != nil {
+				writeProblem(c, p)
+				return
+			}
+			if req.Status != "" && req.Status != models.AcmeDeactivated {
+				writeProblem(c, malformed("Account status can only be changed to deactivated."))
+				return
+			}
+			if req.Contact != nil {
+				if p := checkContact(*req.Contact); p != nil {
+					writeProblem(c, p)
+					return
+				}
+				data, _ := json.Marshal(*req.Contact)
+				account.Contact = string(data)
+			}
+			if req.Status != "" {
+				account.Status = req.Status
+			}
+			if err := models.UpdateAcmeAccount(*account); err != nil {
+				hlog.Error("Failed to update ACME account. error: ", err)
+				writeProblem(c, serverInternal("Failed to update account."))
+				return
+			}
+		}
+		writeJSON(c, http.StatusOK, newAccountResource(c, account))
+	}
+}
+
+// AccountOrders 查询账户的订单列表
+func AccountOrders() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p == nil {
+			p = ownAccount(c, r)
+		}
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		orders, err := models.FindAcmeOrdersByAccount(r.account.AccountID)
+		if err != nil {
+			hlog.Error("Failed to query ACME orders. error: ", err)
+			writeProblem(c, serverInternal("Failed to query orders."))
+			return
+		}
+		urls := make([]string, 0, len(orders))
+		for _, order := range orders {
+			urls = append(urls, orderURL(c, order.OrderID))
+		}
+		writeJSON(c, http.StatusOK, map[string][]string{"orders": urls})
+	}
+}
+
+// KeyChange 更换账户密钥（RFC 8555 7.3.5），外层 JWS 使用旧密钥签名，内层 JWS 使用新密钥签名
+func KeyChange() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		msg, header, p := parseJWSMessage(r.payload)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		if len(header.JWK) == 0 || header.Kid != "" || header.Nonce != "" {
+			writeProblem(c, malformed("Inner JWS must contain jwk and must not contain kid or nonce."))
+			return
+		}
+		if header.URL != baseURL(c)+string(c.Path()) {
+			writeProblem(c, malformed("Inner JWS url does not match the outer JWS."))
+			return
+		}
+		newKey, err := parseJWK(header.JWK)
+		if err != nil {
+			writeProblem(c, problem(http.StatusBadRequest, "badPublicKey", err.Error()))
+			return
+		}
+		payload, p := verifyMessage(msg, header, newKey)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		var req keyChangeRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			writeProblem(c, malformed("Invalid key change payload."))
+			return
+		}
+		if req.Account != accountURL(c, r.account.AccountID) {
+			writeProblem(c, malformed("Key change account does not match the request."))
+			return
+		}
+		oldKey, err := parseJWK(req.OldKey)
+		if err != nil {
+			writeProblem(c, malformed("Invalid oldKey: "+err.Error()))
+			return
+		}
+		oldTp, _ := thumbprint(oldKey)
+		if oldTp != r.account.Thumbprint {
+			writeProblem(c, malformed("oldKey does not match the account key."))
+			return
+		}
+		tp, err := thumbprint(newKey)
+		if err != nil {
+			writeProblem(c, problem(http.StatusBadRequest, "badPublicKey", err.Error()))
+			return
+		}
+		existing, err := models.FindAcmeAccountByThumbprint(tp)
+		if err != nil {
+			hlog.Error("Failed to query ACME account. error: ", err)
+			writeProblem(c, serverInternal("Failed to query account."))
+			return
+		}
+		if existing.ID != 0 {
+			c.Header("Location", accountURL(c, existing.AccountID))
+			writeProblem(c, problem(http.StatusConflict, "malformed", "The new key is already in use by another account."))
+			return
+		}
+
+		account := *r.account
+		account.Thumbprint = tp
+		account.Jwk = string(bytes.TrimSpace(header.JWK))
+		if err := models.UpdateAcmeAccount(account); err != nil {
+			hlog.Error("Failed to update ACME account key. error: ", err)
+			writeProblem(c, serverInternal("Failed to update account key."))
+			return
+		}
+		hlog.Infof("ACME account %s key changed", account.AccountID)
+		writeJSON(c, http.StatusOK, newAccountResource(c, &account))
+	}
+}
@@ -0,0 +1,278 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"spki/src/config"
+	"spki/src/models"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Prefix ACME 接口的路径前缀
+const Prefix = "/spki/acme"
+
+const (
+	defaultProfile       = "server"       // 默认签名配置
+	defaultOrderLifetime = 24 * time.Hour // 默认订单和授权的有效期
+	joseContentType      = "application/jose+json"
+)
+
+// settings ACME 配置
+func settings() config.Acme {
+	if config.AppCfg == nil {
+		return config.Acme{}
+	}
+	return config.AppCfg.Spki.Acme
+}
+
+// signingProfile 签发证书使用的签名配置
+func signingProfile() string {
+	if p := settings().Profile; p != "" {
+		return p
+	}
+	return defaultProfile
+}
+
+// orderLifetime 订单和授权的有效期
+func orderLifetime() time.Duration {
+	if d := settings().OrderLifetime; d > 0 {
+		return d
+	}
+	return defaultOrderLifetime
+}
+
+// Init 根据配置设置质询的验证方式
+func Init() {
+	cfg := settings()
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.CA == "" {
+		hlog.Error("ACME is enabled but spki.acme.ca is not configured.")
+	}
+	SetValidator(ChallengeHTTP01, &HTTP01{Port: cfg.HTTPPort, Client: &http.Client{Timeout: validationTimeout}})
+	if cfg.DNSResolver != "" {
+		SetValidator(ChallengeDNS01, &DNS01{Resolver: NewResolver(cfg.DNSResolver)})
+	}
+}
+
+// baseURL 客户端访问 spki 的地址，未配置时根据请求的协议和主机推断
+func baseURL(c *app.RequestContext) string {
+	if u := settings().BaseURL; u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	scheme := string(c.Request.Header.Peek("X-Forwarded-Proto"))
+	if scheme == "" {
+		scheme = string(c.URI().Scheme())
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + string(c.Host())
+}
+
+// resourceURL ACME 资源的地址
+func resourceURL(c *app.RequestContext, path ...string) string {
+	return baseURL(c) + Prefix + "/" + strings.Join(path, "/")
+}
+
+func directoryURL(c *app.RequestContext) string {
+	return resourceURL(c, "directory")
+}
+
+// link 生成 Link 响应头
+func link(url, rel string) string {
+	return "<" + url + `>;rel="` + rel + `"`
+}
+
+// writeJSON 返回 ACME 资源，同时返回新的 nonce
+func writeJSON(c *app.RequestContext, status int, v interface{}) {
+	c.Header("Replay-Nonce", nonces.issue())
+	c.Header("Link", link(directoryURL(c), "index"))
+	c.Header("Cache-Control", "no-store")
+	body, _ := json.Marshal(v)
+	c.Data(status, "application/json", body)
+}
+
+// enabled 检查是否启用了 ACME，未启用时返回 404
+func enabled(c *app.RequestContext) bool {
+	if settings().Enabled {
+		return true
+	}
+	writeProblem(c, notFound("ACME is not enabled."))
+	return false
+}
+
+// 请求的认证方式
+const (
+	authKID = iota // 使用已注册账户的 kid
+	authJWK        // 使用请求中的 jwk，用于创建账户
+	authAny        // kid 或 jwk 均可，用于吊销证书
+)
+
+// request 已验证签名的 ACME 请求
+type request struct {
+	payload []byte
+	key     crypto.PublicKey
+	jwk     []byte              // 使用 jwk 认证时的公钥
+	account *models.AcmeAccount // 使用 kid 认证时的账户
+}
+
+// postAsGet 是否为 POST-as-GET 请求（RFC 8555 6.3）
+func (r *request) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// decode 解析请求内容
+func (r *request) decode(v interface{}) *Problem {
+	if err := json.Unmarshal(r.payload, v); err != nil {
+		return malformed("Invalid request payload: " + err.Error())
+	}
+	return nil
+}
+
+// parseJWSMessage 解析 JWS 并检查保护头中的签名算法
+func parseJWSMessage(body []byte) (*jwsMessage, *jwsHeader, *Problem) {
+	var msg jwsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, nil, malformed("Request body is not a flattened JWS.")
+	}
+	raw, err := decode(msg.Protected)
+	if err != nil {
+		return nil, nil, malformed("Invalid JWS protected header encoding.")
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, nil, malformed("Invalid JWS protected header.")
+	}
+	supported := false
+	for _, alg := range algorithms {
+		supported = supported || alg == header.Alg
+	}
+	if !supported {
+		p := problem(http.StatusBadRequest, "badSignatureAlgorithm", "Unsupported JWS algorithm: "+header.Alg)
+		p.Algorithms = algorithms
+		return nil, nil, p
+	}
+	return &msg, &header, nil
+}
+
+// verifyMessage 使用公钥验证 JWS 签名并解码内容
+func verifyMessage(msg *jwsMessage, header *jwsHeader, key crypto.PublicKey) ([]byte, *Problem) {
+	sig, err := decode(msg.Signature)
+	if err != nil {
+		return nil, malformed("Invalid JWS signature encoding.")
+	}
+	if err := verifyJWS(header.Alg, key, []byte(msg.Protected+"."+msg.Payload), sig); err != nil {
+		return nil, malformed("JWS signature verification failed: " + err.Error())
+	}
+	payload, err := decode(msg.Payload)
+	if err != nil {
+		return nil, malformed("Invalid JWS payload encoding.")
+	}
+	return payload, nil
+}
+
+// parseRequest 解析并验证 ACME 请求，auth 为请求的认证方式
+func parseRequest(c *app.RequestContext, auth int) (*request, *Problem) {
+	if !strings.HasPrefix(string(c.ContentType()), joseContentType) {
+		return nil, problem(http.StatusUnsupportedMediaType, "malformed", "Content-Type must be "+joseContentType+".")
+	}
+	msg, header, p := parseJWSMessage(c.Request.Body())
+	if p != nil {
+		return nil, p
+	}
+	if !nonces.use(header.Nonce) {
+		return nil, problem(http.StatusBadRequest, "badNonce", "Invalid or expired nonce.")
+	}
+	if want := baseURL(c) + string(c.Path()); header.URL != want {
+		return nil, unauthorized("JWS url " + header.URL + " does not match request URL " + want + ".")
+	}
+
+	r := &request{}
+	switch {
+	case auth != authKID && len(header.JWK) > 0 && header.Kid == "":
+		key, err := parseJWK(header.JWK)
+		if err != nil {
+			return nil, problem(http.StatusBadRequest, "badPublicKey", err.Error())
+		}
+		r.key, r.jwk = key, header.JWK
+	case auth != authJWK && header.Kid != "" && len(header.JWK) == 0:
+		prefix := resourceURL(c, "account") + "/"
+		if !strings.HasPrefix(header.Kid, prefix) {
+			return nil, problem(http.StatusBadRequest, "accountDoesNotExist", "Unknown account "+header.Kid+".")
+		}
+		account, err := models.FindAcmeAccount(strings.TrimPrefix(header.Kid, prefix))
+		if err != nil {
+			hlog.Error("Failed to query ACME account. error: ", err)
+			return nil, serverInternal("Failed to query account.")
+		}
+		if account.ID == 0 {
+			return nil, problem(http.StatusBadRequest, "accountDoesNotExist", "Unknown account "+header.Kid+".")
+		}
+		if account.Status != models.AcmeValid {
+			return nil, unauthorized("Account is " + account.Status + ".")
+		}
+		key, err := parseJWK([]byte(account.Jwk))
+		if err != nil {
+			return nil, serverInternal("Failed to load account key.")
+		}
+		r.key, r.account = key, account
+	case auth == authJWK:
+		return nil, malformed("JWS must contain jwk and must not contain kid.")
+	case auth == authKID:
+		return nil, malformed("JWS must contain kid and must not contain jwk.")
+	default:
+		return nil, malformed("JWS must contain exactly one of jwk and kid.")
+	}
+
+	payload, p := verifyMessage(msg, header, r.key)
+	if p != nil {
+		return nil, p
+	}
+	r.payload = payload
+	return r, nil
+}
+
+// Directory 返回 ACME 目录
+func Directory() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"newNonce":   resourceURL(c, "new-nonce"),
+			"newAccount": resourceURL(c, "new-account"),
+			"newOrder":   resourceURL(c, "new-order"),
+			"revokeCert": resourceURL(c, "revoke-cert"),
+			"keyChange":  resourceURL(c, "key-change"),
+			"meta": map[string]interface{}{
+				"externalAccountRequired": false,
+			},
+		})
+		c.Data(http.StatusOK, "application/json", body)
+	}
+}
+
+// NewNonce 签发新的 nonce，HEAD 请求返回 200，GET 请求返回 204
+func NewNonce() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		c.Header("Replay-Nonce", nonces.issue())
+		c.Header("Cache-Control", "no-store")
+		c.Header("Link", link(directoryURL(c), "index"))
+		if string(c.Method()) == http.MethodHead {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,353 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hconfig "github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/route"
+	"gorm.io/gorm"
+)
+
+const testBaseURL = "http://acme.test"
+
+// client 测试用的 ACME 客户端，使用 ES256 签名
+type client struct {
+	t      *testing.T
+	engine *route.Engine
+	key    *ecdsa.PrivateKey
+	kid    string
+}
+
+// newEngine 注册 ACME 路由
+func newEngine() *route.Engine {
+	engine := route.NewEngine(hconfig.NewOptions(nil))
+	g := engine.Group(Prefix)
+	g.HEAD("/new-nonce", NewNonce())
+	g.POST("/new-account", NewAccount())
+	g.POST("/new-order", NewOrder())
+	g.POST("/order/:id", Order())
+	g.POST("/order/:id/finalize", Finalize())
+	g.POST("/authz/:id", Authorization())
+	g.POST("/chall/:id", Challenge())
+	g.POST("/cert/:certid", Certificate())
+	return engine
+}
+
+// setup 打开内存数据库、创建签发 CA 并启用 ACME，返回已注册账户的客户端
+func setup(t *testing.T) (*gorm.DB, *client) {
+	db := testenv.Open(t)
+	if err := profile.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	caID, _, _ := testenv.CA(t, "ACME Root")
+	testenv.Config(t).Spki.Acme = config.Acme{Enabled: true, CA: caID, Expiry: 30, BaseURL: testBaseURL}
+	t.Cleanup(func() {
+		SetValidator(ChallengeHTTP01, &HTTP01{})
+		SetValidator(ChallengeDNS01, &DNS01{})
+	})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, engine: newEngine(), key: key}
+	res := c.post("/new-account", map[string]interface{}{"termsOfServiceAgreed": true}, nil)
+	if res.StatusCode() != http.StatusCreated {
+		t.Fatalf("new account = %d %s", res.StatusCode(), res.Body())
+	}
+	c.kid = res.Header.Get("Location")
+	return db, c
+}
+
+// nonce 获取新的 nonce
+func (c *client) nonce() string {
+	w := ut.PerformRequest(c.engine, http.MethodHead, Prefix+"/new-nonce", nil)
+	return w.Result().Header.Get("Replay-Nonce")
+}
+
+// jws 生成请求体，payload 为 nil 时为 POST-as-GET
+func (c *client) jws(path string, payload interface{}, nonce string) []byte {
+	header := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": testBaseURL + Prefix + path}
+	if c.kid == "" {
+		header["jwk"] = jwk{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   encode(pad(c.key.X, 32)),
+			Y:   encode(pad(c.key.Y, 32)),
+		}
+	} else {
+		header["kid"] = c.kid
+	}
+	protected, _ := json.Marshal(header)
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	msg := jwsMessage{Protected: encode(protected), Payload: encode(body)}
+	digest := sha256.Sum256([]byte(msg.Protected + "." + msg.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg.Signature = encode(append(pad(r, 32), pad(s, 32)...))
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+// post 发送已签名的请求，out 不为 nil 时解析响应
+func (c *client) post(path string, payload, out interface{}) *protocol.Response {
+	return c.send(path, c.jws(path, payload, c.nonce()), out)
+}
+
+func (c *client) send(path string, body []byte, out interface{}) *protocol.Response {
+	w := ut.PerformRequest(c.engine, http.MethodPost, Prefix+path, &ut.Body{Body: bytes.NewReader(body), Len: len(body)},
+		ut.Header{Key: "Content-Type", Value: joseContentType})
+	res := w.Result()
+	if out != nil {
+		if err := json.Unmarshal(res.Body(), out); err != nil {
+			c.t.Fatalf("invalid response %q: %v", res.Body(), err)
+		}
+	}
+	return res
+}
+
+// path 资源地址的路径部分
+func path(url string) string {
+	return strings.TrimPrefix(url, testBaseURL+Prefix)
+}
+
+// keyAuth 质询的密钥授权
+func (c *client) keyAuth(token string) string {
+	tp, err := thumbprint(&c.key.PublicKey)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return token + "." + tp
+}
+
+// newOrder 创建订单，返回订单地址和第一个授权中指定类型的质询
+func (c *client) newOrder(typ string, names ...string) (string, orderResource, challengeResource) {
+	var ids []identifier
+	for _, name := range names {
+		ids = append(ids, identifier{Type: "dns", Value: name})
+	}
+	var order orderResource
+	res := c.post("/new-order", map[string]interface{}{"identifiers": ids}, &order)
+	if res.StatusCode() != http.StatusCreated || order.Status != models.AcmePending {
+		c.t.Fatalf("new order = %d %s", res.StatusCode(), res.Body())
+	}
+	var authz authzResource
+	c.post(path(order.Authorizations[0]), nil, &authz)
+	for _, chall := range authz.Challenges {
+		if chall.Type == typ {
+			return res.Header.Get("Location"), order, chall
+		}
+	}
+	c.t.Fatalf("no %s challenge in %+v", typ, authz)
+	return "", order, challengeResource{}
+}
+
+// waitOrder 等待后台验证完成，返回不再是 pending 的订单
+func (c *client) waitOrder(orderURL string) orderResource {
+	var order orderResource
+	for i := 0; i < 100; i++ {
+		c.post(path(orderURL), nil, &order)
+		if order.Status != models.AcmePending {
+			return order
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatalf("order is still pending: %+v", order)
+	return order
+}
+
+// csr 生成证书请求
+func (c *client) csr(names ...string) string {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: names[0]}, DNSNames: names}, key)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return encode(der)
+}
+
+// httpServer 返回密钥授权的 http-01 验证服务器，验证方访问的所有域名都连接到该服务器
+func httpServer(t *testing.T, tokens map[string]string) *HTTP01 {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyAuth, ok := tokens[strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(keyAuth))
+	}))
+	t.Cleanup(srv.Close)
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	return &HTTP01{Client: &http.Client{Transport: &http.Transport{DialContext: dial}}}
+}
+
+// resolver 测试用的 TXT 记录
+type resolver map[string][]string
+
+func (r resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return records, nil
+}
+
+func TestIssueHTTP01(t *testing.T) {
+	_, c := setup(t)
+	orderURL, order, chall := c.newOrder(ChallengeHTTP01, "www.example.com")
+	SetValidator(ChallengeHTTP01, httpServer(t, map[string]string{chall.Token: c.keyAuth(chall.Token)}))
+
+	if res := c.post(path(chall.URL), struct{}{}, nil); res.StatusCode() != http.StatusOK {
+		t.Fatalf("challenge = %d %s", res.StatusCode(), res.Body())
+	}
+	if order = c.waitOrder(orderURL); order.Status != models.AcmeReady {
+		t.Fatalf("order = %+v", order)
+	}
+
+	res := c.post(path(order.Finalize), map[string]string{"csr": c.csr("www.example.com")}, &order)
+	if res.StatusCode() != http.StatusOK || order.Status != models.AcmeValid || order.Certificate == "" {
+		t.Fatalf("finalize = %d %s", res.StatusCode(), res.Body())
+	}
+	res = c.post(path(order.Certificate), nil, nil)
+	block, _ := pem.Decode(res.Body())
+	if block == nil {
+		t.Fatalf("certificate = %d %s", res.StatusCode(), res.Body())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.example.com" {
+		t.Fatalf("certificate = %+v, %v", cert, err)
+	}
+
+	// 已签发的订单不能再次提交
+	res = c.post(path(order.Finalize), map[string]string{"csr": c.csr("www.example.com")}, nil)
+	if res.StatusCode() != http.StatusForbidden || !strings.Contains(string(res.Body()), "orderNotReady") {
+		t.Fatalf("second finalize = %d %s", res.StatusCode(), res.Body())
+	}
+}
+
+func TestDNS01(t *testing.T) {
+	_, c := setup(t)
+	orderURL, _, chall := c.newOrder(ChallengeDNS01, "api.example.com")
+	sum := sha256.Sum256([]byte(c.keyAuth(chall.Token)))
+	SetValidator(ChallengeDNS01, &DNS01{Resolver: resolver{"_acme-challenge.api.example.com": {"other", encode(sum[:])}}})
+	c.post(path(chall.URL), struct{}{}, nil)
+	if order := c.waitOrder(orderURL); order.Status != models.AcmeReady {
+		t.Fatalf("order = %+v", order)
+	}
+
+	// TXT 记录不匹配时质询、授权和订单都无效
+	orderURL, _, chall = c.newOrder(ChallengeDNS01, "bad.example.com")
+	SetValidator(ChallengeDNS01, &DNS01{Resolver: resolver{"_acme-challenge.bad.example.com": {"wrong"}}})
+	c.post(path(chall.URL), struct{}{}, nil)
+	if order := c.waitOrder(orderURL); order.Status != models.AcmeInvalid {
+		t.Fatalf("order = %+v", order)
+	}
+	var result challengeResource
+	c.post(path(chall.URL), nil, &result)
+	if result.Status != models.AcmeInvalid || result.Error == nil || result.Error.Type != "urn:ietf:params:acme:error:incorrectResponse" {
+		t.Fatalf("challenge = %+v", result)
+	}
+}
+
+// barrierRepository 读取订单后等待所有并发请求都读取到订单
+type barrierRepository struct {
+	models.Repository
+	sync.WaitGroup
+}
+
+func (r *barrierRepository) FindAcmeOrder(orderID string) (*models.AcmeOrder, error) {
+	order, err := r.Repository.FindAcmeOrder(orderID)
+	r.Done()
+	r.Wait()
+	return order, err
+}
+
+func TestFinalizeConcurrent(t *testing.T) {
+	db, c := setup(t)
+	orderURL, order, chall := c.newOrder(ChallengeHTTP01, "www.example.com")
+	SetValidator(ChallengeHTTP01, httpServer(t, map[string]string{chall.Token: c.keyAuth(chall.Token)}))
+	c.post(path(chall.URL), struct{}{}, nil)
+	if order = c.waitOrder(orderURL); order.Status != models.AcmeReady {
+		t.Fatalf("order = %+v", order)
+	}
+
+	// 所有请求都读取到 ready 状态的订单后才继续处理
+	const n = 8
+	barrier := &barrierRepository{Repository: models.Repo()}
+	barrier.Add(n)
+	models.SetRepository(barrier)
+	defer models.SetRepository(barrier.Repository)
+	bodies := make([][]byte, n)
+	for i := range bodies {
+		bodies[i] = c.jws(path(order.Finalize), map[string]string{"csr": c.csr("www.example.com")}, c.nonce())
+	}
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = c.send(path(order.Finalize), bodies[i], nil).StatusCode()
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusForbidden:
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	// 只签发一张证书：CA 证书和该证书
+	if succeeded != 1 || testenv.Count(t, db, "certificate") != 2 {
+		t.Fatalf("%d finalize requests succeeded, %d certificates saved", succeeded, testenv.Count(t, db, "certificate"))
+	}
+}
+
+func TestBadNonce(t *testing.T) {
+	_, c := setup(t)
+	nonce := c.nonce()
+	body := c.jws("/new-order", map[string]interface{}{"identifiers": []identifier{{Type: "dns", Value: "www.example.com"}}}, nonce)
+	if res := c.send("/new-order", body, nil); res.StatusCode() != http.StatusCreated {
+		t.Fatalf("new order = %d %s", res.StatusCode(), res.Body())
+	}
+	var p Problem
+	if res := c.send("/new-order", body, &p); res.StatusCode() != http.StatusBadRequest || !strings.HasSuffix(p.Type, "badNonce") {
+		t.Fatalf("replayed request = %d %+v", res.StatusCode(), p)
+	}
+}
@@ -0,0 +1,183 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+)
+
+// algorithms 支持的 JWS 签名算法
+var algorithms = []string{"RS256", "ES256", "ES384", "ES512", "EdDSA"}
+
+// jwsMessage Flattened JSON 格式的 JWS（RFC 7515 7.2.2）
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader JWS 保护头（RFC 8555 6.2）
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	JWK   json.RawMessage `json:"jwk"`
+	Kid   string          `json:"kid"`
+}
+
+// jwk JSON Web Key（RFC 7517），只包含公钥成员
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// decode 解码 base64url（无填充）
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// encode 编码为 base64url（无填充）
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// curves JWK 曲线名称
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// parseJWK 解析 JWK 公钥，支持 RSA、EC（P-256、P-384、P-521）和 OKP（Ed25519）
+func parseJWK(raw []byte) (crypto.PublicKey, error) {
+	var k jwk
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %v", err)
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("invalid RSA modulus")
+		}
+		e, err := decode(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key size must be at least 2048 bits")
+		}
+		return pub, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := decode(k.X)
+		y, errY := decode(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// pad 将大整数编码为定长的大端字节
+func pad(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// thumbprint 计算公钥的 JWK 指纹（RFC 7638），成员按字典序排列
+func thumbprint(pub crypto.PublicKey) (string, error) {
+	var canonical string
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(key.E)).Bytes()
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, encode(e), encode(key.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			key.Curve.Params().Name, encode(pad(key.X, size)), encode(pad(key.Y, size)))
+	case ed25519.PublicKey:
+		canonical = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, encode(key))
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return encode(sum[:]), nil
+}
+
+// verifyJWS 使用公钥验证 JWS 签名，算法必须与公钥类型相符
+func verifyJWS(alg string, pub crypto.PublicKey, input, sig []byte) error {
+	var h hash.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h = sha256.New()
+	case "ES384":
+		h = sha512.New384()
+	case "ES512":
+		h = sha512.New()
+	case "EdDSA":
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(key, input, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h.Write(input)
+	digest := h.Sum(nil)
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("algorithm %s does not match RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig)
+	case *ecdsa.PublicKey:
+		want := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}[alg]
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if key.Curve.Params().BitSize != want || len(sig) != 2*size {
+			return fmt.Errorf("algorithm %s does not match EC key", alg)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("algorithm %s does not match key type %T", alg, pub)
+}
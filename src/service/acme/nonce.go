@@ -0,0 +1,71 @@
+package acme
+
+import (
+	"container/list"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+const (
+	nonceLifetime = time.Hour // nonce 的有效期
+	maxNonces     = 100000    // 最多保存的未使用 nonce 数，超过时淘汰最早签发的 nonce
+)
+
+// nonceStore 已签发且未使用的 nonce，保存在内存中，重启后客户端收到 badNonce 会使用新的 nonce 重试
+// nonce 的有效期相同，按签发顺序保存即按过期时间排序，过期或超出上限时从最早签发的一端淘汰
+type nonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]*list.Element
+	order  *list.List // 元素为 *issuedNonce，按签发顺序排列
+}
+
+// issuedNonce 已签发的 nonce 及其过期时间
+type issuedNonce struct {
+	nonce   string
+	expires time.Time
+}
+
+var nonces = newNonceStore()
+
+// newNonceStore 创建空的 nonce 存储
+func newNonceStore() *nonceStore {
+	return &nonceStore{nonces: make(map[string]*list.Element), order: list.New()}
+}
+
+// issue 签发新的 nonce
+func (s *nonceStore) issue() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := encode(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		if s.order.Len() < maxNonces && now.Before(front.Value.(*issuedNonce).expires) {
+			break
+		}
+		s.remove(front)
+	}
+	s.nonces[nonce] = s.order.PushBack(&issuedNonce{nonce: nonce, expires: now.Add(nonceLifetime)})
+	return nonce
+}
+
+// use 使用 nonce，每个 nonce 只能使用一次
+func (s *nonceStore) use(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.nonces[nonce]
+	if !ok {
+		return false
+	}
+	s.remove(e)
+	return time.Now().Before(e.Value.(*issuedNonce).expires)
+}
+
+// remove 删除 nonce
+func (s *nonceStore) remove(e *list.Element) {
+	delete(s.nonces, e.Value.(*issuedNonce).nonce)
+	s.order.Remove(e)
+}
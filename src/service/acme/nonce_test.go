@@ -0,0 +1,42 @@
+package acme
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNonceBound(t *testing.T) {
+	s := newNonceStore()
+	first := s.issue()
+	var last string
+	for i := 0; i < maxNonces+10; i++ {
+		last = s.issue()
+	}
+	if len(s.nonces) > maxNonces || s.order.Len() != len(s.nonces) {
+		t.Fatalf("%d nonces, %d in order, limit %d", len(s.nonces), s.order.Len(), maxNonces)
+	}
+	// 超出上限时淘汰最早签发的 nonce
+	if s.use(first) {
+		t.Fatal("evicted nonce is still usable")
+	}
+	if !s.use(last) || s.use(last) {
+		t.Fatal("latest nonce must be usable exactly once")
+	}
+}
+
+func TestNonceExpired(t *testing.T) {
+	s := newNonceStore()
+	expired := s.issue()
+	s.order.Front().Value.(*issuedNonce).expires = time.Now().Add(-time.Second)
+	if s.use(expired) {
+		t.Fatal("expired nonce is usable")
+	}
+
+	// 签发时清理已过期的 nonce
+	stale := s.issue()
+	s.order.Front().Value.(*issuedNonce).expires = time.Now().Add(-time.Second)
+	s.issue()
+	if _, ok := s.nonces[stale]; ok || len(s.nonces) != 1 {
+		t.Fatalf("%d nonces after issuing, expired nonce kept: %v", len(s.nonces), ok)
+	}
+}
@@ -0,0 +1,672 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// identifier 订单申请的标识（RFC 8555 9.7.7）
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// orderResource 订单资源（RFC 8555 7.1.3）
+type orderResource struct {
+	Status         string       `json:"status"`
+	Expires        string       `json:"expires"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *Problem     `json:"error,omitempty"`
+}
+
+// authzResource 授权资源（RFC 8555 7.1.4）
+type authzResource struct {
+	Identifier identifier          `json:"identifier"`
+	Status     string              `json:"status"`
+	Expires    string              `json:"expires"`
+	Challenges []challengeResource `json:"challenges"`
+	Wildcard   bool                `json:"wildcard,omitempty"`
+}
+
+// challengeResource 质询资源（RFC 8555 8）
+type challengeResource struct {
+	Type      string   `json:"type"`
+	URL       string   `json:"url"`
+	Status    string   `json:"status"`
+	Token     string   `json:"token"`
+	Validated string   `json:"validated,omitempty"`
+	Error     *Problem `json:"error,omitempty"`
+}
+
+func orderURL(c *app.RequestContext, orderID string) string {
+	return resourceURL(c, "order", orderID)
+}
+
+func authzURL(c *app.RequestContext, authzID string) string {
+	return resourceURL(c, "authz", authzID)
+}
+
+func challengeURL(c *app.RequestContext, challengeID string) string {
+	return resourceURL(c, "chall", challengeID)
+}
+
+// timeString 将毫秒时间戳格式化为 RFC 3339 时间
+func timeString(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
+
+// orderStatus 订单的当前状态，待处理的订单过期后为 invalid
+func orderStatus(order *models.AcmeOrder) string {
+	if (order.Status == models.AcmePending || order.Status == models.AcmeReady) && order.Expires <= common.CreateTimestamp() {
+		return models.AcmeInvalid
+	}
+	return order.Status
+}
+
+// authzStatus 授权的当前状态，待验证的授权过期后为 expired
+func authzStatus(authz *models.AcmeAuthorization) string {
+	if authz.Status == models.AcmePending && authz.Expires <= common.CreateTimestamp() {
+		return "expired"
+	}
+	return authz.Status
+}
+
+// newToken 生成质询令牌，包含 128 位以上的随机数（RFC 8555 8.3）
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return encode(b)
+}
+
+// checkIdentifier 检查申请的域名，通配符只能位于最左侧
+func checkIdentifier(id identifier) *Problem {
+	if id.Type != "dns" {
+		return problem(http.StatusBadRequest, "unsupportedIdentifier", "Unsupported identifier type: "+id.Type)
+	}
+	name := strings.TrimPrefix(id.Value, "*.")
+	if name == "" || len(name) > 253 || strings.Contains(name, "*") || strings.HasSuffix(name, ".") || name != strings.ToLower(name) {
+		return problem(http.StatusBadRequest, "rejectedIdentifier", "Invalid domain name: "+id.Value)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return problem(http.StatusBadRequest, "rejectedIdentifier", "Invalid domain name: "+id.Value)
+		}
+		for _, ch := range label {
+			if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-') {
+				return problem(http.StatusBadRequest, "rejectedIdentifier", "Invalid domain name: "+id.Value)
+			}
+		}
+	}
+	if !strings.Contains(name, ".") {
+		return problem(http.StatusBadRequest, "rejectedIdentifier", "Domain name must be fully qualified: "+id.Value)
+	}
+	return nil
+}
+
+// loadOrder 查询订单及其授权，订单不属于请求的账户时返回错误
+func loadOrder(orderID string, account *models.AcmeAccount) (*models.AcmeOrder, []models.AcmeAuthorization, *Problem) {
+	order, err := models.FindAcmeOrder(orderID)
+	if err != nil {
+		hlog.Error("Failed to query ACME order. error: ", err)
+		return nil, nil, serverInternal("Failed to query order.")
+	}
+	if order.ID == 0 {
+		return nil, nil, notFound("Order not found.")
+	}
+	if order.AccountID != account.AccountID {
+		return nil, nil, unauthorized("Order does not belong to the account.")
+	}
+	authzs, err := models.FindAcmeAuthorizationsByOrder(orderID)
+	if err != nil {
+		hlog.Error("Failed to query ACME authorizations. error: ", err)
+		return nil, nil, serverInternal("Failed to query authorizations.")
+	}
+	return order, authzs, nil
+}
+
+func newOrderResource(c *app.RequestContext, order *models.AcmeOrder, authzs []models.AcmeAuthorization) *orderResource {
+	res := &orderResource{
+		Status:         orderStatus(order),
+		Expires:        timeString(order.Expires),
+		Authorizations: make([]string, 0, len(authzs)),
+		Finalize:       orderURL(c, order.OrderID) + "/finalize",
+		Error:          unmarshalProblem(order.Error),
+	}
+	json.Unmarshal([]byte(order.Identifiers), &res.Identifiers)
+	for _, authz := range authzs {
+		res.Authorizations = append(res.Authorizations, authzURL(c, authz.AuthzID))
+	}
+	if order.CertID != nil && *order.CertID != "" {
+		res.Certificate = resourceURL(c, "cert", *order.CertID)
+	}
+	return res
+}
+
+func newChallengeResource(c *app.RequestContext, chall *models.AcmeChallenge) challengeResource {
+	res := challengeResource{
+		Type:   chall.Type,
+		URL:    challengeURL(c, chall.ChallengeID),
+		Status: chall.Status,
+		Token:  chall.Token,
+		Error:  unmarshalProblem(chall.Error),
+	}
+	if chall.Validated != 0 {
+		res.Validated = timeString(chall.Validated)
+	}
+	return res
+}
+
+// NewOrder 创建订单，每个域名生成一个授权，通配符域名只提供 dns-01 质询
+func NewOrder() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		var req struct {
+			Identifiers []identifier `json:"identifiers"`
+			NotBefore   string       `json:"notBefore"`
+			NotAfter    string       `json:"notAfter"`
+		}
+		if p := r.decode(&req); p != nil {
+			writeProblem(c, p)
+			return
+		}
+		if req.NotBefore != "" || req.NotAfter != "" {
+			writeProblem(c, malformed("notBefore and notAfter are not supported, the validity is set by the signing profile."))
+			return
+		}
+		if len(req.Identifiers) == 0 {
+			writeProblem(c, malformed("identifiers is required."))
+			return
+		}
+		seen := make(map[string]bool)
+		var identifiers []identifier
+		for _, id := range req.Identifiers {
+			if p := checkIdentifier(id); p != nil {
+				writeProblem(c, p)
+				return
+			}
+			if !seen[id.Value] {
+				seen[id.Value] = true
+				identifiers = append(identifiers, id)
+			}
+		}
+
+		now := common.CreateTimestamp()
+		expires := now + orderLifetime().Milliseconds()
+		data, _ := json.Marshal(identifiers)
+		order := models.AcmeOrder{
+			OrderID:     common.CreateUuid(),
+			AccountID:   r.account.AccountID,
+			Status:      models.AcmePending,
+			Identifiers: string(data),
+			Expires:     expires,
+			CreateTime:  now,
+		}
+		var authzs []models.AcmeAuthorization
+		err := models.Transaction(func(tx models.Repository) error {
+			if err := tx.InstallAcmeOrder(order); err != nil {
+				return err
+			}
+			for _, id := range identifiers {
+				authz := models.AcmeAuthorization{
+					AuthzID:   common.CreateUuid(),
+					OrderID:   order.OrderID,
+					AccountID: order.AccountID,
+					Type:      id.Type,
+					Value:     strings.TrimPrefix(id.Value, "*."),
+					Wildcard:  strings.HasPrefix(id.Value, "*."),
+					Status:    models.AcmePending,
+					Expires:   expires,
+				}
+				if err := tx.InstallAcmeAuthorization(authz); err != nil {
+					return err
+				}
+				types := []string{ChallengeHTTP01, ChallengeDNS01}
+				if authz.Wildcard {
+					types = []string{ChallengeDNS01}
+				}
+				for _, typ := range types {
+					if err := tx.InstallAcmeChallenge(models.AcmeChallenge{
+						ChallengeID: common.CreateUuid(),
+						AuthzID:     authz.AuthzID,
+						Type:        typ,
+						Token:       newToken(),
+						Status:      models.AcmePending,
+					}); err != nil {
+						return err
+					}
+				}
+				authzs = append(authzs, authz)
+			}
+			return nil
+		})
+		if err != nil {
+			hlog.Error("Failed to save ACME order. error: ", err)
+			writeProblem(c, serverInternal("Failed to save order."))
+			return
+		}
+		c.Header("Location", orderURL(c, order.OrderID))
+		writeJSON(c, http.StatusCreated, newOrderResource(c, &order, authzs))
+	}
+}
+
+// Order 查询订单
+func Order() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		order, authzs, p := loadOrder(c.Param("id"), r.account)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		writeJSON(c, http.StatusOK, newOrderResource(c, order, authzs))
+	}
+}
+
+// loadAuthorization 查询授权，授权不属于请求的账户时返回错误
+func loadAuthorization(authzID string, account *models.AcmeAccount) (*models.AcmeAuthorization, *Problem) {
+	authz, err := models.FindAcmeAuthorization(authzID)
+	if err != nil {
+		hlog.Error("Failed to query ACME authorization. error: ", err)
+		return nil, serverInternal("Failed to query authorization.")
+	}
+	if authz.ID == 0 {
+		return nil, notFound("Authorization not found.")
+	}
+	if authz.AccountID != account.AccountID {
+		return nil, unauthorized("Authorization does not belong to the account.")
+	}
+	return authz, nil
+}
+
+// Authorization 查询授权或停用授权
+func Authorization() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		authz, p := loadAuthorization(c.Param("id"), r.account)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		if !r.postAsGet() {
+			var req struct {
+				Status string `json:"status"`
+			}
+			if p := r.decode(&req); p != nil {
+				writeProblem(c, p)
+				return
+			}
+			if req.Status != models.AcmeDeactivated {
+				writeProblem(c, malformed("Authorization status can only be changed to deactivated."))
+				return
+			}
+			if err := models.UpdateAcmeAuthorizationStatus(authz.AuthzID, models.AcmeDeactivated); err != nil {
+				hlog.Error("Failed to update ACME authorization. error: ", err)
+				writeProblem(c, serverInternal("Failed to update authorization."))
+				return
+			}
+			authz.Status = models.AcmeDeactivated
+		}
+		challs, err := models.FindAcmeChallengesByAuthorization(authz.AuthzID)
+		if err != nil {
+			hlog.Error("Failed to query ACME challenges. error: ", err)
+			writeProblem(c, serverInternal("Failed to query challenges."))
+			return
+		}
+		res := &authzResource{
+			Identifier: identifier{Type: authz.Type, Value: authz.Value},
+			Status:     authzStatus(authz),
+			Expires:    timeString(authz.Expires),
+			Challenges: make([]challengeResource, 0, len(challs)),
+			Wildcard:   authz.Wildcard,
+		}
+		for i := range challs {
+			res.Challenges = append(res.Challenges, newChallengeResource(c, &challs[i]))
+		}
+		writeJSON(c, http.StatusOK, res)
+	}
+}
+
+// Challenge 查询质询或请求服务端验证质询，验证在后台进行
+func Challenge() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		chall, err := models.FindAcmeChallenge(c.Param("id"))
+		if err != nil {
+			hlog.Error("Failed to query ACME challenge. error: ", err)
+			writeProblem(c, serverInternal("Failed to query challenge."))
+			return
+		}
+		if chall.ID == 0 {
+			writeProblem(c, notFound("Challenge not found."))
+			return
+		}
+		authz, p := loadAuthorization(chall.AuthzID, r.account)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		// 空对象表示客户端已完成部署，请求验证；POST-as-GET 只查询状态
+		if !r.postAsGet() && chall.Status == models.AcmePending {
+			if status := authzStatus(authz); status != models.AcmePending {
+				writeProblem(c, malformed("Authorization is "+status+"."))
+				return
+			}
+			chall.Status = models.AcmeProcessing
+			if err := models.UpdateAcmeChallenge(*chall); err != nil {
+				hlog.Error("Failed to update ACME challenge. error: ", err)
+				writeProblem(c, serverInternal("Failed to update challenge."))
+				return
+			}
+			go validate(*r.account, *authz, *chall)
+		}
+		c.Header("Link", link(authzURL(c, authz.AuthzID), "up"))
+		c.Header("Replay-Nonce", nonces.issue())
+		c.Response.Header.Add("Link", link(directoryURL(c), "index"))
+		body, _ := json.Marshal(newChallengeResource(c, chall))
+		c.Data(http.StatusOK, "application/json", body)
+	}
+}
+
+// validate 验证质询，并根据结果更新授权和订单的状态
+func validate(account models.AcmeAccount, authz models.AcmeAuthorization, chall models.AcmeChallenge) {
+	ctx, cancel := context.WithTimeout(context.Background(), validationTimeout)
+	defer cancel()
+
+	status := models.AcmeValid
+	v := validator(chall.Type)
+	if v == nil {
+		status = models.AcmeInvalid
+		chall.Error = marshalProblem(serverInternal("No validator for challenge type " + chall.Type + "."))
+	} else if err := v.Validate(ctx, authz.Value, chall.Token, chall.Token+"."+account.Thumbprint); err != nil {
+		status = models.AcmeInvalid
+		chall.Error = marshalProblem(problem(http.StatusForbidden, "incorrectResponse", err.Error()))
+		hlog.Infof("ACME challenge %s for %s failed: %v", chall.ChallengeID, authz.Value, err)
+	} else {
+		chall.Validated = common.CreateTimestamp()
+	}
+	chall.Status = status
+
+	err := models.Transaction(func(tx models.Repository) error {
+		if err := tx.UpdateAcmeChallenge(chall); err != nil {
+			return err
+		}
+		if err := tx.UpdateAcmeAuthorizationStatus(authz.AuthzID, status); err != nil {
+			return err
+		}
+		order, err := tx.FindAcmeOrder(authz.OrderID)
+		if err != nil || order.Status != models.AcmePending {
+			return err
+		}
+		authzs, err := tx.FindAcmeAuthorizationsByOrder(order.OrderID)
+		if err != nil {
+			return err
+		}
+		next := models.AcmeReady
+		for _, a := range authzs {
+			if a.AuthzID == authz.AuthzID {
+				a.Status = status
+			}
+			if a.Status == models.AcmeInvalid || a.Status == models.AcmeDeactivated {
+				next = models.AcmeInvalid
+				break
+			}
+			if a.Status != models.AcmeValid {
+				next = models.AcmePending
+			}
+		}
+		if next == models.AcmePending {
+			return nil
+		}
+		order.Status = next
+		return tx.UpdateAcmeOrder(*order)
+	})
+	if err != nil {
+		hlog.Error("Failed to save ACME challenge result. error: ", err)
+	}
+}
+
+// csrNames 证书请求中的域名，包括 CN；请求包含其他类型的名称时返回错误
+func csrNames(csr *x509.CertificateRequest) ([]string, *Problem) {
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, problem(http.StatusBadRequest, "badCSR", "CSR may only contain DNS names.")
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append([]string{csr.Subject.CommonName}, csr.DNSNames...) {
+		name = strings.ToLower(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Finalize 提交证书请求，证书请求中的域名须与订单一致，签发后订单状态为 valid
+func Finalize() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		order, authzs, p := loadOrder(c.Param("id"), r.account)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		if status := orderStatus(order); status != models.AcmeReady {
+			writeProblem(c, problem(http.StatusForbidden, "orderNotReady", "Order is "+status+"."))
+			return
+		}
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		if p := r.decode(&req); p != nil {
+			writeProblem(c, p)
+			return
+		}
+		der, err := decode(req.CSR)
+		if err != nil {
+			writeProblem(c, problem(http.StatusBadRequest, "badCSR", "csr must be base64url encoded DER."))
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err == nil {
+			err = csr.CheckSignature()
+		}
+		if err != nil {
+			writeProblem(c, problem(http.StatusBadRequest, "badCSR", "Invalid CSR: "+err.Error()))
+			return
+		}
+		names, p := csrNames(csr)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		var identifiers []identifier
+		json.Unmarshal([]byte(order.Identifiers), &identifiers)
+		want := make([]string, 0, len(identifiers))
+		for _, id := range identifiers {
+			want = append(want, id.Value)
+		}
+		sort.Strings(want)
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			writeProblem(c, problem(http.StatusBadRequest, "badCSR", "CSR names do not match the order identifiers."))
+			return
+		}
+
+		// 并发提交时只有将订单从 ready 改为 processing 的请求签发证书
+		updated, err := models.UpdateAcmeOrderStatus(order.OrderID, models.AcmeReady, models.AcmeProcessing)
+		if err != nil {
+			hlog.Error("Failed to update ACME order. error: ", err)
+			writeProblem(c, serverInternal("Failed to update order."))
+			return
+		}
+		if !updated {
+			writeProblem(c, problem(http.StatusForbidden, "orderNotReady", "Order is already being finalized."))
+			return
+		}
+		order.Status = models.AcmeProcessing
+
+		cn := csr.Subject.CommonName
+		if cn == "" {
+			cn = identifiers[0].Value
+		}
+		record := audit.New(c, audit.ActionIssue, "", audit.ResultFailure)
+		record.UserID, record.Account = order.AccountID, "acme"
+		cert, result, err := issue(csr, cn, want, order.AccountID)
+		if err != nil {
+			hlog.Errorf("Failed to issue certificate for ACME order %s. error: %v", order.OrderID, err)
+			p := serverInternal("Failed to issue certificate.")
+			if errors.Is(err, cacert.ErrRejected) {
+				p = problem(http.StatusBadRequest, "badCSR", err.Error())
+			}
+			order.Status = models.AcmeInvalid
+			order.Error = marshalProblem(p)
+			if err := models.UpdateAcmeOrder(*order); err != nil {
+				hlog.Error("Failed to update ACME order. error: ", err)
+			}
+			record.Detail = err.Error()
+			audit.Log(record)
+			writeProblem(c, p)
+			return
+		}
+		record.CertID, record.Result = result.CertID, audit.ResultSuccess
+		record.Detail = "serial " + signature.SerialString(cert.SerialNumber)
+		audit.Log(record)
+
+		order.Status = models.AcmeValid
+		order.CertID = &result.CertID
+		if err := models.UpdateAcmeOrder(*order); err != nil {
+			hlog.Error("Failed to update ACME order. error: ", err)
+			writeProblem(c, serverInternal("Failed to update order."))
+			return
+		}
+		hlog.Infof("ACME order %s finalized, certificate %s issued", order.OrderID, result.CertID)
+		c.Header("Location", orderURL(c, order.OrderID))
+		writeJSON(c, http.StatusOK, newOrderResource(c, order, authzs))
+	}
+}
+
+// issue 使用配置的 CA 签发证书，证书的使用者可选名称为订单中的域名
+func issue(csr *x509.CertificateRequest, cn string, names []string, accountID string) (*x509.Certificate, *cacert.IssueResult, error) {
+	ca, err := cacert.LoadCA(settings().CA)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca.IssueCSR(&cacert.CSRIssue{
+		CSR:     csr,
+		Profile: signingProfile(),
+		Expiry:  settings().Expiry,
+		Subject: &pkix.Name{CommonName: cn},
+		Sans:    &cacert.Sans{DNS: names},
+		UserID:  accountID,
+		Account: "acme",
+	})
+}
+
+// Certificate 下载订单签发的证书及证书链（PEM）
+func Certificate() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authKID)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		certID := c.Param("certid")
+		order, err := models.FindAcmeOrderByCertID(certID)
+		if err != nil {
+			hlog.Error("Failed to query ACME order. error: ", err)
+			writeProblem(c, serverInternal("Failed to query order."))
+			return
+		}
+		if order.ID == 0 {
+			writeProblem(c, notFound("Certificate not found."))
+			return
+		}
+		if order.AccountID != r.account.AccountID {
+			writeProblem(c, unauthorized("Certificate does not belong to the account."))
+			return
+		}
+		record, err := models.FindCertificateByCertID(certID)
+		if err != nil || record.CertID == nil {
+			hlog.Error("Failed to query certificate. error: ", err)
+			writeProblem(c, serverInternal("Failed to query certificate."))
+			return
+		}
+		version, err := models.FindLatestCertVersion(certID)
+		if err != nil || version.ID == 0 {
+			hlog.Error("Failed to query certificate version. error: ", err)
+			writeProblem(c, serverInternal("Failed to query certificate."))
+			return
+		}
+		chain, err := cacert.IssuerChain(record.ParentID)
+		if err != nil {
+			hlog.Error("Failed to load certificate chain. error: ", err)
+			writeProblem(c, serverInternal("Failed to load certificate chain."))
+			return
+		}
+		data := []byte(version.Cert)
+		for _, cert := range chain {
+			data = append(data, signature.CertToPEM(cert)...)
+		}
+		c.Header("Replay-Nonce", nonces.issue())
+		c.Header("Link", link(directoryURL(c), "index"))
+		c.Data(http.StatusOK, "application/pem-certificate-chain", data)
+	}
+}
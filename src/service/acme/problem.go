@@ -0,0 +1,70 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// errorNS ACME 错误类型的命名空间（RFC 8555 6.7）
+const errorNS = "urn:ietf:params:acme:error:"
+
+// Problem ACME 错误（RFC 7807 problem document）
+type Problem struct {
+	Type       string   `json:"type"`
+	Detail     string   `json:"detail,omitempty"`
+	Status     int      `json:"status"`
+	Algorithms []string `json:"algorithms,omitempty"` // badSignatureAlgorithm 时返回支持的算法
+}
+
+func (p *Problem) Error() string {
+	return p.Type + ": " + p.Detail
+}
+
+// problem 创建 ACME 错误，typ 为不含命名空间的错误类型，如 malformed、unauthorized
+func problem(status int, typ, detail string) *Problem {
+	return &Problem{Type: errorNS + typ, Detail: detail, Status: status}
+}
+
+func malformed(detail string) *Problem {
+	return problem(http.StatusBadRequest, "malformed", detail)
+}
+
+func unauthorized(detail string) *Problem {
+	return problem(http.StatusForbidden, "unauthorized", detail)
+}
+
+func notFound(detail string) *Problem {
+	return problem(http.StatusNotFound, "malformed", detail)
+}
+
+func serverInternal(detail string) *Problem {
+	return problem(http.StatusInternalServerError, "serverInternal", detail)
+}
+
+// marshalProblem 将错误编码为 JSON，保存在订单和质询中
+func marshalProblem(p *Problem) string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+// unmarshalProblem 解析保存的错误，为空时返回 nil
+func unmarshalProblem(s string) *Problem {
+	if s == "" {
+		return nil
+	}
+	var p Problem
+	if json.Unmarshal([]byte(s), &p) != nil {
+		return nil
+	}
+	return &p
+}
+
+// writeProblem 返回 ACME 错误，同时返回新的 nonce 以便客户端重试
+func writeProblem(c *app.RequestContext, p *Problem) {
+	c.Header("Replay-Nonce", nonces.issue())
+	c.Header("Link", link(directoryURL(c), "index"))
+	body, _ := json.Marshal(p)
+	c.Data(p.Status, "application/problem+json", body)
+}
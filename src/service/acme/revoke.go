@@ -0,0 +1,124 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"spki/src/models"
+	"spki/src/service/audit"
+	"spki/src/service/revoke"
+	"spki/src/signature"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// RevokeCert 吊销证书（RFC 8555 7.6），请求须使用签发该证书的账户或证书的私钥签名
+func RevokeCert() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		r, p := parseRequest(c, authAny)
+		if p != nil {
+			writeProblem(c, p)
+			return
+		}
+		var req struct {
+			Certificate string `json:"certificate"`
+			Reason      *int   `json:"reason"`
+		}
+		if p := r.decode(&req); p != nil {
+			writeProblem(c, p)
+			return
+		}
+		code := revoke.Unspecified
+		if req.Reason != nil {
+			code = *req.Reason
+		}
+		if revoke.ReasonName(code) == "" {
+			writeProblem(c, problem(http.StatusBadRequest, "badRevocationReason", "Unsupported revocation reason."))
+			return
+		}
+		der, err := decode(req.Certificate)
+		if err != nil {
+			writeProblem(c, malformed("certificate must be base64url encoded DER."))
+			return
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			writeProblem(c, malformed("Invalid certificate: "+err.Error()))
+			return
+		}
+		version, err := models.FindCertVersionBySerial(signature.SerialString(cert.SerialNumber))
+		if err != nil {
+			hlog.Error("Failed to query certificate version. error: ", err)
+			writeProblem(c, serverInternal("Failed to query certificate."))
+			return
+		}
+		if version.ID == 0 || version.Cert == "" {
+			writeProblem(c, notFound("Certificate not found."))
+			return
+		}
+		if issued, err := signature.ParseCertPEM([]byte(version.Cert)); err != nil || !issued.Equal(cert) {
+			writeProblem(c, notFound("Certificate not found."))
+			return
+		}
+		if p := authorizeRevocation(r, cert, version.CertID); p != nil {
+			writeProblem(c, p)
+			return
+		}
+		record, err := models.FindCertificateByCertID(version.CertID)
+		if err != nil || record.CertID == nil {
+			hlog.Error("Failed to query certificate. error: ", err)
+			writeProblem(c, serverInternal("Failed to query certificate."))
+			return
+		}
+
+		entry := audit.New(c, audit.ActionRevoke, version.CertID, audit.ResultFailure)
+		entry.Account = "acme"
+		if r.account != nil {
+			entry.UserID = r.account.AccountID
+		}
+		entry.Detail = "serial " + version.Serial
+		_, err = revoke.Certificate(record, version, code, 0)
+		if err != nil {
+			audit.Log(entry)
+		}
+		switch {
+		case errors.Is(err, revoke.ErrRevoked):
+			writeProblem(c, problem(http.StatusBadRequest, "alreadyRevoked", "Certificate has already been revoked."))
+		case errors.Is(err, revoke.ErrExpired):
+			writeProblem(c, unauthorized("Certificate has expired."))
+		case err != nil:
+			hlog.Error("Failed to revoke certificate. error: ", err)
+			writeProblem(c, serverInternal("Failed to revoke certificate."))
+		default:
+			entry.Result = audit.ResultSuccess
+			audit.Log(entry)
+			writeJSON(c, http.StatusOK, struct{}{})
+		}
+	}
+}
+
+// authorizeRevocation 检查请求方是否可以吊销证书：签发该证书的账户，或持有证书私钥
+func authorizeRevocation(r *request, cert *x509.Certificate, certID string) *Problem {
+	if r.account == nil {
+		want, err := thumbprint(cert.PublicKey)
+		got, _ := thumbprint(r.key)
+		if err != nil || want != got {
+			return unauthorized("The request is not signed by the certificate key.")
+		}
+		return nil
+	}
+	order, err := models.FindAcmeOrderByCertID(certID)
+	if err != nil {
+		hlog.Error("Failed to query ACME order. error: ", err)
+		return serverInternal("Failed to query order.")
+	}
+	if order.ID == 0 || order.AccountID != r.account.AccountID {
+		return unauthorized("Certificate was not issued to the account.")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 质询类型
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// validationTimeout 单次验证的超时时间
+const validationTimeout = 30 * time.Second
+
+// Validator 质询验证方式，domain 为待验证的域名，keyAuth 为 token.指纹
+type Validator interface {
+	Validate(ctx context.Context, domain, token, keyAuth string) error
+}
+
+// HTTP01 http-01 验证：访问 http://<domain>:<port>/.well-known/acme-challenge/<token>，响应内容须为 keyAuth
+type HTTP01 struct {
+	Port   int // 为 0 时使用 80
+	Client *http.Client
+}
+
+func (v *HTTP01) Validate(ctx context.Context, domain, token, keyAuth string) error {
+	host := domain
+	if v.Port != 0 && v.Port != 80 {
+		host = net.JoinHostPort(domain, strconv.Itoa(v.Port))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch challenge response: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s when fetching challenge response", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8192))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return fmt.Errorf("challenge response does not match the key authorization")
+	}
+	return nil
+}
+
+// TXTResolver 查询 TXT 记录，*net.Resolver 满足该接口
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNS01 dns-01 验证：_acme-challenge.<domain> 的 TXT 记录须包含 base64url(SHA-256(keyAuth))
+type DNS01 struct {
+	Resolver TXTResolver // 为 nil 时使用系统配置
+}
+
+func (v *DNS01) Validate(ctx context.Context, domain, token, keyAuth string) error {
+	resolver := v.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	name := "_acme-challenge." + domain
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to look up TXT record of %s: %v", name, err)
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	want := encode(sum[:])
+	for _, record := range records {
+		if record == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("no matching TXT record found for %s", name)
+}
+
+// NewResolver 创建使用指定 DNS 服务器（host:port）的解析器
+func NewResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]Validator{
+		ChallengeHTTP01: &HTTP01{},
+		ChallengeDNS01:  &DNS01{},
+	}
+)
+
+// SetValidator 设置质询类型的验证方式，用于替换为测试用的 HTTP 服务器或解析器
+func SetValidator(typ string, v Validator) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[typ] = v
+}
+
+// validator 获取质询类型的验证方式
+func validator(typ string) Validator {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	return validators[typ]
+}
@@ -0,0 +1,215 @@
+package alarm
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+const (
+	defaultInterval = time.Hour // 默认后台扫描间隔
+	maxDays         = 3650      // 查询即将到期证书的最大天数
+	day             = 24 * time.Hour
+)
+
+// defaultThresholds 默认告警阈值（天）
+var defaultThresholds = []int{30, 7, 1}
+
+// Notice 证书到期告警
+type Notice struct {
+	CertID         string `json:"certid"`
+	UserID         string `json:"user_id"`
+	Title          string `json:"title,omitempty"`
+	Subject        string `json:"subject"`
+	Genre          int    `json:"genre"`
+	ParentID       string `json:"parent_id,omitempty"`
+	Serial         string `json:"serial"`
+	ExpirationTime int64  `json:"expiration_time"`
+	DaysLeft       int    `json:"days_left"` // 剩余有效期（天），不足一天为 0
+	Threshold      int    `json:"threshold"` // 触发告警的阈值（天）
+}
+
+// Notifier 告警通知方式，返回错误时该告警会在下次扫描时重新发送
+type Notifier interface {
+	Notify(n Notice) error
+}
+
+// logNotifier 将告警写入日志
+type logNotifier struct{}
+
+func (logNotifier) Notify(n Notice) error {
+	hlog.Warnf("Certificate %s (serial %s, subject %s) expires in %d days at %s",
+		n.CertID, n.Serial, n.Subject, n.DaysLeft, time.UnixMilli(n.ExpirationTime).Format(time.RFC3339))
+	return nil
+}
+
+var (
+	mu        sync.Mutex
+	notifiers = []Notifier{logNotifier{}}
+)
+
+// Register 添加告警通知方式
+func Register(n Notifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	notifiers = append(notifiers, n)
+}
+
+// interval 后台扫描间隔
+func interval() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Alarm.Interval > 0 {
+		return config.AppCfg.Spki.Alarm.Interval
+	}
+	return defaultInterval
+}
+
+// thresholds 告警阈值（天），从大到小排列，忽略不大于 0 的值
+func thresholds() []int {
+	src := defaultThresholds
+	if config.AppCfg != nil && len(config.AppCfg.Spki.Alarm.Thresholds) > 0 {
+		src = config.AppCfg.Spki.Alarm.Thresholds
+	}
+	var t []int
+	for _, v := range src {
+		if v > 0 {
+			t = append(t, v)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(t)))
+	return t
+}
+
+// due 返回剩余有效期应触发的告警阈值，无需告警时返回 0
+// alarm 为已发送告警的最小阈值，同时越过多个阈值时只按最小的阈值告警一次
+func due(left time.Duration, alarm int, thresholds []int) int {
+	threshold := 0
+	for _, t := range thresholds {
+		if left <= time.Duration(t)*day && (alarm == 0 || t < alarm) {
+			threshold = t
+		}
+	}
+	return threshold
+}
+
+// newNotice 根据证书版本生成告警
+func newNotice(v *models.ExpiringVersion, now time.Time, threshold int) Notice {
+	n := Notice{
+		CertID:         v.CertID,
+		Serial:         v.Serial,
+		ExpirationTime: v.ExpirationTime,
+		DaysLeft:       int(time.UnixMilli(v.ExpirationTime).Sub(now) / day),
+		Threshold:      threshold,
+	}
+	if v.UserID != nil {
+		n.UserID = *v.UserID
+	}
+	if v.Title != nil {
+		n.Title = *v.Title
+	}
+	if v.Subject != nil {
+		n.Subject = *v.Subject
+	}
+	if v.Genre != nil {
+		n.Genre = *v.Genre
+	}
+	if v.ParentID != nil {
+		n.ParentID = *v.ParentID
+	}
+	return n
+}
+
+// notify 使用所有通知方式发送告警，任一方式失败时返回错误
+func notify(n Notice) error {
+	mu.Lock()
+	list := append([]Notifier(nil), notifiers...)
+	mu.Unlock()
+	var first error
+	for _, notifier := range list {
+		if err := notifier.Notify(n); err != nil {
+			hlog.Errorf("Failed to send expiry alarm of certificate %s: %v", n.CertID, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Scan 扫描即将到期的证书并发送告警，在 Alarm 中记录已告警的阈值，避免重复发送
+func Scan() {
+	t := thresholds()
+	if len(t) == 0 {
+		return
+	}
+	now := time.Now()
+	versions, err := models.FindExpiringCertVersions(now.UnixMilli(), now.Add(time.Duration(t[0])*day).UnixMilli())
+	if err != nil {
+		hlog.Error("Failed to query expiring certificates: ", err)
+		return
+	}
+	for i := range versions {
+		v := &versions[i]
+		threshold := due(time.UnixMilli(v.ExpirationTime).Sub(now), v.Alarm, t)
+		if threshold == 0 {
+			continue
+		}
+		if err := notify(newNotice(v, now, threshold)); err != nil {
+			continue
+		}
+		if err := models.UpdateCertVersionAlarm(v.ID, threshold); err != nil {
+			hlog.Errorf("Failed to record expiry alarm of certificate %s: %v", v.CertID, err)
+		}
+	}
+}
+
+// Start 启动后台任务，定时扫描即将到期的证书
+func Start() {
+	go func() {
+		ticker := time.NewTicker(interval())
+		defer ticker.Stop()
+		Scan()
+		for range ticker.C {
+			Scan()
+		}
+	}()
+}
+
+// Expiring 查询即将到期的有效证书，days 为天数，默认为最大的告警阈值
+func Expiring() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		days := 0
+		if t := thresholds(); len(t) > 0 {
+			days = t[0]
+		}
+		if s := c.Query("days"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v <= 0 || v > maxDays {
+				c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "days must be an integer between 1 and "+strconv.Itoa(maxDays)+".", ""))
+				return
+			}
+			days = v
+		}
+
+		now := time.Now()
+		versions, err := models.FindExpiringCertVersions(now.UnixMilli(), now.Add(time.Duration(days)*day).UnixMilli())
+		if err != nil {
+			hlog.Error("Failed to query expiring certificates. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query expiring certificates.", ""))
+			return
+		}
+		items := make([]Notice, 0, len(versions))
+		for i := range versions {
+			items = append(items, newNotice(&versions[i], now, versions[i].Alarm))
+		}
+		c.JSON(http.StatusOK, answer.ResBody(answer.EcodeOK, "", items))
+	}
+}
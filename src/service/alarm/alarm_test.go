@@ -0,0 +1,123 @@
+package alarm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// recorder 记录收到的告警，err 不为 nil 时发送失败
+type recorder struct {
+	notices []Notice
+	err     error
+}
+
+func (r *recorder) Notify(n Notice) error {
+	r.notices = append(r.notices, n)
+	return r.err
+}
+
+// useRecorder 将告警通知方式替换为 recorder，测试结束后恢复
+func useRecorder(t *testing.T) *recorder {
+	r := &recorder{}
+	old := notifiers
+	notifiers = []Notifier{r}
+	t.Cleanup(func() { notifiers = old })
+	return r
+}
+
+func TestDue(t *testing.T) {
+	thresholds := []int{30, 7, 1}
+	for _, tt := range []struct {
+		left  time.Duration
+		alarm int
+		want  int
+	}{
+		{40 * day, 0, 0},
+		{30 * day, 0, 30},
+		{20 * day, 30, 0},
+		{6 * day, 30, 7},
+		{6 * day, 7, 0},
+		{12 * time.Hour, 0, 1}, // 同时越过多个阈值时只按最小的阈值告警
+		{12 * time.Hour, 1, 0},
+	} {
+		if got := due(tt.left, tt.alarm, thresholds); got != tt.want {
+			t.Errorf("due(%v, %d) = %d, want %d", tt.left, tt.alarm, got, tt.want)
+		}
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	cfg := testenv.Config(t)
+	if got := thresholds(); !reflect.DeepEqual(got, defaultThresholds) {
+		t.Fatalf("default thresholds = %v", got)
+	}
+	cfg.Spki.Alarm.Thresholds = []int{1, 0, 14, -3, 60}
+	if got := thresholds(); !reflect.DeepEqual(got, []int{60, 14, 1}) {
+		t.Fatalf("thresholds = %v", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	testenv.Open(t)
+	testenv.Config(t)
+	r := useRecorder(t)
+	caID, ca, caSigner := testenv.CA(t, "Alarm Root")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certID, cert := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "device")
+
+	// 发送失败时不记录，下次扫描时重新发送
+	r.err = errors.New("unavailable")
+	Scan()
+	r.err = nil
+	Scan()
+	Scan()
+	if len(r.notices) != 2 {
+		t.Fatalf("notices = %+v", r.notices)
+	}
+	n := r.notices[1]
+	if n.CertID != certID || n.Threshold != 1 || n.DaysLeft != 0 || n.ParentID != caID || n.Subject != "/CN=device" || n.ExpirationTime != cert.NotAfter.UnixMilli() {
+		t.Fatalf("notice = %+v", n)
+	}
+	if version, _ := models.FindLatestCertVersion(certID); version.Alarm != 1 {
+		t.Fatalf("alarm = %d", version.Alarm)
+	}
+}
+
+func TestExpiring(t *testing.T) {
+	testenv.Open(t)
+	testenv.Config(t)
+	caID, ca, caSigner := testenv.CA(t, "Alarm Root")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certID, _ := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "device")
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.GET("/spki/certificates/expiring", Expiring())
+
+	// 十年有效期的 CA 证书不在查询范围内
+	for _, query := range []string{"", "?days=1", "?days=3650"} {
+		res := ut.PerformRequest(engine, http.MethodGet, "/spki/certificates/expiring"+query, nil).Result()
+		var body struct {
+			Payload []Notice `json:"payload"`
+		}
+		if res.StatusCode() != http.StatusOK || json.Unmarshal(res.Body(), &body) != nil || len(body.Payload) != 1 || body.Payload[0].CertID != certID {
+			t.Errorf("expiring %s = %d %s", query, res.StatusCode(), res.Body())
+		}
+	}
+	for _, query := range []string{"?days=0", "?days=3651", "?days=week"} {
+		if res := ut.PerformRequest(engine, http.MethodGet, "/spki/certificates/expiring"+query, nil).Result(); res.StatusCode() != http.StatusBadRequest {
+			t.Errorf("expiring %s = %d", query, res.StatusCode())
+		}
+	}
+}
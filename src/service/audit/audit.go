@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"spki/src/config"
+	"spki/src/pkg/common"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// 审计操作
+const (
+	ActionCAInit       = "ca.init"         // 创建根 CA
+	ActionIntermediate = "ca.intermediate" // 创建中间 CA
+	ActionCAUpdateURLs = "ca.update_urls"  // 修改 CA 签发证书时写入的地址
+	ActionIssue        = "cert.issue"      // 签发证书
+	ActionSignCSR      = "cert.sign"       // 签署证书请求
+	ActionRenew        = "cert.renew"      // 续期证书
+	ActionRekey        = "cert.rekey"      // 更换证书私钥
+	ActionRevoke       = "cert.revoke"     // 吊销证书
+	ActionKeyExport    = "key.export"      // 导出私钥
+	ActionAuthDeny     = "auth.deny"       // 拒绝访问
+)
+
+// 审计结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+)
+
+const (
+	defaultBuffer  = 10000            // 默认缓冲的审计记录数
+	defaultTimeout = 10 * time.Second // 默认发送超时时间
+	batchSize      = 100              // 每次发送的最大记录数
+	minRetry       = time.Second      // 首次重试的等待时间，之后每次加倍
+	maxRetry       = time.Minute      // 重试的最长等待时间
+	targetKey      = "auditTarget"    // 请求上下文中保存审计目标证书 ID 的键
+)
+
+// Record 审计记录
+type Record struct {
+	ID       string `json:"id"`
+	Time     int64  `json:"time"`
+	UserID   string `json:"user_id"`
+	Account  string `json:"account"`
+	RemoteIP string `json:"remote_ip"`
+	Action   string `json:"action"`
+	CertID   string `json:"certid,omitempty"` // 操作的证书 ID
+	Result   string `json:"result"`
+	Status   int    `json:"status,omitempty"` // HTTP 响应状态码
+	Detail   string `json:"detail,omitempty"`
+}
+
+var (
+	queue   chan Record
+	dropped int64 // 缓冲区已满时丢弃的记录数
+)
+
+// buffer 缓冲的审计记录数
+func buffer() int {
+	if config.AppCfg != nil && config.AppCfg.Spki.Ats.Buffer > 0 {
+		return config.AppCfg.Spki.Ats.Buffer
+	}
+	return defaultBuffer
+}
+
+// timeout 发送超时时间
+func timeout() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Ats.Timeout > 0 {
+		return config.AppCfg.Spki.Ats.Timeout
+	}
+	return defaultTimeout
+}
+
+// endpoint ATS 接收审计记录的地址，未配置时为空
+func endpoint() string {
+	if config.AppCfg == nil || config.AppCfg.Spki.Ats.Endpoint == "" {
+		return ""
+	}
+	return config.AppCfg.Spki.Ats.Endpoint + "/v1/ats/records"
+}
+
+// New 根据请求生成审计记录，用户 ID 和账号由 apc 写入请求上下文
+func New(c *app.RequestContext, action, certID, result string) Record {
+	return Record{
+		ID:       common.CreateUuid(),
+		Time:     common.CreateTimestamp(),
+		UserID:   c.GetString("userId"),
+		Account:  c.GetString("account"),
+		RemoteIP: common.GetRemoteIp(c),
+		Action:   action,
+		CertID:   certID,
+		Result:   result,
+	}
+}
+
+// Log 异步发送审计记录，缓冲区已满时丢弃记录，不阻塞调用方
+func Log(r Record) {
+	hlog.Infof("Audit: action=%s certid=%s result=%s user=%s ip=%s", r.Action, r.CertID, r.Result, r.UserID, r.RemoteIP)
+	if queue == nil {
+		return
+	}
+	select {
+	case queue <- r:
+	default:
+		n := atomic.AddInt64(&dropped, 1)
+		hlog.Errorf("Audit buffer is full, record %s dropped (%d dropped in total)", r.ID, n)
+	}
+}
+
+// SetTarget 记录请求操作的证书 ID，创建证书的请求在保存后调用
+func SetTarget(c *app.RequestContext, certID string) {
+	c.Set(targetKey, certID)
+}
+
+// Handler 审计中间件，在处理请求后根据响应状态码记录结果
+// 目标证书 ID 优先使用 SetTarget 设置的值，其次为路径参数 certid
+func Handler(action string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.Next(ctx)
+		certID := c.GetString(targetKey)
+		if certID == "" {
+			certID = c.Param("certid")
+		}
+		status := c.Response.StatusCode()
+		result := ResultSuccess
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			result = ResultDenied
+		case status >= http.StatusBadRequest:
+			result = ResultFailure
+		}
+		r := New(c, action, certID, result)
+		r.Status = status
+		Log(r)
+	}
+}
+
+// send 发送一批审计记录
+func send(client *http.Client, url string, records []Record) error {
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// run 批量发送缓冲区中的审计记录，失败时保留当前批次并按指数退避重试
+func run(url string) {
+	client := &http.Client{Timeout: timeout()}
+	var batch []Record
+	retry := minRetry
+	for {
+		if len(batch) == 0 {
+			batch = append(batch, <-queue)
+		}
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case r := <-queue:
+				batch = append(batch, r)
+			default:
+				break fill
+			}
+		}
+		if err := send(client, url, batch); err != nil {
+			hlog.Warnf("Failed to send %d audit records to ATS, retry in %s: %v", len(batch), retry, err)
+			time.Sleep(retry)
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+			continue
+		}
+		batch, retry = batch[:0], minRetry
+	}
+}
+
+// Start 启动后台任务，将审计记录发送到 ATS，未配置 ATS 地址时只写入日志
+func Start() {
+	url := endpoint()
+	if url == "" {
+		hlog.Warn("ATS endpoint is not configured, audit records are only written to the log.")
+		return
+	}
+	queue = make(chan Record, buffer())
+	go run(url)
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"spki/src/internal/testenv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// useQueue 将审计记录写入容量为 size 的缓冲区，测试结束后恢复
+func useQueue(t *testing.T, size int) chan Record {
+	old := queue
+	queue = make(chan Record, size)
+	t.Cleanup(func() { queue = old })
+	return queue
+}
+
+func TestHandler(t *testing.T) {
+	q := useQueue(t, 10)
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.Use(func(ctx context.Context, c *app.RequestContext) {
+		c.Set("userId", "u1")
+		c.Set("account", "alice")
+	})
+	handle := func(status int, target string) app.HandlerFunc {
+		return func(ctx context.Context, c *app.RequestContext) {
+			if target != "" {
+				SetTarget(c, target)
+			}
+			c.Status(status)
+		}
+	}
+	engine.POST("/ca", Handler(ActionCAInit), handle(http.StatusCreated, "created"))
+	engine.POST("/cert/:certid/renew", Handler(ActionRenew), handle(http.StatusBadRequest, ""))
+	engine.POST("/cert/:certid/rekey", Handler(ActionRekey), handle(http.StatusForbidden, ""))
+
+	for _, tt := range []struct {
+		path   string
+		action string
+		certID string
+		result string
+		status int
+	}{
+		{"/ca", ActionCAInit, "created", ResultSuccess, http.StatusCreated},
+		{"/cert/c1/renew", ActionRenew, "c1", ResultFailure, http.StatusBadRequest},
+		{"/cert/c2/rekey", ActionRekey, "c2", ResultDenied, http.StatusForbidden},
+	} {
+		ut.PerformRequest(engine, http.MethodPost, tt.path, nil)
+		r := <-q
+		if r.Action != tt.action || r.CertID != tt.certID || r.Result != tt.result || r.Status != tt.status || r.UserID != "u1" || r.Account != "alice" || r.ID == "" {
+			t.Errorf("%s: record = %+v", tt.path, r)
+		}
+	}
+}
+
+func TestLogDropsWhenFull(t *testing.T) {
+	q := useQueue(t, 1)
+	before := atomic.LoadInt64(&dropped)
+	Log(Record{ID: "1"})
+	Log(Record{ID: "2"})
+	if len(q) != 1 || (<-q).ID != "1" || atomic.LoadInt64(&dropped) != before+1 {
+		t.Fatal("record was not dropped when the buffer is full")
+	}
+}
+
+func TestShip(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		received []Record
+	)
+	done := make(chan struct{})
+	ats := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// 第一次发送失败，保留当前批次重试
+		if attempts++; attempts == 1 || r.URL.Path != "/v1/ats/records" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct {
+			Records []Record `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received = append(received, body.Records...)
+		if len(received) == 3 {
+			close(done)
+		}
+	}))
+	t.Cleanup(ats.Close)
+	testenv.Config(t).Spki.Ats.Endpoint = ats.URL
+	old := queue
+	t.Cleanup(func() { queue = old })
+	Start()
+
+	for _, id := range []string{"1", "2", "3"} {
+		Log(Record{ID: id, Action: ActionIssue})
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit records were not shipped")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if received[0].ID != "1" || received[2].ID != "3" || attempts < 2 {
+		t.Fatalf("received %+v in %d attempts", received, attempts)
+	}
+}
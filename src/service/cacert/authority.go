@@ -0,0 +1,146 @@
+package cacert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/signature"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// maxChainDepth 证书链的最大深度，防止 ParentID 成环时死循环
+const maxChainDepth = 16
+
+var (
+	ErrCANotFound    = errors.New("CA certificate not found")
+	ErrCAUnavailable = errors.New("CA certificate is unavailable")
+)
+
+// Authority 已加载的 CA：证书记录、当前版本、解析后的证书和签名私钥
+type Authority struct {
+	Record  *models.Certificate
+	Version *models.Version
+	Cert    *x509.Certificate
+	Signer  crypto.Signer
+}
+
+// loadCert 加载证书记录及其最新版本
+func loadCert(certID string) (*models.Certificate, *models.Version, *x509.Certificate, error) {
+	record, err := models.FindCertificateByCertID(certID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if record.CertID == nil {
+		return nil, nil, nil, ErrCANotFound
+	}
+	version, err := models.FindLatestCertVersion(certID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if version.ID == 0 {
+		return nil, nil, nil, ErrCANotFound
+	}
+	cert, err := signature.ParseCertPEM([]byte(version.Cert))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse certificate %s: %v", certID, err)
+	}
+	return record, version, cert, nil
+}
+
+// LoadCACert 根据证书 ID 加载 CA 证书，不加载私钥，也不检查 CA 是否已吊销或过期
+func LoadCACert(certID string) (*Authority, error) {
+	record, version, cert, err := loadCert(certID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Genre == nil || *record.Genre != models.GenreCA || !cert.IsCA {
+		return nil, fmt.Errorf("%w: %s is not a CA certificate", ErrCAUnavailable, certID)
+	}
+	return &Authority{Record: record, Version: version, Cert: cert}, nil
+}
+
+// LoadCA 根据证书 ID 加载可用于签发的 CA 证书及其私钥
+func LoadCA(certID string) (*Authority, error) {
+	ca, err := LoadCACert(certID)
+	if err != nil {
+		return nil, err
+	}
+	if ca.Record.State == nil || *ca.Record.State != models.StateValid {
+		return nil, fmt.Errorf("%w: %s is not valid", ErrCAUnavailable, certID)
+	}
+	if time.Now().After(ca.Cert.NotAfter) {
+		return nil, fmt.Errorf("%w: %s has expired", ErrCAUnavailable, certID)
+	}
+
+	if ca.Version.KeyID == "" {
+		return nil, fmt.Errorf("%w: private key of %s is not kept by spki", ErrCAUnavailable, certID)
+	}
+	ca.Signer, err = keystore.Signer(ca.Version.KeyID)
+	if err != nil {
+		if errors.Is(err, keystore.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: private key of %s not found", ErrCAUnavailable, certID)
+		}
+		return nil, fmt.Errorf("failed to load private key of %s: %v", certID, err)
+	}
+	return ca, nil
+}
+
+// IssuerChain 返回从 parentID 指定的 CA 到根 CA 的证书链，parentID 为空时返回空链
+func IssuerChain(parentID *string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for parentID != nil && *parentID != "" {
+		if len(chain) >= maxChainDepth {
+			return nil, fmt.Errorf("certificate chain of %s is too deep", *parentID)
+		}
+		record, _, cert, err := loadCert(*parentID)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+		parentID = record.ParentID
+	}
+	return chain, nil
+}
+
+// Chain 返回从当前 CA 到根 CA 的证书链
+func (a *Authority) Chain() ([]*x509.Certificate, error) {
+	issuers, err := IssuerChain(a.Record.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*x509.Certificate{a.Cert}, issuers...), nil
+}
+
+// ChainPEM 返回 PEM 格式的证书链
+func (a *Authority) ChainPEM() (string, error) {
+	chain, err := a.Chain()
+	if err != nil {
+		return "", err
+	}
+	var pemBytes []byte
+	for _, cert := range chain {
+		pemBytes = append(pemBytes, signature.CertToPEM(cert)...)
+	}
+	return string(pemBytes), nil
+}
+
+// abortLoadCA 根据 LoadCA 的错误类型返回相应的响应
+func abortLoadCA(c *app.RequestContext, err error) {
+	hlog.Error("Failed to load CA. error: ", err)
+	switch {
+	case errors.Is(err, ErrCANotFound):
+		c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "CA certificate not found.", ""))
+	case errors.Is(err, ErrCAUnavailable):
+		c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidCAError, err.Error(), ""))
+	default:
+		c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load CA.", ""))
+	}
+}
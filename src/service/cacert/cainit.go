@@ -2,25 +2,20 @@ package cacert
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha1"
-	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
-	"encoding/pem"
-	"errors"
 	"fmt"
-	"math/big"
 	"net/http"
-	"spki/src/genkey"
+	"spki/src/keystore"
 	"spki/src/models"
 	"spki/src/pkg/answer"
-	"spki/src/pkg/common"
-	"spki/src/pkg/uuid4"
+	"spki/src/service/audit"
+	"spki/src/signature"
 	"strings"
 	"time"
 
@@ -28,22 +23,50 @@ import (
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 )
 
+// KeyConfig 私钥参数
+type KeyConfig struct {
+	Algo string `json:"algo"` // 私钥算法（如 "rsa"、"ecdsa"、"ed25519"）
+	Size int    `json:"size"` // 密钥长度（RSA：2048、4096；ECDSA：256、384、521）
+}
+
+// Names 证书主题
+type Names struct {
+	CN string  `json:"CN"`           // 通用名称（必填）
+	C  *string `json:"C,omitempty"`  // 国家（可选）
+	L  *string `json:"L,omitempty"`  // 城市（可选）
+	ST *string `json:"ST,omitempty"` // 州/省（可选）
+	O  string  `json:"O"`            // 组织（必填）
+	OU string  `json:"OU"`           // 组织单位（必填）
+}
+
 type CAConfig struct {
-	Title *string `json:"title"`
-	Key   struct {
-		Algo string `json:"algo"` // 私钥算法（如 "rsa"、"ecdsa"、"ed25519"）
-		Size int    `json:"size"` // 密钥长度（RSA：2048、4096；ECDSA：256、384、521）
-	} `json:"key"`
-	Names struct {
-		CN string  `json:"CN"`           // 通用名称（必填）
-		C  *string `json:"C,omitempty"`  // 国家（可选）
-		L  *string `json:"L,omitempty"`  // 城市（可选）
-		ST *string `json:"ST,omitempty"` // 州/省（可选）
-		O  string  `json:"O"`            // 组织（必填）
-		OU string  `json:"OU"`           // 组织单位（必填）
-	} `json:"names"`
-	Expiry               int    `json:"expiry"`               // 有效期,单位是天
-	SubjectKeyIdentifier string `json:"subjectKeyIdentifier"` // 生成 SubjectKeyId 的哈希算法:hash,sha256
+	Title                *string   `json:"title"`
+	Key                  KeyConfig `json:"key"`
+	Names                Names     `json:"names"`
+	Expiry               int       `json:"expiry"`               // 有效期,单位是天
+	SubjectKeyIdentifier string    `json:"subjectKeyIdentifier"` // 生成 SubjectKeyId 的哈希算法:hash,sha256
+	MaxPathLen           *int      `json:"maxPathLen,omitempty"` // 允许的下级 CA 层数，不设置时不限制
+	URLs                 *CAURLs   `json:"urls,omitempty"`       // 签发证书时写入的 AIA 和 CRL 分发点地址
+}
+
+// pkixName 转换为 pkix.Name
+func (n *Names) pkixName() pkix.Name {
+	subject := pkix.Name{
+		CommonName:         n.CN,
+		Organization:       []string{n.O},
+		OrganizationalUnit: []string{n.OU},
+	}
+	if n.C != nil {
+		// 将 *string 转换为 []string
+		subject.Country = []string{*n.C}
+	}
+	if n.L != nil {
+		subject.Locality = []string{*n.L}
+	}
+	if n.ST != nil {
+		subject.Province = []string{*n.ST}
+	}
+	return subject
 }
 
 // getPublicKey 从私钥中提取公钥
@@ -60,85 +83,45 @@ func getPublicKey(privateKey any) any {
 	}
 }
 
-// generateSubjectKeyId 根据指定的哈希算法生成 SubjectKeyId
-func generateSubjectKeyId(pubKeyBytes []byte, algorithm string) ([]byte, error) {
-	switch algorithm {
-	case "hash":
-		subjectKeyId := sha1.Sum(pubKeyBytes)
-		return subjectKeyId[:], nil
-	case "sha256":
-		subjectKeyId := sha256.Sum256(pubKeyBytes)
-		return subjectKeyId[:], nil
-	default:
-		return nil, errors.New("unsupported hash algorithm")
-	}
-}
-
-// signca 自签名ca
-func signca(privateKey any, cacfg *CAConfig) ([]byte, error) {
-	var (
-		pubKeyBytes []byte
-		err         error
-	)
-
-	// 解析私钥类型
-	switch key := privateKey.(type) {
-	case *rsa.PrivateKey:
-		pubKeyBytes, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
-	case *ecdsa.PrivateKey:
-		pubKeyBytes, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
-	case ed25519.PrivateKey:
-		pubKeyBytes, err = x509.MarshalPKIXPublicKey(key.Public().(ed25519.PublicKey))
-	default:
-		return nil, fmt.Errorf("unsupported private key type")
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal public key: %v", err)
-	}
-
-	subjectKeyId, err := generateSubjectKeyId(pubKeyBytes, cacfg.SubjectKeyIdentifier)
+// caTemplate 生成 CA 证书模板，maxPathLen 为 -1 时不限制路径长度
+func caTemplate(pub any, cacfg *CAConfig, maxPathLen int) (*x509.Certificate, error) {
+	subjectKeyId, err := signature.SubjectKeyId(pub, cacfg.SubjectKeyIdentifier)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate SubjectKeyId: %v", err)
 	}
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128-1))
-	if err != nil {
-		panic(err)
-	}
-	subject := pkix.Name{
-		CommonName:         cacfg.Names.CN,
-		Organization:       []string{cacfg.Names.O},
-		OrganizationalUnit: []string{cacfg.Names.OU},
-	}
-	if cacfg.Names.C != nil {
-		// 将 *string 转换为 []string
-		subject.Country = []string{*cacfg.Names.C}
-	}
-	if cacfg.Names.L != nil {
-		subject.Locality = []string{*cacfg.Names.L}
-	}
-	if cacfg.Names.ST != nil {
-		subject.Province = []string{*cacfg.Names.ST}
+	if cacfg.Expiry <= 0 {
+		return nil, fmt.Errorf("expiry must be greater than 0")
 	}
 
 	// 证书模板
-	caTemplate := x509.Certificate{
-		SerialNumber:          serialNumber, // 序列号，通常递增
-		Subject:               subject,
+	return &x509.Certificate{
+		Subject:               cacfg.Names.pkixName(),
 		NotBefore:             time.Now(),                                                   // 生效时间
 		NotAfter:              time.Now().Add(time.Duration(cacfg.Expiry) * 24 * time.Hour), // 过期时间
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,                 // 密钥用途
 		IsCA:                  true,                                                         // 表示这是一个CA证书
 		BasicConstraintsValid: true,                                                         // 表示这是一个CA证书
-		AuthorityKeyId:        subjectKeyId,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
 		SubjectKeyId:          subjectKeyId,
+	}, nil
+}
+
+// signca 自签名ca
+func signca(signer crypto.Signer, cacfg *CAConfig) (*x509.Certificate, error) {
+	maxPathLen := -1
+	if cacfg.MaxPathLen != nil {
+		if *cacfg.MaxPathLen < 0 {
+			return nil, fmt.Errorf("maxPathLen must not be negative")
+		}
+		maxPathLen = *cacfg.MaxPathLen
 	}
-	// 自签名
-	ca, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, getPublicKey(privateKey), privateKey)
+	template, err := caTemplate(signer.Public(), cacfg, maxPathLen)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	return ca, nil
+	// 自签名
+	return signature.CertSignature(template, template, signer.Public(), signer)
 }
 
 // byte2base64 把byte切片转化为base64
@@ -155,37 +138,36 @@ func StringPtr(s string) *string {
 func IntPtr(i int) *int {
 	return &i
 }
-func setSubject(cacfg CAConfig) *string {
-	name := cacfg.Names
+
+// SubjectString 按 openssl 的 /C=/L=/ST=/O=/OU=/CN= 形式拼接证书主题
+func SubjectString(name pkix.Name) *string {
 	// 使用 strings.Builder 提高字符串拼接效率
 	var builder strings.Builder
 
 	// 定义字段和对应的前缀
 	fields := []struct {
 		prefix string
-		value  *string
+		values []string
 	}{
-		{"/C=", name.C},
-		{"/L=", name.L},
-		{"/ST=", name.ST},
+		{"/C=", name.Country},
+		{"/L=", name.Locality},
+		{"/ST=", name.Province},
+		{"/O=", name.Organization},
+		{"/OU=", name.OrganizationalUnit},
+		{"/CN=", []string{name.CommonName}},
 	}
 
 	// 遍历字段，拼接非空值
 	for _, field := range fields {
-		if field.value != nil {
+		for _, value := range field.values {
+			if value == "" {
+				continue
+			}
 			builder.WriteString(field.prefix)
-			builder.WriteString(*field.value)
+			builder.WriteString(value)
 		}
 	}
 
-	// 拼接固定字段
-	builder.WriteString("/O=")
-	builder.WriteString(name.O)
-	builder.WriteString("/OU=")
-	builder.WriteString(name.OU)
-	builder.WriteString("/CN=")
-	builder.WriteString(name.CN)
-
 	// 返回结果
 	subject := builder.String()
 	return &subject
@@ -197,61 +179,57 @@ func InitCa() func(ctx context.Context, c *app.RequestContext) {
 		var cacfg CAConfig
 		if err := c.BindJSON(&cacfg); err != nil {
 			hlog.Error("The request body is invalid. error: ", err)
-			c.JSON(http.StatusBadRequest, answer.ResBody("444", "Invalid request data.", ""))
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
 			return
 		}
-
-		cakey, _ := genkey.CreateKey(cacfg.Key.Algo, cacfg.Key.Size) // 创建私钥
-		ca, err := signca(cakey, &cacfg)                             // ca 自签名
-		if err != nil {
-			c.JSON(http.StatusBadRequest, answer.ResBody("444", "签名失败.", ""))
+		if cacfg.Names.CN == "" {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "names.CN is required.", ""))
 			return
 		}
-
-		// 将私钥和ca保存在数据库
-		userId := c.GetString("userId")
-		account := c.GetString("account")
-
-		creator, _ := models.FindByCreatorForIdFormDB(userId)
-		if creator.UserID == nil {
-			if err := models.InstallCreator(userId, account); err != nil {
-				c.JSON(http.StatusBadRequest, answer.ResBody("444", "保存用户失败.", ""))
-				return
-			}
-		}
-		certID := uuid4.Uuid4StrPtr() // 证书id
-		if err := models.CreateCertificate(models.Certificate{
-			CertID:  certID,
-			UserID:  &userId,
-			Title:   cacfg.Title,
-			State:   StringPtr("V"),
-			Subject: setSubject(cacfg),
-			Pathlev: IntPtr(0),
-			Genre:   IntPtr(1),
-		}); err != nil {
+		if err := cacfg.URLs.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
 			return
 		}
-		keyId := uuid4.Uuid4Str() // 私钥id
-		pemBytes, _ := genkey.PrivateKeyToPEM(cakey)
+
+		ks := keystore.CA()
+		cakey, err := ks.Generate(cacfg.Key.Algo, cacfg.Key.Size) // 在私钥存储中创建私钥
 		if err != nil {
-			fmt.Println("Failed to convert private key to PEM:", err)
+			hlog.Error("Failed to create private key. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeGenerateKeyError, err.Error(), ""))
 			return
 		}
-		if err := models.InstallPrivateKey(models.PrivateKey{
-			KeyID:      keyId,
-			PrivateKey: string(pemBytes),
-			CreateTime: common.CreateTimestamp(),
-		}); err != nil {
+		ca, err := signca(cakey.Signer, &cacfg) // ca 自签名
+		if err != nil {
+			destroyKey(cakey)
+			hlog.Error("Failed to sign CA certificate. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeSignCertError, err.Error(), ""))
 			return
 		}
-		if err := models.InstallCertVersion(models.Version{
-			CertID: *certID,
-			KeyID:  keyId,
-			Serial: "",
-			Cert:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca})),
-		}); err != nil {
+
+		// 将ca保存在数据库，私钥、创建者、证书和证书版本在同一个事务中保存
+		certID, err := saveCertRecord(&certRecord{
+			UserID:  c.GetString("userId"),
+			Account: c.GetString("account"),
+			Title:   cacfg.Title,
+			Pathlev: 0,
+			Genre:   models.GenreCA,
+			Cert:    ca,
+			Key:     cakey,
+			URLs:    cacfg.URLs,
+		})
+		if err != nil {
+			destroyKey(cakey)
+			hlog.Error("Failed to save CA certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save CA certificate.", ""))
 			return
 		}
-		c.JSON(http.StatusCreated, answer.ResBody("200", "", cacfg))
+		audit.SetTarget(c, certID)
+		certPEM := string(signature.CertToPEM(ca))
+		c.JSON(http.StatusCreated, answer.ResBody(answer.EcodeOK, "", IssueResult{
+			CertID: certID,
+			Serial: signature.SerialString(ca.SerialNumber),
+			Cert:   certPEM,
+			Chain:  certPEM,
+		}))
 	}
 }
@@ -0,0 +1,263 @@
+package cacert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/profile"
+	"spki/src/keystore"
+	"spki/src/pkg/answer"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// minRSAKeySize 接受的 RSA 公钥最小长度
+const minRSAKeySize = 2048
+
+// ErrRejected 证书请求不符合签名配置或 CA 的限制
+var ErrRejected = errors.New("certificate request rejected")
+
+// CSRIssue 协议接口（ACME、EST、SCEP 等）签署证书请求的参数
+type CSRIssue struct {
+	CSR     *x509.CertificateRequest
+	Profile string        // 签名配置名称，如 server、client、peer
+	Expiry  int           // 有效期,单位是天，为 0 时使用签名配置的最长有效期
+	TTL     time.Duration // 有效期，不为 0 时代替 Expiry，用于不以天为单位的协议（Vault）
+	Subject *pkix.Name    // 证书主题，为 nil 时使用证书请求中的主题
+	Sans    *Sans         // 使用者可选名称，为 nil 时使用证书请求中的名称，签名配置不允许时拒绝含有名称的证书请求
+	Title   *string
+	UserID  string // 创建者，协议接口没有 uias 用户时由调用方指定
+	Account string
+	// DiscardCSR 不保存证书请求，用于含有挑战密码等敏感属性的证书请求（SCEP）
+	DiscardCSR bool
+	// Key 证书请求由 spki 生成时的私钥，保存在可导出的私钥存储中
+	Key crypto.Signer
+}
+
+// SignConfig 签署证书请求的请求体
+type SignConfig struct {
+	Title   *string `json:"title"`
+	CSR     string  `json:"csr"`     // PEM 或 base64 编码的 DER 格式 PKCS#10 证书请求
+	Profile string  `json:"profile"` // 签名配置名称，如 server、client、peer
+	Sans    Sans    `json:"sans"`    // 签名配置不使用证书请求中的使用者可选名称时，以此为准
+	Expiry  int     `json:"expiry"`  // 有效期,单位是天，为 0 时使用签名配置的最长有效期
+}
+
+// ParseCSR 解析 PEM 或 base64 编码的 DER 格式证书请求并校验其签名
+func ParseCSR(data string) (*x509.CertificateRequest, error) {
+	var der []byte
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(data))
+		if block == nil || !strings.HasSuffix(block.Type, "CERTIFICATE REQUEST") {
+			return nil, fmt.Errorf("failed to decode PEM certificate request")
+		}
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode DER certificate request: %v", err)
+		}
+		der = decoded
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate request: %v", err)
+	}
+	// 验证 CSR 的签名
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("certificate request signature verification failed: %v", err)
+	}
+	if err := CheckPublicKey(csr.PublicKey); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+// CheckPublicKey 检查证书请求或新私钥的公钥类型和强度
+func CheckPublicKey(pub any) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeySize {
+			return fmt.Errorf("RSA key size must be at least %d bits", minRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("unsupported ECDSA curve: %s", key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported public key type: %T", pub)
+	}
+	return nil
+}
+
+// applyCSRSans 签名配置允许时使用证书请求中的使用者可选名称，否则使用请求体中指定的名称
+func applyCSRSans(template *x509.Certificate, csr *x509.CertificateRequest, signing *profile.Signing, sans *Sans) error {
+	if !signing.HonorCSRSans {
+		return sans.apply(template)
+	}
+	copyCSRSans(template, csr)
+	return nil
+}
+
+// honorCSRSans 协议接口未指定使用者可选名称时使用证书请求中的名称，签名配置不允许时拒绝含有使用者可选名称的证书请求
+func honorCSRSans(template *x509.Certificate, csr *x509.CertificateRequest, signing *profile.Signing) error {
+	if !signing.HonorCSRSans {
+		if len(csr.DNSNames)+len(csr.IPAddresses)+len(csr.EmailAddresses)+len(csr.URIs) > 0 {
+			return fmt.Errorf("profile %s does not honor subject alternative names in certificate requests", signing.Name)
+		}
+		return nil
+	}
+	copyCSRSans(template, csr)
+	return nil
+}
+
+// copyCSRSans 使用证书请求中的使用者可选名称
+func copyCSRSans(template *x509.Certificate, csr *x509.CertificateRequest) {
+	template.DNSNames = csr.DNSNames
+	template.IPAddresses = csr.IPAddresses
+	template.EmailAddresses = csr.EmailAddresses
+	template.URIs = csr.URIs
+}
+
+// csrToPEM 将证书请求编码为 PEM 格式
+func csrToPEM(csr *x509.CertificateRequest) *string {
+	s := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw}))
+	return &s
+}
+
+// SignCSR 使用指定的 CA 签署外部生成的证书请求，私钥不经过 spki
+func SignCSR() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var cfg SignConfig
+		if err := c.BindJSON(&cfg); err != nil {
+			hlog.Error("The request body is invalid. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
+			return
+		}
+		csr, err := ParseCSR(cfg.CSR)
+		if err != nil {
+			hlog.Error("The certificate request is invalid. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		signing, err := profile.Lookup(cfg.Profile)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		ca, err := LoadCA(c.Param("certid"))
+		if err != nil {
+			abortLoadCA(c, err)
+			return
+		}
+
+		template, err := leafTemplate(ca, signing, cfg.Expiry, csr.PublicKey)
+		if err == nil {
+			err = applyCSRSans(template, csr, signing, &cfg.Sans)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+		template.Subject = csr.Subject
+
+		cert, err := ca.Sign(template, csr.PublicKey)
+		if err != nil {
+			hlog.Error("Failed to sign certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeSignCertError, "Failed to sign certificate.", ""))
+			return
+		}
+
+		result, err := saveIssued(c, ca, &certRecord{Title: cfg.Title, Profile: signing.Name, CertReq: csrToPEM(csr), Cert: cert})
+		if err != nil {
+			hlog.Error("Failed to save certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save certificate.", ""))
+			return
+		}
+		c.JSON(http.StatusCreated, answer.ResBody(answer.EcodeOK, "", result))
+	}
+}
+
+// IssueCSR 签署并保存协议接口收到的证书请求，请求不符合签名配置时返回 ErrRejected
+func (a *Authority) IssueCSR(req *CSRIssue) (*x509.Certificate, *IssueResult, error) {
+	signing, err := profile.Lookup(req.Profile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	if err := CheckPublicKey(req.CSR.PublicKey); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	validity, err := signing.Validity(req.Expiry)
+	if err == nil && req.TTL != 0 {
+		validity, err = signing.ValidityTTL(req.TTL)
+	}
+	var template *x509.Certificate
+	if err == nil {
+		template, err = leafTemplateFor(a, signing, validity, req.Expiry != 0 || req.TTL != 0, req.CSR.PublicKey)
+	}
+	if err == nil {
+		if req.Sans != nil {
+			err = req.Sans.apply(template)
+		} else {
+			err = honorCSRSans(template, req.CSR, signing)
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	template.Subject = req.CSR.Subject
+	if req.Subject != nil {
+		template.Subject = *req.Subject
+	}
+
+	cert, err := a.Sign(template, req.CSR.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	certReq := csrToPEM(req.CSR)
+	if req.DiscardCSR {
+		certReq = nil
+	}
+	var key *keystore.Key
+	if req.Key != nil {
+		if key, err = keystore.Exportable().Import(req.Key); err != nil {
+			return nil, nil, fmt.Errorf("failed to save private key: %v", err)
+		}
+	}
+	result, err := a.save(&certRecord{
+		UserID:  req.UserID,
+		Account: req.Account,
+		Title:   req.Title,
+		CertReq: certReq,
+		Profile: signing.Name,
+		Cert:    cert,
+		Key:     key,
+	})
+	if err != nil {
+		if key != nil {
+			destroyKey(key)
+		}
+		return nil, nil, fmt.Errorf("failed to save certificate: %v", err)
+	}
+	return cert, result, nil
+}
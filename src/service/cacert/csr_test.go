@@ -0,0 +1,109 @@
+package cacert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIssueCSRSans(t *testing.T) {
+	_, caID := setup(t)
+	ca, err := LoadCA(caID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, _ := newCSR(t, "www.example.com", "www.example.com", "example.com")
+	plain, _ := newCSR(t, "signer")
+
+	tests := []struct {
+		name    string
+		profile string
+		req     *CSRIssue
+		want    []string
+		reject  bool
+	}{
+		{name: "honor", profile: "server", req: &CSRIssue{CSR: csr}, want: []string{"www.example.com", "example.com"}},
+		{name: "explicit", profile: "server", req: &CSRIssue{CSR: csr, Sans: &Sans{DNS: []string{"api.example.com"}}}, want: []string{"api.example.com"}},
+		{name: "reject", profile: "code-signing", req: &CSRIssue{CSR: csr}, reject: true},
+		{name: "strip", profile: "code-signing", req: &CSRIssue{CSR: csr, Sans: &Sans{}}},
+		{name: "none", profile: "code-signing", req: &CSRIssue{CSR: plain}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Profile, tt.req.UserID, tt.req.Account = tt.profile, "u1", "alice"
+			cert, _, err := ca.IssueCSR(tt.req)
+			if tt.reject {
+				if !errors.Is(err, ErrRejected) {
+					t.Fatalf("err = %v, want ErrRejected", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cert.DNSNames) != len(tt.want) || len(tt.want) > 0 && !reflect.DeepEqual(cert.DNSNames, tt.want) {
+				t.Fatalf("DNS names = %v, want %v", cert.DNSNames, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSR(t *testing.T) {
+	csr, _ := newCSR(t, "www.example.com", "www.example.com")
+	pemCSR := *csrToPEM(csr)
+	for name, data := range map[string]string{
+		"PEM":          pemCSR,
+		"PEM newlines": "\n" + pemCSR + "\n",
+		"DER":          base64.StdEncoding.EncodeToString(csr.Raw),
+	} {
+		parsed, err := ParseCSR(data)
+		if err != nil || parsed.Subject.CommonName != "www.example.com" {
+			t.Errorf("%s: csr = %v, %v", name, parsed, err)
+		}
+	}
+
+	// 篡改证书请求内容后签名校验失败
+	tampered := bytes.Replace(csr.Raw, []byte("www.example.com"), []byte("www.evil.com.ex"), 1)
+	for name, data := range map[string]string{
+		"empty":       "",
+		"not base64":  "not a csr",
+		"wrong type":  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: csr.Raw})),
+		"tampered":    base64.StdEncoding.EncodeToString(tampered),
+		"invalid DER": base64.StdEncoding.EncodeToString([]byte{0x30, 0x01}),
+	} {
+		if _, err := ParseCSR(data); err == nil {
+			t.Errorf("%s certificate request was accepted", name)
+		}
+	}
+}
+
+func TestCheckPublicKey(t *testing.T) {
+	rsa1024, _ := rsa.GenerateKey(rand.Reader, 1024)
+	rsa2048, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p224, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	for _, tt := range []struct {
+		pub any
+		ok  bool
+	}{
+		{rsa2048.Public(), true},
+		{rsa1024.Public(), false},
+		{p384.Public(), true},
+		{p224.Public(), false},
+		{edPub, true},
+		{"not a key", false},
+	} {
+		if err := CheckPublicKey(tt.pub); (err == nil) != tt.ok {
+			t.Errorf("CheckPublicKey(%T) = %v", tt.pub, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cacert
+
+import (
+	"errors"
+	"spki/src/models"
+	"sync"
+)
+
+// errInjected 由 faultRepository 注入的错误
+var errInjected = errors.New("injected fault")
+
+// faultRepository 在指定方法第 n 次调用时返回 errInjected 的数据存储，用于验证部分写入失败时的回滚
+// 只有签发和创建 CA 时写入的方法会注入错误，其余方法直接调用被包装的数据存储
+type faultRepository struct {
+	models.Repository
+	state *faultState
+}
+
+// faultState 各方法的调用次数和注入错误的位置，事务中的数据存储与外层共用
+type faultState struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	faults map[string]int
+}
+
+// newFaultRepository 包装数据存储
+func newFaultRepository(inner models.Repository) *faultRepository {
+	return &faultRepository{
+		Repository: inner,
+		state:      &faultState{calls: make(map[string]int), faults: make(map[string]int)},
+	}
+}
+
+// FailOn 设置方法在第 n 次调用时返回 errInjected，n 从 1 开始
+func (f *faultRepository) FailOn(method string, n int) {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	f.state.faults[method] = n
+}
+
+// Calls 返回方法已调用的次数
+func (f *faultRepository) Calls(method string) int {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	return f.state.calls[method]
+}
+
+// fault 记录调用，到达设定的次数时返回错误
+func (f *faultRepository) fault(method string) error {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	f.state.calls[method]++
+	if n, ok := f.state.faults[method]; ok && f.state.calls[method] == n {
+		return errInjected
+	}
+	return nil
+}
+
+// Transaction 事务中的调用同样会注入错误
+func (f *faultRepository) Transaction(fn func(tx models.Repository) error) error {
+	return f.Repository.Transaction(func(tx models.Repository) error {
+		return fn(&faultRepository{Repository: tx, state: f.state})
+	})
+}
+
+func (f *faultRepository) InstallCreator(userID, name string) error {
+	if err := f.fault("InstallCreator"); err != nil {
+		return err
+	}
+	return f.Repository.InstallCreator(userID, name)
+}
+
+func (f *faultRepository) CreateCertificate(data models.Certificate) error {
+	if err := f.fault("CreateCertificate"); err != nil {
+		return err
+	}
+	return f.Repository.CreateCertificate(data)
+}
+
+func (f *faultRepository) InstallPrivateKey(data models.PrivateKey) error {
+	if err := f.fault("InstallPrivateKey"); err != nil {
+		return err
+	}
+	return f.Repository.InstallPrivateKey(data)
+}
+
+// DeletePrivateKey 只记录调用，用于确认私钥随事务回滚而不是事后删除
+func (f *faultRepository) DeletePrivateKey(keyID string) error {
+	if err := f.fault("DeletePrivateKey"); err != nil {
+		return err
+	}
+	return f.Repository.DeletePrivateKey(keyID)
+}
+
+func (f *faultRepository) InstallCertVersion(data models.Version) error {
+	if err := f.fault("InstallCertVersion"); err != nil {
+		return err
+	}
+	return f.Repository.InstallCertVersion(data)
+}
+
+func (f *faultRepository) InstallWebhookEvent(data models.WebhookEvent) error {
+	if err := f.fault("InstallWebhookEvent"); err != nil {
+		return err
+	}
+	return f.Repository.InstallWebhookEvent(data)
+}
@@ -0,0 +1,104 @@
+package cacert
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"spki/src/keystore"
+	"spki/src/pkg/answer"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// subordinatePathLen 根据上级 CA 的路径长度约束计算下级 CA 的 MaxPathLen，-1 表示不限制
+// 上级 CA 不允许再签发下级 CA，或者请求的路径长度超出上级约束时返回错误
+func subordinatePathLen(parent *x509.Certificate, requested *int) (int, error) {
+	limit := -1
+	if parent.MaxPathLen > 0 || (parent.MaxPathLen == 0 && parent.MaxPathLenZero) {
+		limit = parent.MaxPathLen
+	}
+	if limit == 0 {
+		return 0, fmt.Errorf("the path length constraint of parent CA does not allow subordinate CAs")
+	}
+
+	if requested == nil {
+		if limit > 0 {
+			return limit - 1, nil
+		}
+		return -1, nil
+	}
+	if *requested < 0 {
+		return 0, fmt.Errorf("maxPathLen must not be negative")
+	}
+	if limit > 0 && *requested >= limit {
+		return 0, fmt.Errorf("maxPathLen must be less than %d required by parent CA", limit)
+	}
+	return *requested, nil
+}
+
+// CreateIntermediateCa 创建由指定 CA 签发的中间 CA 证书
+func CreateIntermediateCa() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var cacfg CAConfig
+		if err := c.BindJSON(&cacfg); err != nil {
+			hlog.Error("The request body is invalid. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
+			return
+		}
+		if cacfg.Names.CN == "" {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "names.CN is required.", ""))
+			return
+		}
+		if err := cacfg.URLs.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		parent, err := LoadCA(c.Param("certid"))
+		if err != nil {
+			abortLoadCA(c, err)
+			return
+		}
+		maxPathLen, err := subordinatePathLen(parent.Cert, cacfg.MaxPathLen)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidCAError, err.Error(), ""))
+			return
+		}
+
+		ks := keystore.CA()
+		cakey, err := ks.Generate(cacfg.Key.Algo, cacfg.Key.Size) // 在私钥存储中创建私钥
+		if err != nil {
+			hlog.Error("Failed to create private key. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeGenerateKeyError, err.Error(), ""))
+			return
+		}
+		template, err := caTemplate(cakey.Signer.Public(), &cacfg, maxPathLen)
+		if err == nil && template.NotAfter.After(parent.Cert.NotAfter) {
+			err = fmt.Errorf("expiry exceeds the validity of parent CA certificate")
+		}
+		if err != nil {
+			destroyKey(cakey)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		ca, err := parent.Sign(template, cakey.Signer.Public())
+		if err != nil {
+			destroyKey(cakey)
+			hlog.Error("Failed to sign intermediate CA. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeSignCertError, "Failed to sign intermediate CA.", ""))
+			return
+		}
+
+		result, err := saveIssued(c, parent, &certRecord{Title: cacfg.Title, Cert: ca, Key: cakey, URLs: cacfg.URLs})
+		if err != nil {
+			destroyKey(cakey)
+			hlog.Error("Failed to save intermediate CA. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save intermediate CA.", ""))
+			return
+		}
+		c.JSON(http.StatusCreated, answer.ResBody(answer.EcodeOK, "", result))
+	}
+}
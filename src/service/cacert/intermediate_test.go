@@ -0,0 +1,60 @@
+package cacert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+)
+
+func TestSubordinatePathLen(t *testing.T) {
+	unlimited := &x509.Certificate{MaxPathLen: -1}
+	zero := &x509.Certificate{MaxPathLen: 0, MaxPathLenZero: true}
+	two := &x509.Certificate{MaxPathLen: 2}
+	n := func(i int) *int { return &i }
+
+	tests := []struct {
+		name      string
+		parent    *x509.Certificate
+		requested *int
+		want      int
+		ok        bool
+	}{
+		{"unlimited parent", unlimited, nil, -1, true},
+		{"unlimited parent requested", unlimited, n(5), 5, true},
+		{"unset parent", &x509.Certificate{}, nil, -1, true},
+		{"parent forbids subordinates", zero, nil, 0, false},
+		{"parent forbids requested", zero, n(0), 0, false},
+		{"inherit from parent", two, nil, 1, true},
+		{"within parent", two, n(0), 0, true},
+		{"equal to parent", two, n(2), 0, false},
+		{"negative", unlimited, n(-1), 0, false},
+	}
+	for _, tt := range tests {
+		got, err := subordinatePathLen(tt.parent, tt.requested)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%s: subordinatePathLen = %d, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestCATemplate(t *testing.T) {
+	cfg := &CAConfig{Names: Names{CN: "Intermediate"}, Expiry: 365}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, maxPathLen := range []int{-1, 0, 1} {
+		template, err := caTemplate(key.Public(), cfg, maxPathLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !template.IsCA || template.MaxPathLen != maxPathLen || template.MaxPathLenZero != (maxPathLen == 0) {
+			t.Errorf("maxPathLen %d: template = %+v", maxPathLen, template)
+		}
+	}
+	if _, err := caTemplate(key.Public(), &CAConfig{Expiry: 0}, -1); err == nil {
+		t.Fatal("zero expiry was accepted")
+	}
+}
@@ -0,0 +1,221 @@
+package cacert
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"spki/profile"
+	"spki/src/genkey"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/service/audit"
+	"spki/src/signature"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Sans 证书使用者可选名称
+type Sans struct {
+	DNS   []string `json:"dns"`
+	IP    []string `json:"ip"`
+	Email []string `json:"email"`
+	URI   []string `json:"uri"`
+}
+
+// IssueConfig 签发末端证书的请求体
+type IssueConfig struct {
+	Title   *string   `json:"title"`
+	Profile string    `json:"profile"` // 签名配置名称，如 server、client、peer
+	Key     KeyConfig `json:"key"`
+	Names   Names     `json:"names"`
+	Sans    Sans      `json:"sans"`
+	Expiry  int       `json:"expiry"` // 有效期,单位是天，为 0 时使用签名配置的最长有效期
+}
+
+// IssueResult 签发结果
+type IssueResult struct {
+	CertID string `json:"certid"`
+	Serial string `json:"serial"`
+	Cert   string `json:"cert"`          // 证书（PEM）
+	Key    string `json:"key,omitempty"` // 私钥（PEM），私钥不由 spki 生成时为空
+	Chain  string `json:"chain"`         // 签发 CA 到根 CA 的证书链（PEM）
+}
+
+// apply 将使用者可选名称写入证书模板
+func (s *Sans) apply(template *x509.Certificate) error {
+	template.DNSNames = s.DNS
+	template.EmailAddresses = s.Email
+	for _, ip := range s.IP {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("invalid IP address: %s", ip)
+		}
+		template.IPAddresses = append(template.IPAddresses, parsed)
+	}
+	for _, uri := range s.URI {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" {
+			return fmt.Errorf("invalid URI: %s", uri)
+		}
+		template.URIs = append(template.URIs, parsed)
+	}
+	return nil
+}
+
+// leafTemplate 按签名配置生成末端证书模板，有效期不能超过签发 CA 的有效期
+func leafTemplate(ca *Authority, signing *profile.Signing, expiry int, pub any) (*x509.Certificate, error) {
+	validity, err := signing.Validity(expiry)
+	if err != nil {
+		return nil, err
+	}
+	return leafTemplateFor(ca, signing, validity, expiry != 0, pub)
+}
+
+// leafTemplateFor 按签名配置和已校验的有效期生成末端证书模板
+// requested 为 false 时有效期是签名配置的最长有效期，超过签发 CA 的有效期时截止到 CA 证书到期
+func leafTemplateFor(ca *Authority, signing *profile.Signing, validity time.Duration, requested bool, pub any) (*x509.Certificate, error) {
+	if err := signing.AllowKeyAlgo(profile.KeyAlgo(pub)); err != nil {
+		return nil, err
+	}
+	notBefore := time.Now()
+	notAfter := notBefore.Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		if requested || !notBefore.Before(ca.Cert.NotAfter) {
+			return nil, fmt.Errorf("expiry exceeds the validity of CA certificate")
+		}
+		notAfter = ca.Cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	signing.Apply(template, pub)
+	return template, nil
+}
+
+// IssueCert 使用指定的 CA 签发末端证书
+func IssueCert() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var cfg IssueConfig
+		if err := c.BindJSON(&cfg); err != nil {
+			hlog.Error("The request body is invalid. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
+			return
+		}
+		if cfg.Names.CN == "" {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "names.CN is required.", ""))
+			return
+		}
+
+		signing, err := profile.Lookup(cfg.Profile)
+		if err == nil {
+			err = signing.AllowKeyAlgo(cfg.Key.Algo)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		ca, err := LoadCA(c.Param("certid"))
+		if err != nil {
+			abortLoadCA(c, err)
+			return
+		}
+
+		key, err := genkey.CreateKey(cfg.Key.Algo, cfg.Key.Size) // 创建私钥
+		if err != nil {
+			hlog.Error("Failed to create private key. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeGenerateKeyError, err.Error(), ""))
+			return
+		}
+		pub := getPublicKey(key)
+
+		template, err := leafTemplate(ca, signing, cfg.Expiry, pub)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+		template.Subject = cfg.Names.pkixName()
+		if err := cfg.Sans.apply(template); err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		cert, err := ca.Sign(template, pub)
+		if err != nil {
+			hlog.Error("Failed to sign certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeSignCertError, "Failed to sign certificate.", ""))
+			return
+		}
+
+		keyPEM, err := genkey.PrivateKeyToPEM(key)
+		if err != nil {
+			hlog.Error("Failed to encode private key. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to encode private key.", ""))
+			return
+		}
+		saved, err := keystore.Exportable().Import(key.(crypto.Signer))
+		if err != nil {
+			hlog.Error("Failed to save private key. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save private key.", ""))
+			return
+		}
+		result, err := saveIssued(c, ca, &certRecord{Title: cfg.Title, Profile: signing.Name, Cert: cert, Key: saved})
+		if err != nil {
+			destroyKey(saved)
+			hlog.Error("Failed to save certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save certificate.", ""))
+			return
+		}
+		result.Key = string(keyPEM)
+		c.JSON(http.StatusCreated, answer.ResBody(answer.EcodeOK, "", result))
+	}
+}
+
+// saveIssued 保存 CA 签发的证书并组装签发结果，创建者为当前请求的用户
+func saveIssued(c *app.RequestContext, ca *Authority, record *certRecord) (*IssueResult, error) {
+	record.UserID = c.GetString("userId")
+	record.Account = c.GetString("account")
+	result, err := ca.save(record)
+	if err != nil {
+		return nil, err
+	}
+	audit.SetTarget(c, result.CertID)
+	return result, nil
+}
+
+// save 保存 CA 签发的证书并组装签发结果，结果中不包含私钥
+// record 中的上级证书、层级和类型由 save 填充
+func (a *Authority) save(record *certRecord) (*IssueResult, error) {
+	record.ParentID = a.Record.CertID
+	record.Pathlev = *a.Record.Pathlev + 1
+	record.Genre = models.GenreLeaf
+	if record.Cert.IsCA {
+		record.Genre = models.GenreCA
+	}
+	certID, err := saveCertRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := a.ChainPEM()
+	if err != nil {
+		return nil, err
+	}
+	return &IssueResult{
+		CertID: certID,
+		Serial: signature.SerialString(record.Cert.SerialNumber),
+		Cert:   string(signature.CertToPEM(record.Cert)),
+		Chain:  chain,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package cacert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"reflect"
+	"spki/profile"
+	"testing"
+	"time"
+)
+
+func TestSansApply(t *testing.T) {
+	var template x509.Certificate
+	sans := &Sans{
+		DNS:   []string{"www.example.com"},
+		IP:    []string{"10.0.0.1", "::1"},
+		Email: []string{"ops@example.com"},
+		URI:   []string{"spiffe://example.com/web"},
+	}
+	if err := sans.apply(&template); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(template.DNSNames, sans.DNS) || !reflect.DeepEqual(template.EmailAddresses, sans.Email) ||
+		len(template.IPAddresses) != 2 || template.IPAddresses[1].String() != "::1" ||
+		len(template.URIs) != 1 || template.URIs[0].Host != "example.com" {
+		t.Fatalf("template = %+v", template)
+	}
+
+	for _, invalid := range []*Sans{{IP: []string{"10.0.0"}}, {URI: []string{"example.com/web"}}, {URI: []string{"http://[::1"}}} {
+		if err := invalid.apply(&x509.Certificate{}); err == nil {
+			t.Errorf("%+v was accepted", invalid)
+		}
+	}
+}
+
+func TestLeafTemplate(t *testing.T) {
+	ca := &Authority{Cert: &x509.Certificate{NotAfter: time.Now().Add(30 * 24 * time.Hour)}}
+	server, err := profile.Lookup("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	template, err := leafTemplate(ca, server, 7, ecKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.IsCA || !template.BasicConstraintsValid || template.NotAfter.Sub(template.NotBefore) != 7*24*time.Hour {
+		t.Fatalf("template = %+v", template)
+	}
+	// 只有 RSA 公钥才能用于密钥加密
+	if template.KeyUsage != x509.KeyUsageDigitalSignature || !reflect.DeepEqual(template.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Fatalf("key usage = %v %v", template.KeyUsage, template.ExtKeyUsage)
+	}
+	if template, err := leafTemplate(ca, server, 7, rsaKey.Public()); err != nil || template.KeyUsage&x509.KeyUsageKeyEncipherment == 0 {
+		t.Fatalf("RSA key usage = %v, %v", template, err)
+	}
+
+	for name, expiry := range map[string]int{"negative": -1, "beyond CA": 31, "beyond profile": 366} {
+		if _, err := leafTemplate(ca, server, expiry, ecKey.Public()); err == nil {
+			t.Errorf("%s expiry %d was accepted", name, expiry)
+		}
+	}
+
+	// CA 剩余有效期短于签名配置的最长有效期时，未指定有效期的证书截止到 CA 证书到期
+	if template, err := leafTemplate(ca, server, 0, ecKey.Public()); err != nil || !template.NotAfter.Equal(ca.Cert.NotAfter) {
+		t.Fatalf("default expiry = %v, %v", template, err)
+	}
+	expired := &Authority{Cert: &x509.Certificate{NotAfter: time.Now().Add(-time.Minute)}}
+	if _, err := leafTemplate(expired, server, 0, ecKey.Public()); err == nil {
+		t.Fatal("certificate of an expired CA was accepted")
+	}
+}
@@ -0,0 +1,123 @@
+package cacert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/pkg/uuid4"
+	"spki/src/service/webhook"
+	"spki/src/signature"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// certRecord 待保存的证书
+type certRecord struct {
+	UserID   string
+	Account  string
+	Title    *string
+	ParentID *string // 上级 CA 证书 ID，自签名根 CA 为 nil
+	Pathlev  int     // 证书层级，根 CA 为 0
+	Genre    int
+	CertReq  *string // 证书请求文件（PEM）
+	Profile  string  // 签发末端证书使用的签名配置名称，CA 证书为空
+	Cert     *x509.Certificate
+	Key      *keystore.Key // 私钥存储中生成或导入的私钥，为 nil 时表示私钥不由 spki 保管
+	URLs     *CAURLs       // CA 签发证书时写入的地址，仅 CA 证书有效
+}
+
+// ensureCreator 确保创建者已存在
+func ensureCreator(tx models.Repository, userId, account string) error {
+	creator, err := tx.FindByCreatorForIdFormDB(userId)
+	if err != nil {
+		return err
+	}
+	if creator.UserID == nil {
+		return tx.InstallCreator(userId, account)
+	}
+	return nil
+}
+
+// sansString 将证书的使用者可选名称以逗号拼接，没有时返回 nil
+func sansString(cert *x509.Certificate) *string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sans := strings.Join(names, ",")
+	return &sans
+}
+
+// destroyKey 证书未能签发或保存时丢弃已生成的私钥，数据库中的私钥记录已随事务回滚
+func destroyKey(key *keystore.Key) {
+	if err := key.Discard(); err != nil {
+		hlog.Errorf("Failed to destroy private key %s. error: %v", key.ID, err)
+	}
+}
+
+// saveCertRecord 在同一个事务中保存私钥、创建者、证书、证书版本和签发事件，返回证书 ID
+// 保存失败时由调用方丢弃私钥存储中的私钥
+func saveCertRecord(r *certRecord) (string, error) {
+	certID := uuid4.Uuid4Str() // 证书id
+	record := models.Certificate{
+		CertID:     &certID,
+		UserID:     &r.UserID,
+		Title:      r.Title,
+		State:      StringPtr(models.StateValid),
+		Subject:    SubjectString(r.Cert.Subject),
+		ParentID:   r.ParentID,
+		Pathlev:    IntPtr(r.Pathlev),
+		Genre:      IntPtr(r.Genre),
+		CertReq:    r.CertReq,
+		Sans:       sansString(r.Cert),
+		CreateTime: common.CreateTimestamp(),
+	}
+	if r.Profile != "" {
+		record.Profile = &r.Profile
+	}
+	if r.URLs != nil {
+		record.IssuerURL, record.OcspURL, record.CrlURL = r.URLs.CAIssuers, r.URLs.Ocsp, r.URLs.Crl
+	}
+	version := models.Version{
+		CertID:         certID,
+		Serial:         signature.SerialString(r.Cert.SerialNumber),
+		Cert:           string(signature.CertToPEM(r.Cert)),
+		EffectiveTime:  r.Cert.NotBefore.UnixMilli(),
+		ExpirationTime: r.Cert.NotAfter.UnixMilli(),
+	}
+	if r.Key != nil {
+		version.KeyID = r.Key.ID
+	}
+	err := models.Transaction(func(tx models.Repository) error {
+		if r.Key != nil {
+			if err := r.Key.Save(tx); err != nil {
+				return fmt.Errorf("failed to save private key: %v", err)
+			}
+		}
+		if err := ensureCreator(tx, r.UserID, r.Account); err != nil {
+			return fmt.Errorf("failed to save creator: %v", err)
+		}
+		if err := tx.CreateCertificate(record); err != nil {
+			return fmt.Errorf("failed to save certificate: %v", err)
+		}
+		if err := tx.InstallCertVersion(version); err != nil {
+			return fmt.Errorf("failed to save certificate version: %v", err)
+		}
+		return webhook.Enqueue(tx, webhook.EventIssued, webhook.NewCertificate(&record, &version))
+	})
+	if err != nil {
+		return "", err
+	}
+	webhook.Dispatch()
+	return certID, nil
+}
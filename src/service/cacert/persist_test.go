@@ -0,0 +1,211 @@
+package cacert
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"gorm.io/gorm"
+)
+
+// setup 打开内存数据库、创建签发 CA 并订阅所有 Webhook 事件，返回数据库和 CA 证书 ID
+func setup(t *testing.T) (*gorm.DB, string) {
+	db := testenv.Open(t)
+	testenv.Config(t).Spki.Webhook.Endpoints = []config.WebhookEndpoint{{Name: "deploy", URL: "http://127.0.0.1:1/hook"}}
+	if err := profile.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	caID, _, _ := testenv.CA(t, "Test Root")
+	return db, caID
+}
+
+// injectFaults 将数据存储替换为注入错误的数据存储，测试结束后恢复
+func injectFaults(t *testing.T) *faultRepository {
+	inner := models.Repo()
+	fr := newFaultRepository(inner)
+	models.SetRepository(fr)
+	t.Cleanup(func() { models.SetRepository(inner) })
+	return fr
+}
+
+// newCSR 生成证书请求及其私钥
+func newCSR(t *testing.T, cn string, dnsNames ...string) (*x509.CertificateRequest, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr, key
+}
+
+// assertRows 检查各表的行数
+func assertRows(t *testing.T, db *gorm.DB, want map[string]int64) {
+	t.Helper()
+	for table, n := range want {
+		if got := testenv.Count(t, db, table); got != n {
+			t.Errorf("%s has %d rows, want %d", table, got, n)
+		}
+	}
+}
+
+func TestIssueCSRRollback(t *testing.T) {
+	for _, method := range []string{"InstallPrivateKey", "InstallCreator", "CreateCertificate", "InstallCertVersion", "InstallWebhookEvent"} {
+		t.Run(method, func(t *testing.T) {
+			db, caID := setup(t)
+			ca, err := LoadCA(caID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fr := injectFaults(t)
+			fr.FailOn(method, 1)
+
+			csr, key := newCSR(t, "www.example.com", "www.example.com")
+			_, _, err = ca.IssueCSR(&CSRIssue{CSR: csr, Profile: "server", UserID: "u1", Account: "alice", Key: key})
+			if err == nil || errors.Is(err, ErrRejected) {
+				t.Fatalf("err = %v, want injected fault", err)
+			}
+			if fr.Calls(method) != 1 || fr.Calls("DeletePrivateKey") != 0 {
+				t.Fatalf("%s was called %d times, DeletePrivateKey %d times", method, fr.Calls(method), fr.Calls("DeletePrivateKey"))
+			}
+			// 只剩下 CA 证书、CA 证书版本和 CA 私钥，签发时导入的私钥随事务回滚
+			assertRows(t, db, map[string]int64{
+				"creator":        0,
+				"certificate":    1,
+				"version":        1,
+				"webhook_outbox": 0,
+				"private_key":    1,
+			})
+		})
+	}
+}
+
+func TestIssueCSRCommit(t *testing.T) {
+	db, caID := setup(t)
+	ca, err := LoadCA(caID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, key := newCSR(t, "www.example.com", "www.example.com")
+	_, result, err := ca.IssueCSR(&CSRIssue{CSR: csr, Profile: "server", UserID: "u1", Account: "alice", Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, db, map[string]int64{
+		"creator":        1,
+		"certificate":    2,
+		"version":        2,
+		"webhook_outbox": 1,
+		"private_key":    2,
+	})
+	version, err := models.FindLatestCertVersion(result.CertID)
+	if err != nil || version.Serial != result.Serial || version.KeyID == "" {
+		t.Fatalf("version = %+v, %v", version, err)
+	}
+	// 记录签发使用的签名配置
+	record, err := models.FindCertificateByCertID(result.CertID)
+	if err != nil || record.Profile == nil || *record.Profile != "server" {
+		t.Fatalf("certificate = %+v, %v", record, err)
+	}
+}
+
+// initCa 调用创建 CA 的接口，返回状态码和错误码
+func initCa(t *testing.T, cfg CAConfig) (int, string) {
+	body, _ := json.Marshal(cfg)
+	c := ut.CreateUtRequestContext(http.MethodPost, "/spki/ca", &ut.Body{Body: bytes.NewReader(body), Len: len(body)},
+		ut.Header{Key: "Content-Type", Value: "application/json"})
+	c.Set("userId", "u1")
+	c.Set("account", "alice")
+	InitCa()(context.Background(), c)
+
+	var res struct {
+		Metadata answer.Metadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(c.Response.Body(), &res); err != nil {
+		t.Fatalf("invalid response %q: %v", c.Response.Body(), err)
+	}
+	return c.Response.StatusCode(), res.Metadata.Ecode
+}
+
+func TestInitCaRollback(t *testing.T) {
+	cfg := CAConfig{Key: KeyConfig{Algo: "ecdsa", Size: 256}, Names: Names{CN: "Root", O: "Example", OU: "PKI"}, Expiry: 365}
+	for _, method := range []string{"InstallPrivateKey", "InstallCreator", "CreateCertificate", "InstallCertVersion", "InstallWebhookEvent"} {
+		t.Run(method, func(t *testing.T) {
+			db := testenv.Open(t)
+			testenv.Config(t).Spki.Webhook.Endpoints = []config.WebhookEndpoint{{Name: "deploy", URL: "http://127.0.0.1:1/hook"}}
+			fr := injectFaults(t)
+			fr.FailOn(method, 1)
+
+			status, ecode := initCa(t, cfg)
+			if status != http.StatusInternalServerError || ecode != answer.EcodeDatabaseError {
+				t.Fatalf("response = %d %s", status, ecode)
+			}
+			assertRows(t, db, map[string]int64{
+				"creator":        0,
+				"certificate":    0,
+				"version":        0,
+				"webhook_outbox": 0,
+				"private_key":    0,
+			})
+		})
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		db := testenv.Open(t)
+		testenv.Config(t)
+		status, ecode := initCa(t, cfg)
+		if status != http.StatusCreated || ecode != answer.EcodeOK {
+			t.Fatalf("response = %d %s", status, ecode)
+		}
+		assertRows(t, db, map[string]int64{"creator": 1, "certificate": 1, "version": 1, "private_key": 1})
+	})
+}
+
+func TestInitCaKeyRollback(t *testing.T) {
+	db := testenv.Open(t)
+	testenv.Config(t)
+	dir := t.TempDir()
+	if err := keystore.Init(&config.KeyStore{Type: keystore.BackendFile, Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { keystore.Init(&config.KeyStore{}) })
+	fr := injectFaults(t)
+	fr.FailOn("InstallCertVersion", 1)
+
+	// 私钥记录在证书版本之前写入，由事务回滚撤销，不依赖事后删除
+	cfg := CAConfig{Key: KeyConfig{Algo: "ecdsa", Size: 256}, Names: Names{CN: "Root"}, Expiry: 365}
+	status, ecode := initCa(t, cfg)
+	if status != http.StatusInternalServerError || ecode != answer.EcodeDatabaseError {
+		t.Fatalf("response = %d %s", status, ecode)
+	}
+	if fr.Calls("InstallPrivateKey") != 1 || fr.Calls("DeletePrivateKey") != 0 {
+		t.Fatalf("InstallPrivateKey was called %d times, DeletePrivateKey %d times", fr.Calls("InstallPrivateKey"), fr.Calls("DeletePrivateKey"))
+	}
+	assertRows(t, db, map[string]int64{"certificate": 0, "version": 0, "private_key": 0})
+	// 软件令牌中的私钥文件已删除
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*.key")); len(paths) != 0 {
+		t.Fatalf("private key files after rollback: %v", paths)
+	}
+}
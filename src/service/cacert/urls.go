@@ -0,0 +1,133 @@
+package cacert
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/signature"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// CAURLs CA 签发证书时写入的 AIA 和 CRL 分发点地址
+// 字段为 nil 时使用 spki.yaml 中的默认值，为空字符串时不写入该扩展
+type CAURLs struct {
+	CAIssuers *string `json:"caIssuers,omitempty"` // CA 证书下载地址
+	Ocsp      *string `json:"ocsp,omitempty"`      // OCSP 响应器地址
+	Crl       *string `json:"crl,omitempty"`       // CRL 分发点
+}
+
+// validate 检查地址格式
+func (u *CAURLs) validate() error {
+	if u == nil {
+		return nil
+	}
+	for _, v := range []*string{u.CAIssuers, u.Ocsp, u.Crl} {
+		if v == nil || *v == "" {
+			continue
+		}
+		parsed, err := url.Parse(*v)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return errors.New("invalid URL: " + *v)
+		}
+	}
+	return nil
+}
+
+// resolveURL 返回 CA 的地址，未设置时使用默认值并替换其中的 {certid}
+func resolveURL(value *string, def, certID string) string {
+	if value != nil {
+		return *value
+	}
+	return strings.ReplaceAll(def, "{certid}", certID)
+}
+
+// URLs 返回 CA 签发证书时实际使用的地址
+func (a *Authority) URLs() (caIssuers, ocsp, crl string) {
+	var def config.Aia
+	if config.AppCfg != nil {
+		def = config.AppCfg.Spki.Aia
+	}
+	certID := *a.Record.CertID
+	return resolveURL(a.Record.IssuerURL, def.CAIssuers, certID),
+		resolveURL(a.Record.OcspURL, def.Ocsp, certID),
+		resolveURL(a.Record.CrlURL, def.Crl, certID)
+}
+
+// Sign 使用 CA 私钥签发证书，并写入 CA 的 AIA 和 CRL 分发点扩展
+func (a *Authority) Sign(template *x509.Certificate, pub any) (*x509.Certificate, error) {
+	caIssuers, ocsp, crl := a.URLs()
+	if caIssuers != "" {
+		template.IssuingCertificateURL = []string{caIssuers}
+	}
+	if ocsp != "" {
+		template.OCSPServer = []string{ocsp}
+	}
+	if crl != "" {
+		template.CRLDistributionPoints = []string{crl}
+	}
+	return signature.CertSignature(template, a.Cert, pub, a.Signer)
+}
+
+// UpdateCaURLs 修改 CA 签发证书时写入的 AIA 和 CRL 分发点地址
+func UpdateCaURLs() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var urls CAURLs
+		if err := c.BindJSON(&urls); err != nil {
+			hlog.Error("The request body is invalid. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
+			return
+		}
+		if err := urls.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		certID := c.Param("certid")
+		record, err := models.FindCertificateByCertID(certID)
+		if err != nil {
+			hlog.Error("Failed to query certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificate.", ""))
+			return
+		}
+		if record.CertID == nil || *record.Genre != models.GenreCA {
+			c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "CA certificate not found.", ""))
+			return
+		}
+
+		if err := models.UpdateCertificateURLs(certID, urls.CAIssuers, urls.Ocsp, urls.Crl); err != nil {
+			hlog.Error("Failed to update CA URLs. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to update CA URLs.", ""))
+			return
+		}
+		c.JSON(http.StatusOK, answer.ResBody(answer.EcodeOK, "", urls))
+	}
+}
+
+// GetCaCert 下载 DER 格式的 CA 证书，即 AIA caIssuers 地址
+func GetCaCert() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		record, _, cert, err := loadCert(c.Param("certid"))
+		if err != nil {
+			if errors.Is(err, ErrCANotFound) {
+				c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "CA certificate not found.", ""))
+				return
+			}
+			hlog.Error("Failed to load CA certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load CA certificate.", ""))
+			return
+		}
+		if *record.Genre != models.GenreCA {
+			c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "CA certificate not found.", ""))
+			return
+		}
+		c.Data(http.StatusOK, "application/pkix-cert", cert.Raw)
+	}
+}
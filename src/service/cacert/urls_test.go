@@ -0,0 +1,90 @@
+package cacert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"testing"
+	"time"
+)
+
+func TestCAURLsValidate(t *testing.T) {
+	s := func(v string) *string { return &v }
+	for _, tt := range []struct {
+		urls *CAURLs
+		ok   bool
+	}{
+		{nil, true},
+		{&CAURLs{}, true},
+		{&CAURLs{CAIssuers: s("http://pki.example.com/ca.der"), Ocsp: s("https://ocsp.example.com"), Crl: s("")}, true},
+		{&CAURLs{Ocsp: s("ldap://ldap.example.com")}, false},
+		{&CAURLs{Crl: s("pki.example.com/crl")}, false},
+		{&CAURLs{CAIssuers: s("http://[::1")}, false},
+	} {
+		if err := tt.urls.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate(%+v) = %v", tt.urls, err)
+		}
+	}
+}
+
+func TestAuthoritySign(t *testing.T) {
+	testenv.Config(t).Spki.Aia = config.Aia{
+		CAIssuers: "http://pki.example.com/ca/{certid}",
+		Ocsp:      "http://pki.example.com/ocsp/{certid}",
+		Crl:       "http://pki.example.com/crl/{certid}",
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(der)
+	certID, empty, override := "ca1", "", "http://crl.example.com/root.crl"
+	ca := &Authority{Record: &models.Certificate{CertID: &certID}, Cert: caCert, Signer: key}
+
+	// 未设置时使用默认地址，为空字符串时不写入扩展
+	for name, tt := range map[string]struct {
+		ocsp, crl *string
+		want      []string
+	}{
+		"default":  {nil, nil, []string{"http://pki.example.com/ca/ca1", "http://pki.example.com/ocsp/ca1", "http://pki.example.com/crl/ca1"}},
+		"override": {&empty, &override, []string{"http://pki.example.com/ca/ca1", "", override}},
+	} {
+		ca.Record.OcspURL, ca.Record.CrlURL = tt.ocsp, tt.crl
+		cert, err := ca.Sign(&x509.Certificate{SerialNumber: big.NewInt(2), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Minute)}, key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{first(cert.IssuingCertificateURL), first(cert.OCSPServer), first(cert.CRLDistributionPoints)}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: URLs = %q, want %q", name, got, tt.want)
+		}
+	}
+}
+
+// first 返回第一个地址，没有地址时返回空字符串
+func first(urls []string) string {
+	if len(urls) == 0 {
+		return ""
+	}
+	return urls[0]
+}
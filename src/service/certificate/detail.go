@@ -0,0 +1,208 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"spki/profile"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/service/cacert"
+	"spki/src/service/revoke"
+	"spki/src/signature"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Sans 使用者可选名称
+type Sans struct {
+	DNS   []string `json:"dns,omitempty"`
+	IP    []string `json:"ip,omitempty"`
+	Email []string `json:"email,omitempty"`
+	URI   []string `json:"uri,omitempty"`
+}
+
+// Fingerprints 证书指纹
+type Fingerprints struct {
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+}
+
+// Detail 证书详情，包含从当前版本证书中解析出的信息
+type Detail struct {
+	Item
+	Issuer             string       `json:"issuer"`
+	SerialNumber       string       `json:"serial_number"` // 冒号分隔的十六进制序列号
+	SansDetail         Sans         `json:"san"`
+	KeyAlgorithm       string       `json:"key_algorithm"`
+	KeySize            int          `json:"key_size"`
+	SignatureAlgorithm string       `json:"signature_algorithm"`
+	SubjectKeyID       string       `json:"ski,omitempty"`
+	AuthorityKeyID     string       `json:"aki,omitempty"`
+	NotBefore          string       `json:"not_before"`
+	NotAfter           string       `json:"not_after"`
+	IsCA               bool         `json:"is_ca"`
+	MaxPathLen         *int         `json:"max_path_len,omitempty"` // 仅 CA 证书，不限制时为空
+	Fingerprints       Fingerprints `json:"fingerprints"`
+	Cert               string       `json:"cert"` // 证书（PEM）
+}
+
+// VersionItem 证书版本
+type VersionItem struct {
+	ID               int    `json:"id"`
+	Serial           string `json:"serial"`
+	KeyID            string `json:"keyid,omitempty"`
+	EffectiveTime    int64  `json:"effective_time"`
+	ExpirationTime   int64  `json:"expiration_time"`
+	RevocationTime   int64  `json:"revocation_time,omitempty"`
+	RevocationReason string `json:"revocation_reason,omitempty"`
+	InvalidityTime   int64  `json:"invalidity_time,omitempty"`
+}
+
+// hexColon 以冒号分隔的大写十六进制表示，与 openssl 输出一致
+func hexColon(b []byte) string {
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02X", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+// keySize 返回公钥长度
+func keySize(pub any) int {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	default:
+		return 0
+	}
+}
+
+// newDetail 解析证书，生成证书详情
+func newDetail(record *models.Certificate, version *models.Version, cert *x509.Certificate) Detail {
+	d := Detail{
+		Item: newItem(&models.CertificateItem{
+			Certificate:    *record,
+			Serial:         version.Serial,
+			EffectiveTime:  version.EffectiveTime,
+			ExpirationTime: version.ExpirationTime,
+			RevocationTime: version.RevocationTime,
+		}),
+		Issuer:       *cacert.SubjectString(cert.Issuer),
+		SerialNumber: hexColon(cert.SerialNumber.Bytes()),
+		SansDetail: Sans{
+			DNS:   cert.DNSNames,
+			Email: cert.EmailAddresses,
+		},
+		KeyAlgorithm:       profile.KeyAlgo(cert.PublicKey),
+		KeySize:            keySize(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SubjectKeyID:       hexColon(cert.SubjectKeyId),
+		AuthorityKeyID:     hexColon(cert.AuthorityKeyId),
+		NotBefore:          cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:           cert.NotAfter.UTC().Format(time.RFC3339),
+		IsCA:               cert.IsCA,
+		Cert:               string(signature.CertToPEM(cert)),
+	}
+	for _, ip := range cert.IPAddresses {
+		d.SansDetail.IP = append(d.SansDetail.IP, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		d.SansDetail.URI = append(d.SansDetail.URI, uri.String())
+	}
+	if cert.IsCA && (cert.MaxPathLen > 0 || cert.MaxPathLenZero) {
+		d.MaxPathLen = &cert.MaxPathLen
+	}
+	sum1 := sha1.Sum(cert.Raw)
+	sum256 := sha256.Sum256(cert.Raw)
+	d.Fingerprints = Fingerprints{SHA1: hexColon(sum1[:]), SHA256: hexColon(sum256[:])}
+	return d
+}
+
+// findRecord 查询证书，不存在时返回 404
+func findRecord(c *app.RequestContext) *models.Certificate {
+	record, err := models.FindCertificateByCertID(c.Param("certid"))
+	if err != nil {
+		hlog.Error("Failed to query certificate. error: ", err)
+		c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificate.", ""))
+		return nil
+	}
+	if record.CertID == nil {
+		c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "Certificate not found.", ""))
+		return nil
+	}
+	return record
+}
+
+// GetCertificate 查询证书详情
+func GetCertificate() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		record := findRecord(c)
+		if record == nil {
+			return
+		}
+		version, err := models.FindLatestCertVersion(*record.CertID)
+		if err != nil {
+			hlog.Error("Failed to query certificate version. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificate version.", ""))
+			return
+		}
+		if version.ID == 0 {
+			c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "Certificate not found.", ""))
+			return
+		}
+		cert, err := signature.ParseCertPEM([]byte(version.Cert))
+		if err != nil {
+			hlog.Errorf("Failed to parse certificate %s. error: %v", *record.CertID, err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to parse certificate.", ""))
+			return
+		}
+		c.JSON(http.StatusOK, answer.ResBody(answer.EcodeOK, "", newDetail(record, version, cert)))
+	}
+}
+
+// ListVersions 查询证书的所有版本，续期和更换私钥都会产生新版本
+func ListVersions() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		record := findRecord(c)
+		if record == nil {
+			return
+		}
+		versions, err := models.FindCertVersions(*record.CertID)
+		if err != nil {
+			hlog.Error("Failed to query certificate versions. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificate versions.", ""))
+			return
+		}
+		items := make([]VersionItem, 0, len(versions))
+		for _, v := range versions {
+			item := VersionItem{
+				ID:             v.ID,
+				Serial:         v.Serial,
+				KeyID:          v.KeyID,
+				EffectiveTime:  v.EffectiveTime,
+				ExpirationTime: v.ExpirationTime,
+				RevocationTime: v.RevocationTime,
+				InvalidityTime: v.InvalidityTime,
+			}
+			if v.RevocationTime > 0 {
+				item.RevocationReason = revoke.ReasonName(v.RevocationCode)
+			}
+			items = append(items, item)
+		}
+		c.JSON(http.StatusOK, answer.ResBody(answer.EcodeOK, "", items))
+	}
+}
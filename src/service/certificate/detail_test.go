@@ -0,0 +1,80 @@
+package certificate
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"spki/src/models"
+	"spki/src/service/cacert"
+	"spki/src/service/revoke"
+	"spki/src/signature"
+	"testing"
+)
+
+func TestGetCertificate(t *testing.T) {
+	engine, caID := setup(t)
+	engine.GET("/spki/certificates/:certid", GetCertificate())
+	issued := issue(t, engine, caID, cacert.IssueConfig{
+		Profile: "server",
+		Names:   cacert.Names{CN: "www.example.com", O: "Example"},
+		Sans:    cacert.Sans{DNS: []string{"www.example.com"}, IP: []string{"10.0.0.1"}},
+		Expiry:  30,
+	})
+	cert, _ := signature.ParseCertPEM([]byte(issued.Cert))
+
+	res := call(t, engine, http.MethodGet, "/spki/certificates/"+issued.CertID, nil)
+	var detail Detail
+	if res.status != http.StatusOK || json.Unmarshal(res.Payload, &detail) != nil {
+		t.Fatalf("detail = %d %s", res.status, res.body)
+	}
+	sum := sha256.Sum256(cert.Raw)
+	if detail.CertID != issued.CertID || detail.ParentID != caID || detail.Serial != issued.Serial || detail.Issuer != "/CN=Test Root" ||
+		detail.KeyAlgorithm != "ecdsa" || detail.KeySize != 256 || detail.IsCA || detail.MaxPathLen != nil ||
+		detail.Fingerprints.SHA256 != hexColon(sum[:]) || detail.Cert != issued.Cert {
+		t.Fatalf("detail = %+v", detail)
+	}
+	if !reflect.DeepEqual(detail.SansDetail, Sans{DNS: []string{"www.example.com"}, IP: []string{"10.0.0.1"}}) {
+		t.Fatalf("sans = %+v", detail.SansDetail)
+	}
+
+	res = call(t, engine, http.MethodGet, "/spki/certificates/"+caID, nil)
+	if res.status != http.StatusOK || json.Unmarshal(res.Payload, &detail) != nil || !detail.IsCA || detail.Genre != models.GenreCA {
+		t.Fatalf("CA detail = %d %s", res.status, res.body)
+	}
+	if res := call(t, engine, http.MethodGet, "/spki/certificates/unknown", nil); res.status != http.StatusNotFound {
+		t.Fatalf("unknown certificate = %d", res.status)
+	}
+}
+
+func TestHexColon(t *testing.T) {
+	if got := hexColon([]byte{0x0a, 0xff, 0x10}); got != "0A:FF:10" {
+		t.Fatalf("hexColon = %q", got)
+	}
+	if got := hexColon(nil); got != "" {
+		t.Fatalf("hexColon(nil) = %q", got)
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	engine, caID := setup(t)
+	engine.GET("/spki/certificates/:certid/versions", ListVersions())
+	issued := issue(t, engine, caID, cacert.IssueConfig{Profile: "client", Names: cacert.Names{CN: "alice"}, Expiry: 30})
+	record, _ := models.FindCertificateByCertID(issued.CertID)
+	version, _ := models.FindLatestCertVersion(issued.CertID)
+	if _, err := revoke.Certificate(record, version, revoke.KeyCompromise, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	res := call(t, engine, http.MethodGet, "/spki/certificates/"+issued.CertID+"/versions", nil)
+	var items []VersionItem
+	if res.status != http.StatusOK || json.Unmarshal(res.Payload, &items) != nil {
+		t.Fatalf("versions = %d %s", res.status, res.body)
+	}
+	if len(items) != 1 || items[0].Serial != issued.Serial || items[0].KeyID == "" || items[0].RevocationTime == 0 || items[0].RevocationReason != "keyCompromise" {
+		t.Fatalf("versions = %+v", items)
+	}
+	if res := call(t, engine, http.MethodGet, "/spki/certificates/unknown/versions", nil); res.status != http.StatusNotFound {
+		t.Fatalf("unknown certificate = %d", res.status)
+	}
+}
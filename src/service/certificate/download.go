@@ -0,0 +1,172 @@
+package certificate
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"spki/src/genkey"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// pkcs12PasswordHeader 请求中指定、或响应中返回自动生成的 PKCS#12 密码
+const pkcs12PasswordHeader = "X-Pkcs12-Password"
+
+// pkcs12PasswordLength 自动生成的 PKCS#12 密码长度
+const pkcs12PasswordLength = 16
+
+// downloadFormat 下载格式
+type downloadFormat struct {
+	ContentType string
+	Ext         string
+}
+
+// formats 支持的下载格式
+var formats = map[string]downloadFormat{
+	"pem":   {"application/x-pem-file", "pem"},           // 证书（PEM）
+	"der":   {"application/pkix-cert", "cer"},            // 证书（DER）
+	"chain": {"application/x-pem-file", "chain.pem"},     // 证书及其到根 CA 的证书链（PEM）
+	"p7b":   {"application/x-pkcs7-certificates", "p7b"}, // 证书及证书链的 PKCS#7 证书包（DER）
+	"p12":   {"application/x-pkcs12", "p12"},             // 私钥、证书及证书链（PKCS#12）
+}
+
+// findVersion 查询要下载的证书版本，未指定序列号时为最新版本
+func findVersion(certID, serial string) (*models.Version, error) {
+	if serial == "" {
+		return models.FindLatestCertVersion(certID)
+	}
+	version, err := models.FindCertVersionBySerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	if version.CertID != certID {
+		return &models.Version{}, nil
+	}
+	return version, nil
+}
+
+// encodePKCS12 使用 spki 保管的私钥生成 PKCS#12，CA 私钥不允许导出，导出私钥均记录审计
+func encodePKCS12(c *app.RequestContext, record *models.Certificate, version *models.Version, cert *x509.Certificate, chain []*x509.Certificate) []byte {
+	data := exportPKCS12(c, record, version, cert, chain)
+	result := audit.ResultSuccess
+	switch {
+	case c.Response.StatusCode() == http.StatusForbidden:
+		result = audit.ResultDenied
+	case data == nil:
+		result = audit.ResultFailure
+	}
+	r := audit.New(c, audit.ActionKeyExport, *record.CertID, result)
+	r.Detail = "serial " + version.Serial
+	audit.Log(r)
+	return data
+}
+
+// exportPKCS12 导出私钥并生成 PKCS#12，失败时写入错误响应并返回 nil
+func exportPKCS12(c *app.RequestContext, record *models.Certificate, version *models.Version, cert *x509.Certificate, chain []*x509.Certificate) []byte {
+	if *record.Genre == models.GenreCA || version.KeyID == "" {
+		c.JSON(http.StatusForbidden, answer.ResBody(answer.EcodeKeyNotExportable, "The private key of this certificate can not be exported.", ""))
+		return nil
+	}
+	key, err := keystore.Export(version.KeyID)
+	if err != nil {
+		if errors.Is(err, keystore.ErrExportForbidden) || errors.Is(err, keystore.ErrKeyNotFound) {
+			c.JSON(http.StatusForbidden, answer.ResBody(answer.EcodeKeyNotExportable, "The private key of this certificate can not be exported.", ""))
+			return nil
+		}
+		hlog.Error("Failed to load private key. error: ", err)
+		c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load private key.", ""))
+		return nil
+	}
+
+	password := string(c.GetHeader(pkcs12PasswordHeader))
+	if password == "" {
+		if password, err = genkey.GenerateRandomPassword(pkcs12PasswordLength); err != nil {
+			hlog.Error("Failed to generate password. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to generate password.", ""))
+			return nil
+		}
+		c.Header(pkcs12PasswordHeader, password)
+	}
+	data, err := pkcs12.Modern.Encode(key, cert, chain, password)
+	if err != nil {
+		hlog.Error("Failed to encode PKCS#12. error: ", err)
+		c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to encode PKCS#12.", ""))
+		return nil
+	}
+	return data
+}
+
+// Download 下载证书，format：pem、der、chain、p7b、p12，serial 指定证书版本，默认为最新版本
+// p12 的密码通过 X-Pkcs12-Password 请求头指定，未指定时自动生成并通过同名响应头返回
+func Download() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		name := c.DefaultQuery("format", "pem")
+		format, ok := formats[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "format must be one of pem, der, chain, p7b, p12.", ""))
+			return
+		}
+		record := findRecord(c)
+		if record == nil {
+			return
+		}
+		version, err := findVersion(*record.CertID, c.Query("serial"))
+		if err != nil {
+			hlog.Error("Failed to query certificate version. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificate version.", ""))
+			return
+		}
+		if version.ID == 0 {
+			c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "Certificate version not found.", ""))
+			return
+		}
+		cert, err := signature.ParseCertPEM([]byte(version.Cert))
+		if err != nil {
+			hlog.Errorf("Failed to parse certificate %s. error: %v", *record.CertID, err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to parse certificate.", ""))
+			return
+		}
+
+		var chain []*x509.Certificate
+		if name == "chain" || name == "p7b" || name == "p12" {
+			if chain, err = cacert.IssuerChain(record.ParentID); err != nil {
+				hlog.Error("Failed to load certificate chain. error: ", err)
+				c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load certificate chain.", ""))
+				return
+			}
+		}
+
+		var data []byte
+		switch name {
+		case "pem":
+			data = signature.CertToPEM(cert)
+		case "der":
+			data = cert.Raw
+		case "chain":
+			for _, cert := range append([]*x509.Certificate{cert}, chain...) {
+				data = append(data, signature.CertToPEM(cert)...)
+			}
+		case "p7b":
+			if data, err = signature.CertsToPKCS7(append([]*x509.Certificate{cert}, chain...)); err != nil {
+				hlog.Error("Failed to encode PKCS#7. error: ", err)
+				c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to encode PKCS#7.", ""))
+				return
+			}
+		case "p12":
+			if data = encodePKCS12(c, record, version, cert, chain); data == nil {
+				return
+			}
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+version.Serial+"."+format.Ext+`"`)
+		c.Data(http.StatusOK, format.ContentType, data)
+	}
+}
@@ -0,0 +1,104 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"spki/src/pkg/answer"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestDownload(t *testing.T) {
+	engine, caID := setup(t)
+	engine.GET("/spki/certificates/:certid/download", Download())
+	issued := issue(t, engine, caID, cacert.IssueConfig{Profile: "server", Names: cacert.Names{CN: "www.example.com"}, Expiry: 30})
+	other := issue(t, engine, caID, cacert.IssueConfig{Profile: "server", Names: cacert.Names{CN: "api.example.com"}, Expiry: 30})
+	path := "/spki/certificates/" + issued.CertID + "/download"
+	leaf, _ := signature.ParseCertPEM([]byte(issued.Cert))
+
+	for format, contentType := range map[string]string{
+		"pem":   "application/x-pem-file",
+		"der":   "application/pkix-cert",
+		"chain": "application/x-pem-file",
+		"p7b":   "application/x-pkcs7-certificates",
+	} {
+		res := call(t, engine, http.MethodGet, path+"?format="+format, nil)
+		if res.status != http.StatusOK || res.header.Get("Content-Type") != contentType {
+			t.Fatalf("%s: response = %d %s", format, res.status, res.header)
+		}
+		var certs []*x509.Certificate
+		switch format {
+		case "der":
+			cert, err := x509.ParseCertificate(res.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			certs = append(certs, cert)
+		case "pem", "chain":
+			for rest := res.body; ; {
+				var block *pem.Block
+				if block, rest = pem.Decode(rest); block == nil {
+					break
+				}
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				certs = append(certs, cert)
+			}
+		}
+		if format == "p7b" {
+			// PKCS#7 证书包中包含证书及 CA 证书
+			if !bytes.Contains(res.body, leaf.Raw) || !bytes.Contains(res.body, []byte("Test Root")) {
+				t.Fatal("p7b does not contain the certificate chain")
+			}
+			continue
+		}
+		want := map[string]int{"pem": 1, "der": 1, "chain": 2}[format]
+		if len(certs) != want || certs[0].Subject.CommonName != "www.example.com" || want == 2 && certs[1].Subject.CommonName != "Test Root" {
+			t.Fatalf("%s: %d certificates", format, len(certs))
+		}
+	}
+	if res := call(t, engine, http.MethodGet, path, nil); res.header.Get("Content-Disposition") != `attachment; filename="`+issued.Serial+`.pem"` {
+		t.Fatalf("Content-Disposition = %q", res.header.Get("Content-Disposition"))
+	}
+
+	// 未指定密码时自动生成并通过响应头返回
+	res := call(t, engine, http.MethodGet, path+"?format=p12", nil)
+	password := res.header.Get(pkcs12PasswordHeader)
+	if res.status != http.StatusOK || len(password) != pkcs12PasswordLength {
+		t.Fatalf("p12 = %d, password %q", res.status, password)
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(res.body, password)
+	if err != nil || key == nil || cert.Subject.CommonName != "www.example.com" || len(chain) != 1 {
+		t.Fatalf("p12 = %v %v %d, %v", key, cert, len(chain), err)
+	}
+	res = call(t, engine, http.MethodGet, path+"?format=p12", nil, ut.Header{Key: pkcs12PasswordHeader, Value: "changeit"})
+	if _, _, _, err := pkcs12.DecodeChain(res.body, "changeit"); err != nil || res.header.Get(pkcs12PasswordHeader) != "" {
+		t.Fatalf("p12 with password = %v", err)
+	}
+
+	for name, tt := range map[string]struct {
+		path   string
+		status int
+		ecode  string
+	}{
+		"format":       {path + "?format=jks", http.StatusBadRequest, answer.EcodeInvalidRequestParamsError},
+		"certificate":  {"/spki/certificates/unknown/download", http.StatusNotFound, answer.EcodeResourceNotFound},
+		"other serial": {path + "?serial=" + other.Serial, http.StatusNotFound, answer.EcodeResourceNotFound},
+		"CA key":       {"/spki/certificates/" + caID + "/download?format=p12", http.StatusForbidden, answer.EcodeKeyNotExportable},
+	} {
+		if res := call(t, engine, http.MethodGet, tt.path, nil); res.status != tt.status || res.Metadata.Ecode != tt.ecode {
+			t.Errorf("%s: response = %d %s", name, res.status, res.body)
+		}
+	}
+	if res := call(t, engine, http.MethodGet, path+"?serial="+issued.Serial+"&format=der", nil); res.status != http.StatusOK || !bytes.Equal(res.body, leaf.Raw) {
+		t.Fatalf("download by serial = %d", res.status)
+	}
+}
@@ -0,0 +1,190 @@
+package certificate
+
+import (
+	"context"
+	"net/http"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// genres 证书类型名称
+var genres = map[string]int{
+	"ca":   models.GenreCA,
+	"leaf": models.GenreLeaf,
+}
+
+// sortFields 排序字段
+var sortFields = map[string]string{
+	"expiry":  "expiration_time",
+	"created": "create_time",
+}
+
+// Item 证书列表中的证书
+type Item struct {
+	CertID         string  `json:"certid"`
+	UserID         string  `json:"user_id"`
+	Title          *string `json:"title"`
+	State          string  `json:"state"`
+	Subject        string  `json:"subject"`
+	Sans           string  `json:"sans,omitempty"`
+	ParentID       string  `json:"parent_id,omitempty"`
+	Pathlev        int     `json:"pathlev"`
+	Genre          int     `json:"genre"`
+	Serial         string  `json:"serial"`
+	EffectiveTime  int64   `json:"effective_time"`
+	ExpirationTime int64   `json:"expiration_time"`
+	RevocationTime int64   `json:"revocation_time,omitempty"`
+	CreateTime     int64   `json:"create_time,omitempty"`
+}
+
+// ListResult 证书列表
+type ListResult struct {
+	PageInfo *answer.PageInfo `json:"page_info"`
+	Items    []Item           `json:"items"`
+}
+
+// deref 返回字符串指针的值，nil 时返回空字符串
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// newItem 转换为证书列表中的证书
+func newItem(t *models.CertificateItem) Item {
+	item := Item{
+		CertID:         deref(t.CertID),
+		UserID:         deref(t.UserID),
+		Title:          t.Title,
+		State:          deref(t.State),
+		Subject:        deref(t.Subject),
+		Sans:           deref(t.Sans),
+		ParentID:       deref(t.ParentID),
+		Serial:         t.Serial,
+		EffectiveTime:  t.EffectiveTime,
+		ExpirationTime: t.ExpirationTime,
+		RevocationTime: t.RevocationTime,
+		CreateTime:     t.CreateTime,
+	}
+	if t.Pathlev != nil {
+		item.Pathlev = *t.Pathlev
+	}
+	if t.Genre != nil {
+		item.Genre = *t.Genre
+	}
+	return item
+}
+
+// queryInt 读取整数查询参数，未设置时返回 def
+func queryInt(c *app.RequestContext, key string, def int) (int, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// queryTime 读取时间查询参数，支持 RFC3339 和毫秒时间戳，未设置时返回 0
+func queryTime(c *app.RequestContext, key string) (int64, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, true
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ms, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, false
+	}
+	return t.UnixMilli(), true
+}
+
+// parseFilter 解析查询参数
+func parseFilter(c *app.RequestContext) (*models.CertificateFilter, int, int, string) {
+	page, ok := queryInt(c, "page", 1)
+	if !ok || page < 1 {
+		return nil, 0, 0, "page must be a positive integer."
+	}
+	pageSize, ok := queryInt(c, "page_size", defaultPageSize)
+	if !ok || pageSize < 1 || pageSize > maxPageSize {
+		return nil, 0, 0, "page_size must be between 1 and " + strconv.Itoa(maxPageSize) + "."
+	}
+
+	filter := &models.CertificateFilter{
+		UserID:   c.Query("user_id"),
+		State:    c.Query("state"),
+		ParentID: c.Query("parent_id"),
+		Subject:  c.Query("subject"),
+		San:      c.Query("san"),
+		Offset:   (page - 1) * pageSize,
+		Limit:    pageSize,
+	}
+	if genre := c.Query("genre"); genre != "" {
+		if filter.Genre, ok = genres[genre]; !ok {
+			return nil, 0, 0, "genre must be ca or leaf."
+		}
+	}
+	switch filter.State {
+	case "", models.StateValid, models.StateRevoked, models.StateExpired:
+	default:
+		return nil, 0, 0, "state must be V, R or E."
+	}
+	if filter.ExpireAfter, ok = queryTime(c, "expire_after"); !ok {
+		return nil, 0, 0, "expire_after must be a RFC3339 time or a millisecond timestamp."
+	}
+	if filter.ExpireBefore, ok = queryTime(c, "expire_before"); !ok {
+		return nil, 0, 0, "expire_before must be a RFC3339 time or a millisecond timestamp."
+	}
+
+	sort := c.DefaultQuery("sort", "created")
+	if filter.OrderBy, ok = sortFields[sort]; !ok {
+		return nil, 0, 0, "sort must be expiry or created."
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return nil, 0, 0, "order must be asc or desc."
+	}
+	return filter, page, pageSize, ""
+}
+
+// ListCertificates 分页查询证书，支持按创建者、类型、状态、上级 CA、主题、使用者可选名称和到期时间过滤
+func ListCertificates() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		filter, page, pageSize, msg := parseFilter(c)
+		if filter == nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, msg, ""))
+			return
+		}
+
+		rows, total, err := models.FindCertificates(*filter)
+		if err != nil {
+			hlog.Error("Failed to query certificates. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificates.", ""))
+			return
+		}
+		items := make([]Item, 0, len(rows))
+		for i := range rows {
+			items = append(items, newItem(&rows[i]))
+		}
+		c.JSON(http.StatusOK, answer.ResBody(answer.EcodeOK, "", ListResult{
+			PageInfo: answer.SetPageInfo(pageSize, page, int(total)),
+			Items:    items,
+		}))
+	}
+}
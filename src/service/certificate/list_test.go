@@ -0,0 +1,163 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/service/cacert"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// response 接口的响应
+type response struct {
+	status   int
+	header   http.Header
+	body     []byte
+	Metadata answer.Metadata `json:"metadata"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// setup 打开内存数据库并创建签发 CA，返回注册了证书接口的路由和 CA 证书 ID
+func setup(t *testing.T) (*route.Engine, string) {
+	testenv.Open(t)
+	testenv.Config(t)
+	caID, _, _ := testenv.CA(t, "Test Root")
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.Use(func(ctx context.Context, c *app.RequestContext) {
+		c.Set("userId", testenv.UserID)
+		c.Set("account", "alice")
+	})
+	engine.POST("/spki/ca/:certid/issue", cacert.IssueCert())
+	engine.GET("/spki/certificates", ListCertificates())
+	return engine, caID
+}
+
+// call 发送请求，body 不为 nil 时编码为 JSON
+func call(t *testing.T, engine *route.Engine, method, path string, body any, headers ...ut.Header) *response {
+	t.Helper()
+	var reqBody *ut.Body
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = &ut.Body{Body: bytes.NewReader(data), Len: len(data)}
+		headers = append(headers, ut.Header{Key: "Content-Type", Value: "application/json"})
+	}
+	res := ut.PerformRequest(engine, method, path, reqBody, headers...).Result()
+	r := &response{status: res.StatusCode(), header: http.Header{}, body: res.Body()}
+	res.Header.VisitAll(func(k, v []byte) { r.header.Add(string(k), string(v)) })
+	if bytes.HasPrefix(r.body, []byte("{")) {
+		if err := json.Unmarshal(r.body, r); err != nil {
+			t.Fatalf("invalid response %q: %v", r.body, err)
+		}
+	}
+	return r
+}
+
+// issue 签发末端证书
+func issue(t *testing.T, engine *route.Engine, caID string, cfg cacert.IssueConfig) *cacert.IssueResult {
+	t.Helper()
+	if cfg.Key.Algo == "" {
+		cfg.Key = cacert.KeyConfig{Algo: "ecdsa", Size: 256}
+	}
+	res := call(t, engine, http.MethodPost, "/spki/ca/"+caID+"/issue", cfg)
+	var result cacert.IssueResult
+	if res.status != http.StatusCreated || json.Unmarshal(res.Payload, &result) != nil {
+		t.Fatalf("issue = %d %s", res.status, res.body)
+	}
+	return &result
+}
+
+func TestListCertificates(t *testing.T) {
+	engine, caID := setup(t)
+	for _, cn := range []string{"a.example.com", "b.example.com", "c.example.org"} {
+		issue(t, engine, caID, cacert.IssueConfig{Profile: "server", Names: cacert.Names{CN: cn}, Sans: cacert.Sans{DNS: []string{cn}}, Expiry: 30})
+	}
+
+	list := func(query string) ([]Item, *answer.PageInfo) {
+		res := call(t, engine, http.MethodGet, "/spki/certificates"+query, nil)
+		var result ListResult
+		if res.status != http.StatusOK || json.Unmarshal(res.Payload, &result) != nil {
+			t.Fatalf("list %s = %d %s", query, res.status, res.body)
+		}
+		return result.Items, result.PageInfo
+	}
+	items, page := list("")
+	if len(items) != 4 || page.Total != 4 || page.Page != 1 || page.PageSize != defaultPageSize {
+		t.Fatalf("items = %+v, page = %+v", items, page)
+	}
+	// 默认按创建时间倒序，CA 证书最早创建
+	if items[3].CertID != caID || items[3].Genre != 1 {
+		t.Fatalf("last item = %+v", items[3])
+	}
+
+	for query, want := range map[string]int{
+		"?genre=ca":                           1,
+		"?genre=leaf&state=V":                 3,
+		"?san=example.com":                    2,
+		"?subject=c.example.org":              1,
+		"?parent_id=" + caID:                  3,
+		"?user_id=unknown":                    0,
+		"?expire_before=2000-01-01T00:00:00Z": 0,
+	} {
+		if items, page := list(query); len(items) != want || page.Total != want {
+			t.Errorf("list %s = %d items, total %d, want %d", query, len(items), page.Total, want)
+		}
+	}
+
+	// 分页时总数不受分页影响
+	items, page = list("?page=2&page_size=3&sort=expiry&order=asc")
+	if len(items) != 1 || page.Total != 4 || items[0].CertID != caID {
+		t.Fatalf("page 2 = %+v, %+v", items, page)
+	}
+
+	for _, query := range []string{"?page=0", "?page=x", "?page_size=101", "?genre=root", "?state=X", "?sort=name", "?order=up", "?expire_after=yesterday"} {
+		if res := call(t, engine, http.MethodGet, "/spki/certificates"+query, nil); res.status != http.StatusBadRequest || res.Metadata.Ecode != answer.EcodeInvalidRequestParamsError {
+			t.Errorf("list %s = %d %s", query, res.status, res.body)
+		}
+	}
+}
+
+func TestListCertificatesExpired(t *testing.T) {
+	db := testenv.Open(t)
+	testenv.Config(t)
+	caID, caCert, caSigner := testenv.CA(t, "Test Root")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validID, _ := testenv.Leaf(t, caID, caCert, caSigner, key.Public(), "valid.example.com")
+	expiredID, _ := testenv.Leaf(t, caID, caCert, caSigner, key.Public(), "expired.example.com")
+	// 数据库中的状态仍为有效，最新版本已到期
+	if err := db.Model(&models.Version{}).Where("certid = ?", expiredID).Update("expiration_time", time.Now().Add(-time.Hour).UnixMilli()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.GET("/spki/certificates", ListCertificates())
+	for state, want := range map[string]string{models.StateValid: validID, models.StateExpired: expiredID} {
+		res := call(t, engine, http.MethodGet, "/spki/certificates?genre=leaf&state="+state, nil)
+		var result ListResult
+		if res.status != http.StatusOK || json.Unmarshal(res.Payload, &result) != nil {
+			t.Fatalf("list state %s = %d %s", state, res.status, res.body)
+		}
+		if len(result.Items) != 1 || result.PageInfo.Total != 1 || result.Items[0].CertID != want || result.Items[0].State != state {
+			t.Errorf("list state %s = %+v", state, result.Items)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/profile"
+	"spki/src/genkey"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/pkg/common"
+	"spki/src/service/cacert"
+	"spki/src/service/crl"
+	"spki/src/service/ocsp"
+	"spki/src/service/revoke"
+	"spki/src/service/webhook"
+	"spki/src/signature"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// RenewConfig 续期和更换私钥的请求体
+type RenewConfig struct {
+	Key       *cacert.KeyConfig `json:"key,omitempty"` // 仅更换私钥时有效，不设置时使用原私钥的算法和长度
+	Expiry    int               `json:"expiry"`        // 有效期,单位是天，为 0 时与原证书相同
+	Supersede bool              `json:"supersede"`     // 是否以 superseded 原因吊销原版本
+}
+
+// renewal 续期或更换私钥时加载的证书和签发者
+type renewal struct {
+	record  *models.Certificate
+	version *models.Version
+	cert    *x509.Certificate
+	issuer  *cacert.Authority // 自签名根 CA 为 nil
+}
+
+// renewTemplate 复制原证书的主题、使用者可选名称、密钥用途和基本约束，生成新的证书模板
+// 续期时保留 SubjectKeyId，以便原证书签发的证书链继续有效
+func renewTemplate(old *x509.Certificate, validity time.Duration, keepSKI bool) *x509.Certificate {
+	template := &x509.Certificate{
+		RawSubject:            old.RawSubject,
+		Subject:               old.Subject,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              old.KeyUsage,
+		ExtKeyUsage:           old.ExtKeyUsage,
+		UnknownExtKeyUsage:    old.UnknownExtKeyUsage,
+		BasicConstraintsValid: old.BasicConstraintsValid,
+		IsCA:                  old.IsCA,
+		MaxPathLen:            old.MaxPathLen,
+		MaxPathLenZero:        old.MaxPathLenZero,
+		DNSNames:              old.DNSNames,
+		EmailAddresses:        old.EmailAddresses,
+		IPAddresses:           old.IPAddresses,
+		URIs:                  old.URIs,
+		PolicyIdentifiers:     old.PolicyIdentifiers,
+	}
+	if keepSKI {
+		template.SubjectKeyId = old.SubjectKeyId
+	}
+	return template
+}
+
+// errNoVersion 证书没有版本
+var errNoVersion = errors.New("certificate version not found")
+
+// newRenewal 加载证书的最新版本及其签发 CA，已吊销的证书返回 revoke.ErrRevoked
+func newRenewal(record *models.Certificate) (*renewal, error) {
+	if record.State != nil && *record.State == models.StateRevoked {
+		return nil, revoke.ErrRevoked
+	}
+	version, err := models.FindLatestCertVersion(*record.CertID)
+	if err != nil {
+		return nil, err
+	}
+	if version.ID == 0 {
+		return nil, errNoVersion
+	}
+	cert, err := signature.ParseCertPEM([]byte(version.Cert))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %v", *record.CertID, err)
+	}
+
+	r := &renewal{record: record, version: version, cert: cert}
+	if record.ParentID != nil && *record.ParentID != "" {
+		issuer, err := cacert.LoadCA(*record.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		r.issuer = issuer
+	}
+	return r, nil
+}
+
+// loadRenewal 加载待续期的证书及其签发 CA，已吊销的证书不能续期
+func loadRenewal(c *app.RequestContext) *renewal {
+	record := findRecord(c)
+	if record == nil {
+		return nil
+	}
+	r, err := newRenewal(record)
+	switch {
+	case err == nil:
+		return r
+	case errors.Is(err, revoke.ErrRevoked):
+		c.JSON(http.StatusConflict, answer.ResBody(answer.EcodeCertRevoked, "Certificate has been revoked.", ""))
+	case errors.Is(err, errNoVersion):
+		c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "Certificate not found.", ""))
+	case errors.Is(err, cacert.ErrCANotFound) || errors.Is(err, cacert.ErrCAUnavailable):
+		hlog.Error("Failed to load issuing CA. error: ", err)
+		c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidCAError, "The issuing CA is unavailable: "+err.Error(), ""))
+	default:
+		hlog.Error("Failed to load certificate. error: ", err)
+		c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load certificate.", ""))
+	}
+	return nil
+}
+
+// validity 计算新证书的有效期，为 0 时与原证书相同
+// 末端证书不能超过签发时签名配置的最长有效期，CA 证书和未记录签名配置的证书不能超过原证书的有效期，且都不能超过签发 CA 的有效期
+func (r *renewal) validity(expiry int) (time.Duration, error) {
+	if expiry < 0 {
+		return 0, errors.New("expiry must not be negative")
+	}
+	validity := r.cert.NotAfter.Sub(r.cert.NotBefore)
+	limit := validity
+	if r.record.Profile != nil && *r.record.Profile != "" {
+		signing, err := profile.Lookup(*r.record.Profile)
+		if err != nil {
+			return 0, err
+		}
+		limit = signing.MaxExpiry
+	}
+	if expiry > 0 {
+		validity = time.Duration(expiry) * 24 * time.Hour
+	}
+	if validity > limit {
+		return 0, fmt.Errorf("expiry exceeds the maximum validity of the certificate (%v)", limit)
+	}
+	if r.issuer != nil && time.Now().Add(validity).After(r.issuer.Cert.NotAfter) {
+		return 0, errors.New("expiry exceeds the validity of the issuing CA certificate")
+	}
+	return validity, nil
+}
+
+// checkKey 检查新公钥的类型和强度，末端证书还须符合签发时签名配置允许的私钥算法
+func (r *renewal) checkKey(pub crypto.PublicKey) error {
+	if err := cacert.CheckPublicKey(pub); err != nil {
+		return err
+	}
+	if r.record.Profile == nil || *r.record.Profile == "" {
+		return nil
+	}
+	signing, err := profile.Lookup(*r.record.Profile)
+	if err != nil {
+		return err
+	}
+	return signing.AllowKeyAlgo(profile.KeyAlgo(pub))
+}
+
+// sign 签发新证书，自签名根 CA 使用自身的私钥签名
+func (r *renewal) sign(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	if r.issuer != nil {
+		return r.issuer.Sign(template, pub)
+	}
+	signer, err := keystore.Signer(r.version.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return signature.CertSignature(template, template, pub, signer)
+}
+
+// save 在同一个事务中保存新私钥、新版本和续期事件，并按需吊销原版本
+// key 为更换私钥时新生成的私钥，为 nil 时新版本使用 keyID 对应的私钥
+func (r *renewal) save(cert *x509.Certificate, keyID string, key *keystore.Key, supersede bool) error {
+	certID := *r.record.CertID
+	if key != nil {
+		keyID = key.ID
+	}
+	version := models.Version{
+		CertID:         certID,
+		KeyID:          keyID,
+		Serial:         signature.SerialString(cert.SerialNumber),
+		Cert:           string(signature.CertToPEM(cert)),
+		EffectiveTime:  cert.NotBefore.UnixMilli(),
+		ExpirationTime: cert.NotAfter.UnixMilli(),
+	}
+	renewed := webhook.NewCertificate(r.record, &version)
+	renewed.PreviousSerial = r.version.Serial
+	renewed.Rekey = keyID != r.version.KeyID
+	err := models.Transaction(func(tx models.Repository) error {
+		if key != nil {
+			if err := key.Save(tx); err != nil {
+				return err
+			}
+		}
+		if err := tx.InstallCertVersion(version); err != nil {
+			return err
+		}
+		if err := webhook.Enqueue(tx, webhook.EventRenewed, renewed); err != nil {
+			return err
+		}
+		if supersede && r.version.RevocationTime == 0 {
+			revoked := webhook.NewCertificate(r.record, r.version)
+			revoked.Reason = revoke.ReasonName(revoke.Superseded)
+			revoked.RevocationTime = common.CreateTimestamp()
+			// 原版本已被并发吊销时保留原吊销记录，不再发送吊销事件
+			updated, err := tx.RevokeCertVersion(r.version.ID, revoked.RevocationTime, revoke.Superseded, 0)
+			if err != nil {
+				return err
+			}
+			if updated {
+				if err := webhook.Enqueue(tx, webhook.EventRevoked, revoked); err != nil {
+					return err
+				}
+			}
+		}
+		if r.record.State == nil || *r.record.State != models.StateValid {
+			return tx.UpdateCertificateState(certID, models.StateValid)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	webhook.Dispatch()
+	if supersede && r.issuer != nil {
+		ocsp.Invalidate(*r.record.ParentID, r.version.Serial)
+		crl.Regenerate(*r.record.ParentID)
+	}
+	return nil
+}
+
+// result 组装续期结果
+func (r *renewal) result(cert *x509.Certificate) (*cacert.IssueResult, error) {
+	result := &cacert.IssueResult{
+		CertID: *r.record.CertID,
+		Serial: signature.SerialString(cert.SerialNumber),
+		Cert:   string(signature.CertToPEM(cert)),
+	}
+	chain := []*x509.Certificate{cert}
+	if r.issuer != nil {
+		issuers, err := r.issuer.Chain()
+		if err != nil {
+			return nil, err
+		}
+		chain = issuers
+	}
+	for _, cert := range chain {
+		result.Chain += string(signature.CertToPEM(cert))
+	}
+	return result, nil
+}
+
+// bindRenewConfig 解析请求体，请求体为空时使用默认值
+func bindRenewConfig(c *app.RequestContext) (*RenewConfig, bool) {
+	var cfg RenewConfig
+	if len(c.Request.Body()) == 0 {
+		return &cfg, true
+	}
+	if err := c.BindJSON(&cfg); err != nil {
+		hlog.Error("The request body is invalid. error: ", err)
+		c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
+		return nil, false
+	}
+	return &cfg, true
+}
+
+// RenewCert 续期证书：使用原私钥和新的有效期、新序列号签发新版本，CA 证书保持主题和 SubjectKeyId 不变
+func RenewCert() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		cfg, ok := bindRenewConfig(c)
+		if !ok {
+			return
+		}
+		r := loadRenewal(c)
+		if r == nil {
+			return
+		}
+		validity, err := r.validity(cfg.Expiry)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		cert, err := r.sign(renewTemplate(r.cert, validity, true), r.cert.PublicKey)
+		if err != nil {
+			hlog.Error("Failed to renew certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeSignCertError, "Failed to renew certificate.", ""))
+			return
+		}
+		if err := r.save(cert, r.version.KeyID, nil, cfg.Supersede); err != nil {
+			hlog.Error("Failed to save certificate version. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save certificate version.", ""))
+			return
+		}
+		result, err := r.result(cert)
+		if err != nil {
+			hlog.Error("Failed to load certificate chain. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load certificate chain.", ""))
+			return
+		}
+		c.JSON(http.StatusCreated, answer.ResBody(answer.EcodeOK, "", result))
+	}
+}
+
+// Reissue 协议接口（EST 重新注册等）使用证书请求中的公钥为已有的末端证书签发新版本，主题和使用者可选名称与原证书相同
+// 公钥与原证书相同时沿用原私钥，否则新版本的私钥不由 spki 保管；有效期或公钥不符合要求时返回 cacert.ErrRejected
+func Reissue(certID string, pub crypto.PublicKey, expiry int) (*x509.Certificate, *cacert.IssueResult, error) {
+	record, err := models.FindCertificateByCertID(certID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record.CertID == nil {
+		return nil, nil, errNoVersion
+	}
+	if record.Genre != nil && *record.Genre == models.GenreCA {
+		return nil, nil, fmt.Errorf("%w: %s is a CA certificate", cacert.ErrRejected, certID)
+	}
+	r, err := newRenewal(record)
+	if err != nil {
+		return nil, nil, err
+	}
+	validity, err := r.validity(expiry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", cacert.ErrRejected, err)
+	}
+	if err := r.checkKey(pub); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", cacert.ErrRejected, err)
+	}
+
+	keyID := ""
+	old, ok := r.cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	sameKey := ok && old.Equal(pub)
+	if sameKey {
+		keyID = r.version.KeyID
+	}
+	template := renewTemplate(r.cert, validity, sameKey)
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+	cert, err := r.sign(template, pub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	if err := r.save(cert, keyID, nil, false); err != nil {
+		return nil, nil, fmt.Errorf("failed to save certificate version: %v", err)
+	}
+	result, err := r.result(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, result, nil
+}
+
+// keyParams 返回公钥的算法和长度
+func keyParams(pub crypto.PublicKey) cacert.KeyConfig {
+	return cacert.KeyConfig{Algo: profile.KeyAlgo(pub), Size: keySize(pub)}
+}
+
+// RekeyCert 更换末端证书的私钥：生成新私钥，以相同的主题和使用者可选名称签发新版本
+func RekeyCert() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		cfg, ok := bindRenewConfig(c)
+		if !ok {
+			return
+		}
+		r := loadRenewal(c)
+		if r == nil {
+			return
+		}
+		if *r.record.Genre == models.GenreCA {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "Rekey is only supported for end-entity certificates.", ""))
+			return
+		}
+		validity, err := r.validity(cfg.Expiry)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		params := keyParams(r.cert.PublicKey)
+		if cfg.Key != nil {
+			params = *cfg.Key
+		}
+		key, err := genkey.CreateKey(params.Algo, params.Size) // 创建私钥
+		if err != nil {
+			hlog.Error("Failed to create private key. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeGenerateKeyError, err.Error(), ""))
+			return
+		}
+		signer := key.(crypto.Signer)
+		if err := r.checkKey(signer.Public()); err != nil {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, err.Error(), ""))
+			return
+		}
+
+		template := renewTemplate(r.cert, validity, false)
+		if _, ok := signer.Public().(*rsa.PublicKey); !ok { // 只有 RSA 公钥才能用于密钥加密
+			template.KeyUsage &^= x509.KeyUsageKeyEncipherment
+		}
+		cert, err := r.sign(template, signer.Public())
+		if err != nil {
+			hlog.Error("Failed to rekey certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeSignCertError, "Failed to rekey certificate.", ""))
+			return
+		}
+
+		keyPEM, err := genkey.PrivateKeyToPEM(key)
+		if err != nil {
+			hlog.Error("Failed to encode private key. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to encode private key.", ""))
+			return
+		}
+		saved, err := keystore.Exportable().Import(signer)
+		if err != nil {
+			hlog.Error("Failed to save private key. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save private key.", ""))
+			return
+		}
+		if err := r.save(cert, "", saved, cfg.Supersede); err != nil {
+			if err := saved.Discard(); err != nil {
+				hlog.Errorf("Failed to destroy private key %s. error: %v", saved.ID, err)
+			}
+			hlog.Error("Failed to save certificate version. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to save certificate version.", ""))
+			return
+		}
+		result, err := r.result(cert)
+		if err != nil {
+			hlog.Error("Failed to load certificate chain. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to load certificate chain.", ""))
+			return
+		}
+		result.Key = string(keyPEM)
+		c.JSON(http.StatusCreated, answer.ResBody(answer.EcodeOK, "", result))
+	}
+}
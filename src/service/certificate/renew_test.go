@@ -0,0 +1,205 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// renew 续期或更换私钥，返回响应和新证书
+func renew(t *testing.T, engine *route.Engine, op, certID string, cfg RenewConfig) (*response, *cacert.IssueResult) {
+	t.Helper()
+	res := call(t, engine, http.MethodPost, "/spki/certificates/"+certID+"/"+op, cfg)
+	var result cacert.IssueResult
+	if res.status == http.StatusCreated {
+		if err := json.Unmarshal(res.Payload, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res, &result
+}
+
+// setupRenew 注册续期和更换私钥接口，签发有效期 30 天的服务器证书
+func setupRenew(t *testing.T) (*route.Engine, string, *cacert.IssueResult) {
+	engine, caID := setup(t)
+	engine.POST("/spki/certificates/:certid/renew", RenewCert())
+	engine.POST("/spki/certificates/:certid/rekey", RekeyCert())
+	issued := issue(t, engine, caID, cacert.IssueConfig{Profile: "server", Names: cacert.Names{CN: "www.example.com"}, Sans: cacert.Sans{DNS: []string{"www.example.com"}}, Expiry: 30})
+	return engine, caID, issued
+}
+
+func TestRenewCert(t *testing.T) {
+	engine, caID, issued := setupRenew(t)
+	old, _ := signature.ParseCertPEM([]byte(issued.Cert))
+	oldVersion, _ := models.FindLatestCertVersion(issued.CertID)
+
+	res, renewed := renew(t, engine, "renew", issued.CertID, RenewConfig{Supersede: true})
+	if res.status != http.StatusCreated || renewed.CertID != issued.CertID || renewed.Serial == issued.Serial || renewed.Key != "" {
+		t.Fatalf("renew = %d %s", res.status, res.body)
+	}
+	cert, _ := signature.ParseCertPEM([]byte(renewed.Cert))
+	if cert.Subject.CommonName != "www.example.com" || cert.DNSNames[0] != "www.example.com" || !bytes.Equal(cert.SubjectKeyId, old.SubjectKeyId) ||
+		cert.NotAfter.Sub(cert.NotBefore) != 30*24*time.Hour {
+		t.Fatalf("renewed certificate = %+v", cert)
+	}
+	version, _ := models.FindLatestCertVersion(issued.CertID)
+	if version.Serial != renewed.Serial || version.KeyID != oldVersion.KeyID {
+		t.Fatalf("version = %+v", version)
+	}
+	if superseded, _ := models.FindCertVersionBySerial(issued.Serial); superseded.RevocationTime == 0 {
+		t.Fatal("previous version was not superseded")
+	}
+
+	// 末端证书可以续期到签名配置的最长有效期，不能超过
+	if res, renewed := renew(t, engine, "renew", issued.CertID, RenewConfig{Expiry: 365}); res.status != http.StatusCreated {
+		t.Fatalf("renew within profile = %d %s", res.status, res.body)
+	} else if cert, _ := signature.ParseCertPEM([]byte(renewed.Cert)); cert.NotAfter.Sub(cert.NotBefore) != 365*24*time.Hour {
+		t.Fatalf("validity = %v", cert.NotAfter.Sub(cert.NotBefore))
+	}
+	for name, tt := range map[string]struct {
+		certID string
+		cfg    RenewConfig
+	}{
+		"beyond profile": {issued.CertID, RenewConfig{Expiry: 366}},
+		"negative":       {issued.CertID, RenewConfig{Expiry: -1}},
+		"beyond CA cert": {caID, RenewConfig{Expiry: 3700}},
+	} {
+		if res, _ := renew(t, engine, "renew", tt.certID, tt.cfg); res.status != http.StatusBadRequest || res.Metadata.Ecode != answer.EcodeInvalidRequestParamsError {
+			t.Errorf("%s: renew = %d %s", name, res.status, res.body)
+		}
+	}
+
+	// 自签名根 CA 使用自身私钥续期
+	if res, renewed := renew(t, engine, "renew", caID, RenewConfig{}); res.status != http.StatusCreated {
+		t.Fatalf("renew CA = %d %s", res.status, res.body)
+	} else if cert, _ := signature.ParseCertPEM([]byte(renewed.Cert)); !cert.IsCA || cert.CheckSignatureFrom(cert) != nil {
+		t.Fatal("renewed CA certificate is not self-signed")
+	}
+	if res, _ := renew(t, engine, "renew", "unknown", RenewConfig{}); res.status != http.StatusNotFound {
+		t.Fatalf("renew unknown certificate = %d", res.status)
+	}
+}
+
+func TestRekeyCert(t *testing.T) {
+	engine, caID, issued := setupRenew(t)
+	oldVersion, _ := models.FindLatestCertVersion(issued.CertID)
+
+	res, rekeyed := renew(t, engine, "rekey", issued.CertID, RenewConfig{Key: &cacert.KeyConfig{Algo: "rsa", Size: 2048}})
+	if res.status != http.StatusCreated || rekeyed.Key == "" {
+		t.Fatalf("rekey = %d %s", res.status, res.body)
+	}
+	cert, _ := signature.ParseCertPEM([]byte(rekeyed.Cert))
+	version, _ := models.FindLatestCertVersion(issued.CertID)
+	if keyParams(cert.PublicKey).Algo != "rsa" || version.KeyID == "" || version.KeyID == oldVersion.KeyID {
+		t.Fatalf("rekeyed version = %+v", version)
+	}
+
+	for name, tt := range map[string]struct {
+		certID string
+		cfg    RenewConfig
+	}{
+		"CA":             {caID, RenewConfig{}},
+		"beyond profile": {issued.CertID, RenewConfig{Expiry: 400}},
+	} {
+		if res, _ := renew(t, engine, "rekey", tt.certID, tt.cfg); res.status != http.StatusBadRequest {
+			t.Errorf("%s: rekey = %d %s", name, res.status, res.body)
+		}
+	}
+
+	// 已吊销的证书不能续期和更换私钥
+	if err := models.UpdateCertificateState(issued.CertID, models.StateRevoked); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []string{"renew", "rekey"} {
+		if res, _ := renew(t, engine, op, issued.CertID, RenewConfig{}); res.status != http.StatusConflict || res.Metadata.Ecode != answer.EcodeCertRevoked {
+			t.Errorf("%s revoked certificate = %d %s", op, res.status, res.body)
+		}
+	}
+}
+
+func TestReissue(t *testing.T) {
+	_, caID, issued := setupRenew(t)
+	old, _ := signature.ParseCertPEM([]byte(issued.Cert))
+	oldVersion, _ := models.FindLatestCertVersion(issued.CertID)
+
+	// 公钥与原证书相同时沿用原私钥
+	cert, result, err := Reissue(issued.CertID, old.PublicKey, 0)
+	if err != nil || result.Serial == issued.Serial || cert.Subject.CommonName != "www.example.com" {
+		t.Fatalf("reissue = %v, %v", result, err)
+	}
+	if version, _ := models.FindLatestCertVersion(issued.CertID); version.KeyID != oldVersion.KeyID {
+		t.Fatalf("version = %+v", version)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, _, err := Reissue(issued.CertID, key.Public(), 90); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := models.FindLatestCertVersion(issued.CertID); version.KeyID != "" {
+		t.Fatalf("new key was recorded as kept by spki: %+v", version)
+	}
+
+	for name, tt := range map[string]struct {
+		certID string
+		expiry int
+	}{
+		"beyond profile": {issued.CertID, 366},
+		"CA":             {caID, 0},
+	} {
+		if _, _, err := Reissue(tt.certID, key.Public(), tt.expiry); !errors.Is(err, cacert.ErrRejected) {
+			t.Errorf("%s: reissue = %v, want ErrRejected", name, err)
+		}
+	}
+}
+
+func TestRenewKeyCheck(t *testing.T) {
+	engine, _, issued := setupRenew(t)
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 强度不足的新私钥
+	if res, _ := renew(t, engine, "rekey", issued.CertID, RenewConfig{Key: &cacert.KeyConfig{Algo: "rsa", Size: 1024}}); res.status != http.StatusBadRequest || res.Metadata.Ecode != answer.EcodeInvalidRequestParamsError {
+		t.Errorf("rekey with weak key = %d %s", res.status, res.body)
+	}
+	if _, _, err := Reissue(issued.CertID, weak.Public(), 0); !errors.Is(err, cacert.ErrRejected) {
+		t.Errorf("reissue with weak key = %v, want ErrRejected", err)
+	}
+
+	// 签发时的签名配置只允许 ECDSA 私钥
+	err = profile.Init(map[string]config.SigningProfile{
+		"server": {KeyUsages: []string{"digital signature"}, ExtKeyUsages: []string{"server auth"}, KeyAlgos: []string{"ecdsa"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { profile.Init(nil) })
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := renew(t, engine, "rekey", issued.CertID, RenewConfig{Key: &cacert.KeyConfig{Algo: "rsa", Size: 2048}}); res.status != http.StatusBadRequest || res.Metadata.Ecode != answer.EcodeInvalidRequestParamsError {
+		t.Errorf("rekey with RSA key = %d %s", res.status, res.body)
+	}
+	if _, _, err := Reissue(issued.CertID, key.Public(), 0); !errors.Is(err, cacert.ErrRejected) {
+		t.Errorf("reissue with RSA key = %v, want ErrRejected", err)
+	}
+	if res, _ := renew(t, engine, "rekey", issued.CertID, RenewConfig{Key: &cacert.KeyConfig{Algo: "ecdsa", Size: 256}}); res.status != http.StatusCreated {
+		t.Errorf("rekey with ECDSA key = %d %s", res.status, res.body)
+	}
+}
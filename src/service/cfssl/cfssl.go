@@ -0,0 +1,207 @@
+package cfssl
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Prefix cfssl 远程签名接口的路径前缀，与 cfssl serve 一致
+const Prefix = "/api/v1/cfssl"
+
+// defaultProfile 默认签名配置
+const defaultProfile = "server"
+
+// creator cfssl 接口签发证书的创建者名称，authsign 时附加密钥名称
+const creator = "cfssl"
+
+// 错误码，与 cfssl errors 包的分类和原因一致；请求格式错误时使用 HTTP 状态码
+const (
+	codeGenerationFailed = 2400 // PrivateKeyError, GenerationFailed
+	codeInvalidPolicy    = 5200 // PolicyError, InvalidPolicy
+	codeInvalidRequest   = 5300 // PolicyError, InvalidRequest
+	codeUnknownProfile   = 5400 // PolicyError, UnknownProfile
+	codeCSRParseFailed   = 9004 // CSRError, ParseFailed
+)
+
+// response cfssl 接口的响应格式，客户端以 success 和 errors 判断结果
+type response struct {
+	Success  bool            `json:"success"`
+	Result   any             `json:"result"`
+	Errors   []responseError `json:"errors"`
+	Messages []string        `json:"messages"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// settings cfssl 接口配置
+func settings() config.Cfssl {
+	if config.AppCfg == nil {
+		return config.Cfssl{}
+	}
+	return config.AppCfg.Spki.Cfssl
+}
+
+// userID 作为证书创建者时的用户 ID
+func userID(account string) string {
+	sum := sha256.Sum256([]byte(account))
+	return hex.EncodeToString(sum[:16])
+}
+
+// succeed 返回成功响应
+func succeed(c *app.RequestContext, result any) {
+	c.JSON(http.StatusOK, response{Success: true, Result: result, Errors: []responseError{}, Messages: []string{}})
+}
+
+// fail 返回错误响应，cfssl 客户端在状态码不是 200 时读取 errors
+func fail(c *app.RequestContext, status, code int, msg string) {
+	c.JSON(status, response{Errors: []responseError{{Code: code, Message: msg}}, Messages: []string{}})
+}
+
+// enabled 检查是否启用了 cfssl 接口，未启用时返回 404
+func enabled(c *app.RequestContext) bool {
+	if settings().Enabled {
+		return true
+	}
+	fail(c, http.StatusNotFound, http.StatusNotFound, "The cfssl API is not enabled.")
+	return false
+}
+
+// bind 解析 JSON 请求体
+func bind(c *app.RequestContext, body []byte, v any) bool {
+	if err := json.Unmarshal(body, v); err != nil {
+		hlog.Info("The cfssl request body is invalid. error: ", err)
+		fail(c, http.StatusBadRequest, http.StatusBadRequest, "Unable to parse request.")
+		return false
+	}
+	return true
+}
+
+// lookupProfile 获取请求指定的签名配置，未指定时使用配置的默认签名配置
+func lookupProfile(c *app.RequestContext, name string) *profile.Signing {
+	if name == "" {
+		name = settings().Profile
+	}
+	if name == "" {
+		name = defaultProfile
+	}
+	signing, err := profile.Lookup(name)
+	if err != nil {
+		fail(c, http.StatusBadRequest, codeUnknownProfile, err.Error())
+		return nil
+	}
+	return signing
+}
+
+// unauthenticatedProfile 获取无需认证的 sign 和 newcert 使用的签名配置：须在 profiles 中且未设置 auth_key，
+// 签发 OCSP 签名或代码签名证书的签名配置只能通过 authsign 使用
+func unauthenticatedProfile(c *app.RequestContext, name string) *profile.Signing {
+	signing := lookupProfile(c, name)
+	if signing == nil {
+		return nil
+	}
+	if signing.AuthKey != "" || privileged(signing) {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Profile %s requires authenticated signing.", signing.Name))
+		return nil
+	}
+	allowed := settings().Profiles
+	if len(allowed) == 0 {
+		allowed = []string{settings().Profile}
+		if allowed[0] == "" {
+			allowed[0] = defaultProfile
+		}
+	}
+	if !slices.Contains(allowed, signing.Name) {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Profile %s is not allowed for unauthenticated signing.", signing.Name))
+		return nil
+	}
+	return signing
+}
+
+// privileged 签名配置签发的证书可以签名 OCSP 响应或代码
+func privileged(signing *profile.Signing) bool {
+	for _, eku := range signing.ExtKeyUsage {
+		switch eku {
+		case x509.ExtKeyUsageAny, x509.ExtKeyUsageOCSPSigning, x509.ExtKeyUsageCodeSigning:
+			return true
+		}
+	}
+	return false
+}
+
+// loadCA 加载 label 对应的签发 CA，label 为空时使用默认 CA
+func loadCA(c *app.RequestContext, label string) *cacert.Authority {
+	id := settings().CA
+	if label != "" {
+		var ok bool
+		if id, ok = settings().Labels[label]; !ok {
+			fail(c, http.StatusBadRequest, http.StatusBadRequest, fmt.Sprintf("Unknown label %q.", label))
+			return nil
+		}
+	}
+	ca, err := cacert.LoadCA(id)
+	if err != nil {
+		hlog.Error("Failed to load cfssl CA. error: ", err)
+		fail(c, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "The CA is unavailable.")
+		return nil
+	}
+	return ca
+}
+
+// infoRequest info 请求
+type infoRequest struct {
+	Label   string `json:"label"`
+	Profile string `json:"profile"`
+}
+
+// infoResult info 响应
+type infoResult struct {
+	Certificate string   `json:"certificate"`
+	Usages      []string `json:"usages"`
+	Expiry      string   `json:"expiry"`
+}
+
+// Info 返回 label 对应 CA 的证书和签名配置的用途与最长有效期，GET 时从查询参数读取 label 和 profile
+func Info() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		req := infoRequest{Label: c.Query("label"), Profile: c.Query("profile")}
+		if string(c.Method()) == http.MethodPost && !bind(c, c.Request.Body(), &req) {
+			return
+		}
+		signing := lookupProfile(c, req.Profile)
+		if signing == nil {
+			return
+		}
+		ca := loadCA(c, req.Label)
+		if ca == nil {
+			return
+		}
+		usages := signing.Usages
+		if usages == nil {
+			usages = []string{}
+		}
+		succeed(c, infoResult{
+			Certificate: string(signature.CertToPEM(ca.Cert)),
+			Usages:      usages,
+			Expiry:      signing.MaxExpiry.String(),
+		})
+	}
+}
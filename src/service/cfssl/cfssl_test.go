@@ -0,0 +1,214 @@
+package cfssl
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"reflect"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+)
+
+// authKeyHex authsign 使用的 HMAC 密钥
+const authKeyHex = "000102030405060708090a0b0c0d0e0f"
+
+// setup 打开内存数据库、创建签发 CA 并启用 cfssl 接口，authed 签名配置须通过 authsign 使用
+func setup(t *testing.T) {
+	testenv.Open(t)
+	err := profile.Init(map[string]config.SigningProfile{
+		"authed": {KeyUsages: []string{"digital signature"}, ExtKeyUsages: []string{"server auth"}, AuthKey: "primary"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { profile.Init(nil) })
+	caID, _, _ := testenv.CA(t, "cfssl Root")
+	testenv.Config(t).Spki.Cfssl = config.Cfssl{
+		Enabled:  true,
+		CA:       caID,
+		AuthKeys: map[string]config.CfsslAuthKey{"primary": {Key: authKeyHex}, "legacy": {Type: "nonstandard", Key: authKeyHex}},
+	}
+}
+
+// csrPEM 生成 PEM 格式的证书请求
+func csrPEM(t *testing.T, cn string, dnsNames ...string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+// call 以 JSON 请求体调用接口，返回状态码和响应
+func call(t *testing.T, handler app.HandlerFunc, body any) (int, *response) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ut.CreateUtRequestContext(http.MethodPost, Prefix+"/sign", &ut.Body{Body: bytes.NewReader(data), Len: len(data)},
+		ut.Header{Key: "Content-Type", Value: "application/json"})
+	handler(context.Background(), c)
+	var res response
+	if err := json.Unmarshal(c.Response.Body(), &res); err != nil {
+		t.Fatalf("invalid response %q: %v", c.Response.Body(), err)
+	}
+	return c.Response.StatusCode(), &res
+}
+
+// token 使用 authsign 密钥计算请求的 HMAC
+func token(t *testing.T, request []byte) []byte {
+	key, err := hex.DecodeString(authKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(request)
+	return mac.Sum(nil)
+}
+
+// issued 解析响应中的证书
+func issued(t *testing.T, res *response) *x509.Certificate {
+	t.Helper()
+	result, _ := res.Result.(map[string]any)
+	certPEM, _ := result["certificate"].(string)
+	cert, err := signature.ParseCertPEM([]byte(certPEM))
+	if err != nil {
+		t.Fatalf("invalid certificate in %+v: %v", res, err)
+	}
+	return cert
+}
+
+func TestSign(t *testing.T) {
+	setup(t)
+	status, res := call(t, Sign(), signRequest{Request: csrPEM(t, "www.example.com"), Hosts: []string{"www.example.com", "10.0.0.1"}})
+	if status != http.StatusOK || !res.Success {
+		t.Fatalf("sign = %d %+v", status, res)
+	}
+	cert := issued(t, res)
+	if cert.Subject.CommonName != "www.example.com" || len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 1 {
+		t.Fatalf("certificate = %s %v %v", cert.Subject, cert.DNSNames, cert.IPAddresses)
+	}
+
+	for name, tt := range map[string]struct {
+		req    signRequest
+		status int
+		code   int
+	}{
+		"auth_key profile":  {signRequest{Request: csrPEM(t, "a"), Profile: "authed"}, http.StatusBadRequest, codeInvalidRequest},
+		"unknown profile":   {signRequest{Request: csrPEM(t, "a"), Profile: "nope"}, http.StatusBadRequest, codeUnknownProfile},
+		"unlisted profile":  {signRequest{Request: csrPEM(t, "a"), Profile: "client"}, http.StatusBadRequest, codeInvalidRequest},
+		"OCSP signing":      {signRequest{Request: csrPEM(t, "a"), Profile: "ocsp-signing"}, http.StatusBadRequest, codeInvalidRequest},
+		"code signing":      {signRequest{Request: csrPEM(t, "a"), Profile: "code-signing"}, http.StatusBadRequest, codeInvalidRequest},
+		"unknown label":     {signRequest{Request: csrPEM(t, "a"), Label: "nope"}, http.StatusBadRequest, http.StatusBadRequest},
+		"invalid CSR":       {signRequest{Request: "garbage"}, http.StatusBadRequest, codeCSRParseFailed},
+		"client extensions": {signRequest{Request: csrPEM(t, "a"), Extensions: []json.RawMessage{[]byte("{}")}}, http.StatusBadRequest, codeInvalidRequest},
+	} {
+		status, res := call(t, Sign(), tt.req)
+		if status != tt.status || res.Success || len(res.Errors) != 1 || res.Errors[0].Code != tt.code {
+			t.Errorf("%s: sign = %d %+v", name, status, res)
+		}
+	}
+}
+
+func TestSignProfiles(t *testing.T) {
+	setup(t)
+	config.AppCfg.Spki.Cfssl.Profiles = []string{"server", "client", "ocsp-signing", "code-signing"}
+	status, res := call(t, Sign(), signRequest{Request: csrPEM(t, "device"), Profile: "client"})
+	if status != http.StatusOK || !res.Success {
+		t.Fatalf("sign with listed profile = %d %+v", status, res)
+	}
+	if cert := issued(t, res); cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("extended key usage = %v", cert.ExtKeyUsage)
+	}
+
+	// OCSP 签名和代码签名证书即使列在 profiles 中也不能无需认证签发
+	for _, name := range []string{"ocsp-signing", "code-signing"} {
+		status, res := call(t, Sign(), signRequest{Request: csrPEM(t, "responder"), Profile: name})
+		if status != http.StatusBadRequest || res.Success || res.Errors[0].Code != codeInvalidRequest {
+			t.Errorf("sign %s = %d %+v", name, status, res)
+		}
+		status, res = call(t, NewCert(), newCertRequest{Request: &certRequest{CN: "responder"}, Profile: name})
+		if status != http.StatusBadRequest || res.Success || res.Errors[0].Code != codeInvalidRequest {
+			t.Errorf("newcert %s = %d %+v", name, status, res)
+		}
+	}
+}
+
+func TestAuthSign(t *testing.T) {
+	setup(t)
+	request := func(profile string) []byte {
+		data, _ := json.Marshal(signRequest{Request: csrPEM(t, "api.example.com"), Hosts: []string{"api.example.com"}, Profile: profile})
+		return data
+	}
+	authed := request("authed")
+	status, res := call(t, AuthSign(), authenticatedRequest{Request: authed, Token: token(t, authed)})
+	if status != http.StatusOK || !res.Success || issued(t, res).DNSNames[0] != "api.example.com" {
+		t.Fatalf("authsign = %d %+v", status, res)
+	}
+
+	for name, tt := range map[string]struct {
+		req    authenticatedRequest
+		status int
+	}{
+		"missing token":   {authenticatedRequest{Request: authed}, http.StatusUnauthorized},
+		"wrong token":     {authenticatedRequest{Request: authed, Token: token(t, []byte("other"))}, http.StatusUnauthorized},
+		"forged token":    {authenticatedRequest{Request: authed, Token: bytes.Repeat([]byte{1}, sha256.Size)}, http.StatusUnauthorized},
+		"no auth_key":     {authenticatedRequest{Request: request("server"), Token: token(t, request("server"))}, http.StatusBadRequest},
+		"invalid request": {authenticatedRequest{Request: []byte("{"), Token: token(t, []byte("{"))}, http.StatusBadRequest},
+	} {
+		status, res := call(t, AuthSign(), tt.req)
+		if status != tt.status || res.Success {
+			t.Errorf("%s: authsign = %d %+v", name, status, res)
+		}
+	}
+}
+
+func TestAuthKey(t *testing.T) {
+	setup(t)
+	settings().AuthKeys["odd"] = config.CfsslAuthKey{Key: "abc"}
+	settings().AuthKeys["empty"] = config.CfsslAuthKey{}
+	for name, ok := range map[string]bool{"primary": true, "legacy": false, "missing": false, "odd": false, "empty": false} {
+		key, err := authKey(name)
+		if (err == nil) != ok || ok && hex.EncodeToString(key) != authKeyHex {
+			t.Errorf("auth key %s = %x, %v", name, key, err)
+		}
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	for _, tt := range []struct {
+		hosts []string
+		want  *cacert.Sans
+	}{
+		{nil, nil},
+		{[]string{"www.example.com", "10.0.0.1", "::1"}, &cacert.Sans{DNS: []string{"www.example.com"}, IP: []string{"10.0.0.1", "::1"}}},
+		{[]string{"admin@example.com", "spiffe://example.com/web"}, &cacert.Sans{Email: []string{"admin@example.com"}, URI: []string{"spiffe://example.com/web"}}},
+		{[]string{"*.example.com", "localhost"}, &cacert.Sans{DNS: []string{"*.example.com", "localhost"}}},
+	} {
+		if got := parseHosts(tt.hosts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHosts(%v) = %+v, want %+v", tt.hosts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cfssl
+
+import (
+	"context"
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"spki/src/genkey"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// keyRequest 私钥参数，未指定时与 cfssl 一样使用 ecdsa 256
+type keyRequest struct {
+	Algo string `json:"algo"`
+	Size int    `json:"size"`
+}
+
+// certRequest 证书请求参数，与 cfssl 的 csr.CertificateRequest 一致
+type certRequest struct {
+	CN           string      `json:"CN"`
+	Names        []name      `json:"names"`
+	Hosts        []string    `json:"hosts"`
+	Key          *keyRequest `json:"key,omitempty"`
+	SerialNumber string      `json:"serial_number,omitempty"`
+}
+
+// newCertRequest newcert 请求
+type newCertRequest struct {
+	Request *certRequest `json:"request"`
+	Profile string       `json:"profile"`
+	Label   string       `json:"label"`
+	Bundle  bool         `json:"bundle"`
+}
+
+// newCertResult newcert 响应，sums 为证书和证书请求 DER 编码的摘要
+type newCertResult struct {
+	PrivateKey         string                       `json:"private_key"`
+	CertificateRequest string                       `json:"certificate_request"`
+	Certificate        string                       `json:"certificate"`
+	Sums               map[string]map[string]string `json:"sums"`
+}
+
+// size 私钥长度，未指定时使用算法的默认长度
+func (k *keyRequest) size() int {
+	if k.Size != 0 {
+		return k.Size
+	}
+	if k.Algo == "rsa" {
+		return 2048
+	}
+	return 256
+}
+
+// sum 计算 PEM 中 DER 编码的摘要
+func sum(data string) map[string]string {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return map[string]string{}
+	}
+	return map[string]string{
+		"md5":   fmt.Sprintf("%X", md5.Sum(block.Bytes)),
+		"sha-1": fmt.Sprintf("%X", sha1.Sum(block.Bytes)),
+	}
+}
+
+// createCSR 使用生成的私钥创建证书请求
+func createCSR(req *certRequest, key crypto.Signer) (*x509.CertificateRequest, error) {
+	s := subject{CN: req.CN, Names: req.Names, SerialNumber: req.SerialNumber}
+	template := &x509.CertificateRequest{Subject: s.pkixName()}
+	if sans := parseHosts(req.Hosts); sans != nil {
+		template.DNSNames = sans.DNS
+		template.EmailAddresses = sans.Email
+		for _, ip := range sans.IP {
+			template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+		}
+		for _, uri := range sans.URI {
+			parsed, err := url.Parse(uri)
+			if err != nil {
+				return nil, err
+			}
+			template.URIs = append(template.URIs, parsed)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificateRequest(der)
+}
+
+// NewCert 生成私钥和证书请求并签发证书，私钥保存在可导出的私钥存储中并随响应返回
+func NewCert() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		var req newCertRequest
+		if !bind(c, c.Request.Body(), &req) {
+			return
+		}
+		if req.Request == nil {
+			fail(c, http.StatusBadRequest, http.StatusBadRequest, "Missing parameter 'request'.")
+			return
+		}
+		if req.Bundle {
+			fail(c, http.StatusBadRequest, http.StatusBadRequest, "Bundling is not supported.")
+			return
+		}
+		signing := unauthenticatedProfile(c, req.Profile)
+		if signing == nil {
+			return
+		}
+		kr := req.Request.Key
+		if kr == nil {
+			kr = &keyRequest{Algo: "ecdsa"}
+		}
+		if err := signing.AllowKeyAlgo(kr.Algo); err != nil {
+			fail(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		ca := loadCA(c, req.Label)
+		if ca == nil {
+			return
+		}
+
+		key, err := genkey.CreateKey(kr.Algo, kr.size())
+		if err != nil {
+			fail(c, http.StatusBadRequest, codeGenerationFailed, err.Error())
+			return
+		}
+		keyPEM, err := genkey.PrivateKeyToPEM(key)
+		if err != nil {
+			hlog.Error("Failed to encode private key. error: ", err)
+			fail(c, http.StatusInternalServerError, http.StatusInternalServerError, "Failed to encode private key.")
+			return
+		}
+		signer := key.(crypto.Signer)
+		csr, err := createCSR(req.Request, signer)
+		if err != nil {
+			fail(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		record := audit.New(c, audit.ActionIssue, "", audit.ResultFailure)
+		record.UserID, record.Account = userID(creator), creator
+		_, result, err := ca.IssueCSR(&cacert.CSRIssue{
+			CSR:     csr,
+			Profile: signing.Name,
+			UserID:  record.UserID,
+			Account: creator,
+			Key:     signer,
+		})
+		if err != nil {
+			record.Detail = err.Error()
+			audit.Log(record)
+			if errors.Is(err, cacert.ErrRejected) {
+				fail(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+				return
+			}
+			hlog.Error("Failed to issue cfssl certificate. error: ", err)
+			fail(c, http.StatusInternalServerError, http.StatusInternalServerError, "Failed to issue certificate.")
+			return
+		}
+		record.CertID, record.Result = result.CertID, audit.ResultSuccess
+		record.Detail = "serial " + result.Serial + ", profile " + signing.Name
+		audit.Log(record)
+
+		csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw}))
+		succeed(c, newCertResult{
+			PrivateKey:         string(keyPEM),
+			CertificateRequest: csrPEM,
+			Certificate:        result.Cert,
+			Sums: map[string]map[string]string{
+				"certificate":         sum(result.Cert),
+				"certificate_request": sum(csrPEM),
+			},
+		})
+	}
+}
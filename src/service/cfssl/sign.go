@@ -0,0 +1,269 @@
+package cfssl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"spki/profile"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// name 主题中的名称，与 cfssl 的 csr.Name 一致
+type name struct {
+	C            string `json:"C,omitempty"`
+	ST           string `json:"ST,omitempty"`
+	L            string `json:"L,omitempty"`
+	O            string `json:"O,omitempty"`
+	OU           string `json:"OU,omitempty"`
+	SerialNumber string `json:"SerialNumber,omitempty"`
+}
+
+// subject sign 请求中的主题，非空字段覆盖证书请求中的主题
+type subject struct {
+	CN           string `json:"CN"`
+	Names        []name `json:"names"`
+	SerialNumber string `json:"SerialNumber,omitempty"`
+}
+
+// signRequest sign 请求，与 cfssl 的 signer.SignRequest 一致
+type signRequest struct {
+	Hostname   string            `json:"hostname"` // 旧版客户端使用的逗号分隔的 hosts
+	Hosts      []string          `json:"hosts"`
+	Request    string            `json:"certificate_request"`
+	Subject    *subject          `json:"subject,omitempty"`
+	Profile    string            `json:"profile"`
+	Label      string            `json:"label"`
+	Serial     *big.Int          `json:"serial,omitempty"`
+	Extensions []json.RawMessage `json:"extensions,omitempty"`
+	NotBefore  time.Time         `json:"not_before"`
+	NotAfter   time.Time         `json:"not_after"`
+}
+
+// authenticatedRequest authsign 请求，token 为使用 auth key 计算的 request 的 HMAC-SHA256
+type authenticatedRequest struct {
+	Timestamp     int64  `json:"timestamp"`
+	RemoteAddress []byte `json:"remote_address"`
+	Token         []byte `json:"token"`
+	Request       []byte `json:"request"`
+}
+
+// signResult sign 和 authsign 响应
+type signResult struct {
+	Certificate string `json:"certificate"`
+}
+
+// pkixName 合并主题中的名称
+func (s *subject) pkixName() pkix.Name {
+	n := pkix.Name{CommonName: s.CN, SerialNumber: s.SerialNumber}
+	for _, entry := range s.Names {
+		n.Country = appendIf(n.Country, entry.C)
+		n.Province = appendIf(n.Province, entry.ST)
+		n.Locality = appendIf(n.Locality, entry.L)
+		n.Organization = appendIf(n.Organization, entry.O)
+		n.OrganizationalUnit = appendIf(n.OrganizationalUnit, entry.OU)
+		if entry.SerialNumber != "" {
+			n.SerialNumber = entry.SerialNumber
+		}
+	}
+	return n
+}
+
+// appendIf 追加非空字符串
+func appendIf(s []string, v string) []string {
+	if v == "" {
+		return s
+	}
+	return append(s, v)
+}
+
+// subjectName 请求中的主题覆盖证书请求中的主题，未指定的字段使用证书请求中的值；请求未指定主题时返回 nil
+func subjectName(s *subject, csr *x509.CertificateRequest) *pkix.Name {
+	if s == nil {
+		return nil
+	}
+	n := s.pkixName()
+	if n.CommonName == "" {
+		n.CommonName = csr.Subject.CommonName
+	}
+	if n.SerialNumber == "" {
+		n.SerialNumber = csr.Subject.SerialNumber
+	}
+	for _, field := range []struct {
+		dst *[]string
+		src []string
+	}{
+		{&n.Country, csr.Subject.Country},
+		{&n.Province, csr.Subject.Province},
+		{&n.Locality, csr.Subject.Locality},
+		{&n.Organization, csr.Subject.Organization},
+		{&n.OrganizationalUnit, csr.Subject.OrganizationalUnit},
+	} {
+		if len(*field.dst) == 0 {
+			*field.dst = field.src
+		}
+	}
+	return &n
+}
+
+// parseHosts 按 cfssl 的规则将 hosts 分为 IP、邮箱、URI 和域名；hosts 为空时返回 nil，使用证书请求中的名称
+func parseHosts(hosts []string) *cacert.Sans {
+	if len(hosts) == 0 {
+		return nil
+	}
+	sans := &cacert.Sans{}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			sans.IP = append(sans.IP, ip.String())
+		} else if addr, err := mail.ParseAddress(host); err == nil {
+			sans.Email = append(sans.Email, addr.Address)
+		} else if uri, err := url.ParseRequestURI(host); err == nil && uri.Scheme != "" {
+			sans.URI = append(sans.URI, host)
+		} else {
+			sans.DNS = append(sans.DNS, host)
+		}
+	}
+	return sans
+}
+
+// Sign 签署证书请求，只能使用 profiles 中未设置 auth_key 的签名配置
+func Sign() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		var req signRequest
+		if !bind(c, c.Request.Body(), &req) {
+			return
+		}
+		signing := unauthenticatedProfile(c, req.Profile)
+		if signing == nil {
+			return
+		}
+		signCSR(c, &req, signing, creator)
+	}
+}
+
+// AuthSign 校验 token 后签署证书请求，签名配置须设置 auth_key
+func AuthSign() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		var aReq authenticatedRequest
+		if !bind(c, c.Request.Body(), &aReq) {
+			return
+		}
+		var req signRequest
+		if !bind(c, aReq.Request, &req) {
+			return
+		}
+		signing := lookupProfile(c, req.Profile)
+		if signing == nil {
+			return
+		}
+		if signing.AuthKey == "" {
+			fail(c, http.StatusBadRequest, codeInvalidPolicy, fmt.Sprintf("Profile %s has no auth key.", signing.Name))
+			return
+		}
+		key, err := authKey(signing.AuthKey)
+		if err != nil {
+			hlog.Errorf("The cfssl auth key of profile %s is invalid. error: %v", signing.Name, err)
+			fail(c, http.StatusInternalServerError, http.StatusInternalServerError, "Invalid auth key configuration.")
+			return
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(aReq.Request)
+		if !hmac.Equal(mac.Sum(nil), aReq.Token) {
+			record := audit.New(c, audit.ActionSignCSR, "", audit.ResultFailure)
+			record.Account = creator + ":" + signing.AuthKey
+			record.UserID = userID(record.Account)
+			record.Detail = "invalid token, profile " + signing.Name
+			audit.Log(record)
+			hlog.Infof("cfssl authsign rejected: invalid token for profile %s", signing.Name)
+			fail(c, http.StatusUnauthorized, http.StatusUnauthorized, "Invalid token.")
+			return
+		}
+		signCSR(c, &req, signing, creator+":"+signing.AuthKey)
+	}
+}
+
+// authKey 读取签名配置引用的 HMAC 密钥
+func authKey(name string) ([]byte, error) {
+	key, ok := settings().AuthKeys[name]
+	if !ok {
+		return nil, fmt.Errorf("auth key %s not found", name)
+	}
+	if key.Type != "" && key.Type != "standard" {
+		return nil, fmt.Errorf("unsupported auth key type %s", key.Type)
+	}
+	decoded, err := hex.DecodeString(key.Key)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("auth key %s must be hex encoded", name)
+	}
+	return decoded, nil
+}
+
+// signCSR 按签名配置签署 sign 和 authsign 请求中的证书请求
+func signCSR(c *app.RequestContext, req *signRequest, signing *profile.Signing, account string) {
+	csr, err := cacert.ParseCSR(req.Request)
+	if err != nil {
+		fail(c, http.StatusBadRequest, codeCSRParseFailed, err.Error())
+		return
+	}
+	// 签名配置不允许客户端指定序列号、扩展和有效期
+	if req.Serial != nil || len(req.Extensions) > 0 || !req.NotBefore.IsZero() || !req.NotAfter.IsZero() {
+		fail(c, http.StatusBadRequest, codeInvalidRequest, "serial, extensions, not_before and not_after are not supported.")
+		return
+	}
+	hosts := req.Hosts
+	if len(hosts) == 0 && req.Hostname != "" {
+		hosts = strings.Split(req.Hostname, ",")
+	}
+	ca := loadCA(c, req.Label)
+	if ca == nil {
+		return
+	}
+
+	record := audit.New(c, audit.ActionSignCSR, "", audit.ResultFailure)
+	record.UserID, record.Account = userID(account), account
+	_, result, err := ca.IssueCSR(&cacert.CSRIssue{
+		CSR:     csr,
+		Profile: signing.Name,
+		Subject: subjectName(req.Subject, csr),
+		Sans:    parseHosts(hosts),
+		UserID:  record.UserID,
+		Account: account,
+	})
+	if err != nil {
+		record.Detail = err.Error()
+		audit.Log(record)
+		if errors.Is(err, cacert.ErrRejected) {
+			fail(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		hlog.Error("Failed to sign cfssl certificate request. error: ", err)
+		fail(c, http.StatusInternalServerError, http.StatusInternalServerError, "Failed to sign certificate.")
+		return
+	}
+	record.CertID, record.Result = result.CertID, audit.ResultSuccess
+	record.Detail = "serial " + result.Serial + ", profile " + signing.Name
+	audit.Log(record)
+	succeed(c, signResult{Certificate: result.Cert})
+}
@@ -0,0 +1,219 @@
+package crl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/service/cacert"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+const (
+	defaultNextUpdate = 24 * time.Hour // 默认 CRL 有效期
+	defaultInterval   = time.Hour      // 默认后台重新生成间隔
+)
+
+// oidInvalidityDate RFC 5280 5.3.2 Invalidity Date
+var oidInvalidityDate = asn1.ObjectIdentifier{2, 5, 29, 24}
+
+// mu 保证同一时间只有一个 CRL 在生成，使 CRL 编号单调递增
+var mu sync.Mutex
+
+// nextUpdate CRL 有效期
+func nextUpdate() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Crl.NextUpdate > 0 {
+		return config.AppCfg.Spki.Crl.NextUpdate
+	}
+	return defaultNextUpdate
+}
+
+// interval 后台重新生成 CRL 的间隔
+func interval() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Crl.Interval > 0 {
+		return config.AppCfg.Spki.Crl.Interval
+	}
+	return defaultInterval
+}
+
+// revokedEntry 将吊销的证书版本转换为 CRL 条目
+func revokedEntry(v *models.Version) (x509.RevocationListEntry, error) {
+	serial, ok := new(big.Int).SetString(v.Serial, 16)
+	if !ok {
+		return x509.RevocationListEntry{}, fmt.Errorf("invalid serial number %q of certificate %s", v.Serial, v.CertID)
+	}
+	entry := x509.RevocationListEntry{
+		SerialNumber:   serial,
+		RevocationTime: time.UnixMilli(v.RevocationTime).UTC(),
+		ReasonCode:     v.RevocationCode,
+	}
+	if v.InvalidityTime != 0 {
+		value, err := asn1.MarshalWithParams(time.UnixMilli(v.InvalidityTime).UTC(), "generalized")
+		if err != nil {
+			return x509.RevocationListEntry{}, err
+		}
+		entry.ExtraExtensions = []pkix.Extension{{Id: oidInvalidityDate, Value: value}}
+	}
+	return entry, nil
+}
+
+// Generate 生成并保存 CA 的 CRL，CRL 编号在上一次的基础上加一，同时删除之前的 CRL
+func Generate(caCertID string) (*models.Crl, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ca, err := cacert.LoadCA(caCertID)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := models.FindLatestCrl(caCertID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	versions, err := models.FindRevokedCertVersions(caCertID, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]x509.RevocationListEntry, 0, len(versions))
+	for i := range versions {
+		entry, err := revokedEntry(&versions[i])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(latest.Number + 1),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(nextUpdate()),
+		RevokedCertificateEntries: entries,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %v", err)
+	}
+
+	record := models.Crl{
+		CertID:     caCertID,
+		Number:     template.Number.Int64(),
+		ThisUpdate: template.ThisUpdate.UnixMilli(),
+		NextUpdate: template.NextUpdate.UnixMilli(),
+		Crl:        string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})),
+	}
+	err = models.Transaction(func(tx models.Repository) error {
+		if err := tx.InstallCrl(record); err != nil {
+			return err
+		}
+		return tx.DeleteCrlsBefore(caCertID, record.Number)
+	})
+	if err != nil {
+		return nil, err
+	}
+	hlog.Infof("CRL %d of CA %s generated, %d revoked certificates", record.Number, caCertID, len(entries))
+	return &record, nil
+}
+
+// Regenerate 异步重新生成 CA 的 CRL，吊销证书后调用
+func Regenerate(caCertID string) {
+	go func() {
+		if _, err := Generate(caCertID); err != nil {
+			hlog.Errorf("Failed to regenerate CRL of CA %s: %v", caCertID, err)
+		}
+	}()
+}
+
+// generateAll 为所有有效的 CA 重新生成 CRL
+func generateAll() {
+	cas, err := models.FindCertificatesByGenreAndState(models.GenreCA, models.StateValid)
+	if err != nil {
+		hlog.Error("Failed to query CA certificates: ", err)
+		return
+	}
+	for _, ca := range cas {
+		if _, err := Generate(*ca.CertID); err != nil {
+			hlog.Errorf("Failed to generate CRL of CA %s: %v", *ca.CertID, err)
+		}
+	}
+}
+
+// Start 启动后台任务，定时为所有 CA 重新生成 CRL
+func Start() {
+	go func() {
+		ticker := time.NewTicker(interval())
+		defer ticker.Stop()
+		generateAll()
+		for range ticker.C {
+			generateAll()
+		}
+	}()
+}
+
+// Current 获取 CA 当前有效的 CRL，不存在或已过期时重新生成
+func Current(caCertID string) (*models.Crl, error) {
+	latest, err := models.FindLatestCrl(caCertID)
+	if err != nil {
+		return nil, err
+	}
+	if latest.ID != 0 && latest.NextUpdate > time.Now().UnixMilli() {
+		return latest, nil
+	}
+	return Generate(caCertID)
+}
+
+// serveCrl 获取 CRL，失败时返回错误响应
+func serveCrl(c *app.RequestContext) *pem.Block {
+	record, err := Current(c.Param("certid"))
+	if err != nil {
+		hlog.Error("Failed to get CRL. error: ", err)
+		switch {
+		case errors.Is(err, cacert.ErrCANotFound):
+			c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "CA certificate not found.", ""))
+		case errors.Is(err, cacert.ErrCAUnavailable):
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidCAError, err.Error(), ""))
+		default:
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to get CRL.", ""))
+		}
+		return nil
+	}
+	block, _ := pem.Decode([]byte(record.Crl))
+	if block == nil {
+		hlog.Errorf("Failed to decode CRL %d of CA %s", record.Number, record.CertID)
+		c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeError, "Failed to get CRL.", ""))
+		return nil
+	}
+	return block
+}
+
+// GetCrl 下载 DER 格式的 CRL
+func GetCrl() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if block := serveCrl(c); block != nil {
+			c.Data(http.StatusOK, "application/pkix-crl", block.Bytes)
+		}
+	}
+}
+
+// GetCrlPEM 下载 PEM 格式的 CRL
+func GetCrlPEM() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if block := serveCrl(c); block != nil {
+			c.Data(http.StatusOK, "application/x-pem-file", pem.EncodeToMemory(block))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package crl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"net/http"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func TestRevokedEntry(t *testing.T) {
+	invalidity := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry, err := revokedEntry(&models.Version{Serial: "0a1b", RevocationTime: time.Now().UnixMilli(), RevocationCode: 1, InvalidityTime: invalidity.UnixMilli()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.SerialNumber.Int64() != 0x0a1b || entry.ReasonCode != 1 || len(entry.ExtraExtensions) != 1 || !entry.ExtraExtensions[0].Id.Equal(oidInvalidityDate) {
+		t.Fatalf("entry = %+v", entry)
+	}
+	var got time.Time
+	if _, err := asn1.UnmarshalWithParams(entry.ExtraExtensions[0].Value, &got, "generalized"); err != nil || !got.Equal(invalidity) {
+		t.Fatalf("invalidity date = %v, %v", got, err)
+	}
+	if _, err := revokedEntry(&models.Version{Serial: "zz"}); err == nil {
+		t.Fatal("invalid serial number was accepted")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	db := testenv.Open(t)
+	testenv.Config(t)
+	caID, ca, caSigner := testenv.CA(t, "CRL Root")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	revokedID, revoked := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "revoked")
+	testenv.Leaf(t, caID, ca, caSigner, key.Public(), "valid")
+	version, _ := models.FindLatestCertVersion(revokedID)
+	if _, err := models.RevokeCertVersion(version.ID, time.Now().UnixMilli(), 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for number := int64(1); number <= 2; number++ {
+		record, err := Generate(caID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := x509.ParseRevocationList(decode(t, record.Crl))
+		if err != nil || list.CheckSignatureFrom(ca) != nil {
+			t.Fatalf("CRL = %v, %v", list, err)
+		}
+		if list.Number.Int64() != number || len(list.RevokedCertificateEntries) != 1 ||
+			list.RevokedCertificateEntries[0].SerialNumber.Cmp(revoked.SerialNumber) != 0 || list.RevokedCertificateEntries[0].ReasonCode != 1 {
+			t.Fatalf("CRL %d = %+v", number, list)
+		}
+	}
+	// 只保留最新生成的 CRL
+	if n := testenv.Count(t, db, "crl"); n != 1 {
+		t.Fatalf("%d CRLs are kept", n)
+	}
+	current, err := Current(caID)
+	if err != nil || current.Number != 2 {
+		t.Fatalf("current CRL = %+v, %v", current, err)
+	}
+}
+
+func TestGetCrl(t *testing.T) {
+	testenv.Open(t)
+	testenv.Config(t)
+	caID, ca, caSigner := testenv.CA(t, "CRL Root")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafID, _ := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "leaf")
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.GET("/spki/crl/:certid", GetCrl())
+	engine.GET("/spki/crl/:certid/pem", GetCrlPEM())
+	for name, tt := range map[string]struct {
+		path, contentType string
+		status            int
+	}{
+		"DER":        {"/spki/crl/" + caID, "application/pkix-crl", http.StatusOK},
+		"PEM":        {"/spki/crl/" + caID + "/pem", "application/x-pem-file", http.StatusOK},
+		"unknown CA": {"/spki/crl/unknown", "", http.StatusNotFound},
+		"not a CA":   {"/spki/crl/" + leafID, "", http.StatusBadRequest},
+	} {
+		res := ut.PerformRequest(engine, http.MethodGet, tt.path, nil).Result()
+		if res.StatusCode() != tt.status || tt.contentType != "" && string(res.Header.ContentType()) != tt.contentType {
+			t.Errorf("%s: response = %d %s", name, res.StatusCode(), res.Header.ContentType())
+		}
+	}
+}
+
+// decode 解码 PEM 格式的 CRL
+func decode(t *testing.T, data string) []byte {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("invalid CRL %q", data)
+	}
+	return block.Bytes
+}
@@ -0,0 +1,155 @@
+package est
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"spki/src/models"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/network"
+)
+
+// client 已认证的 EST 客户端
+type client struct {
+	name string            // 用户名，或 TLS 客户端证书的主题
+	cert *x509.Certificate // TLS 客户端证书，HTTP basic 认证时为 nil
+}
+
+// userID 客户端作为证书创建者时的用户 ID
+func (cl *client) userID() string {
+	sum := sha256.Sum256([]byte("est:" + cl.name))
+	return hex.EncodeToString(sum[:16])
+}
+
+// account 客户端作为证书创建者时的名称
+func (cl *client) account() string {
+	return "est:" + cl.name
+}
+
+// peerCertificates TLS 客户端证书及其携带的中间证书，非 TLS 连接或客户端未提供证书时返回 nil
+func peerCertificates(c *app.RequestContext) []*x509.Certificate {
+	conn, ok := c.GetConn().(network.ConnTLSer)
+	if !ok {
+		return nil
+	}
+	return conn.ConnectionState().PeerCertificates
+}
+
+// trustAnchors 校验客户端证书使用的根证书和中间证书：EST 签发 CA 的证书链，以及 client_ca_file 中的证书
+func trustAnchors() (*x509.CertPool, *x509.CertPool, error) {
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	if id := settings().CA; id != "" {
+		ca, err := cacert.LoadCA(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain, err := ca.Chain()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, cert := range chain {
+			if i == len(chain)-1 {
+				roots.AddCert(cert)
+			} else {
+				intermediates.AddCert(cert)
+			}
+		}
+	}
+	if file := settings().ClientCAFile; file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+	return roots, intermediates, nil
+}
+
+// verifyClientCert 校验 TLS 客户端证书的签发者和用途；spki 签发的证书还须未被吊销
+func verifyClientCert(certs []*x509.Certificate) error {
+	roots, intermediates, err := trustAnchors()
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := certs[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return err
+	}
+	version, err := models.FindCertVersionBySerial(signature.SerialString(leaf.SerialNumber))
+	if err != nil {
+		return err
+	}
+	if version.ID != 0 && version.RevocationTime != 0 {
+		return errors.New("client certificate has been revoked")
+	}
+	return nil
+}
+
+// basicAuth 解析 HTTP basic 认证信息
+func basicAuth(c *app.RequestContext) (string, string, bool) {
+	auth := string(c.Request.Header.Peek("Authorization"))
+	if len(auth) < 6 || !strings.EqualFold(auth[:6], "Basic ") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(auth[6:]))
+	if err != nil {
+		return "", "", false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	return username, password, ok
+}
+
+// checkUser 校验用户名和密码，密码为空的用户不能登录
+func checkUser(username, password string) bool {
+	for _, user := range settings().Users {
+		if user.Username == username && user.Password != "" &&
+			subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate 认证 EST 客户端，优先使用 TLS 客户端证书，其次使用 HTTP basic；认证失败时返回 401
+func authenticate(c *app.RequestContext) *client {
+	if certs := peerCertificates(c); len(certs) > 0 {
+		err := verifyClientCert(certs)
+		if err == nil {
+			name := *cacert.SubjectString(certs[0].Subject)
+			if name == "" {
+				name = "serial " + signature.SerialString(certs[0].SerialNumber)
+			}
+			return &client{name: name, cert: certs[0]}
+		}
+		hlog.Infof("EST client certificate %s rejected: %v", certs[0].Subject, err)
+	}
+	if username, password, ok := basicAuth(c); ok {
+		if checkUser(username, password) {
+			return &client{name: username}
+		}
+		hlog.Infof("EST authentication failed for user %s", username)
+	}
+	c.Header("WWW-Authenticate", `Basic realm="spki-est"`)
+	fail(c, http.StatusUnauthorized, "Authentication required.")
+	return nil
+}
@@ -0,0 +1,304 @@
+package est
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+	"spki/src/service/certificate"
+	"spki/src/service/revoke"
+	"spki/src/signature"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Prefix EST 接口的路径前缀（RFC 7030 3.2.2）
+const Prefix = "/.well-known/est"
+
+// defaultProfile 默认签名配置
+const defaultProfile = "client"
+
+// keyAlgoOIDs 私钥算法对应的 OID，用于 csrattrs 响应
+var keyAlgoOIDs = map[string]asn1.ObjectIdentifier{
+	"rsa":     {1, 2, 840, 113549, 1, 1, 1},
+	"ecdsa":   {1, 2, 840, 10045, 2, 1},
+	"ed25519": {1, 3, 101, 112},
+}
+
+// settings EST 配置
+func settings() config.Est {
+	if config.AppCfg == nil {
+		return config.Est{}
+	}
+	return config.AppCfg.Spki.Est
+}
+
+// signingProfile 签发证书使用的签名配置
+func signingProfile() string {
+	if p := settings().Profile; p != "" {
+		return p
+	}
+	return defaultProfile
+}
+
+// fail 返回错误，EST 客户端只读取状态码和文本内容
+func fail(c *app.RequestContext, status int, msg string) {
+	c.Data(status, "text/plain; charset=utf-8", []byte(msg))
+}
+
+// enabled 检查是否启用了 EST，未启用时返回 404
+func enabled(c *app.RequestContext) bool {
+	if settings().Enabled {
+		return true
+	}
+	fail(c, http.StatusNotFound, "EST is not enabled.")
+	return false
+}
+
+// writeBase64 返回 base64 编码的响应（RFC 7030 4.1.3），每 64 个字符换行
+func writeBase64(c *app.RequestContext, contentType string, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 64 {
+		b.WriteString(encoded[:64])
+		b.WriteString("\r\n")
+		encoded = encoded[64:]
+	}
+	b.WriteString(encoded)
+	b.WriteString("\r\n")
+	c.Header("Content-Transfer-Encoding", "base64")
+	c.Data(http.StatusOK, contentType, []byte(b.String()))
+}
+
+// writeCerts 返回 certs-only 格式的 PKCS#7
+func writeCerts(c *app.RequestContext, certs []*x509.Certificate) {
+	data, err := signature.CertsToPKCS7(certs)
+	if err != nil {
+		hlog.Error("Failed to encode PKCS#7. error: ", err)
+		fail(c, http.StatusInternalServerError, "Failed to encode certificates.")
+		return
+	}
+	writeBase64(c, "application/pkcs7-mime; smime-type=certs-only", data)
+}
+
+// readCSR 解析请求体中 base64 编码的 PKCS#10 证书请求，也接受 PEM 格式
+func readCSR(c *app.RequestContext) *x509.CertificateRequest {
+	data := string(c.Request.Body())
+	if !strings.HasPrefix(strings.TrimSpace(data), "-----BEGIN") {
+		data = strings.Join(strings.Fields(data), "")
+	}
+	csr, err := cacert.ParseCSR(data)
+	if err != nil {
+		hlog.Error("The EST certificate request is invalid. error: ", err)
+		fail(c, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	return csr
+}
+
+// loadCA 加载配置的签发 CA
+func loadCA(c *app.RequestContext) *cacert.Authority {
+	ca, err := cacert.LoadCA(settings().CA)
+	if err != nil {
+		hlog.Error("Failed to load EST CA. error: ", err)
+		fail(c, http.StatusServiceUnavailable, "The CA is unavailable.")
+		return nil
+	}
+	return ca
+}
+
+// CACerts 返回签发 CA 到根 CA 的证书链，无需认证
+func CACerts() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		ca := loadCA(c)
+		if ca == nil {
+			return
+		}
+		chain, err := ca.Chain()
+		if err != nil {
+			hlog.Error("Failed to load certificate chain. error: ", err)
+			fail(c, http.StatusInternalServerError, "Failed to load certificate chain.")
+			return
+		}
+		writeCerts(c, chain)
+	}
+}
+
+// CSRAttrs 返回签名配置允许的私钥算法，未限制时返回 204
+func CSRAttrs() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		signing, err := profile.Lookup(signingProfile())
+		if err != nil {
+			hlog.Error("Failed to load EST signing profile. error: ", err)
+			fail(c, http.StatusInternalServerError, "Failed to load signing profile.")
+			return
+		}
+		var oids []asn1.ObjectIdentifier
+		for _, algo := range signing.KeyAlgos {
+			oids = append(oids, keyAlgoOIDs[algo])
+		}
+		if len(oids) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		data, err := asn1.Marshal(oids)
+		if err != nil {
+			hlog.Error("Failed to encode CSR attributes. error: ", err)
+			fail(c, http.StatusInternalServerError, "Failed to encode CSR attributes.")
+			return
+		}
+		writeBase64(c, "application/csrattrs", data)
+	}
+}
+
+// SimpleEnroll 签署客户端提交的证书请求，证书的主题和使用者可选名称取自证书请求
+func SimpleEnroll() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		cl := authenticate(c)
+		if cl == nil {
+			return
+		}
+		csr := readCSR(c)
+		if csr == nil {
+			return
+		}
+		ca := loadCA(c)
+		if ca == nil {
+			return
+		}
+
+		record := audit.New(c, audit.ActionSignCSR, "", audit.ResultFailure)
+		record.UserID, record.Account = cl.userID(), cl.account()
+		cert, result, err := ca.IssueCSR(&cacert.CSRIssue{
+			CSR:     csr,
+			Profile: signingProfile(),
+			Expiry:  settings().Expiry,
+			UserID:  cl.userID(),
+			Account: cl.account(),
+		})
+		if err != nil {
+			record.Detail = err.Error()
+			audit.Log(record)
+			hlog.Error("Failed to issue EST certificate. error: ", err)
+			if errors.Is(err, cacert.ErrRejected) {
+				fail(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			fail(c, http.StatusInternalServerError, "Failed to issue certificate.")
+			return
+		}
+		record.CertID, record.Result = result.CertID, audit.ResultSuccess
+		record.Detail = "serial " + result.Serial
+		audit.Log(record)
+		hlog.Infof("EST certificate %s issued to %s", result.CertID, cl.name)
+		writeCerts(c, []*x509.Certificate{cert})
+	}
+}
+
+// findEnrolled 查找客户端重新注册的证书：TLS 认证时为客户端证书，HTTP basic 认证时为该用户签发的、主题相同的最新有效证书。
+// 只能重新注册 EST 签发 CA 签发的证书，client_ca_file 中的 CA 或其他 CA 签发的证书只能用于认证
+func findEnrolled(cl *client, subject string) (string, error) {
+	if cl.cert != nil {
+		version, err := models.FindCertVersionBySerial(signature.SerialString(cl.cert.SerialNumber))
+		if err != nil || version.ID == 0 {
+			return "", err
+		}
+		record, err := models.FindCertificateByCertID(version.CertID)
+		if err != nil || record.ParentID == nil || *record.ParentID != settings().CA {
+			return "", err
+		}
+		return version.CertID, nil
+	}
+	items, _, err := models.FindCertificates(models.CertificateFilter{
+		UserID:       cl.userID(),
+		ParentID:     settings().CA,
+		Genre:        models.GenreLeaf,
+		State:        models.StateValid,
+		ExactSubject: subject,
+		OrderBy:      "create_time",
+		Desc:         true,
+		Limit:        10,
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, item := range items {
+		if item.RevocationTime == 0 {
+			return *item.CertID, nil
+		}
+	}
+	return "", nil
+}
+
+// SimpleReenroll 为已注册的证书签发新版本，证书请求的主题须与原证书相同，可以更换公钥
+func SimpleReenroll() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		cl := authenticate(c)
+		if cl == nil {
+			return
+		}
+		csr := readCSR(c)
+		if csr == nil {
+			return
+		}
+		subject := *cacert.SubjectString(csr.Subject)
+		certID, err := findEnrolled(cl, subject)
+		if err != nil {
+			hlog.Error("Failed to query certificate. error: ", err)
+			fail(c, http.StatusInternalServerError, "Failed to query certificate.")
+			return
+		}
+		if certID == "" {
+			fail(c, http.StatusForbidden, "No enrolled certificate found for the client.")
+			return
+		}
+		if cl.cert != nil && *cacert.SubjectString(cl.cert.Subject) != subject {
+			fail(c, http.StatusBadRequest, "The subject of the certificate request must match the current certificate.")
+			return
+		}
+
+		record := audit.New(c, audit.ActionRenew, certID, audit.ResultFailure)
+		record.UserID, record.Account = cl.userID(), cl.account()
+		cert, _, err := certificate.Reissue(certID, csr.PublicKey, 0)
+		if err != nil {
+			record.Detail = err.Error()
+			audit.Log(record)
+			hlog.Error("Failed to reissue EST certificate. error: ", err)
+			switch {
+			case errors.Is(err, revoke.ErrRevoked):
+				fail(c, http.StatusForbidden, "The certificate has been revoked.")
+			case errors.Is(err, cacert.ErrRejected):
+				fail(c, http.StatusBadRequest, err.Error())
+			default:
+				fail(c, http.StatusInternalServerError, "Failed to reissue certificate.")
+			}
+			return
+		}
+		record.Result = audit.ResultSuccess
+		record.Detail = "serial " + signature.SerialString(cert.SerialNumber)
+		audit.Log(record)
+		hlog.Infof("EST certificate %s reissued to %s", certID, cl.name)
+		writeCerts(c, []*x509.Certificate{cert})
+	}
+}
@@ -0,0 +1,159 @@
+package est
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"spki/src/signature"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+)
+
+// setup 打开内存数据库、创建 EST 签发 CA 并启用 EST
+func setup(t *testing.T) {
+	testenv.Open(t)
+	if err := profile.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	caID, _, _ := testenv.CA(t, "EST Root")
+	testenv.Config(t).Spki.Est = config.Est{
+		Enabled: true,
+		CA:      caID,
+		Users:   []config.EstUser{{Username: "device", Password: "secret"}, {Username: "other", Password: "secret"}},
+	}
+}
+
+// csr 生成 base64 编码的证书请求
+func csr(t *testing.T, cn string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(der))
+}
+
+// enroll 以 HTTP basic 认证调用注册接口，返回状态码和签发的证书
+func enroll(t *testing.T, handler app.HandlerFunc, username string, body []byte) (int, *x509.Certificate) {
+	c := ut.CreateUtRequestContext(http.MethodPost, Prefix+"/simpleenroll", &ut.Body{Body: bytes.NewReader(body), Len: len(body)},
+		ut.Header{Key: "Content-Type", Value: "application/pkcs10"},
+		ut.Header{Key: "Authorization", Value: "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":secret"))})
+	handler(context.Background(), c)
+	if c.Response.StatusCode() != http.StatusOK {
+		return c.Response.StatusCode(), nil
+	}
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(c.Response.Body()), nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := parseCerts(der)
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("invalid PKCS#7 response: %v", err)
+	}
+	return http.StatusOK, certs[0]
+}
+
+// parseCerts 解析只包含证书的 PKCS#7
+func parseCerts(der []byte) ([]*x509.Certificate, error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificates(sd.Certificates.Bytes)
+}
+
+func TestEnrollBasic(t *testing.T) {
+	setup(t)
+	status, cert := enroll(t, SimpleEnroll(), "device", csr(t, "device-1"))
+	if status != http.StatusOK || cert.Subject.CommonName != "device-1" {
+		t.Fatalf("enroll = %d", status)
+	}
+	status, renewed := enroll(t, SimpleReenroll(), "device", csr(t, "device-1"))
+	if status != http.StatusOK || renewed.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+		t.Fatalf("reenroll = %d", status)
+	}
+
+	// 其他用户不能重新注册该证书
+	if status, _ := enroll(t, SimpleReenroll(), "other", csr(t, "device-1")); status != http.StatusForbidden {
+		t.Fatalf("reenroll by another user = %d", status)
+	}
+	if status, _ := enroll(t, SimpleEnroll(), "nobody", csr(t, "device-1")); status != http.StatusUnauthorized {
+		t.Fatalf("enroll without valid credentials = %d", status)
+	}
+}
+
+func TestFindEnrolled(t *testing.T) {
+	testenv.Open(t)
+	caID, ca, signer := testenv.CA(t, "EST Root")
+	testenv.Config(t).Spki.Est = config.Est{Enabled: true, CA: caID}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafID, leaf := testenv.Leaf(t, caID, ca, signer, key.Public(), "device-1")
+	if certID, err := findEnrolled(&client{cert: leaf}, "/CN=device-1"); err != nil || certID != leafID {
+		t.Fatalf("EST certificate = %q, %v", certID, err)
+	}
+
+	// 其他 CA 签发的客户端证书（如 client_ca_file 中的出厂证书 CA）只能用于认证，不能重新注册
+	otherID, other, otherSigner := testenv.CA(t, "Factory Root")
+	_, foreign := testenv.Leaf(t, otherID, other, otherSigner, key.Public(), "device-1")
+	if certID, err := findEnrolled(&client{cert: foreign}, "/CN=device-1"); err != nil || certID != "" {
+		t.Fatalf("certificate of another CA = %q, %v", certID, err)
+	}
+
+	unknown := *leaf
+	unknown.SerialNumber = big.NewInt(12345)
+	if certID, err := findEnrolled(&client{cert: &unknown}, "/CN=device-1"); err != nil || certID != "" {
+		t.Fatalf("unknown certificate = %q, %v", certID, err)
+	}
+}
+
+func TestFindEnrolledBasic(t *testing.T) {
+	setup(t)
+	status, cert := enroll(t, SimpleEnroll(), "device", csr(t, "device-1"))
+	if status != http.StatusOK {
+		t.Fatalf("enroll = %d", status)
+	}
+	// 主题包含 device-1 的较新证书不影响按主题完全匹配
+	for i := 0; i < 11; i++ {
+		if status, _ := enroll(t, SimpleEnroll(), "device", csr(t, "device-10")); status != http.StatusOK {
+			t.Fatalf("enroll device-10 = %d", status)
+		}
+	}
+	certID, err := findEnrolled(&client{name: "device"}, "/CN=device-1")
+	if err != nil || certID == "" {
+		t.Fatalf("enrolled certificate = %q, %v", certID, err)
+	}
+	version, err := models.FindLatestCertVersion(certID)
+	if err != nil || version.Serial != signature.SerialString(cert.SerialNumber) {
+		t.Fatalf("version = %+v, %v", version, err)
+	}
+}
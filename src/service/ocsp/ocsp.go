@@ -0,0 +1,269 @@
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/signature"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	xocsp "golang.org/x/crypto/ocsp"
+)
+
+const (
+	defaultCache    = 5 * time.Minute // 默认的已签名响应缓存时间
+	maxCacheEntries = 10000           // 缓存的已签名响应数量上限
+)
+
+// oidNonce RFC 6960 4.4.1 Nonce
+var oidNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// ocspRequest 用于解析请求扩展，x/crypto/ocsp 不解析 Nonce
+type ocspRequest struct {
+	TBSRequest struct {
+		Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+		RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+		RequestList   []asn1.RawValue
+		Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+	}
+}
+
+// cacheEntry 已签名的响应，expires 为响应的 NextUpdate
+type cacheEntry struct {
+	der     []byte
+	issuer  *x509.Certificate
+	expires time.Time
+}
+
+// cache 已签名响应的缓存，键为 CA 证书 ID 和序列号，只缓存该 CA 签发的证书的响应
+var cache = struct {
+	sync.RWMutex
+	m     map[string]cacheEntry
+	swept time.Time // 上次清除过期响应的时间
+}{m: make(map[string]cacheEntry)}
+
+// cacheTTL 已签名响应的缓存时间
+func cacheTTL() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Ocsp.Cache > 0 {
+		return config.AppCfg.Spki.Ocsp.Cache
+	}
+	return defaultCache
+}
+
+func cacheKey(caCertID, serial string) string {
+	return caCertID + "/" + serial
+}
+
+// cached 获取缓存的响应，响应已过期或请求中的颁发者与 CA 不一致时返回 nil
+func cached(key string, req *xocsp.Request, now time.Time) []byte {
+	cache.RLock()
+	entry, ok := cache.m[key]
+	cache.RUnlock()
+	if !ok {
+		return nil
+	}
+	if !now.Before(entry.expires) {
+		cache.Lock()
+		if current, ok := cache.m[key]; ok && !now.Before(current.expires) {
+			delete(cache.m, key)
+		}
+		cache.Unlock()
+		return nil
+	}
+	if !matchIssuer(req, entry.issuer) {
+		return nil
+	}
+	return entry.der
+}
+
+// store 缓存响应。每个缓存周期清除一次过期的响应，达到数量上限时先清除过期的响应，仍然已满时随机淘汰一个响应
+func store(key string, entry cacheEntry, now time.Time) {
+	cache.Lock()
+	defer cache.Unlock()
+	if _, ok := cache.m[key]; !ok && (len(cache.m) >= maxCacheEntries || now.Sub(cache.swept) >= cacheTTL()) {
+		for k, e := range cache.m {
+			if !now.Before(e.expires) {
+				delete(cache.m, k)
+			}
+		}
+		cache.swept = now
+		for k := range cache.m {
+			if len(cache.m) < maxCacheEntries {
+				break
+			}
+			delete(cache.m, k)
+		}
+	}
+	cache.m[key] = entry
+}
+
+// Invalidate 清除证书的已签名响应缓存，证书状态变化后调用
+func Invalidate(caCertID, serial string) {
+	cache.Lock()
+	defer cache.Unlock()
+	delete(cache.m, cacheKey(caCertID, serial))
+}
+
+// requestNonce 获取请求中的 Nonce 扩展
+func requestNonce(der []byte) *pkix.Extension {
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		return nil
+	}
+	for _, ext := range req.TBSRequest.Extensions {
+		if ext.Id.Equal(oidNonce) {
+			return &pkix.Extension{Id: oidNonce, Value: ext.Value}
+		}
+	}
+	return nil
+}
+
+// matchIssuer 检查请求中的颁发者名称和公钥哈希是否与 CA 一致
+func matchIssuer(req *xocsp.Request, issuer *x509.Certificate) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	return bytes.Equal(keyHash, req.IssuerKeyHash) && bytes.Equal(nameHash, req.IssuerNameHash)
+}
+
+// certStatus 根据证书版本查询证书状态，填充响应模板
+func certStatus(caCertID string, req *xocsp.Request, template *xocsp.Response) error {
+	serial := signature.SerialString(req.SerialNumber)
+	version, err := models.FindCertVersionBySerial(serial)
+	if err != nil {
+		return err
+	}
+	template.Status = xocsp.Unknown
+	if version.ID == 0 {
+		return nil
+	}
+	record, err := models.FindCertificateByCertID(version.CertID)
+	if err != nil {
+		return err
+	}
+	if record.ParentID == nil || *record.ParentID != caCertID {
+		return nil
+	}
+
+	template.Status = xocsp.Good
+	if version.RevocationTime != 0 {
+		template.Status = xocsp.Revoked
+		template.RevokedAt = time.UnixMilli(version.RevocationTime).UTC()
+		template.RevocationReason = version.RevocationCode
+	}
+	return nil
+}
+
+// respond 生成 OCSP 响应，不带 Nonce 的、该 CA 签发的证书的响应会被缓存到 NextUpdate
+func respond(caCertID string, der []byte) ([]byte, error) {
+	req, err := xocsp.ParseRequest(der)
+	if err != nil {
+		return xocsp.MalformedRequestErrorResponse, fmt.Errorf("malformed OCSP request: %v", err)
+	}
+	now := time.Now()
+	nonce := requestNonce(der)
+	key := cacheKey(caCertID, signature.SerialString(req.SerialNumber))
+	if nonce == nil {
+		if resp := cached(key, req, now); resp != nil {
+			return resp, nil
+		}
+	}
+
+	r, err := loadResponder(caCertID)
+	if err != nil {
+		return xocsp.UnauthorizedErrorResponse, err
+	}
+	if !matchIssuer(req, r.issuer) {
+		return xocsp.UnauthorizedErrorResponse, fmt.Errorf("OCSP request is not for CA %s", caCertID)
+	}
+
+	template := xocsp.Response{
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now.UTC().Truncate(time.Minute),
+		NextUpdate:   now.Add(cacheTTL()).UTC().Truncate(time.Minute),
+		Certificate:  r.cert,
+	}
+	if err := certStatus(caCertID, req, &template); err != nil {
+		return xocsp.InternalErrorErrorResponse, err
+	}
+	if nonce != nil {
+		template.ExtraExtensions = []pkix.Extension{*nonce}
+	}
+	responderCert := r.cert
+	if responderCert == nil {
+		responderCert = r.issuer
+	}
+	resp, err := xocsp.CreateResponse(r.issuer, responderCert, template, r.signer)
+	if err != nil {
+		return xocsp.InternalErrorErrorResponse, err
+	}
+
+	// 未知证书的响应不缓存，否则任意序列号的请求都会占用缓存
+	if nonce == nil && template.Status != xocsp.Unknown {
+		store(key, cacheEntry{der: resp, issuer: r.issuer, expires: template.NextUpdate}, now)
+	}
+	return resp, nil
+}
+
+// getRequest 获取 GET 路径中编码的请求。路由参数中连续的斜杠已被合并，base64 编码的请求可能包含连续的斜杠，因此从原始路径中截取
+func getRequest(c *app.RequestContext) string {
+	path := string(c.Request.URI().PathOriginal())
+	prefix := "/" + c.Param("certid") + "/"
+	if i := strings.Index(path, prefix); i >= 0 {
+		return path[i+len(prefix):]
+	}
+	return strings.TrimPrefix(c.Param("request"), "/")
+}
+
+// Respond OCSP 响应器，支持 POST 请求体和 GET 路径中 base64 编码的请求（RFC 6960 附录 A）
+func Respond() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var der []byte
+		if string(c.Method()) == http.MethodGet {
+			encoded, err := url.PathUnescape(getRequest(c))
+			if err == nil {
+				der, err = base64.StdEncoding.DecodeString(encoded)
+			}
+			if err != nil {
+				hlog.Warn("Failed to decode OCSP GET request: ", err)
+				c.Data(http.StatusOK, "application/ocsp-response", xocsp.MalformedRequestErrorResponse)
+				return
+			}
+		} else {
+			der = c.Request.Body()
+		}
+
+		resp, err := respond(c.Param("certid"), der)
+		if err != nil {
+			hlog.Warn("OCSP request failed. error: ", err)
+		} else if string(c.Method()) == http.MethodGet {
+			c.Header("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", int(cacheTTL().Seconds())))
+		}
+		c.Data(http.StatusOK, "application/ocsp-response", resp)
+	}
+}
@@ -0,0 +1,390 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"spki/src/genkey"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"spki/src/signature"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	xocsp "golang.org/x/crypto/ocsp"
+)
+
+// fixture 测试 CA 及其签发的证书
+type fixture struct {
+	caID     string
+	ca       *x509.Certificate
+	caSigner crypto.Signer
+	leafID   string
+	leaf     *x509.Certificate
+}
+
+// setup 打开内存数据库、清空响应缓存并签发一张证书
+func setup(t *testing.T) *fixture {
+	testenv.Open(t)
+	testenv.Config(t)
+	resetCache()
+	t.Cleanup(resetCache)
+	caID, ca, signer := testenv.CA(t, "Test Root")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafID, leaf := testenv.Leaf(t, caID, ca, signer, key.Public(), "client")
+	return &fixture{caID: caID, ca: ca, caSigner: signer, leafID: leafID, leaf: leaf}
+}
+
+func resetCache() {
+	cache.Lock()
+	cache.m = make(map[string]cacheEntry)
+	cache.swept = time.Time{}
+	cache.Unlock()
+}
+
+func cacheLen() int {
+	cache.RLock()
+	defer cache.RUnlock()
+	return len(cache.m)
+}
+
+// request 生成证书的 OCSP 请求
+func request(t *testing.T, cert, issuer *x509.Certificate) []byte {
+	der, err := xocsp.CreateRequest(cert, issuer, &xocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// withNonce 在请求中添加 Nonce 扩展，x/crypto/ocsp 不支持生成带扩展的请求
+func withNonce(t *testing.T, der, nonce []byte) []byte {
+	var req struct {
+		TBSRequest struct {
+			RequestList []asn1.RawValue
+			Extensions  []pkix.Extension `asn1:"explicit,tag:2,optional"`
+		}
+	}
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := asn1.Marshal(nonce)
+	req.TBSRequest.Extensions = []pkix.Extension{{Id: oidNonce, Value: value}}
+	der, err := asn1.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// check 生成响应并验证签名，返回解析后的响应
+func check(t *testing.T, f *fixture, der []byte) *xocsp.Response {
+	t.Helper()
+	resp, err := respond(f.caID, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := xocsp.ParseResponse(resp, f.ca)
+	if err != nil {
+		t.Fatalf("invalid OCSP response: %v", err)
+	}
+	return parsed
+}
+
+func TestRespondStatus(t *testing.T) {
+	f := setup(t)
+	der := request(t, f.leaf, f.ca)
+	resp := check(t, f, der)
+	if resp.Status != xocsp.Good || resp.SerialNumber.Cmp(f.leaf.SerialNumber) != 0 {
+		t.Fatalf("status = %d, serial = %v", resp.Status, resp.SerialNumber)
+	}
+	if cacheLen() != 1 {
+		t.Fatalf("cache has %d entries, want 1", cacheLen())
+	}
+
+	// 吊销后缓存的响应失效
+	version, err := models.FindLatestCertVersion(f.leafID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt := time.Now().Truncate(time.Second)
+	if _, err := models.RevokeCertVersion(version.ID, revokedAt.UnixMilli(), xocsp.KeyCompromise, 0); err != nil {
+		t.Fatal(err)
+	}
+	if resp := check(t, f, der); resp.Status != xocsp.Good {
+		t.Fatalf("cached status = %d, want good", resp.Status)
+	}
+	Invalidate(f.caID, version.Serial)
+	resp = check(t, f, der)
+	if resp.Status != xocsp.Revoked || resp.RevocationReason != xocsp.KeyCompromise || !resp.RevokedAt.Equal(revokedAt) {
+		t.Fatalf("status = %d, reason = %d, revoked at %v", resp.Status, resp.RevocationReason, resp.RevokedAt)
+	}
+}
+
+func TestRespondUnknown(t *testing.T) {
+	f := setup(t)
+	unknown := *f.leaf
+	unknown.SerialNumber = big.NewInt(12345)
+	if resp := check(t, f, request(t, &unknown, f.ca)); resp.Status != xocsp.Unknown {
+		t.Fatalf("status = %d, want unknown", resp.Status)
+	}
+
+	// 其他 CA 签发的证书对该 CA 是未知的
+	otherID, other, otherSigner := testenv.CA(t, "Other Root")
+	_, foreign := testenv.Leaf(t, otherID, other, otherSigner, f.leaf.PublicKey, "foreign")
+	foreign.RawIssuer = f.ca.RawSubject
+	if resp := check(t, f, request(t, foreign, f.ca)); resp.Status != xocsp.Unknown {
+		t.Fatalf("foreign status = %d, want unknown", resp.Status)
+	}
+	if cacheLen() != 0 {
+		t.Fatalf("unknown responses were cached: %d entries", cacheLen())
+	}
+}
+
+func TestRespondWrongIssuer(t *testing.T) {
+	f := setup(t)
+	_, other, _ := testenv.CA(t, "Other Root")
+	der := request(t, f.leaf, other)
+	for i := 0; i < 2; i++ {
+		resp, err := respond(f.caID, der)
+		if err == nil || !bytes.Equal(resp, xocsp.UnauthorizedErrorResponse) {
+			t.Fatalf("response = %x, %v", resp, err)
+		}
+		// 第二次请求时该证书的响应已缓存，颁发者不一致时不能返回缓存的响应
+		check(t, f, request(t, f.leaf, f.ca))
+	}
+
+	if resp, err := respond(f.caID, []byte("garbage")); err == nil || !bytes.Equal(resp, xocsp.MalformedRequestErrorResponse) {
+		t.Fatalf("malformed response = %x, %v", resp, err)
+	}
+}
+
+func TestRespondNonce(t *testing.T) {
+	f := setup(t)
+	nonce := []byte("0123456789abcdef")
+	resp := check(t, f, withNonce(t, request(t, f.leaf, f.ca), nonce))
+	want, _ := asn1.Marshal(nonce)
+	found := false
+	for _, ext := range resp.Extensions {
+		found = found || ext.Id.Equal(oidNonce) && bytes.Equal(ext.Value, want)
+	}
+	if !found {
+		t.Fatalf("nonce was not echoed: %+v", resp.Extensions)
+	}
+	if cacheLen() != 0 {
+		t.Fatalf("response with nonce was cached: %d entries", cacheLen())
+	}
+}
+
+// delegatedResponder 签发有效期至 notAfter 的委托 OCSP 签名证书并写入文件，返回证书和证书、私钥文件
+func delegatedResponder(t *testing.T, f *fixture, notAfter time.Time, ekus ...x509.ExtKeyUsage) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  ekus,
+	}
+	cert, err := signature.CertSignature(template, f.ca, key.Public(), f.caSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "responder.pem"), filepath.Join(dir, "responder-key.pem")
+	if err := os.WriteFile(certFile, signature.CertToPEM(cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, keyFile, key)
+	return cert, certFile, keyFile
+}
+
+// writeKey 将私钥写入文件
+func writeKey(t *testing.T, file string, key crypto.Signer) {
+	keyPEM, err := genkey.PrivateKeyToPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useResponder 配置委托 OCSP 签名证书
+func useResponder(t *testing.T, certFile, keyFile string) {
+	responder := &testenv.Config(t).Spki.Ocsp.Responder
+	responder.ResponderFile, responder.ResponderKeyFile = certFile, keyFile
+}
+
+func TestRespondDelegated(t *testing.T) {
+	f := setup(t)
+	cert, certFile, keyFile := delegatedResponder(t, f, time.Now().Add(time.Hour), x509.ExtKeyUsageOCSPSigning)
+	useResponder(t, certFile, keyFile)
+
+	resp := check(t, f, request(t, f.leaf, f.ca))
+	if resp.Certificate == nil || !resp.Certificate.Equal(cert) {
+		t.Fatalf("response is not signed by the delegated responder: %v", resp.Certificate)
+	}
+
+	// 委托证书不是其他 CA 签发的，其他 CA 仍使用 CA 私钥签名
+	otherID, other, otherSigner := testenv.CA(t, "Other Root")
+	_, foreign := testenv.Leaf(t, otherID, other, otherSigner, f.leaf.PublicKey, "foreign")
+	der, err := respond(otherID, request(t, foreign, other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := xocsp.ParseResponse(der, other); err != nil || resp.Certificate != nil {
+		t.Fatalf("response of other CA = %+v, %v", resp, err)
+	}
+
+	// 使用委托证书时不需要 CA 私钥，已吊销的 CA 仍能响应
+	if err := models.UpdateCertificateState(f.caID, models.StateRevoked); err != nil {
+		t.Fatal(err)
+	}
+	resetCache()
+	if resp := check(t, f, request(t, f.leaf, f.ca)); resp.Certificate == nil || resp.Status != xocsp.Good {
+		t.Fatalf("response of revoked CA = %+v", resp)
+	}
+}
+
+func TestRespondDelegatedInvalid(t *testing.T) {
+	for name, create := range map[string]func(t *testing.T, f *fixture) (string, string){
+		"without EKU": func(t *testing.T, f *fixture) (string, string) {
+			_, certFile, keyFile := delegatedResponder(t, f, time.Now().Add(time.Hour), x509.ExtKeyUsageClientAuth)
+			return certFile, keyFile
+		},
+		"expired": func(t *testing.T, f *fixture) (string, string) {
+			_, certFile, keyFile := delegatedResponder(t, f, time.Now().Add(-time.Minute), x509.ExtKeyUsageOCSPSigning)
+			return certFile, keyFile
+		},
+		"mismatched key": func(t *testing.T, f *fixture) (string, string) {
+			_, certFile, keyFile := delegatedResponder(t, f, time.Now().Add(time.Hour), x509.ExtKeyUsageOCSPSigning)
+			other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeKey(t, keyFile, other)
+			return certFile, keyFile
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := setup(t)
+			certFile, keyFile := create(t, f)
+			useResponder(t, certFile, keyFile)
+			if resp, err := respond(f.caID, request(t, f.leaf, f.ca)); err == nil || !bytes.Equal(resp, xocsp.UnauthorizedErrorResponse) {
+				t.Fatalf("response = %x, %v", resp, err)
+			}
+		})
+	}
+}
+
+func TestRespondDelegatedMissing(t *testing.T) {
+	f := setup(t)
+	dir := t.TempDir()
+	useResponder(t, filepath.Join(dir, "responder.pem"), filepath.Join(dir, "responder-key.pem"))
+
+	// 委托证书文件无法加载时使用 CA 私钥签名
+	if resp := check(t, f, request(t, f.leaf, f.ca)); resp.Certificate != nil || resp.Status != xocsp.Good {
+		t.Fatalf("response = %+v", resp)
+	}
+}
+
+func TestCacheBound(t *testing.T) {
+	resetCache()
+	t.Cleanup(resetCache)
+	now := time.Now()
+	entry := cacheEntry{der: []byte{1}, expires: now.Add(time.Minute)}
+	for i := 0; i < maxCacheEntries+10; i++ {
+		store(fmt.Sprintf("ca/%x", i), entry, now)
+	}
+	if n := cacheLen(); n != maxCacheEntries {
+		t.Fatalf("cache has %d entries, want %d", n, maxCacheEntries)
+	}
+
+	// 过期的响应在下一个缓存周期写入时清除
+	later := now.Add(time.Minute + defaultCache)
+	store("ca/new", cacheEntry{der: []byte{2}, expires: later.Add(time.Minute)}, later)
+	if n := cacheLen(); n != 1 {
+		t.Fatalf("cache has %d entries after sweep, want 1", n)
+	}
+
+	// 读取时删除过期的响应
+	store("ca/old", cacheEntry{der: []byte{3}, expires: later}, later)
+	if der := cached("ca/old", &xocsp.Request{}, later); der != nil {
+		t.Fatal("expired response was returned")
+	}
+	if n := cacheLen(); n != 1 {
+		t.Fatalf("cache has %d entries, want 1", n)
+	}
+}
+
+func TestRespondHTTP(t *testing.T) {
+	f := setup(t)
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.POST("/spki/ocsp/:certid", Respond())
+	engine.GET("/spki/ocsp/:certid/*request", Respond())
+	der := request(t, f.leaf, f.ca)
+
+	encoded := url.PathEscape(base64.StdEncoding.EncodeToString(der))
+	requests := map[string]*ut.ResponseRecorder{
+		http.MethodGet: ut.PerformRequest(engine, http.MethodGet, "/spki/ocsp/"+f.caID+"/"+encoded, nil),
+		http.MethodPost: ut.PerformRequest(engine, http.MethodPost, "/spki/ocsp/"+f.caID, &ut.Body{Body: bytes.NewReader(der), Len: len(der)},
+			ut.Header{Key: "Content-Type", Value: "application/ocsp-request"}),
+	}
+	for method, w := range requests {
+		res := w.Result()
+		if res.StatusCode() != http.StatusOK || string(res.Header.ContentType()) != "application/ocsp-response" {
+			t.Fatalf("%s: %d %s", method, res.StatusCode(), res.Header.ContentType())
+		}
+		resp, err := xocsp.ParseResponse(res.Body(), f.ca)
+		if err != nil || resp.Status != xocsp.Good {
+			t.Fatalf("%s: %+v, %v", method, resp, err)
+		}
+		if cc := res.Header.Get("Cache-Control"); (method == http.MethodGet) != (cc != "") {
+			t.Errorf("%s: Cache-Control = %q", method, cc)
+		}
+	}
+
+	// base64 编码的请求中连续的斜杠不能被合并
+	unknown := *f.leaf
+	for i := int64(1); ; i++ {
+		unknown.SerialNumber = big.NewInt(i)
+		der = request(t, &unknown, f.ca)
+		if encoded := base64.StdEncoding.EncodeToString(der); strings.Contains(encoded, "//") {
+			w := ut.PerformRequest(engine, http.MethodGet, "/spki/ocsp/"+f.caID+"/"+encoded, nil)
+			resp, err := xocsp.ParseResponse(w.Result().Body(), f.ca)
+			if err != nil || resp.SerialNumber.Int64() != i {
+				t.Fatalf("GET with //: %+v, %v", resp, err)
+			}
+			break
+		}
+	}
+
+	w := ut.PerformRequest(engine, http.MethodGet, "/spki/ocsp/"+f.caID+"/%21%21", nil)
+	if !bytes.Equal(w.Result().Body(), xocsp.MalformedRequestErrorResponse) {
+		t.Fatalf("malformed GET = %x", w.Result().Body())
+	}
+}
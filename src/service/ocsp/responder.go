@@ -0,0 +1,115 @@
+package ocsp
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"spki/src/config"
+	"spki/src/genkey"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// responder OCSP 响应签名者，cert 为 nil 时由 CA 私钥直接签名
+type responder struct {
+	issuer *x509.Certificate
+	cert   *x509.Certificate
+	signer crypto.Signer
+}
+
+// delegated 已加载的委托 OCSP 签名证书，配置的文件变化时重新加载
+var delegated = struct {
+	sync.Mutex
+	certFile, keyFile string
+	cert              *x509.Certificate
+	signer            crypto.Signer
+}{}
+
+// delegatedFiles 委托 OCSP 签名证书及其私钥的文件，未配置时返回空字符串
+func delegatedFiles() (string, string) {
+	if config.AppCfg == nil || config.AppCfg.Spki == nil {
+		return "", ""
+	}
+	cfg := config.AppCfg.Spki.Ocsp.Responder
+	return cfg.ResponderFile, cfg.ResponderKeyFile
+}
+
+// loadDelegated 从文件加载委托 OCSP 签名证书及其私钥
+func loadDelegated(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	delegated.Lock()
+	defer delegated.Unlock()
+	if delegated.cert != nil && delegated.certFile == certFile && delegated.keyFile == keyFile {
+		return delegated.cert, delegated.signer, nil
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := signature.ParseCertPEM(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := genkey.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	delegated.certFile, delegated.keyFile = certFile, keyFile
+	delegated.cert, delegated.signer = cert, signer
+	return cert, signer, nil
+}
+
+// checkDelegated 检查委托 OCSP 签名证书可以使用：包含 OCSPSigning 扩展用途、私钥与证书匹配且在有效期内
+func checkDelegated(cert *x509.Certificate, signer crypto.Signer, now time.Time) error {
+	ocspSigning := false
+	for _, eku := range cert.ExtKeyUsage {
+		ocspSigning = ocspSigning || eku == x509.ExtKeyUsageOCSPSigning
+	}
+	if !ocspSigning {
+		return errors.New("OCSP responder certificate lacks the OCSPSigning extended key usage")
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return errors.New("OCSP responder private key does not match the certificate")
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("OCSP responder certificate is not valid at %s", now.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// loadResponder 加载 CA 的 OCSP 响应签名者，委托 OCSP 签名证书由该 CA 签发时只加载 CA 证书，CA 已吊销或过期时仍可响应
+// 委托证书文件无法加载时记录日志并改用 CA 私钥签名
+func loadResponder(caCertID string) (*responder, error) {
+	if certFile, keyFile := delegatedFiles(); certFile != "" {
+		ca, err := cacert.LoadCACert(caCertID)
+		if err != nil {
+			return nil, err
+		}
+		cert, signer, err := loadDelegated(certFile, keyFile)
+		if err != nil {
+			hlog.Errorf("Failed to load OCSP responder certificate, CA private key is used. error: %v", err)
+		} else if cert.CheckSignatureFrom(ca.Cert) == nil {
+			if err := checkDelegated(cert, signer, time.Now()); err != nil {
+				return nil, err
+			}
+			return &responder{issuer: ca.Cert, cert: cert, signer: signer}, nil
+		}
+	}
+
+	ca, err := cacert.LoadCA(caCertID)
+	if err != nil {
+		return nil, err
+	}
+	return &responder{issuer: ca.Cert, signer: ca.Signer}, nil
+}
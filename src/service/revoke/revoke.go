@@ -0,0 +1,259 @@
+package revoke
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/pkg/common"
+	"spki/src/service/audit"
+	"spki/src/service/crl"
+	"spki/src/service/ocsp"
+	"spki/src/service/webhook"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// RFC 5280 5.3.1 CRLReason
+const (
+	Unspecified          = 0
+	KeyCompromise        = 1
+	CACompromise         = 2
+	AffiliationChanged   = 3
+	Superseded           = 4
+	CessationOfOperation = 5
+	CertificateHold      = 6
+	RemoveFromCRL        = 8 // 仅用于增量 CRL，不能作为吊销原因
+	PrivilegeWithdrawn   = 9
+	AACompromise         = 10
+)
+
+// reasons 吊销原因名称与代码的对应关系
+var reasons = map[string]int{
+	"unspecified":          Unspecified,
+	"keyCompromise":        KeyCompromise,
+	"cACompromise":         CACompromise,
+	"affiliationChanged":   AffiliationChanged,
+	"superseded":           Superseded,
+	"cessationOfOperation": CessationOfOperation,
+	"certificateHold":      CertificateHold,
+	"privilegeWithdrawn":   PrivilegeWithdrawn,
+	"aACompromise":         AACompromise,
+}
+
+// ReasonCode 根据吊销原因名称获取代码，名称为空时为 unspecified
+func ReasonCode(name string) (int, bool) {
+	if name == "" {
+		return Unspecified, true
+	}
+	code, ok := reasons[name]
+	return code, ok
+}
+
+// ReasonName 根据吊销原因代码获取名称，未知代码返回空字符串
+func ReasonName(code int) string {
+	for name, c := range reasons {
+		if c == code {
+			return name
+		}
+	}
+	return ""
+}
+
+var (
+	ErrRevoked = errors.New("certificate has already been revoked")
+	ErrExpired = errors.New("certificate has expired")
+)
+
+// RevokeConfig 吊销证书的请求体，certid 和 serial 二选一
+type RevokeConfig struct {
+	CertID         string `json:"certid"`
+	Serial         string `json:"serial"`         // 十六进制证书序列号
+	Reason         string `json:"reason"`         // 吊销原因，如 keyCompromise、cACompromise、superseded
+	InvalidityDate string `json:"invalidityDate"` // 私钥泄露或证书失效的时间（RFC 3339），可选
+}
+
+// RevokeResult 吊销结果
+type RevokeResult struct {
+	CertID         string `json:"certid"`
+	Serial         string `json:"serial"`
+	Reason         int    `json:"reason"`
+	RevocationTime int64  `json:"revocationTime"`
+	InvalidityTime int64  `json:"invalidityTime,omitempty"`
+}
+
+// normalizeSerial 统一序列号格式：去掉冒号，转为小写
+func normalizeSerial(serial string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(serial), ":", ""))
+}
+
+// findTarget 根据证书 ID 或序列号查找待吊销的证书和版本，按证书 ID 查找时取最新版本
+func findTarget(cfg *RevokeConfig) (*models.Certificate, *models.Version, error) {
+	var (
+		version *models.Version
+		err     error
+	)
+	if cfg.Serial != "" {
+		version, err = models.FindCertVersionBySerial(normalizeSerial(cfg.Serial))
+	} else {
+		version, err = models.FindLatestCertVersion(cfg.CertID)
+	}
+	if err != nil || version.ID == 0 {
+		return nil, nil, err
+	}
+	if cfg.CertID != "" && cfg.CertID != version.CertID {
+		return nil, nil, nil
+	}
+	record, err := models.FindCertificateByCertID(version.CertID)
+	if err != nil || record.CertID == nil {
+		return nil, nil, err
+	}
+	return record, version, nil
+}
+
+// enqueueRevoked 在事务中写入证书版本的吊销事件
+func enqueueRevoked(tx models.Repository, record *models.Certificate, version *models.Version, code int, revocationTime, invalidityTime int64) error {
+	event := webhook.NewCertificate(record, version)
+	event.Reason = ReasonName(code)
+	event.RevocationTime = revocationTime
+	event.InvalidityTime = invalidityTime
+	return webhook.Enqueue(tx, webhook.EventRevoked, event)
+}
+
+// Certificate 吊销证书版本：吊销记录、吊销事件和证书状态在同一个事务中更新，然后刷新 OCSP 缓存和 CRL
+// 吊销最新版本时同时吊销证书未到期的旧版本，证书已吊销时返回 ErrRevoked，已过期时返回 ErrExpired
+func Certificate(record *models.Certificate, version *models.Version, code int, invalidityTime int64) (*RevokeResult, error) {
+	now := common.CreateTimestamp()
+	if version.RevocationTime != 0 || (record.State != nil && *record.State == models.StateRevoked) {
+		return nil, ErrRevoked
+	}
+	if version.ExpirationTime <= now || (record.State != nil && *record.State == models.StateExpired) {
+		return nil, ErrExpired
+	}
+
+	// 只有吊销最新版本时才变更证书状态并吊销续期或更换私钥留下的旧版本，吊销被替换的旧版本不影响证书
+	var serials []string
+	err := models.Transaction(func(tx models.Repository) error {
+		// 并发吊销时只有一个请求能更新吊销记录，其余请求返回 ErrRevoked
+		updated, err := tx.RevokeCertVersion(version.ID, now, code, invalidityTime)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return ErrRevoked
+		}
+		serials = []string{version.Serial}
+		if err := enqueueRevoked(tx, record, version, code, now, invalidityTime); err != nil {
+			return err
+		}
+		latest, err := tx.FindLatestCertVersion(version.CertID)
+		if err != nil || latest.ID != version.ID {
+			return err
+		}
+		versions, err := tx.FindCertVersions(version.CertID)
+		if err != nil {
+			return err
+		}
+		for i := range versions {
+			v := &versions[i]
+			if v.ID == version.ID || v.RevocationTime != 0 || v.ExpirationTime <= now {
+				continue
+			}
+			updated, err := tx.RevokeCertVersion(v.ID, now, code, invalidityTime)
+			if err != nil {
+				return err
+			}
+			if !updated {
+				continue
+			}
+			serials = append(serials, v.Serial)
+			if err := enqueueRevoked(tx, record, v, code, now, invalidityTime); err != nil {
+				return err
+			}
+		}
+		return tx.UpdateCertificateState(version.CertID, models.StateRevoked)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.Dispatch()
+	hlog.Infof("Certificate %s (serial %s) revoked, reason: %d", version.CertID, strings.Join(serials, ", "), code)
+	if record.ParentID != nil && *record.ParentID != "" {
+		for _, serial := range serials {
+			ocsp.Invalidate(*record.ParentID, serial)
+		}
+		crl.Regenerate(*record.ParentID)
+	}
+	return &RevokeResult{
+		CertID:         version.CertID,
+		Serial:         version.Serial,
+		Reason:         code,
+		RevocationTime: now,
+		InvalidityTime: invalidityTime,
+	}, nil
+}
+
+// Revoke 吊销证书
+func Revoke() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var cfg RevokeConfig
+		if err := c.BindJSON(&cfg); err != nil {
+			hlog.Error("The request body is invalid. error: ", err)
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestError, "Invalid request data.", ""))
+			return
+		}
+		if cfg.CertID == "" && cfg.Serial == "" {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "certid or serial is required.", ""))
+			return
+		}
+		code, ok := ReasonCode(cfg.Reason)
+		if !ok {
+			c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "Unsupported revocation reason: "+cfg.Reason, ""))
+			return
+		}
+
+		now := common.CreateTimestamp()
+		var invalidityTime int64
+		if cfg.InvalidityDate != "" {
+			t, err := time.Parse(time.RFC3339, cfg.InvalidityDate)
+			if err != nil || t.UnixMilli() > now {
+				c.JSON(http.StatusBadRequest, answer.ResBody(answer.EcodeInvalidRequestParamsError, "invalidityDate must be an RFC 3339 time in the past.", ""))
+				return
+			}
+			invalidityTime = t.UnixMilli()
+		}
+
+		record, version, err := findTarget(&cfg)
+		if version != nil {
+			audit.SetTarget(c, version.CertID)
+		}
+		if err != nil {
+			hlog.Error("Failed to query certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to query certificate.", ""))
+			return
+		}
+		if record == nil {
+			c.JSON(http.StatusNotFound, answer.ResBody(answer.EcodeResourceNotFound, "Certificate not found.", ""))
+			return
+		}
+		result, err := Certificate(record, version, code, invalidityTime)
+		switch {
+		case errors.Is(err, ErrRevoked):
+			c.JSON(http.StatusConflict, answer.ResBody(answer.EcodeCertRevoked, "Certificate has already been revoked.", ""))
+			return
+		case errors.Is(err, ErrExpired):
+			c.JSON(http.StatusConflict, answer.ResBody(answer.EcodeCertExpired, "Certificate has expired.", ""))
+			return
+		case err != nil:
+			hlog.Error("Failed to revoke certificate. error: ", err)
+			c.JSON(http.StatusInternalServerError, answer.ResBody(answer.EcodeDatabaseError, "Failed to revoke certificate.", ""))
+			return
+		}
+		c.JSON(http.StatusOK, answer.ResBody(answer.EcodeOK, "", result))
+	}
+}
@@ -0,0 +1,162 @@
+package revoke
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"spki/src/pkg/answer"
+	"spki/src/signature"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/ut"
+)
+
+func TestReasonCode(t *testing.T) {
+	for name, want := range map[string]int{"": Unspecified, "keyCompromise": KeyCompromise, "superseded": Superseded, "aACompromise": AACompromise} {
+		if code, ok := ReasonCode(name); !ok || code != want {
+			t.Errorf("ReasonCode(%q) = %d, %v", name, code, ok)
+		}
+	}
+	// removeFromCRL 只用于增量 CRL，不能作为吊销原因
+	for _, name := range []string{"removeFromCRL", "KeyCompromise", "unknown"} {
+		if _, ok := ReasonCode(name); ok {
+			t.Errorf("ReasonCode(%q) was accepted", name)
+		}
+	}
+	for code, want := range map[int]string{KeyCompromise: "keyCompromise", CertificateHold: "certificateHold", RemoveFromCRL: "", 7: ""} {
+		if got := ReasonName(code); got != want {
+			t.Errorf("ReasonName(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestNormalizeSerial(t *testing.T) {
+	if got := normalizeSerial(" 0A:1B:ff "); got != "0a1bff" {
+		t.Fatalf("normalizeSerial = %q", got)
+	}
+}
+
+// revoke 调用吊销接口，返回状态码和错误码
+func revoke(t *testing.T, cfg RevokeConfig) (int, string) {
+	body, _ := json.Marshal(cfg)
+	c := ut.CreateUtRequestContext(http.MethodPost, "/spki/revoke", &ut.Body{Body: bytes.NewReader(body), Len: len(body)},
+		ut.Header{Key: "Content-Type", Value: "application/json"})
+	Revoke()(context.Background(), c)
+	var res struct {
+		Metadata answer.Metadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(c.Response.Body(), &res); err != nil {
+		t.Fatalf("invalid response %q: %v", c.Response.Body(), err)
+	}
+	return c.Response.StatusCode(), res.Metadata.Ecode
+}
+
+func TestRevoke(t *testing.T) {
+	testenv.Open(t)
+	testenv.Config(t)
+	caID, ca, caSigner := testenv.CA(t, "Revoke Root")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certID, cert := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "device")
+	otherID, _ := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "other")
+
+	for name, tt := range map[string]struct {
+		cfg    RevokeConfig
+		status int
+	}{
+		"missing target":    {RevokeConfig{}, http.StatusBadRequest},
+		"unknown reason":    {RevokeConfig{CertID: certID, Reason: "removeFromCRL"}, http.StatusBadRequest},
+		"future date":       {RevokeConfig{CertID: certID, InvalidityDate: "2999-01-01T00:00:00Z"}, http.StatusBadRequest},
+		"unknown serial":    {RevokeConfig{Serial: "01"}, http.StatusNotFound},
+		"mismatched certid": {RevokeConfig{CertID: otherID, Serial: cert.SerialNumber.Text(16)}, http.StatusNotFound},
+	} {
+		if status, _ := revoke(t, tt.cfg); status != tt.status {
+			t.Errorf("%s: status = %d, want %d", name, status, tt.status)
+		}
+	}
+
+	// 序列号不区分大小写
+	serial := strings.ToUpper(cert.SerialNumber.Text(16))
+	if status, ecode := revoke(t, RevokeConfig{Serial: serial, Reason: "keyCompromise", InvalidityDate: "2020-01-01T00:00:00Z"}); status != http.StatusOK {
+		t.Fatalf("revoke = %d %s", status, ecode)
+	}
+	version, err := models.FindLatestCertVersion(certID)
+	if err != nil || version.RevocationTime == 0 || version.RevocationCode != KeyCompromise || version.InvalidityTime == 0 {
+		t.Fatalf("version = %+v, %v", version, err)
+	}
+	record, err := models.FindCertificateByCertID(certID)
+	if err != nil || *record.State != models.StateRevoked {
+		t.Fatalf("certificate = %+v, %v", record, err)
+	}
+	if status, ecode := revoke(t, RevokeConfig{CertID: certID}); status != http.StatusConflict || ecode != answer.EcodeCertRevoked {
+		t.Fatalf("second revoke = %d %s", status, ecode)
+	}
+
+	// 使用已读取的旧记录再次吊销时，条件更新拒绝覆盖已有的吊销记录
+	version.RevocationTime = 0
+	record.State = nil
+	if _, err := Certificate(record, version, Superseded, 0); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("concurrent revoke = %v, want ErrRevoked", err)
+	}
+	if version, _ := models.FindLatestCertVersion(certID); version.RevocationCode != KeyCompromise {
+		t.Fatalf("revocation reason was overwritten: %+v", version)
+	}
+}
+
+// renew 为证书保存一个新版本，模拟续期，返回新版本的证书
+func renew(t *testing.T, certID, caID string, ca *x509.Certificate, caSigner crypto.Signer, pub crypto.PublicKey) *x509.Certificate {
+	_, cert := testenv.Leaf(t, caID, ca, caSigner, pub, "renewed")
+	err := models.InstallCertVersion(models.Version{
+		CertID:         certID,
+		Serial:         signature.SerialString(cert.SerialNumber),
+		Cert:           string(signature.CertToPEM(cert)),
+		EffectiveTime:  cert.NotBefore.UnixMilli(),
+		ExpirationTime: cert.NotAfter.UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRevokeVersions(t *testing.T) {
+	testenv.Open(t)
+	testenv.Config(t)
+	caID, ca, caSigner := testenv.CA(t, "Revoke Root")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// 吊销旧版本的序列号只吊销该版本，证书仍然有效
+	certID, old := testenv.Leaf(t, caID, ca, caSigner, key.Public(), "device")
+	renew(t, certID, caID, ca, caSigner, key.Public())
+	if status, ecode := revoke(t, RevokeConfig{Serial: old.SerialNumber.Text(16), Reason: "superseded"}); status != http.StatusOK {
+		t.Fatalf("revoke old version = %d %s", status, ecode)
+	}
+	if version, _ := models.FindLatestCertVersion(certID); version.RevocationTime != 0 {
+		t.Fatalf("latest version was revoked: %+v", version)
+	}
+
+	// 按证书 ID 吊销时，续期留下的未到期旧版本一并吊销
+	certID, _ = testenv.Leaf(t, caID, ca, caSigner, key.Public(), "server")
+	renew(t, certID, caID, ca, caSigner, key.Public())
+	if status, ecode := revoke(t, RevokeConfig{CertID: certID, Reason: "keyCompromise"}); status != http.StatusOK {
+		t.Fatalf("revoke = %d %s", status, ecode)
+	}
+	versions, err := models.FindCertVersions(certID)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("versions = %+v, %v", versions, err)
+	}
+	for _, version := range versions {
+		if version.RevocationTime == 0 || version.RevocationCode != KeyCompromise {
+			t.Errorf("version %s was not revoked: %+v", version.Serial, version)
+		}
+	}
+}
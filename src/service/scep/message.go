@@ -0,0 +1,171 @@
+package scep
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+)
+
+// SCEP 消息属性（RFC 8894 3.2.1）
+var (
+	oidMessageType    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidPKIStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidFailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidSenderNonce    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidRecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+	oidTransactionID  = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+
+	oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+)
+
+// 消息类型
+const (
+	msgCertRep        = "3"
+	msgPKCSReq        = "19"
+	msgGetCertInitial = "20"
+)
+
+// 处理状态
+const (
+	statusSuccess = "0"
+	statusFailure = "2"
+)
+
+// 失败原因
+const (
+	failBadAlg          = "0"
+	failBadMessageCheck = "1"
+	failBadRequest      = "2"
+	failBadCertID       = "4"
+)
+
+// pkiMessage 已校验签名的 SCEP 请求
+type pkiMessage struct {
+	messageType   string
+	transactionID string
+	senderNonce   []byte
+	signer        *x509.Certificate // 请求者证书，通常为自签名证书，响应使用其公钥加密
+	envelope      []byte            // 加密的请求内容（PKCS#7 EnvelopedData）
+}
+
+// parseMessage 解析 SCEP 请求并校验签名
+func parseMessage(der []byte) (*pkiMessage, error) {
+	signed, err := signature.ParseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	msg := &pkiMessage{signer: signed.Signer, envelope: signed.Content}
+	if err := signed.Attribute(oidMessageType, &msg.messageType); err != nil {
+		return nil, err
+	}
+	if err := signed.Attribute(oidTransactionID, &msg.transactionID); err != nil {
+		return nil, err
+	}
+	if err := signed.Attribute(oidSenderNonce, &msg.senderNonce); err != nil {
+		return nil, err
+	}
+	if msg.transactionID == "" || len(msg.senderNonce) == 0 {
+		return nil, errors.New("transactionID and senderNonce are required")
+	}
+	return msg, nil
+}
+
+// certRep 生成 CertRep 响应
+type certRep struct {
+	req      *pkiMessage
+	ca       *cacert.Authority
+	status   string
+	failInfo string
+	content  []byte // 成功时为加密的证书，失败时为 nil
+}
+
+// encode 使用 CA 私钥签名响应
+func (r *certRep) encode() ([]byte, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	attrs := []signature.Attribute{
+		{Type: oidTransactionID, Value: printable(r.req.transactionID)},
+		{Type: oidMessageType, Value: printable(msgCertRep)},
+		{Type: oidPKIStatus, Value: printable(r.status)},
+		{Type: oidSenderNonce, Value: nonce},
+		{Type: oidRecipientNonce, Value: r.req.senderNonce},
+	}
+	if r.status == statusFailure {
+		attrs = append(attrs, signature.Attribute{Type: oidFailInfo, Value: printable(r.failInfo)})
+	}
+	return signature.SignData(r.content, r.ca.Cert, r.ca.Signer, attrs, nil)
+}
+
+// failWith 设置失败响应
+func (r *certRep) failWith(info string) {
+	r.status, r.failInfo, r.content = statusFailure, info, nil
+}
+
+// succeed 设置成功响应，证书使用请求采用的内容加密算法加密
+func (r *certRep) succeed(cert *x509.Certificate, c signature.Cipher) error {
+	content, err := sealCert(cert, r.req.signer, c)
+	if err != nil {
+		return err
+	}
+	r.status, r.content = statusSuccess, content
+	return nil
+}
+
+// printable 编码为 PrintableString 的属性值
+func printable(s string) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagPrintableString, Bytes: []byte(s)}
+}
+
+// sealCert 将签发的证书编码为 certs-only 的 PKCS#7，并用请求者证书的公钥加密
+func sealCert(cert *x509.Certificate, recipient *x509.Certificate, c signature.Cipher) ([]byte, error) {
+	degenerate, err := signature.CertsToPKCS7([]*x509.Certificate{cert})
+	if err != nil {
+		return nil, err
+	}
+	return signature.SealEnvelope(degenerate, recipient, c)
+}
+
+// tbsCSR 证书请求的待签名部分，用于读取 x509 包不解析的属性
+type tbsCSR struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []csrAttribute `asn1:"optional,tag:0"`
+}
+
+// csrAttribute 证书请求属性
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// challengePassword 读取证书请求中的挑战密码（PKCS#9 challengePassword），不存在时返回空字符串
+func challengePassword(csr *x509.CertificateRequest) (string, error) {
+	var tbs tbsCSR
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return "", fmt.Errorf("invalid certificate request: %v", err)
+	}
+	for _, attr := range tbs.Attributes {
+		if !attr.Type.Equal(oidChallengePassword) || len(attr.Values) == 0 {
+			continue
+		}
+		var password string
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password); err != nil {
+			return "", fmt.Errorf("invalid challenge password: %v", err)
+		}
+		return password, nil
+	}
+	return "", nil
+}
+
+// issuerAndSubject GetCertInitial 请求的内容
+type issuerAndSubject struct {
+	Issuer  asn1.RawValue
+	Subject asn1.RawValue
+}
@@ -0,0 +1,339 @@
+package scep
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/src/config"
+	"spki/src/keystore"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Prefix SCEP 接口的路径，操作由 operation 参数指定（RFC 8894 4.1）
+const Prefix = "/scep"
+
+// defaultProfile 默认签名配置
+const defaultProfile = "client"
+
+// creator SCEP 签发证书的创建者名称
+const creator = "scep"
+
+// caCaps GetCACaps 响应的 CA 能力（RFC 8894 3.5.2）
+var caCaps = []string{"POSTPKIOperation", "SHA-1", "SHA-256", "AES", "DES3", "SCEPStandard"}
+
+// settings SCEP 配置
+func settings() config.Scep {
+	if config.AppCfg == nil {
+		return config.Scep{}
+	}
+	return config.AppCfg.Spki.Scep
+}
+
+// signingProfile 签发证书使用的签名配置
+func signingProfile() string {
+	if p := settings().Profile; p != "" {
+		return p
+	}
+	return defaultProfile
+}
+
+// userID SCEP 作为证书创建者时的用户 ID
+func userID() string {
+	sum := sha256.Sum256([]byte(creator))
+	return hex.EncodeToString(sum[:16])
+}
+
+// fail 返回错误，无法生成 CertRep 响应时使用
+func fail(c *app.RequestContext, status int, msg string) {
+	c.Data(status, "text/plain; charset=utf-8", []byte(msg))
+}
+
+// enabled 检查是否启用了 SCEP，未启用时返回 404
+func enabled(c *app.RequestContext) bool {
+	if settings().Enabled {
+		return true
+	}
+	fail(c, http.StatusNotFound, "SCEP is not enabled.")
+	return false
+}
+
+// loadCA 加载配置的签发 CA
+func loadCA(c *app.RequestContext) *cacert.Authority {
+	ca, err := cacert.LoadCA(settings().CA)
+	if err != nil {
+		hlog.Error("Failed to load SCEP CA. error: ", err)
+		fail(c, http.StatusServiceUnavailable, "The CA is unavailable.")
+		return nil
+	}
+	return ca
+}
+
+// checkChallenge 校验挑战密码，未配置挑战密码时拒绝所有请求
+func checkChallenge(password string) bool {
+	expected := settings().ChallengePassword
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// Operation SCEP 接口，根据 operation 参数处理 GetCACaps、GetCACert 和 PKIOperation
+func Operation() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		switch op := c.Query("operation"); op {
+		case "GetCACaps":
+			c.Data(http.StatusOK, "text/plain", []byte(strings.Join(caCaps, "\n")+"\n"))
+		case "GetCACert":
+			getCACert(c)
+		case "PKIOperation":
+			pkiOperation(c)
+		default:
+			fail(c, http.StatusBadRequest, fmt.Sprintf("Unsupported operation %q.", op))
+		}
+	}
+}
+
+// getCACert 返回签发 CA 的证书；CA 不是根 CA 时返回 PKCS#7 格式的证书链（RFC 8894 4.2.1）
+func getCACert(c *app.RequestContext) {
+	ca := loadCA(c)
+	if ca == nil {
+		return
+	}
+	chain, err := ca.Chain()
+	if err != nil {
+		hlog.Error("Failed to load certificate chain. error: ", err)
+		fail(c, http.StatusInternalServerError, "Failed to load certificate chain.")
+		return
+	}
+	if len(chain) == 1 {
+		c.Data(http.StatusOK, "application/x-x509-ca-cert", chain[0].Raw)
+		return
+	}
+	data, err := signature.CertsToPKCS7(chain)
+	if err != nil {
+		hlog.Error("Failed to encode PKCS#7. error: ", err)
+		fail(c, http.StatusInternalServerError, "Failed to encode certificates.")
+		return
+	}
+	c.Data(http.StatusOK, "application/x-x509-ca-ra-cert", data)
+}
+
+// readMessage 读取 pkiMessage：POST 时为请求体，GET 时为 base64 编码的 message 参数
+func readMessage(c *app.RequestContext) ([]byte, error) {
+	if string(c.Method()) == http.MethodPost {
+		return c.Request.Body(), nil
+	}
+	// 未转义的 + 在查询参数中被解码为空格
+	message := strings.ReplaceAll(c.Query("message"), " ", "+")
+	return base64.StdEncoding.DecodeString(message)
+}
+
+// pkiOperation 处理 PKCSReq 和 GetCertInitial 请求，处理结果以 CA 签名的 CertRep 消息返回
+func pkiOperation(c *app.RequestContext) {
+	der, err := readMessage(c)
+	if err != nil || len(der) == 0 {
+		fail(c, http.StatusBadRequest, "Invalid pkiMessage.")
+		return
+	}
+	req, err := parseMessage(der)
+	if err != nil {
+		hlog.Info("Invalid SCEP pkiMessage. error: ", err)
+		fail(c, http.StatusBadRequest, "Invalid pkiMessage.")
+		return
+	}
+	ca := loadCA(c)
+	if ca == nil {
+		return
+	}
+	decrypter, err := keystore.Decrypter(ca.Version.KeyID)
+	if err != nil {
+		hlog.Error("The SCEP CA key can not decrypt requests. error: ", err)
+		fail(c, http.StatusServiceUnavailable, "The CA is unavailable.")
+		return
+	}
+
+	rep := &certRep{req: req, ca: ca}
+	if err := handle(c, rep, decrypter); err != nil {
+		hlog.Error("Failed to process SCEP request. error: ", err)
+		fail(c, http.StatusInternalServerError, "Failed to process request.")
+		return
+	}
+	data, err := rep.encode()
+	if err != nil {
+		hlog.Error("Failed to sign SCEP response. error: ", err)
+		fail(c, http.StatusInternalServerError, "Failed to sign response.")
+		return
+	}
+	c.Data(http.StatusOK, "application/x-pki-message", data)
+}
+
+// handle 解密请求并按消息类型处理，请求不合法时设置失败响应，内部错误时返回 error
+func handle(c *app.RequestContext, rep *certRep, decrypter crypto.Decrypter) error {
+	req := rep.req
+	if _, ok := req.signer.PublicKey.(*rsa.PublicKey); !ok {
+		// 响应需要用请求者证书的公钥加密
+		hlog.Infof("SCEP transaction %s rejected: unsupported requester key %T", req.transactionID, req.signer.PublicKey)
+		rep.failWith(failBadAlg)
+		return nil
+	}
+	content, cipher, err := signature.OpenEnvelope(req.envelope, rep.ca.Cert, decrypter)
+	if err != nil {
+		hlog.Infof("Failed to decrypt SCEP transaction %s: %v", req.transactionID, err)
+		rep.failWith(failBadMessageCheck)
+		return nil
+	}
+	switch req.messageType {
+	case msgPKCSReq:
+		return pkcsReq(c, rep, content, cipher)
+	case msgGetCertInitial:
+		return getCertInitial(rep, content, cipher)
+	default:
+		hlog.Infof("SCEP transaction %s rejected: unsupported message type %s", req.transactionID, req.messageType)
+		rep.failWith(failBadRequest)
+		return nil
+	}
+}
+
+// loadIssued 读取 SCEP 事务签发的证书，证书已被吊销时返回 nil
+func loadIssued(tx *models.ScepTransaction) (*x509.Certificate, error) {
+	version, err := models.FindCertVersionBySerial(tx.Serial)
+	if err != nil {
+		return nil, err
+	}
+	if version.ID == 0 {
+		return nil, fmt.Errorf("certificate %s of SCEP transaction %s not found", tx.Serial, tx.TransactionID)
+	}
+	if version.RevocationTime != 0 {
+		return nil, nil
+	}
+	return signature.ParseCertPEM([]byte(version.Cert))
+}
+
+// pkcsReq 校验挑战密码后签署证书请求；重发的请求返回已签发的证书
+func pkcsReq(c *app.RequestContext, rep *certRep, content []byte, cipher signature.Cipher) error {
+	req := rep.req
+	csr, err := x509.ParseCertificateRequest(content)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	var password string
+	if err == nil {
+		password, err = challengePassword(csr)
+	}
+	if err != nil {
+		hlog.Infof("SCEP transaction %s rejected: %v", req.transactionID, err)
+		rep.failWith(failBadRequest)
+		return nil
+	}
+
+	record := audit.New(c, audit.ActionSignCSR, "", audit.ResultFailure)
+	record.UserID, record.Account = userID(), creator
+	if !checkChallenge(password) {
+		record.Detail = "invalid challenge password, transaction " + req.transactionID
+		audit.Log(record)
+		hlog.Infof("SCEP transaction %s rejected: invalid challenge password", req.transactionID)
+		rep.failWith(failBadRequest)
+		return nil
+	}
+
+	// 客户端通常以公钥的摘要作为事务 ID，公钥和主题都相同时视为重发的请求
+	tx, err := models.FindScepTransaction(req.transactionID)
+	if err != nil {
+		return err
+	}
+	if tx.ID != 0 {
+		cert, err := loadIssued(tx)
+		if err != nil {
+			return err
+		}
+		if cert != nil && bytes.Equal(cert.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo) &&
+			*cacert.SubjectString(cert.Subject) == *cacert.SubjectString(csr.Subject) {
+			return rep.succeed(cert, cipher)
+		}
+	}
+
+	cert, result, err := rep.ca.IssueCSR(&cacert.CSRIssue{
+		CSR:        csr,
+		Profile:    signingProfile(),
+		Expiry:     settings().Expiry,
+		UserID:     userID(),
+		Account:    creator,
+		DiscardCSR: true,
+	})
+	if err != nil {
+		record.Detail = err.Error()
+		audit.Log(record)
+		if errors.Is(err, cacert.ErrRejected) {
+			hlog.Infof("SCEP transaction %s rejected: %v", req.transactionID, err)
+			rep.failWith(failBadRequest)
+			return nil
+		}
+		return err
+	}
+	record.CertID, record.Result = result.CertID, audit.ResultSuccess
+	record.Detail = "serial " + result.Serial + ", transaction " + req.transactionID
+	audit.Log(record)
+	saved := models.ScepTransaction{
+		TransactionID: req.transactionID,
+		CertID:        result.CertID,
+		Serial:        result.Serial,
+		CreateTime:    common.CreateTimestamp(),
+	}
+	if tx.ID != 0 {
+		err = models.UpdateScepTransaction(saved)
+	} else {
+		err = models.InstallScepTransaction(saved)
+	}
+	if err != nil {
+		// 证书已保存，只影响 GetCertInitial 查询
+		hlog.Errorf("Failed to save SCEP transaction %s. error: %v", req.transactionID, err)
+	}
+	hlog.Infof("SCEP certificate %s issued, transaction %s", result.CertID, req.transactionID)
+	return rep.succeed(cert, cipher)
+}
+
+// getCertInitial 查询事务签发的证书，证书的签发者和主题须与请求一致
+func getCertInitial(rep *certRep, content []byte, cipher signature.Cipher) error {
+	req := rep.req
+	var ias issuerAndSubject
+	if _, err := asn1.Unmarshal(content, &ias); err != nil {
+		hlog.Infof("SCEP transaction %s rejected: invalid IssuerAndSubject: %v", req.transactionID, err)
+		rep.failWith(failBadRequest)
+		return nil
+	}
+	tx, err := models.FindScepTransaction(req.transactionID)
+	if err != nil {
+		return err
+	}
+	if tx.ID == 0 {
+		rep.failWith(failBadCertID)
+		return nil
+	}
+	cert, err := loadIssued(tx)
+	if err != nil {
+		return err
+	}
+	if cert == nil || !bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) || !bytes.Equal(ias.Subject.FullBytes, cert.RawSubject) {
+		rep.failWith(failBadCertID)
+		return nil
+	}
+	return rep.succeed(cert, cipher)
+}
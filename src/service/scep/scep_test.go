@@ -0,0 +1,293 @@
+package scep
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/url"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/signature"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"gorm.io/gorm"
+)
+
+const password = "s3cret"
+
+// requester SCEP 客户端，使用自签名证书签名请求
+type requester struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// response 解析后的 CertRep
+type response struct {
+	status, failInfo string
+	cert             *x509.Certificate
+}
+
+// setup 打开内存数据库、创建 RSA 签发 CA 并启用 SCEP
+func setup(t *testing.T) (*gorm.DB, *x509.Certificate) {
+	db := testenv.Open(t)
+	if err := profile.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	caID, ca, _ := testenv.CAWithKey(t, "SCEP Root", "rsa", 2048)
+	testenv.Config(t).Spki.Scep = config.Scep{Enabled: true, CA: caID, Expiry: 30, ChallengePassword: password}
+	return db, ca
+}
+
+// newRequester 生成客户端私钥和自签名证书
+func newRequester(t *testing.T, cn string) *requester {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &requester{key: key, cert: cert}
+}
+
+// csr 生成包含挑战密码的证书请求，x509 包不支持写入 challengePassword 属性
+func (r *requester) csr(t *testing.T, cn, challenge string) []byte {
+	subject, err := asn1.Marshal(pkix.Name{CommonName: cn}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(r.key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs, err := asn1.Marshal(tbsCSR{
+		Subject:    asn1.RawValue{FullBytes: subject},
+		PublicKey:  asn1.RawValue{FullBytes: pub},
+		Attributes: []csrAttribute{{Type: oidChallengePassword, Values: []asn1.RawValue{{FullBytes: value}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := r.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct {
+		TBS    asn1.RawValue
+		SigAlg pkix.AlgorithmIdentifier
+		Sig    asn1.BitString
+	}{
+		TBS:    asn1.RawValue{FullBytes: tbs},
+		SigAlg: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, Parameters: asn1.NullRawValue},
+		Sig:    asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// message 生成加密并签名的 pkiMessage，返回消息和 senderNonce
+func (r *requester) message(t *testing.T, ca *x509.Certificate, messageType, transactionID string, content []byte) ([]byte, []byte) {
+	envelope, err := signature.SealEnvelope(content, ca, signature.CipherAES128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	der, err := signature.SignData(envelope, r.cert, r.key, []signature.Attribute{
+		{Type: oidTransactionID, Value: printable(transactionID)},
+		{Type: oidMessageType, Value: printable(messageType)},
+		{Type: oidSenderNonce, Value: nonce},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, nonce
+}
+
+// send 以 POST 发送 pkiMessage，get 为 true 时以 GET 的 message 参数发送，返回校验后的 CertRep
+func (r *requester) send(t *testing.T, ca *x509.Certificate, messageType, transactionID string, content []byte, get bool) *response {
+	t.Helper()
+	der, nonce := r.message(t, ca, messageType, transactionID, content)
+	c := ut.CreateUtRequestContext(http.MethodPost, Prefix+"?operation=PKIOperation", &ut.Body{Body: bytes.NewReader(der), Len: len(der)},
+		ut.Header{Key: "Content-Type", Value: "application/x-pki-message"})
+	if get {
+		query := url.Values{"operation": {"PKIOperation"}, "message": {base64.StdEncoding.EncodeToString(der)}}
+		c = ut.CreateUtRequestContext(http.MethodGet, Prefix+"?"+query.Encode(), nil)
+	}
+	Operation()(context.Background(), c)
+	if c.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("PKIOperation = %d: %s", c.Response.StatusCode(), c.Response.Body())
+	}
+
+	msg, err := signature.ParseSignedData(c.Response.Body())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Signer.Equal(ca) {
+		t.Fatalf("CertRep signed by %s", msg.Signer.Subject)
+	}
+	var repType, repTransactionID string
+	var recipientNonce []byte
+	rep := &response{}
+	for _, attr := range []struct {
+		oid asn1.ObjectIdentifier
+		out interface{}
+	}{
+		{oidMessageType, &repType},
+		{oidTransactionID, &repTransactionID},
+		{oidRecipientNonce, &recipientNonce},
+		{oidPKIStatus, &rep.status},
+	} {
+		if err := msg.Attribute(attr.oid, attr.out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if repType != msgCertRep || repTransactionID != transactionID || !bytes.Equal(recipientNonce, nonce) {
+		t.Fatalf("CertRep type %s, transaction %s, recipientNonce %x", repType, repTransactionID, recipientNonce)
+	}
+	if rep.status != statusSuccess {
+		if err := msg.Attribute(oidFailInfo, &rep.failInfo); err != nil {
+			t.Fatal(err)
+		}
+		return rep
+	}
+
+	// 证书以请求者证书的公钥加密
+	degenerate, cipher, err := signature.OpenEnvelope(msg.Content, r.cert, r.key)
+	if err != nil || cipher != signature.CipherAES128 {
+		t.Fatalf("open CertRep = %s, %v", cipher, err)
+	}
+	certs, err := parseCerts(degenerate)
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("invalid PKCS#7 in CertRep: %v", err)
+	}
+	rep.cert = certs[0]
+	return rep
+}
+
+// parseCerts 解析只包含证书的 PKCS#7
+func parseCerts(der []byte) ([]*x509.Certificate, error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificates(sd.Certificates.Bytes)
+}
+
+// getCertInitialContent GetCertInitial 请求的 IssuerAndSubject
+func getCertInitialContent(t *testing.T, issuer, subject []byte) []byte {
+	der, err := asn1.Marshal(issuerAndSubject{Issuer: asn1.RawValue{FullBytes: issuer}, Subject: asn1.RawValue{FullBytes: subject}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestPKCSReq(t *testing.T) {
+	db, ca := setup(t)
+	r := newRequester(t, "device-1")
+	rep := r.send(t, ca, msgPKCSReq, "tx-1", r.csr(t, "device-1", password), false)
+	if rep.status != statusSuccess || rep.cert.Subject.CommonName != "device-1" {
+		t.Fatalf("PKCSReq = %+v", rep)
+	}
+	if err := rep.cert.CheckSignatureFrom(ca); err != nil {
+		t.Fatal(err)
+	}
+	if pub, ok := rep.cert.PublicKey.(*rsa.PublicKey); !ok || !pub.Equal(r.key.Public()) {
+		t.Fatal("certificate was not issued for the requester key")
+	}
+
+	// 重发的请求返回已签发的证书
+	resent := r.send(t, ca, msgPKCSReq, "tx-1", r.csr(t, "device-1", password), true)
+	if resent.status != statusSuccess || resent.cert.SerialNumber.Cmp(rep.cert.SerialNumber) != 0 {
+		t.Fatalf("resent PKCSReq = %+v", resent)
+	}
+	if n := testenv.Count(t, db, "certificate"); n != 2 {
+		t.Fatalf("%d certificates, want CA and one issued certificate", n)
+	}
+}
+
+func TestPKCSReqChallenge(t *testing.T) {
+	db, ca := setup(t)
+	r := newRequester(t, "device-1")
+	for _, challenge := range []string{"wrong", ""} {
+		rep := r.send(t, ca, msgPKCSReq, "tx-1", r.csr(t, "device-1", challenge), false)
+		if rep.status != statusFailure || rep.failInfo != failBadRequest {
+			t.Fatalf("PKCSReq with challenge %q = %+v", challenge, rep)
+		}
+	}
+	if n := testenv.Count(t, db, "certificate"); n != 1 {
+		t.Fatalf("%d certificates after rejected requests", n)
+	}
+}
+
+func TestGetCertInitial(t *testing.T) {
+	_, ca := setup(t)
+	r := newRequester(t, "device-1")
+	issued := r.send(t, ca, msgPKCSReq, "tx-1", r.csr(t, "device-1", password), false)
+	if issued.status != statusSuccess {
+		t.Fatalf("PKCSReq = %+v", issued)
+	}
+
+	rep := r.send(t, ca, msgGetCertInitial, "tx-1", getCertInitialContent(t, ca.RawSubject, issued.cert.RawSubject), false)
+	if rep.status != statusSuccess || !rep.cert.Equal(issued.cert) {
+		t.Fatalf("GetCertInitial = %+v", rep)
+	}
+
+	// 未知事务和主题不一致时返回 badCertId
+	for name, tt := range map[string]struct {
+		transactionID string
+		subject       []byte
+	}{
+		"unknown transaction": {"tx-2", issued.cert.RawSubject},
+		"wrong subject":       {"tx-1", ca.RawSubject},
+	} {
+		rep := r.send(t, ca, msgGetCertInitial, tt.transactionID, getCertInitialContent(t, ca.RawSubject, tt.subject), false)
+		if rep.status != statusFailure || rep.failInfo != failBadCertID {
+			t.Fatalf("GetCertInitial with %s = %+v", name, rep)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package vault
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/src/genkey"
+	"spki/src/service/audit"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// certRequest issue 和 sign 请求，与 Vault 的参数名称一致
+type certRequest struct {
+	CommonName        string    `json:"common_name"`
+	AltNames          commaList `json:"alt_names"`
+	IPSans            commaList `json:"ip_sans"`
+	URISans           commaList `json:"uri_sans"`
+	OtherSans         commaList `json:"other_sans"`
+	TTL               ttl       `json:"ttl"`
+	Format            string    `json:"format"`             // pem、der 或 pem_bundle，默认为 pem
+	PrivateKeyFormat  string    `json:"private_key_format"` // der 或 pkcs8，der 时私钥的编码与 format 一致
+	ExcludeCNFromSans bool      `json:"exclude_cn_from_sans"`
+	CSR               string    `json:"csr"`
+}
+
+// certData issue 和 sign 响应的 data
+type certData struct {
+	Certificate    string   `json:"certificate"`
+	IssuingCA      string   `json:"issuing_ca"`
+	CAChain        []string `json:"ca_chain"`
+	PrivateKey     string   `json:"private_key,omitempty"`
+	PrivateKeyType string   `json:"private_key_type,omitempty"`
+	SerialNumber   string   `json:"serial_number"`
+	Expiration     int64    `json:"expiration"`
+}
+
+// bind 解析 JSON 请求体，请求体为空时使用默认参数
+func bind(c *app.RequestContext, v any) bool {
+	body := c.Request.Body()
+	if len(body) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		hlog.Info("The Vault request body is invalid. error: ", err)
+		fail(c, http.StatusBadRequest, "failed to parse JSON input: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// checkFormat 校验输出格式
+func (req *certRequest) checkFormat() error {
+	switch req.Format {
+	case "", "pem", "der", "pem_bundle":
+	default:
+		return fmt.Errorf("unknown format for format: %s", req.Format)
+	}
+	switch req.PrivateKeyFormat {
+	case "", "der", "pkcs8":
+	default:
+		return fmt.Errorf("unknown format for private_key_format: %s", req.PrivateKeyFormat)
+	}
+	if len(req.URISans) > 0 || len(req.OtherSans) > 0 {
+		return errors.New("uri_sans and other_sans are not allowed by this role")
+	}
+	return nil
+}
+
+// encode 按 format 编码证书，der 时为 base64 编码的 DER
+func encode(format string, cert *x509.Certificate) string {
+	if format == "der" {
+		return base64.StdEncoding.EncodeToString(cert.Raw)
+	}
+	return string(signature.CertToPEM(cert))
+}
+
+// encodeKey 按 format 和 private_key_format 编码私钥，返回私钥和私钥类型
+func encodeKey(req *certRequest, key any) (string, string, error) {
+	var block *pem.Block
+	if req.PrivateKeyFormat == "pkcs8" {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return "", "", err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	} else {
+		keyPEM, err := genkey.PrivateKeyToPEM(key)
+		if err != nil {
+			return "", "", err
+		}
+		block, _ = pem.Decode(keyPEM)
+	}
+	typ := keyType(key.(crypto.Signer).Public())
+	if req.Format == "der" {
+		return base64.StdEncoding.EncodeToString(block.Bytes), typ, nil
+	}
+	return string(pem.EncodeToMemory(block)), typ, nil
+}
+
+// certResponse 组装 issue 和 sign 响应，pem_bundle 时 certificate 依次包含私钥、证书和签发 CA 证书
+func certResponse(req *certRequest, ca *cacert.Authority, cert *x509.Certificate, serial string, key any) (*certData, error) {
+	chain, err := ca.Chain()
+	if err != nil {
+		return nil, err
+	}
+	data := &certData{
+		Certificate:  encode(req.Format, cert),
+		IssuingCA:    encode(req.Format, ca.Cert),
+		SerialNumber: vaultSerial(serial),
+		Expiration:   cert.NotAfter.Unix(),
+	}
+	for _, issuer := range chain {
+		data.CAChain = append(data.CAChain, encode(req.Format, issuer))
+	}
+	if key != nil {
+		if data.PrivateKey, data.PrivateKeyType, err = encodeKey(req, key); err != nil {
+			return nil, err
+		}
+	}
+	if req.Format == "pem_bundle" {
+		data.Certificate = data.PrivateKey + data.Certificate + data.IssuingCA
+	}
+	return data, nil
+}
+
+// issue 按角色签发证书并记录审计日志，失败时返回错误响应
+func issue(c *app.RequestContext, ca *cacert.Authority, r *role, action string, req *cacert.CSRIssue) (*x509.Certificate, *cacert.IssueResult) {
+	record := audit.New(c, action, "", audit.ResultFailure)
+	record.UserID, record.Account = req.UserID, req.Account
+	cert, result, err := ca.IssueCSR(req)
+	if err != nil {
+		record.Detail = err.Error()
+		audit.Log(record)
+		if errors.Is(err, cacert.ErrRejected) {
+			fail(c, http.StatusBadRequest, err.Error())
+			return nil, nil
+		}
+		hlog.Error("Failed to issue Vault certificate. error: ", err)
+		fail(c, http.StatusInternalServerError, "failed to issue certificate")
+		return nil, nil
+	}
+	record.CertID, record.Result = result.CertID, audit.ResultSuccess
+	record.Detail = "serial " + result.Serial + ", role " + r.name
+	audit.Log(record)
+	return cert, result
+}
+
+// Issue 按角色生成私钥并签发证书，私钥保存在可导出的私钥存储中并随响应返回
+func Issue() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		account, ok := authenticate(c)
+		if !ok {
+			return
+		}
+		var req certRequest
+		if !bind(c, &req) {
+			return
+		}
+		r := lookupRole(c)
+		if r == nil {
+			return
+		}
+		if err := req.checkFormat(); err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if r.keyType() == "any" {
+			fail(c, http.StatusBadRequest, "role key type \"any\" not allowed for issuing certificates, only signing")
+			return
+		}
+		sans, err := r.subjectAltNames(req.CommonName, req.AltNames, req.IPSans, req.ExcludeCNFromSans)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		ca := loadCA(c)
+		if ca == nil {
+			return
+		}
+
+		key, err := genkey.CreateKey(r.keyAlgo(), r.keyBits())
+		if err != nil {
+			hlog.Errorf("Failed to create private key for Vault role %s. error: %v", r.name, err)
+			fail(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		signer := key.(crypto.Signer)
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: req.CommonName}}, signer)
+		var csr *x509.CertificateRequest
+		if err == nil {
+			csr, err = x509.ParseCertificateRequest(der)
+		}
+		if err != nil {
+			hlog.Error("Failed to create certificate request. error: ", err)
+			fail(c, http.StatusInternalServerError, "failed to create certificate request")
+			return
+		}
+
+		validity, warnings := r.ttl(time.Duration(req.TTL))
+		cert, result := issue(c, ca, r, audit.ActionIssue, &cacert.CSRIssue{
+			CSR:     csr,
+			Profile: r.signing.Name,
+			TTL:     validity,
+			Sans:    sans,
+			UserID:  userID(account),
+			Account: account,
+			Key:     signer,
+		})
+		if cert == nil {
+			return
+		}
+		data, err := certResponse(&req, ca, cert, result.Serial, key)
+		if err != nil {
+			hlog.Error("Failed to encode Vault response. error: ", err)
+			fail(c, http.StatusInternalServerError, "failed to encode certificate")
+			return
+		}
+		succeed(c, data, warnings)
+	}
+}
+
+// Sign 按角色签署证书请求；与 Vault 的默认角色一致，使用证书请求中的使用者可选名称，请求未指定 common_name 时使用证书请求中的通用名称
+func Sign() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		account, ok := authenticate(c)
+		if !ok {
+			return
+		}
+		var req certRequest
+		if !bind(c, &req) {
+			return
+		}
+		r := lookupRole(c)
+		if r == nil {
+			return
+		}
+		if err := req.checkFormat(); err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		csr, err := cacert.ParseCSR(req.CSR)
+		if err == nil {
+			err = r.checkKey(csr.PublicKey)
+		}
+		if err == nil && len(csr.URIs) > 0 {
+			err = errors.New("URI Subject Alternative Names are not allowed in this role")
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		cn := req.CommonName
+		if cn == "" {
+			cn = csr.Subject.CommonName
+		}
+		names := append(append([]string{}, csr.DNSNames...), csr.EmailAddresses...)
+		var ips []string
+		for _, ip := range csr.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		sans, err := r.subjectAltNames(cn, names, ips, req.ExcludeCNFromSans)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		ca := loadCA(c)
+		if ca == nil {
+			return
+		}
+
+		validity, warnings := r.ttl(time.Duration(req.TTL))
+		cert, result := issue(c, ca, r, audit.ActionSignCSR, &cacert.CSRIssue{
+			CSR:     csr,
+			Profile: r.signing.Name,
+			TTL:     validity,
+			Subject: &pkix.Name{CommonName: cn},
+			Sans:    sans,
+			UserID:  userID(account),
+			Account: account,
+		})
+		if cert == nil {
+			return
+		}
+		data, err := certResponse(&req, ca, cert, result.Serial, nil)
+		if err != nil {
+			hlog.Error("Failed to encode Vault response. error: ", err)
+			fail(c, http.StatusInternalServerError, "failed to encode certificate")
+			return
+		}
+		succeed(c, data, warnings)
+	}
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/src/models"
+	"spki/src/service/audit"
+	"spki/src/service/revoke"
+	"spki/src/signature"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// revokeRequest revoke 请求，serial_number 和 certificate 二选一
+type revokeRequest struct {
+	SerialNumber string `json:"serial_number"` // 冒号或连字符分隔的十六进制序列号
+	Certificate  string `json:"certificate"`   // PEM 格式的证书
+}
+
+// revokeData revoke 响应的 data
+type revokeData struct {
+	RevocationTime        int64  `json:"revocation_time"`
+	RevocationTimeRFC3339 string `json:"revocation_time_rfc3339"`
+}
+
+// serial 请求中的序列号，转换为 spki 保存的格式：小写十六进制，没有前导零
+func (req *revokeRequest) serial() (string, error) {
+	if req.Certificate != "" {
+		cert, err := signature.ParseCertPEM([]byte(req.Certificate))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		return signature.SerialString(cert.SerialNumber), nil
+	}
+	serial := strings.NewReplacer(":", "", "-", "").Replace(strings.TrimSpace(req.SerialNumber))
+	if serial == "" {
+		return "", errors.New("the serial number must be provided")
+	}
+	serial = strings.TrimLeft(strings.ToLower(serial), "0")
+	if serial == "" {
+		serial = "0"
+	}
+	return serial, nil
+}
+
+// display 错误信息中的序列号，优先使用请求中的格式
+func (req *revokeRequest) display(serial string) string {
+	if s := strings.TrimSpace(req.SerialNumber); s != "" {
+		return s
+	}
+	return vaultSerial(serial)
+}
+
+// revoked 返回吊销时间
+func revoked(c *app.RequestContext, ms int64) {
+	t := time.UnixMilli(ms)
+	succeed(c, revokeData{RevocationTime: t.Unix(), RevocationTimeRFC3339: t.UTC().Format(time.RFC3339)}, nil)
+}
+
+// Revoke 吊销签发 CA 签发的证书，证书已吊销时返回原吊销时间
+func Revoke() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		account, ok := authenticate(c)
+		if !ok {
+			return
+		}
+		var req revokeRequest
+		if !bind(c, &req) {
+			return
+		}
+		serial, err := req.serial()
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		version, err := models.FindCertVersionBySerial(serial)
+		var record *models.Certificate
+		if err == nil && version.ID != 0 {
+			record, err = models.FindCertificateByCertID(version.CertID)
+		}
+		if err != nil {
+			hlog.Error("Failed to query certificate. error: ", err)
+			fail(c, http.StatusInternalServerError, "failed to query certificate")
+			return
+		}
+		// 只能吊销 Vault 接口配置的 CA 签发的证书
+		if record == nil || record.CertID == nil || record.ParentID == nil || *record.ParentID != settings().CA {
+			fail(c, http.StatusBadRequest, fmt.Sprintf("certificate with serial %s not found", req.display(serial)))
+			return
+		}
+
+		entry := audit.New(c, audit.ActionRevoke, version.CertID, audit.ResultFailure)
+		entry.UserID, entry.Account = userID(account), account
+		result, err := revoke.Certificate(record, version, revoke.Unspecified, 0)
+		switch {
+		case errors.Is(err, revoke.ErrRevoked):
+			// 并发吊销时查询前读取的版本没有吊销时间，重新读取
+			if version.RevocationTime == 0 {
+				if latest, err := models.FindCertVersionBySerial(serial); err == nil {
+					version = latest
+				}
+			}
+			revoked(c, version.RevocationTime)
+			return
+		case errors.Is(err, revoke.ErrExpired):
+			entry.Detail = "certificate has expired"
+			audit.Log(entry)
+			fail(c, http.StatusBadRequest, fmt.Sprintf("certificate with serial %s has expired", req.display(serial)))
+			return
+		case err != nil:
+			entry.Detail = err.Error()
+			audit.Log(entry)
+			hlog.Error("Failed to revoke certificate. error: ", err)
+			fail(c, http.StatusInternalServerError, "failed to revoke certificate")
+			return
+		}
+		entry.Result = audit.ResultSuccess
+		entry.Detail = "serial " + result.Serial
+		audit.Log(entry)
+		revoked(c, result.RevocationTime)
+	}
+}
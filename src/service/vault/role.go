@@ -0,0 +1,203 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/service/cacert"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// role Vault 角色及其对应的签名配置
+type role struct {
+	config.VaultRole
+	name    string
+	signing *profile.Signing
+}
+
+// lookupRole 根据路径中的角色名称获取角色
+func lookupRole(c *app.RequestContext) *role {
+	name := c.Param("role")
+	cfg, ok := settings().Roles[name]
+	if !ok {
+		fail(c, http.StatusBadRequest, fmt.Sprintf("unknown role: %s", name))
+		return nil
+	}
+	profileName := cfg.Profile
+	if profileName == "" {
+		profileName = defaultProfile
+	}
+	signing, err := profile.Lookup(profileName)
+	if err != nil {
+		hlog.Errorf("The profile of Vault role %s is invalid. error: %v", name, err)
+		fail(c, http.StatusInternalServerError, fmt.Sprintf("role %s: %v", name, err))
+		return nil
+	}
+	return &role{VaultRole: cfg, name: name, signing: signing}
+}
+
+// keyType 私钥类型，默认为 rsa
+func (r *role) keyType() string {
+	if r.KeyType == "" {
+		return "rsa"
+	}
+	return r.KeyType
+}
+
+// keyBits 私钥长度，未指定时使用私钥类型的默认长度
+func (r *role) keyBits() int {
+	if r.KeyBits != 0 {
+		return r.KeyBits
+	}
+	switch r.keyType() {
+	case "rsa":
+		return 2048
+	case "ec":
+		return 256
+	default:
+		return 0
+	}
+}
+
+// keyAlgo spki 的私钥算法名称，Vault 的 ec 对应 ecdsa
+func (r *role) keyAlgo() string {
+	if r.keyType() == "ec" {
+		return "ecdsa"
+	}
+	return r.keyType()
+}
+
+// keyType 公钥的 Vault 私钥类型名称
+func keyType(pub any) string {
+	if algo := profile.KeyAlgo(pub); algo != "ecdsa" {
+		return algo
+	}
+	return "ec"
+}
+
+// checkKey 校验证书请求的公钥类型和长度，key_bits 为最小长度
+func (r *role) checkKey(pub any) error {
+	if r.keyType() == "any" {
+		return nil
+	}
+	if keyType(pub) != r.keyType() {
+		return fmt.Errorf("role requires keys of type %s", r.keyType())
+	}
+	bits := 0
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		bits = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		bits = key.Curve.Params().BitSize
+	}
+	if bits < r.keyBits() {
+		return fmt.Errorf("role requires a minimum of a %d-bit key, but CSR's key is %d bits", r.keyBits(), bits)
+	}
+	return nil
+}
+
+// ttl 计算有效期：请求未指定时使用角色的 ttl，超过最长有效期时使用最长有效期并返回警告
+func (r *role) ttl(requested time.Duration) (time.Duration, []string) {
+	maxTTL := r.MaxTTL
+	if maxTTL == 0 || maxTTL > r.signing.MaxExpiry {
+		maxTTL = r.signing.MaxExpiry
+	}
+	ttl := requested
+	if ttl == 0 {
+		ttl = r.TTL
+	}
+	if ttl == 0 {
+		return maxTTL, nil
+	}
+	if ttl > maxTTL {
+		return maxTTL, []string{fmt.Sprintf("TTL %q is longer than permitted maxTTL %q, so maxTTL is being used", ttl, maxTTL)}
+	}
+	return ttl, nil
+}
+
+// allowName 检查域名或邮箱地址的域名部分是否符合角色的名称限制
+func (r *role) allowName(name string) bool {
+	if r.AllowAnyName {
+		return true
+	}
+	if at := strings.LastIndex(name, "@"); at >= 0 {
+		name = name[at+1:]
+	}
+	name = strings.ToLower(name)
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return false
+	}
+	for _, domain := range r.AllowedDomains {
+		domain = strings.ToLower(domain)
+		if r.AllowBareDomains && name == domain {
+			return true
+		}
+		// 包括 *.domain 形式的通配符域名
+		if r.AllowSubdomains && strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+		if r.AllowGlobDomains && strings.Contains(domain, "*") && matchGlob(domain, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob 逐个标签匹配通配符域名，* 不能跨越标签，如 *.example.com 不匹配 a.b.example.com
+func matchGlob(pattern, name string) bool {
+	patterns, labels := strings.Split(pattern, "."), strings.Split(name, ".")
+	if len(patterns) != len(labels) {
+		return false
+	}
+	for i := range patterns {
+		if ok, _ := path.Match(patterns[i], labels[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// subjectAltNames 按角色校验通用名称和使用者可选名称，除非 excludeCN，通用名称加入使用者可选名称
+func (r *role) subjectAltNames(cn string, names, ips []string, excludeCN bool) (*cacert.Sans, error) {
+	if cn == "" {
+		return nil, errors.New("the common_name field is required")
+	}
+	if !r.allowName(cn) {
+		return nil, fmt.Errorf("common name %s not allowed by this role", cn)
+	}
+	if !excludeCN && !slices.Contains(names, cn) {
+		names = append([]string{cn}, names...)
+	}
+	sans := &cacert.Sans{}
+	for _, name := range names {
+		if !r.allowName(name) {
+			return nil, fmt.Errorf("subject alternate name %s not allowed by this role", name)
+		}
+		if strings.Contains(name, "@") {
+			sans.Email = append(sans.Email, name)
+		} else {
+			sans.DNS = append(sans.DNS, name)
+		}
+	}
+	if len(ips) > 0 && !r.AllowIPSans {
+		return nil, fmt.Errorf("IP Subject Alternative Names are not allowed in this role, but was provided %s", strings.Join(ips, ","))
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("the value %q is not a valid IP address", ip)
+		}
+		sans.IP = append(sans.IP, ip)
+	}
+	return sans, nil
+}
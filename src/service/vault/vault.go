@@ -0,0 +1,235 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"spki/src/config"
+	"spki/src/pkg/common"
+	"spki/src/service/cacert"
+	"spki/src/service/crl"
+	"spki/src/signature"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// Prefix Vault PKI 接口的路径前缀，对应挂载在 pki 的 PKI 引擎
+const Prefix = "/v1/pki"
+
+// defaultProfile 角色未指定签名配置时使用的签名配置
+const defaultProfile = "server"
+
+// creator Vault 接口签发证书的创建者名称，附加令牌名称
+const creator = "vault"
+
+// secret Vault 的响应格式，结果在 data 中
+type secret struct {
+	RequestID     string   `json:"request_id"`
+	LeaseID       string   `json:"lease_id"`
+	Renewable     bool     `json:"renewable"`
+	LeaseDuration int      `json:"lease_duration"`
+	Data          any      `json:"data"`
+	WrapInfo      any      `json:"wrap_info"`
+	Warnings      []string `json:"warnings"`
+	Auth          any      `json:"auth"`
+}
+
+// settings Vault 接口配置
+func settings() config.Vault {
+	if config.AppCfg == nil {
+		return config.Vault{}
+	}
+	return config.AppCfg.Spki.Vault
+}
+
+// userID 作为证书创建者时的用户 ID
+func userID(account string) string {
+	sum := sha256.Sum256([]byte(account))
+	return hex.EncodeToString(sum[:16])
+}
+
+// succeed 返回成功响应，warnings 为空时返回 null
+func succeed(c *app.RequestContext, data any, warnings []string) {
+	c.JSON(http.StatusOK, secret{RequestID: common.CreateUuid(), Data: data, Warnings: warnings})
+}
+
+// fail 返回错误响应，与 Vault 一致只包含错误信息列表
+func fail(c *app.RequestContext, status int, msg string) {
+	c.JSON(status, map[string][]string{"errors": {msg}})
+}
+
+// enabled 检查是否启用了 Vault 接口，未启用时返回 404
+func enabled(c *app.RequestContext) bool {
+	if settings().Enabled {
+		return true
+	}
+	fail(c, http.StatusNotFound, "no handler for route \"pki\"")
+	return false
+}
+
+// authenticate 校验 X-Vault-Token 或 Bearer 令牌，返回令牌名称作为创建者账号
+func authenticate(c *app.RequestContext) (string, bool) {
+	token := string(c.GetHeader("X-Vault-Token"))
+	if token == "" {
+		token = strings.TrimPrefix(string(c.GetHeader("Authorization")), "Bearer ")
+	}
+	if token != "" {
+		for name, expected := range settings().Tokens {
+			if expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1 {
+				return creator + ":" + name, true
+			}
+		}
+	}
+	fail(c, http.StatusForbidden, "permission denied")
+	return "", false
+}
+
+// loadCA 加载配置的签发 CA
+func loadCA(c *app.RequestContext) *cacert.Authority {
+	ca, err := cacert.LoadCA(settings().CA)
+	if err != nil {
+		hlog.Error("Failed to load Vault CA. error: ", err)
+		fail(c, http.StatusInternalServerError, "the CA is unavailable")
+		return nil
+	}
+	return ca
+}
+
+// ttl Vault 的时长参数，可以是秒数或带单位的字符串，如 3600、"72h"、"30d"
+type ttl time.Duration
+
+// UnmarshalJSON 解析秒数或时长字符串
+func (t *ttl) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*t = ttl(time.Duration(v) * time.Second)
+		return nil
+	case string:
+		d, err := parseTTL(v)
+		*t = ttl(d)
+		return err
+	case nil:
+		*t = 0
+		return nil
+	default:
+		return fmt.Errorf("invalid ttl: %s", data)
+	}
+}
+
+// parseTTL 解析时长字符串，不带单位时为秒，支持以 d 表示天
+func parseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ttl: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %s", s)
+	}
+	return d, nil
+}
+
+// commaList Vault 的列表参数，可以是逗号分隔的字符串或字符串数组
+type commaList []string
+
+// UnmarshalJSON 解析逗号分隔的字符串或字符串数组
+func (l *commaList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = trimList(list)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid list: %s", data)
+	}
+	*l = trimList(strings.Split(s, ","))
+	return nil
+}
+
+// trimList 去掉空白和空项
+func trimList(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// vaultSerial 将序列号转换为 Vault 使用的冒号分隔的十六进制格式
+func vaultSerial(serial string) string {
+	if len(serial)%2 == 1 {
+		serial = "0" + serial
+	}
+	pairs := make([]string, 0, len(serial)/2)
+	for i := 0; i < len(serial); i += 2 {
+		pairs = append(pairs, serial[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// CAPem 返回签发 CA 的 PEM 格式证书，无需令牌
+func CAPem() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		ca := loadCA(c)
+		if ca == nil {
+			return
+		}
+		c.Data(http.StatusOK, "application/pem-certificate-chain", signature.CertToPEM(ca.Cert))
+	}
+}
+
+// CRL 返回签发 CA 的 DER 格式 CRL，无需令牌
+func CRL() func(ctx context.Context, c *app.RequestContext) {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if !enabled(c) {
+			return
+		}
+		record, err := crl.Current(settings().CA)
+		if err != nil {
+			hlog.Error("Failed to get Vault CRL. error: ", err)
+			if errors.Is(err, cacert.ErrCANotFound) {
+				fail(c, http.StatusNotFound, "CA certificate not found")
+			} else {
+				fail(c, http.StatusInternalServerError, "failed to get CRL")
+			}
+			return
+		}
+		block, _ := pem.Decode([]byte(record.Crl))
+		if block == nil {
+			hlog.Errorf("Failed to decode CRL %d of CA %s", record.Number, record.CertID)
+			fail(c, http.StatusInternalServerError, "failed to get CRL")
+			return
+		}
+		c.Data(http.StatusOK, "application/pkix-crl", block.Bytes)
+	}
+}
@@ -0,0 +1,266 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"reflect"
+	"spki/profile"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/service/cacert"
+	"spki/src/signature"
+	"testing"
+	"time"
+
+	hconfig "github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+// testToken 测试使用的访问令牌
+const testToken = "s.test-token"
+
+// newRole 创建使用 server 签名配置的角色
+func newRole(t *testing.T, cfg config.VaultRole) *role {
+	signing, err := profile.Lookup(defaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &role{VaultRole: cfg, name: "test", signing: signing}
+}
+
+func TestAllowName(t *testing.T) {
+	bare := config.VaultRole{AllowedDomains: []string{"example.com"}, AllowBareDomains: true}
+	sub := config.VaultRole{AllowedDomains: []string{"example.com"}, AllowSubdomains: true}
+	glob := config.VaultRole{AllowedDomains: []string{"*.example.com", "web-*.internal"}, AllowGlobDomains: true}
+	for _, tt := range []struct {
+		role config.VaultRole
+		name string
+		want bool
+	}{
+		{bare, "example.com", true},
+		{bare, "EXAMPLE.com", true},
+		{bare, "www.example.com", false},
+		{bare, "admin@example.com", true},
+		{sub, "www.example.com", true},
+		{sub, "a.b.example.com", true},
+		{sub, "*.example.com", true},
+		{sub, "example.com", false},
+		{sub, "foo.example.com.evil.com", false},
+		{sub, "evilexample.com", false},
+		{sub, ".example.com", false},
+		{sub, "a..example.com", false},
+		{sub, "www.example.com.", false},
+		{sub, "user@www.example.com", true},
+		{sub, "user@evil.com", false},
+		{glob, "www.example.com", true},
+		{glob, "a.b.example.com", false},
+		{glob, "example.com", false},
+		{glob, "www.example.com.evil.com", false},
+		{glob, "web-1.internal", true},
+		{glob, "web-1.evil.internal", false},
+		{glob, "web.internal", false},
+		{config.VaultRole{AllowedDomains: []string{"*"}, AllowGlobDomains: true}, "a.b", false},
+		{config.VaultRole{AllowAnyName: true}, "anything.evil.com", true},
+		{config.VaultRole{}, "example.com", false},
+	} {
+		if got := newRole(t, tt.role).allowName(tt.name); got != tt.want {
+			t.Errorf("allowName(%q) with %+v = %v, want %v", tt.name, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestSubjectAltNames(t *testing.T) {
+	r := newRole(t, config.VaultRole{AllowedDomains: []string{"example.com"}, AllowSubdomains: true})
+	sans, err := r.subjectAltNames("www.example.com", []string{"api.example.com", "ops@mail.example.com"}, nil, false)
+	want := &cacert.Sans{DNS: []string{"www.example.com", "api.example.com"}, Email: []string{"ops@mail.example.com"}}
+	if err != nil || !reflect.DeepEqual(sans, want) {
+		t.Fatalf("sans = %+v, %v", sans, err)
+	}
+	if sans, err := r.subjectAltNames("www.example.com", nil, nil, true); err != nil || len(sans.DNS) != 0 {
+		t.Fatalf("sans excluding CN = %+v, %v", sans, err)
+	}
+
+	for name, tt := range map[string]struct {
+		cn    string
+		names []string
+		ips   []string
+	}{
+		"missing common name":  {"", nil, nil},
+		"common name":          {"www.evil.com", nil, nil},
+		"alt name":             {"www.example.com", []string{"foo.example.com.evil.com"}, nil},
+		"IP SAN not permitted": {"www.example.com", nil, []string{"10.0.0.1"}},
+	} {
+		if sans, err := r.subjectAltNames(tt.cn, tt.names, tt.ips, false); err == nil {
+			t.Errorf("%s: sans = %+v, want error", name, sans)
+		}
+	}
+
+	r.AllowIPSans = true
+	if sans, err := r.subjectAltNames("www.example.com", nil, []string{"10.0.0.1"}, true); err != nil || !reflect.DeepEqual(sans.IP, []string{"10.0.0.1"}) {
+		t.Fatalf("IP sans = %+v, %v", sans, err)
+	}
+	if _, err := r.subjectAltNames("www.example.com", nil, []string{"10.0.0"}, true); err == nil {
+		t.Fatal("invalid IP address was accepted")
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	rsa1024, _ := rsa.GenerateKey(rand.Reader, 1024)
+	rsa2048, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	for _, tt := range []struct {
+		role config.VaultRole
+		pub  any
+		ok   bool
+	}{
+		{config.VaultRole{}, rsa2048.Public(), true},
+		{config.VaultRole{}, rsa1024.Public(), false},
+		{config.VaultRole{}, p256.Public(), false},
+		{config.VaultRole{KeyType: "ec"}, p256.Public(), true},
+		{config.VaultRole{KeyType: "ec", KeyBits: 384}, p256.Public(), false},
+		{config.VaultRole{KeyType: "ec", KeyBits: 384}, p384.Public(), true},
+		{config.VaultRole{KeyType: "any"}, rsa1024.Public(), true},
+	} {
+		if err := newRole(t, tt.role).checkKey(tt.pub); (err == nil) != tt.ok {
+			t.Errorf("checkKey(%T) with %+v = %v", tt.pub, tt.role, err)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, true},
+		{"3600", time.Hour, true},
+		{"72h", 72 * time.Hour, true},
+		{"30d", 30 * 24 * time.Hour, true},
+		{" 90m ", 90 * time.Minute, true},
+		{"xd", 0, false},
+		{"1w", 0, false},
+	} {
+		got, err := parseTTL(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseTTL(%q) = %v, %v", tt.s, got, err)
+		}
+	}
+
+	var req certRequest
+	if err := json.Unmarshal([]byte(`{"ttl": 60, "alt_names": "a.example.com, b.example.com,"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(req.TTL) != time.Minute || !reflect.DeepEqual([]string(req.AltNames), []string{"a.example.com", "b.example.com"}) {
+		t.Fatalf("request = %+v", req)
+	}
+	if err := json.Unmarshal([]byte(`{"ttl": true}`), &req); err == nil {
+		t.Fatal("invalid ttl was accepted")
+	}
+}
+
+// setup 打开内存数据库、创建签发 CA 并启用 Vault 接口，返回注册了签发和签署路由的路由
+func setup(t *testing.T) (*route.Engine, *x509.Certificate) {
+	testenv.Open(t)
+	caID, ca, _ := testenv.CA(t, "Vault Root")
+	testenv.Config(t).Spki.Vault = config.Vault{
+		Enabled: true,
+		CA:      caID,
+		Tokens:  map[string]string{"ci": testToken, "disabled": ""},
+		Roles: map[string]config.VaultRole{
+			"web": {AllowedDomains: []string{"example.com"}, AllowSubdomains: true, KeyType: "ec"},
+		},
+	}
+	engine := route.NewEngine(hconfig.NewOptions(nil))
+	engine.POST(Prefix+"/issue/:role", Issue())
+	engine.POST(Prefix+"/sign/:role", Sign())
+	return engine, ca
+}
+
+// post 发送 JSON 请求，返回状态码和响应
+func post(t *testing.T, engine *route.Engine, path string, body any, headers ...ut.Header) (int, *secret) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers = append(headers, ut.Header{Key: "Content-Type", Value: "application/json"})
+	res := ut.PerformRequest(engine, http.MethodPost, path, &ut.Body{Body: bytes.NewReader(data), Len: len(data)}, headers...).Result()
+	var s secret
+	if res.StatusCode() == http.StatusOK {
+		if err := json.Unmarshal(res.Body(), &s); err != nil {
+			t.Fatalf("invalid response %q: %v", res.Body(), err)
+		}
+	}
+	return res.StatusCode(), &s
+}
+
+func TestAuthenticate(t *testing.T) {
+	engine, _ := setup(t)
+	req := map[string]any{"common_name": "www.example.com"}
+	for name, tt := range map[string]struct {
+		headers []ut.Header
+		status  int
+	}{
+		"vault token":   {[]ut.Header{{Key: "X-Vault-Token", Value: testToken}}, http.StatusOK},
+		"bearer token":  {[]ut.Header{{Key: "Authorization", Value: "Bearer " + testToken}}, http.StatusOK},
+		"missing token": {nil, http.StatusForbidden},
+		"wrong token":   {[]ut.Header{{Key: "X-Vault-Token", Value: "s.wrong"}}, http.StatusForbidden},
+		"token prefix":  {[]ut.Header{{Key: "X-Vault-Token", Value: testToken[:4]}}, http.StatusForbidden},
+		"empty bearer":  {[]ut.Header{{Key: "Authorization", Value: "Bearer "}}, http.StatusForbidden},
+	} {
+		if status, _ := post(t, engine, Prefix+"/issue/web", req, tt.headers...); status != tt.status {
+			t.Errorf("%s: issue = %d, want %d", name, status, tt.status)
+		}
+	}
+}
+
+func TestIssueAndSign(t *testing.T) {
+	engine, ca := setup(t)
+	token := ut.Header{Key: "X-Vault-Token", Value: testToken}
+	status, s := post(t, engine, Prefix+"/issue/web", map[string]any{"common_name": "www.example.com", "alt_names": "api.example.com", "ttl": "24h"}, token)
+	if status != http.StatusOK {
+		t.Fatalf("issue = %d", status)
+	}
+	data, _ := s.Data.(map[string]any)
+	certPEM, _ := data["certificate"].(string)
+	cert, err := signature.ParseCertPEM([]byte(certPEM))
+	if err != nil || cert.CheckSignatureFrom(ca) != nil || data["private_key_type"] != "ec" {
+		t.Fatalf("issued = %+v, %v", data, err)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"www.example.com", "api.example.com"}) || cert.NotAfter.Sub(cert.NotBefore) != 24*time.Hour {
+		t.Fatalf("certificate names %v, validity %v", cert.DNSNames, cert.NotAfter.Sub(cert.NotBefore))
+	}
+
+	// 证书请求中不符合角色的名称被拒绝
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for name, tt := range map[string]struct {
+		dnsNames []string
+		status   int
+	}{
+		"allowed":   {[]string{"www.example.com"}, http.StatusOK},
+		"evil name": {[]string{"foo.example.com.evil.com"}, http.StatusBadRequest},
+	} {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "www.example.com"}, DNSNames: tt.dnsNames}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+		if status, _ := post(t, engine, Prefix+"/sign/web", map[string]any{"csr": csr}, token); status != tt.status {
+			t.Errorf("%s: sign = %d, want %d", name, status, tt.status)
+		}
+	}
+	if status, _ := post(t, engine, Prefix+"/issue/db", map[string]any{"common_name": "www.example.com"}, token); status != http.StatusBadRequest {
+		t.Fatalf("issue with unknown role = %d", status)
+	}
+}
@@ -0,0 +1,334 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"spki/src/config"
+	"spki/src/models"
+	"spki/src/pkg/common"
+	"spki/src/pkg/uuid4"
+	"spki/src/service/alarm"
+	"strconv"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// 事件类型
+const (
+	EventIssued   = "certificate.issued"   // 签发证书，包括 CA 证书
+	EventRenewed  = "certificate.renewed"  // 续期或更换私钥
+	EventRevoked  = "certificate.revoked"  // 吊销证书
+	EventExpiring = "certificate.expiring" // 证书即将到期
+)
+
+const (
+	defaultInterval    = 10 * time.Second // 默认检查发件箱的间隔
+	defaultTimeout     = 10 * time.Second // 默认投递超时时间
+	defaultMaxAttempts = 10               // 默认最大投递次数
+	minBackoff         = 10 * time.Second // 首次重试的等待时间，之后每次加倍
+	maxBackoff         = time.Hour        // 重试的最长等待时间
+	batchSize          = 100              // 每次从发件箱读取的事件数
+	maxErrorLength     = 1024             // 保存的失败原因的最大长度
+)
+
+// 投递请求头
+const (
+	HeaderEvent     = "X-Spki-Event"
+	HeaderDelivery  = "X-Spki-Delivery"
+	HeaderSignature = "X-Spki-Signature"
+)
+
+// Envelope 投递的事件
+type Envelope struct {
+	ID    string      `json:"id"`
+	Event string      `json:"event"`
+	Time  int64       `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// Certificate 证书事件的内容
+type Certificate struct {
+	CertID         string `json:"certid"`
+	UserID         string `json:"user_id,omitempty"`
+	Subject        string `json:"subject"`
+	Genre          int    `json:"genre"`
+	ParentID       string `json:"parent_id,omitempty"`
+	Serial         string `json:"serial"`
+	EffectiveTime  int64  `json:"effective_time"`
+	ExpirationTime int64  `json:"expiration_time"`
+
+	PreviousSerial string `json:"previous_serial,omitempty"` // 续期前的证书序列号
+	Rekey          bool   `json:"rekey,omitempty"`           // 续期时是否更换了私钥
+	Reason         string `json:"reason,omitempty"`          // 吊销原因
+	RevocationTime int64  `json:"revocation_time,omitempty"`
+	InvalidityTime int64  `json:"invalidity_time,omitempty"`
+}
+
+// NewCertificate 根据证书和证书版本生成事件内容
+func NewCertificate(record *models.Certificate, version *models.Version) *Certificate {
+	e := &Certificate{
+		CertID:         version.CertID,
+		Serial:         version.Serial,
+		EffectiveTime:  version.EffectiveTime,
+		ExpirationTime: version.ExpirationTime,
+		RevocationTime: version.RevocationTime,
+		InvalidityTime: version.InvalidityTime,
+	}
+	if record.UserID != nil {
+		e.UserID = *record.UserID
+	}
+	if record.Subject != nil {
+		e.Subject = *record.Subject
+	}
+	if record.Genre != nil {
+		e.Genre = *record.Genre
+	}
+	if record.ParentID != nil {
+		e.ParentID = *record.ParentID
+	}
+	return e
+}
+
+// kick 通知后台任务立即投递
+var kick = make(chan struct{}, 1)
+
+// endpoints 接收地址
+func endpoints() []config.WebhookEndpoint {
+	if config.AppCfg == nil {
+		return nil
+	}
+	return config.AppCfg.Spki.Webhook.Endpoints
+}
+
+// findEndpoint 根据名称查找接收地址
+func findEndpoint(name string) *config.WebhookEndpoint {
+	list := endpoints()
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// subscribed 接收地址是否订阅了事件
+func subscribed(endpoint *config.WebhookEndpoint, event string) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for _, e := range endpoint.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// interval 后台检查发件箱的间隔
+func interval() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Webhook.Interval > 0 {
+		return config.AppCfg.Spki.Webhook.Interval
+	}
+	return defaultInterval
+}
+
+// timeout 单次投递的超时时间
+func timeout() time.Duration {
+	if config.AppCfg != nil && config.AppCfg.Spki.Webhook.Timeout > 0 {
+		return config.AppCfg.Spki.Webhook.Timeout
+	}
+	return defaultTimeout
+}
+
+// maxAttempts 最大投递次数
+func maxAttempts() int {
+	if config.AppCfg != nil && config.AppCfg.Spki.Webhook.MaxAttempts > 0 {
+		return config.AppCfg.Spki.Webhook.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// backoff 第 attempts 次投递失败后的等待时间
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// Sign 计算签名请求头的值：t=<秒级时间戳>,v1=<HMAC-SHA256(secret, "<时间戳>.<请求体>") 的十六进制>
+func Sign(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue 将事件写入发件箱，每个订阅了该事件的接收地址一条，没有订阅时不写入
+// tx 为调用方的事务，事件与业务数据一起提交，提交后调用 Dispatch 立即投递
+func Enqueue(tx models.Repository, event string, data interface{}) error {
+	list := endpoints()
+	if len(list) == 0 {
+		return nil
+	}
+	now := common.CreateTimestamp()
+	envelope := Envelope{ID: uuid4.Uuid4Str(), Event: event, Time: now, Data: data}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if !subscribed(&list[i], event) {
+			continue
+		}
+		err := tx.InstallWebhookEvent(models.WebhookEvent{
+			EventID:     envelope.ID,
+			Endpoint:    list[i].Name,
+			Event:       event,
+			Payload:     string(payload),
+			State:       models.WebhookPending,
+			NextAttempt: now,
+			CreateTime:  now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save webhook event: %v", err)
+		}
+	}
+	return nil
+}
+
+// Publish 将事件写入发件箱并立即投递，用于不在事务中产生的事件
+func Publish(event string, data interface{}) error {
+	if err := Enqueue(models.Repo(), event, data); err != nil {
+		return err
+	}
+	Dispatch()
+	return nil
+}
+
+// Dispatch 通知后台任务立即投递发件箱中的事件
+func Dispatch() {
+	select {
+	case kick <- struct{}{}:
+	default:
+	}
+}
+
+// post 投递一次事件，接收方返回 2xx 时成功
+func post(client *http.Client, endpoint *config.WebhookEndpoint, e *models.WebhookEvent) error {
+	body := []byte(e.Payload)
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, e.Event)
+	req.Header.Set(HeaderDelivery, e.EventID)
+	if endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, time.Now().Unix(), body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// deliver 投递一个事件，成功后从发件箱删除，失败时按指数退避安排重试
+func deliver(client *http.Client, e *models.WebhookEvent) {
+	endpoint := findEndpoint(e.Endpoint)
+	var err error
+	if endpoint == nil {
+		err = fmt.Errorf("endpoint %s is not configured", e.Endpoint)
+		e.Attempts = maxAttempts()
+	} else {
+		err = post(client, endpoint, e)
+		e.Attempts++
+	}
+	if err == nil {
+		if err := models.DeleteWebhookEvent(e.ID); err != nil {
+			hlog.Errorf("Failed to delete delivered webhook event %d: %v", e.ID, err)
+		}
+		return
+	}
+
+	e.LastError = err.Error()
+	if len(e.LastError) > maxErrorLength {
+		e.LastError = e.LastError[:maxErrorLength]
+	}
+	if e.Attempts >= maxAttempts() {
+		e.State = models.WebhookFailed
+		hlog.Errorf("Webhook event %s to %s failed after %d attempts: %v", e.EventID, e.Endpoint, e.Attempts, err)
+	} else {
+		e.NextAttempt = time.Now().Add(backoff(e.Attempts)).UnixMilli()
+		hlog.Warnf("Webhook event %s to %s failed (attempt %d), retry later: %v", e.EventID, e.Endpoint, e.Attempts, err)
+	}
+	if err := models.UpdateWebhookEvent(*e); err != nil {
+		hlog.Errorf("Failed to update webhook event %d: %v", e.ID, err)
+	}
+}
+
+// Flush 投递发件箱中所有到达投递时间的事件
+func Flush() {
+	client := &http.Client{Timeout: timeout()}
+	delivered := map[int]bool{}
+	for {
+		events, err := models.FindDueWebhookEvents(common.CreateTimestamp(), batchSize)
+		if err != nil {
+			hlog.Error("Failed to query webhook events: ", err)
+			return
+		}
+		n := 0
+		for i := range events {
+			if delivered[events[i].ID] { // 删除或更新失败的事件留到下次检查
+				continue
+			}
+			delivered[events[i].ID] = true
+			deliver(client, &events[i])
+			n++
+		}
+		if n == 0 {
+			return
+		}
+	}
+}
+
+// alarmNotifier 将证书到期告警作为事件投递
+type alarmNotifier struct{}
+
+func (alarmNotifier) Notify(n alarm.Notice) error {
+	return Publish(EventExpiring, n)
+}
+
+// Start 启动后台任务投递发件箱中的事件，并订阅证书到期告警，需在 alarm.Start 之前调用
+func Start() {
+	alarm.Register(alarmNotifier{})
+	go func() {
+		ticker := time.NewTicker(interval())
+		defer ticker.Stop()
+		for {
+			Flush()
+			select {
+			case <-ticker.C:
+			case <-kick:
+			}
+		}
+	}()
+}
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"spki/src/config"
+	"spki/src/internal/testenv"
+	"spki/src/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const secret = "s3cret"
+
+// delivery 接收方收到的一次投递
+type delivery struct {
+	event, id string
+	body      []byte
+}
+
+// receiver 事件接收方，按顺序返回 statuses 中的状态码，之后返回 200，签名不正确时返回 401
+type receiver struct {
+	t          *testing.T
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []delivery
+}
+
+// verify 按文档中的算法校验签名请求头
+func verify(header string, body []byte) bool {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			signature = v
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	if req.Header.Get("Content-Type") != "application/json" || !verify(req.Header.Get(HeaderSignature), body) {
+		r.t.Errorf("invalid delivery: %v %s", req.Header, body)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, delivery{event: req.Header.Get(HeaderEvent), id: req.Header.Get(HeaderDelivery), body: body})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]delivery(nil), r.deliveries...)
+}
+
+// setup 打开内存数据库并启动接收方，deploy 订阅所有事件，audit 只订阅吊销事件
+func setup(t *testing.T, statuses ...int) (*gorm.DB, *receiver) {
+	db := testenv.Open(t)
+	r := &receiver{t: t, statuses: statuses}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	testenv.Config(t).Spki.Webhook.Endpoints = []config.WebhookEndpoint{
+		{Name: "deploy", URL: srv.URL, Secret: secret},
+		{Name: "audit", URL: srv.URL, Secret: secret, Events: []string{EventRevoked}},
+	}
+	return db, r
+}
+
+// outbox 发件箱中的事件
+func outbox(t *testing.T, db *gorm.DB) []models.WebhookEvent {
+	var events []models.WebhookEvent
+	if err := db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestDeliverAndRetry(t *testing.T) {
+	db, r := setup(t, http.StatusInternalServerError)
+	data := &Certificate{CertID: "c1", Serial: "01"}
+	if err := Enqueue(models.Repo(), EventIssued, data); err != nil {
+		t.Fatal(err)
+	}
+	events := outbox(t, db)
+	if len(events) != 1 || events[0].Endpoint != "deploy" {
+		t.Fatalf("outbox = %+v", events)
+	}
+
+	// 接收方返回 500，事件保留在发件箱中等待重试
+	Flush()
+	events = outbox(t, db)
+	if len(events) != 1 || events[0].Attempts != 1 || events[0].State != models.WebhookPending || !strings.Contains(events[0].LastError, "500") {
+		t.Fatalf("outbox after failure = %+v", events)
+	}
+	if wait := time.UnixMilli(events[0].NextAttempt).Sub(time.Now()); wait <= 0 || wait > minBackoff {
+		t.Fatalf("next attempt in %v", wait)
+	}
+	Flush()
+	if n := len(r.received()); n != 1 {
+		t.Fatalf("event was redelivered before backoff: %d deliveries", n)
+	}
+
+	// 到达重试时间后重新投递，成功后从发件箱删除
+	events[0].NextAttempt = time.Now().UnixMilli()
+	if err := models.UpdateWebhookEvent(events[0]); err != nil {
+		t.Fatal(err)
+	}
+	Flush()
+	if events := outbox(t, db); len(events) != 0 {
+		t.Fatalf("outbox after redelivery = %+v", events)
+	}
+	received := r.received()
+	if len(received) != 2 || received[0].id != received[1].id || received[1].event != EventIssued {
+		t.Fatalf("deliveries = %+v", received)
+	}
+	var envelope struct {
+		ID    string      `json:"id"`
+		Event string      `json:"event"`
+		Data  Certificate `json:"data"`
+	}
+	if err := json.Unmarshal(received[1].body, &envelope); err != nil || envelope.ID != received[1].id || envelope.Data != *data {
+		t.Fatalf("envelope = %+v, %v", envelope, err)
+	}
+}
+
+func TestSubscribedEndpoints(t *testing.T) {
+	db, r := setup(t)
+	if err := Enqueue(models.Repo(), EventRevoked, &Certificate{CertID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	if events := outbox(t, db); len(events) != 2 {
+		t.Fatalf("outbox = %+v", events)
+	}
+	Flush()
+	if n := len(r.received()); n != 2 {
+		t.Fatalf("%d deliveries, want 2", n)
+	}
+
+	config.AppCfg.Spki.Webhook.Endpoints = nil
+	if err := Enqueue(models.Repo(), EventIssued, &Certificate{CertID: "c2"}); err != nil {
+		t.Fatal(err)
+	}
+	if events := outbox(t, db); len(events) != 0 {
+		t.Fatalf("event without endpoints was saved: %+v", events)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	db, _ := setup(t, http.StatusInternalServerError, http.StatusBadGateway)
+	config.AppCfg.Spki.Webhook.MaxAttempts = 2
+	if err := Enqueue(models.Repo(), EventIssued, &Certificate{CertID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	Flush()
+	events := outbox(t, db)
+	events[0].NextAttempt = time.Now().UnixMilli()
+	if err := models.UpdateWebhookEvent(events[0]); err != nil {
+		t.Fatal(err)
+	}
+	Flush()
+	events = outbox(t, db)
+	if len(events) != 1 || events[0].State != models.WebhookFailed || events[0].Attempts != 2 || !strings.Contains(events[0].LastError, "502") {
+		t.Fatalf("outbox = %+v", events)
+	}
+
+	// 接收地址从配置中删除后不再投递
+	if err := Enqueue(models.Repo(), EventIssued, &Certificate{CertID: "c2"}); err != nil {
+		t.Fatal(err)
+	}
+	config.AppCfg.Spki.Webhook.Endpoints = config.AppCfg.Spki.Webhook.Endpoints[1:]
+	Flush()
+	events = outbox(t, db)
+	if len(events) != 2 || events[1].State != models.WebhookFailed || !strings.Contains(events[1].LastError, "not configured") {
+		t.Fatalf("outbox = %+v", events)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: minBackoff, 2: 2 * minBackoff, 4: 8 * minBackoff, 20: maxBackoff} {
+		if got := backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+// Cipher PKCS#7 EnvelopedData 的内容加密算法
+type Cipher string
+
+const (
+	CipherDES    Cipher = "des-cbc"
+	CipherDES3   Cipher = "des-ede3-cbc"
+	CipherAES128 Cipher = "aes128-cbc"
+	CipherAES192 Cipher = "aes192-cbc"
+	CipherAES256 Cipher = "aes256-cbc"
+)
+
+// cipherSpec 内容加密算法的 OID 和密钥长度
+type cipherSpec struct {
+	oid    asn1.ObjectIdentifier
+	keyLen int
+}
+
+var cipherSpecs = map[Cipher]cipherSpec{
+	CipherDES:    {asn1.ObjectIdentifier{1, 3, 14, 3, 2, 7}, 8},
+	CipherDES3:   {asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}, 24},
+	CipherAES128: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}, 16},
+	CipherAES192: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}, 24},
+	CipherAES256: {asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, 32},
+}
+
+// block 创建分组密码
+func (c Cipher) block(key []byte) (cipher.Block, error) {
+	switch c {
+	case CipherDES:
+		return des.NewCipher(key)
+	case CipherDES3:
+		return des.NewTripleDESCipher(key)
+	default:
+		return aes.NewCipher(key)
+	}
+}
+
+// lookupCipher 根据 OID 查找内容加密算法
+func lookupCipher(oid asn1.ObjectIdentifier) (Cipher, cipherSpec, bool) {
+	for c, spec := range cipherSpecs {
+		if spec.oid.Equal(oid) {
+			return c, spec, true
+		}
+	}
+	return "", cipherSpec{}, false
+}
+
+// recipientInfo PKCS#7 RecipientInfo，只支持 RSA 密钥传输
+type recipientInfo struct {
+	Version                int
+	IssuerAndSerial        issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// encryptedContentInfo 加密的内容，EncryptedContent 为 [0] IMPLICIT OCTET STRING
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// envelopedData PKCS#7 EnvelopedData
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []recipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+// encryptedBytes 取出加密内容，兼容 BER 分段编码的 OCTET STRING
+func (e encryptedContentInfo) encryptedBytes() ([]byte, error) {
+	if !e.EncryptedContent.IsCompound {
+		return e.EncryptedContent.Bytes, nil
+	}
+	var out []byte
+	rest := e.EncryptedContent.Bytes
+	for len(rest) > 0 {
+		var chunk []byte
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+// OpenEnvelope 使用接收者证书对应的 RSA 私钥解密 DER 编码的 PKCS#7 EnvelopedData，返回内容和内容加密算法
+func OpenEnvelope(der []byte, cert *x509.Certificate, key crypto.Decrypter) ([]byte, Cipher, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, "", fmt.Errorf("invalid PKCS#7: %v", err)
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, "", fmt.Errorf("unexpected PKCS#7 content type %s", ci.ContentType)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, "", fmt.Errorf("invalid PKCS#7 EnvelopedData: %v", err)
+	}
+	var recipient *recipientInfo
+	for i := range ed.RecipientInfos {
+		if ed.RecipientInfos[i].IssuerAndSerial.matches(cert) {
+			recipient = &ed.RecipientInfos[i]
+			break
+		}
+	}
+	if recipient == nil {
+		return nil, "", errors.New("no recipient matches the certificate")
+	}
+	if !recipient.KeyEncryptionAlgorithm.Algorithm.Equal(oidEncryptionRSA) {
+		return nil, "", fmt.Errorf("unsupported key encryption algorithm %s", recipient.KeyEncryptionAlgorithm.Algorithm)
+	}
+
+	eci := ed.EncryptedContentInfo
+	c, spec, ok := lookupCipher(eci.ContentEncryptionAlgorithm.Algorithm)
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported content encryption algorithm %s", eci.ContentEncryptionAlgorithm.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, "", fmt.Errorf("invalid content encryption parameters: %v", err)
+	}
+	encrypted, err := eci.encryptedBytes()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid encrypted content: %v", err)
+	}
+
+	// 指定会话密钥长度，填充错误时返回随机密钥，避免泄露解密结果（Bleichenbacher 攻击）
+	contentKey, err := key.Decrypt(rand.Reader, recipient.EncryptedKey, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: spec.keyLen})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt content key: %v", err)
+	}
+	block, err := c.block(contentKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(iv) != block.BlockSize() || len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, "", errors.New("invalid encrypted content length")
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, encrypted)
+	plain, err = unpad(plain, block.BlockSize())
+	if err != nil {
+		return nil, "", err
+	}
+	return plain, c, nil
+}
+
+// SealEnvelope 使用 c 加密内容，并用接收者证书的 RSA 公钥加密内容密钥，生成 DER 编码的 PKCS#7 EnvelopedData
+func SealEnvelope(content []byte, recipient *x509.Certificate, c Cipher) ([]byte, error) {
+	pub, ok := recipient.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported recipient key %T", recipient.PublicKey)
+	}
+	spec, ok := cipherSpecs[c]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encryption algorithm %s", c)
+	}
+	contentKey := make([]byte, spec.keyLen)
+	if _, err := rand.Read(contentKey); err != nil {
+		return nil, err
+	}
+	block, err := c.block(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	encrypted := pad(content, block.BlockSize())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, contentKey)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	ed, err := asn1.Marshal(envelopedData{
+		Version: 0,
+		RecipientInfos: []recipientInfo{{
+			Version:                0,
+			IssuerAndSerial:        issuerAndSerial{Issuer: asn1.RawValue{FullBytes: recipient.RawIssuer}, Serial: recipient.SerialNumber},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEncryptionRSA, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		}},
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: spec.oid, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encrypted},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: ed},
+	})
+}
+
+// pad PKCS#7 填充
+func pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+// unpad 去除 PKCS#7 填充
+func unpad(data []byte, blockSize int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, errors.New("invalid padding")
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, errors.New("invalid padding")
+		}
+	}
+	return data[:len(data)-n], nil
+}
@@ -1,6 +1,81 @@
 package signature
 
-// CertSignature证书签名
-func CertSignature() {
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
 
+// SerialNumber 生成 128 位随机证书序列号
+func SerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128-1))
+}
+
+// SerialString 证书序列号的字符串形式（小写十六进制），用于数据库存储和查询
+func SerialString(serial *big.Int) string {
+	return serial.Text(16)
+}
+
+// SubjectKeyId 根据指定的哈希算法生成 SubjectKeyId，algorithm：hash，sha256
+func SubjectKeyId(pub any, algorithm string) ([]byte, error) {
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	switch algorithm {
+	case "", "hash":
+		subjectKeyId := sha1.Sum(pubKeyBytes)
+		return subjectKeyId[:], nil
+	case "sha256":
+		subjectKeyId := sha256.Sum256(pubKeyBytes)
+		return subjectKeyId[:], nil
+	default:
+		return nil, errors.New("unsupported hash algorithm")
+	}
+}
+
+// CertSignature 证书签名，使用上级 CA 证书及其私钥签发 template 描述的证书
+// 未设置序列号和 SubjectKeyId 时自动生成，AuthorityKeyId 取上级证书的 SubjectKeyId
+func CertSignature(template, parent *x509.Certificate, pub any, signer crypto.Signer) (*x509.Certificate, error) {
+	if template.SerialNumber == nil {
+		serialNumber, err := SerialNumber()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial number: %v", err)
+		}
+		template.SerialNumber = serialNumber
+	}
+	if template.SubjectKeyId == nil {
+		subjectKeyId, err := SubjectKeyId(pub, "hash")
+		if err != nil {
+			return nil, err
+		}
+		template.SubjectKeyId = subjectKeyId
+	}
+	template.AuthorityKeyId = parent.SubjectKeyId
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// CertToPEM 将证书编码为 PEM 格式
+func CertToPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// ParseCertPEM 解析 PEM 格式的证书
+func ParseCertPEM(pemBytes []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to decode PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
 }
@@ -0,0 +1,312 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+var (
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidEncryptionRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureECDSA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// ErrAttributeNotFound 签名属性不存在
+var ErrAttributeNotFound = errors.New("attribute not found")
+
+// digestAlgorithms 支持的摘要算法
+var digestAlgorithms = map[string]crypto.Hash{
+	oidDigestSHA1.String():   crypto.SHA1,
+	oidDigestSHA256.String(): crypto.SHA256,
+	oidDigestSHA384.String(): crypto.SHA384,
+	oidDigestSHA512.String(): crypto.SHA512,
+}
+
+// Attribute 签名属性，Value 为属性值，按 encoding/asn1 规则编码
+type Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// attribute 编码后的签名属性，Values 为 SET OF 属性值
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// issuerAndSerial 证书的签发者和序列号，用于在 SignerInfo 和 RecipientInfo 中标识证书
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// matches 是否标识 cert
+func (is issuerAndSerial) matches(cert *x509.Certificate) bool {
+	return bytes.Equal(is.Issuer.FullBytes, cert.RawIssuer) && is.Serial != nil && is.Serial.Cmp(cert.SerialNumber) == 0
+}
+
+// signerInfo PKCS#7 SignerInfo，AuthenticatedAttributes 为 [0] IMPLICIT SET OF Attribute
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerial           issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// signedDataIn 解析使用的 PKCS#7 SignedData，证书和 CRL 均为可选
+type signedDataIn struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// SignedMessage 已校验签名的 PKCS#7 SignedData
+type SignedMessage struct {
+	Content      []byte              // 被签名的数据
+	Certificates []*x509.Certificate // 携带的证书
+	Signer       *x509.Certificate   // 签名者证书
+	attributes   []attribute
+}
+
+// Attribute 将签名属性的值解码到 out，属性不存在时返回 ErrAttributeNotFound
+func (m *SignedMessage) Attribute(oid asn1.ObjectIdentifier, out interface{}) error {
+	for _, attr := range m.attributes {
+		if !attr.Type.Equal(oid) {
+			continue
+		}
+		if _, err := asn1.Unmarshal(attr.Values.Bytes, out); err != nil {
+			return fmt.Errorf("invalid attribute %s: %v", oid, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrAttributeNotFound, oid)
+}
+
+// ParseSignedData 解析 DER 编码的 PKCS#7 SignedData，并使用其携带的签名者证书校验签名
+// 只支持一个签名者，签名者必须使用签名属性（SCEP 消息均满足）
+func ParseSignedData(der []byte) (*SignedMessage, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unexpected PKCS#7 content type %s", ci.ContentType)
+	}
+	var sd signedDataIn
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 SignedData: %v", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected exactly one signer, got %d", len(sd.SignerInfos))
+	}
+
+	msg := &SignedMessage{}
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &msg.Content); err != nil {
+			return nil, fmt.Errorf("invalid PKCS#7 content: %v", err)
+		}
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS#7 certificates: %v", err)
+		}
+		msg.Certificates = certs
+	}
+
+	si := sd.SignerInfos[0]
+	for _, cert := range msg.Certificates {
+		if si.IssuerAndSerial.matches(cert) {
+			msg.Signer = cert
+			break
+		}
+	}
+	if msg.Signer == nil {
+		return nil, errors.New("signer certificate not found")
+	}
+	if len(si.AuthenticatedAttributes.Bytes) == 0 {
+		return nil, errors.New("signed attributes are required")
+	}
+	if _, err := asn1.UnmarshalWithParams(si.AuthenticatedAttributes.FullBytes, &msg.attributes, "set,tag:0"); err != nil {
+		return nil, fmt.Errorf("invalid signed attributes: %v", err)
+	}
+
+	hash, ok := digestAlgorithms[si.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", si.DigestAlgorithm.Algorithm)
+	}
+	var digest []byte
+	if err := msg.Attribute(oidAttributeMessageDigest, &digest); err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(msg.Content)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return nil, errors.New("message digest mismatch")
+	}
+
+	// 签名针对 SET OF 编码的签名属性，而非 [0] IMPLICIT 编码
+	signed := append([]byte{}, si.AuthenticatedAttributes.FullBytes...)
+	signed[0] = 0x31
+	algo, err := signatureAlgorithm(msg.Signer.PublicKey, hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.Signer.CheckSignature(algo, signed, si.EncryptedDigest); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 signature: %v", err)
+	}
+	return msg, nil
+}
+
+// signatureAlgorithm 根据公钥类型和摘要算法确定签名算法
+func signatureAlgorithm(pub crypto.PublicKey, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signer key %T with digest %v", pub, hash)
+}
+
+// encodeAttributes 编码签名属性，按 DER 规则排序，返回 SET OF 编码
+func encodeAttributes(attrs []Attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+	for _, attr := range attrs {
+		value, err := asn1.Marshal(attr.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attribute %s: %v", attr.Type, err)
+		}
+		data, err := asn1.Marshal(attribute{
+			Type:   attr.Type,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+}
+
+// SignData 使用 SHA-256 生成带签名属性的 PKCS#7 SignedData（DER），certs 为附带的证书，
+// content 为 nil 时不含被签名的数据；签名者只支持 RSA 和 ECDSA 私钥
+func SignData(content []byte, cert *x509.Certificate, signer crypto.Signer, attrs []Attribute, certs []*x509.Certificate) ([]byte, error) {
+	var encryption pkix.AlgorithmIdentifier
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		encryption = pkix.AlgorithmIdentifier{Algorithm: oidEncryptionRSA, Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		encryption = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSA256}
+	default:
+		return nil, fmt.Errorf("unsupported signer key %T", signer.Public())
+	}
+
+	digest := crypto.SHA256.New()
+	digest.Write(content)
+	signedAttrs, err := encodeAttributes(append([]Attribute{
+		{Type: oidAttributeContentType, Value: oidData},
+		{Type: oidAttributeSigningTime, Value: time.Now().UTC()},
+		{Type: oidAttributeMessageDigest, Value: digest.Sum(nil)},
+	}, attrs...))
+	if err != nil {
+		return nil, err
+	}
+	h := crypto.SHA256.New()
+	h.Write(signedAttrs)
+	sig, err := signer.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名属性在 SignerInfo 中为 [0] IMPLICIT
+	implicitAttrs := append([]byte{}, signedAttrs...)
+	implicitAttrs[0] = 0xa0
+	digestAlgo := pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}
+	si, err := asn1.Marshal(signerInfo{
+		Version:                   1,
+		IssuerAndSerial:           issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+		DigestAlgorithm:           digestAlgo,
+		AuthenticatedAttributes:   asn1.RawValue{FullBytes: implicitAttrs},
+		DigestEncryptionAlgorithm: encryption,
+		EncryptedDigest:           sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digestAlgos, err := asn1.Marshal(digestAlgo)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := contentInfo{ContentType: oidData}
+	if content != nil {
+		octets, err := asn1.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		inner.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}
+	}
+	var raw []byte
+	for _, c := range append([]*x509.Certificate{cert}, certs...) {
+		raw = append(raw, c.Raw...)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: digestAlgos},
+		ContentInfo:      inner,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: si},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}